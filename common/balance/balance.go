@@ -2,6 +2,7 @@ package balance
 
 import (
 	"context"
+	"strconv"
 
 	"github.com/labring/aiproxy/model"
 )
@@ -10,8 +11,20 @@ type GroupBalance interface {
 	GetGroupRemainBalance(ctx context.Context, group model.GroupCache) (float64, PostGroupConsumer, error)
 }
 
+// PostGroupConsumer consumes the usage of a charge of a request from the group balance,
+// the consume id is the idempotency key, a charge retried with the same consume id is consumed once
 type PostGroupConsumer interface {
-	PostGroupConsume(ctx context.Context, tokenName string, usage float64) (float64, error)
+	PostGroupConsume(ctx context.Context, requestID, consumeID, tokenName string, usage float64) (float64, error)
+}
+
+// ConsumeID identifies a charge of a request, a request is charged once per attempt,
+// e.g. the interrupted part of a failed over stream and its continuation,
+// requests without id are never deduplicated
+func ConsumeID(requestID string, retryTimes int) string {
+	if requestID == "" {
+		return ""
+	}
+	return requestID + ":" + strconv.Itoa(retryTimes)
 }
 
 var (
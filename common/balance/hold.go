@@ -0,0 +1,206 @@
+package balance
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/env"
+	"github.com/redis/go-redis/v9"
+)
+
+const groupBalanceHoldKey = "balance_hold:%s"
+
+// holds of requests never settled, e.g. the instance crashed, expire after the timeout
+var holdExpire = time.Duration(env.Int64("BALANCE_HOLD_EXPIRE_SECONDS", 3600)) * time.Second
+
+// Hold reserves the amount from the balance of the group for the request until it is released,
+// it is not held and false is returned when the balance minus the outstanding holds is less than the amount
+func Hold(ctx context.Context, group, requestID string, balance, amount float64) (bool, error) {
+	if common.RedisEnabled {
+		return redisHold(ctx, group, requestID, balance, amount)
+	}
+	return memoryHolds.hold(group, requestID, balance, amount), nil
+}
+
+// Release removes the hold of the request, the actual amount is consumed separately
+func Release(ctx context.Context, group, requestID string) error {
+	if common.RedisEnabled {
+		return common.RDB.HDel(ctx, fmt.Sprintf(groupBalanceHoldKey, group), requestID).Err()
+	}
+	memoryHolds.release(group, requestID)
+	return nil
+}
+
+// GetHeldAmount returns the sum of the outstanding holds of the group
+func GetHeldAmount(ctx context.Context, group string) (float64, error) {
+	if common.RedisEnabled {
+		return redisHeldAmount(ctx, group)
+	}
+	return memoryHolds.held(group), nil
+}
+
+// the fields are the request ids, the values are "amount:expire_at"
+const holdLuaScript = `
+local key = KEYS[1]
+local request_id = ARGV[1]
+local balance = tonumber(ARGV[2])
+local amount = tonumber(ARGV[3])
+local now = tonumber(ARGV[4])
+local expire_at = tonumber(ARGV[5])
+
+local held = 0
+local all_fields = redis.call('HGETALL', key)
+for i = 1, #all_fields, 2 do
+	local a, e = all_fields[i+1]:match("^([^:]+):(%d+)$")
+	if tonumber(e) == nil or tonumber(e) < now then
+		redis.call('HDEL', key, all_fields[i])
+	elseif all_fields[i] ~= request_id then
+		held = held + tonumber(a)
+	end
+end
+
+if amount > 0 and balance - held < amount then
+	return 0
+end
+
+if amount > 0 then
+	redis.call('HSET', key, request_id, ARGV[3] .. ":" .. ARGV[5])
+end
+local ttl = redis.call('TTL', key)
+if ttl < expire_at - now then
+	redis.call('EXPIRE', key, expire_at - now)
+end
+return 1
+`
+
+const heldAmountLuaScript = `
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+
+local held = 0
+local all_fields = redis.call('HGETALL', key)
+for i = 1, #all_fields, 2 do
+	local a, e = all_fields[i+1]:match("^([^:]+):(%d+)$")
+	if tonumber(e) == nil or tonumber(e) < now then
+		redis.call('HDEL', key, all_fields[i])
+	else
+		held = held + tonumber(a)
+	end
+end
+return tostring(held)
+`
+
+var (
+	holdScript       = redis.NewScript(holdLuaScript)
+	heldAmountScript = redis.NewScript(heldAmountLuaScript)
+)
+
+func redisHold(ctx context.Context, group, requestID string, balance, amount float64) (bool, error) {
+	now := time.Now()
+	ok, err := holdScript.Run(
+		ctx,
+		common.RDB,
+		[]string{fmt.Sprintf(groupBalanceHoldKey, group)},
+		requestID,
+		strconv.FormatFloat(balance, 'f', -1, 64),
+		strconv.FormatFloat(amount, 'f', -1, 64),
+		now.Unix(),
+		now.Add(holdExpire).Unix(),
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+func redisHeldAmount(ctx context.Context, group string) (float64, error) {
+	result, err := heldAmountScript.Run(
+		ctx,
+		common.RDB,
+		[]string{fmt.Sprintf(groupBalanceHoldKey, group)},
+		time.Now().Unix(),
+	).Text()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(result, 64)
+}
+
+type memoryHold struct {
+	amount   float64
+	expireAt time.Time
+}
+
+type inMemoryHolds struct {
+	mu     sync.Mutex
+	groups map[string]map[string]memoryHold
+}
+
+var memoryHolds = &inMemoryHolds{
+	groups: make(map[string]map[string]memoryHold),
+}
+
+// heldLocked sums the holds of the group except the request and drops the expired ones
+func (m *inMemoryHolds) heldLocked(group, requestID string) float64 {
+	now := time.Now()
+	var held float64
+	for id, h := range m.groups[group] {
+		if h.expireAt.Before(now) {
+			delete(m.groups[group], id)
+			continue
+		}
+		if id != requestID {
+			held += h.amount
+		}
+	}
+	return held
+}
+
+func (m *inMemoryHolds) hold(group, requestID string, balance, amount float64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	held := m.heldLocked(group, requestID)
+	if amount <= 0 {
+		return true
+	}
+	if balance-held < amount {
+		return false
+	}
+	holds, ok := m.groups[group]
+	if !ok {
+		holds = make(map[string]memoryHold)
+		m.groups[group] = holds
+	}
+	holds[requestID] = memoryHold{
+		amount:   amount,
+		expireAt: time.Now().Add(holdExpire),
+	}
+	return true
+}
+
+func (m *inMemoryHolds) release(group, requestID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	holds, ok := m.groups[group]
+	if !ok {
+		return
+	}
+	delete(holds, requestID)
+	if len(holds) == 0 {
+		delete(m.groups, group)
+	}
+}
+
+func (m *inMemoryHolds) held(group string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	held := m.heldLocked(group, "")
+	if len(m.groups[group]) == 0 {
+		delete(m.groups, group)
+	}
+	return held
+}
@@ -0,0 +1,77 @@
+package balance_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/balance"
+	"github.com/redis/go-redis/v9"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func testHold(ctx context.Context, group string) {
+	ok, err := balance.Hold(ctx, group, "r1", 10, 6)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(ok, convey.ShouldBeTrue)
+
+	// the balance minus the outstanding holds is not enough
+	ok, err = balance.Hold(ctx, group, "r2", 10, 5)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(ok, convey.ShouldBeFalse)
+
+	ok, err = balance.Hold(ctx, group, "r2", 10, 4)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(ok, convey.ShouldBeTrue)
+
+	held, err := balance.GetHeldAmount(ctx, group)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(held, convey.ShouldEqual, 10)
+
+	// holding a request again replaces its hold
+	ok, err = balance.Hold(ctx, group, "r1", 10, 3)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(ok, convey.ShouldBeTrue)
+	held, err = balance.GetHeldAmount(ctx, group)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(held, convey.ShouldEqual, 7)
+
+	// a request without an amount is always allowed and holds nothing
+	ok, err = balance.Hold(ctx, group, "r3", 0, 0)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(ok, convey.ShouldBeTrue)
+
+	// settled requests free their holds
+	convey.So(balance.Release(ctx, group, "r1"), convey.ShouldBeNil)
+	convey.So(balance.Release(ctx, group, "r2"), convey.ShouldBeNil)
+	held, err = balance.GetHeldAmount(ctx, group)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(held, convey.ShouldEqual, 0)
+
+	ok, err = balance.Hold(ctx, group, "r4", 10, 10)
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(ok, convey.ShouldBeTrue)
+	convey.So(balance.Release(ctx, group, "r4"), convey.ShouldBeNil)
+}
+
+func TestHold(t *testing.T) {
+	convey.Convey("TestHold", t, func() {
+		ctx := context.Background()
+
+		convey.Convey("memory", func() {
+			testHold(ctx, "memory")
+		})
+
+		convey.Convey("redis", func() {
+			mr := miniredis.RunT(t)
+			common.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			common.RedisEnabled = true
+			defer func() {
+				common.RedisEnabled = false
+			}()
+
+			testHold(ctx, "redis")
+		})
+	})
+}
@@ -0,0 +1,60 @@
+package balance
+
+import (
+	"context"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
+)
+
+var _ GroupBalance = (*Local)(nil)
+
+// Local is the prepaid balance kept in the ledger of the database,
+// for deployments without an external account service
+type Local struct{}
+
+func InitLocal() {
+	Default = NewLocal()
+}
+
+func NewLocal() *Local {
+	return &Local{}
+}
+
+func (l *Local) GetGroupRemainBalance(_ context.Context, group model.GroupCache) (float64, PostGroupConsumer, error) {
+	balance, err := model.CacheGetGroupLedgerBalance(group.ID)
+	if err != nil {
+		return 0, nil, err
+	}
+	return balance, newLocalPostGroupConsumer(group.ID), nil
+}
+
+type LocalPostGroupConsumer struct {
+	group string
+}
+
+func newLocalPostGroupConsumer(group string) *LocalPostGroupConsumer {
+	return &LocalPostGroupConsumer{group: group}
+}
+
+func (l *LocalPostGroupConsumer) PostGroupConsume(_ context.Context, requestID, consumeID, tokenName string, usage float64) (float64, error) {
+	amount := decimal.NewFromFloat(usage).Round(6).InexactFloat64()
+	if amount <= 0 {
+		return 0, nil
+	}
+
+	deducted, err := model.DeductGroupLedger(l.group, requestID, consumeID, tokenName, amount)
+	if err != nil {
+		return 0, err
+	}
+	if !deducted {
+		return amount, nil
+	}
+
+	if err := model.CacheDecreaseGroupLedgerBalance(l.group, amount); err != nil {
+		log.Errorf("decrease group (%s) ledger balance cache failed: %s", l.group, err)
+	}
+
+	return amount, nil
+}
@@ -22,6 +22,6 @@ func (q *MockGroupBalance) GetGroupRemainBalance(_ context.Context, _ model.Grou
 	return mockBalance, q, nil
 }
 
-func (q *MockGroupBalance) PostGroupConsume(_ context.Context, _ string, usage float64) (float64, error) {
+func (q *MockGroupBalance) PostGroupConsume(_ context.Context, _, _, _ string, usage float64) (float64, error) {
 	return usage, nil
 }
@@ -322,15 +322,17 @@ func newSealosPostGroupConsumer(accountURL, group, uid string) *SealosPostGroupC
 	}
 }
 
-func (s *SealosPostGroupConsumer) PostGroupConsume(ctx context.Context, tokenName string, usage float64) (float64, error) {
+// PostGroupConsume charges the group on the sealos account service,
+// the cached balance is only decreased once the charge succeeded, so a failed charge retried later is decreased once
+func (s *SealosPostGroupConsumer) PostGroupConsume(ctx context.Context, _, consumeID, tokenName string, usage float64) (float64, error) {
 	amount := s.calculateAmount(usage)
 
-	if err := cacheDecreaseGroupBalance(ctx, s.group, amount.IntPart()); err != nil {
-		log.Errorf("decrease group (%s) balance cache failed: %s", s.group, err)
+	if err := s.postConsume(ctx, consumeID, amount.IntPart(), tokenName); err != nil {
+		return 0, err
 	}
 
-	if err := s.postConsume(ctx, amount.IntPart(), tokenName); err != nil {
-		return 0, err
+	if err := cacheDecreaseGroupBalance(ctx, s.group, amount.IntPart()); err != nil {
+		log.Errorf("decrease group (%s) balance cache failed: %s", s.group, err)
 	}
 
 	return amount.Div(decimalBalancePrecision).InexactFloat64(), nil
@@ -344,7 +346,10 @@ func (s *SealosPostGroupConsumer) calculateAmount(usage float64) decimal.Decimal
 	return amount
 }
 
-func (s *SealosPostGroupConsumer) postConsume(ctx context.Context, amount int64, tokenName string) error {
+// postConsume posts a charge to the account service with the consume id as the Idempotency-Key header,
+// the consume id identifies a single charge of a request, so every retry attempt of a request is charged
+// while a replay of the same charge by the reconciler is not, charges without id are never deduplicated
+func (s *SealosPostGroupConsumer) postConsume(ctx context.Context, consumeID string, amount int64, tokenName string) error {
 	reqBody, err := sonic.Marshal(sealosPostGroupConsumeReq{
 		Namespace: s.group,
 		Amount:    amount,
@@ -365,6 +370,9 @@ func (s *SealosPostGroupConsumer) postConsume(ctx context.Context, amount int64,
 	}
 
 	req.Header.Set("Authorization", "Bearer "+jwtToken)
+	if consumeID != "" {
+		req.Header.Set("Idempotency-Key", consumeID)
+	}
 	resp, err := sealosHTTPClient.Do(req)
 	if err != nil {
 		return err
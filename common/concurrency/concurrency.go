@@ -0,0 +1,128 @@
+package concurrency
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/labring/aiproxy/common"
+	log "github.com/sirupsen/logrus"
+)
+
+// leaseTTL bounds how long a slot can be held when the holder never releases it,
+// e.g. the instance crashed in the middle of a request, a held lease is refreshed
+// every leaseRefreshInterval, so long streams keep their slot
+const (
+	leaseTTL             = time.Minute
+	leaseRefreshInterval = leaseTTL / 3
+)
+
+// Lease is a held concurrency slot of a channel, a nil lease is valid and releases nothing
+type Lease struct {
+	channelID int
+	member    string
+	redis     bool
+	unlimited bool
+	released  atomic.Bool
+	stop      chan struct{}
+}
+
+// Acquire tries to take a concurrency slot of the channel,
+// maxConcurrency <= 0 means unlimited and always succeeds
+func Acquire(ctx context.Context, channelID int, maxConcurrency int64) (*Lease, bool) {
+	lease, ok := acquire(ctx, channelID, maxConcurrency)
+	if ok {
+		outstanding.add(channelID)
+	}
+	return lease, ok
+}
+
+func acquire(ctx context.Context, channelID int, maxConcurrency int64) (*Lease, bool) {
+	if maxConcurrency <= 0 {
+		return &Lease{channelID: channelID, unlimited: true}, true
+	}
+
+	if common.RedisEnabled {
+		member := uuid.NewString()
+		ok, err := redisAcquire(ctx, channelID, maxConcurrency, member)
+		if err == nil {
+			if !ok {
+				return nil, false
+			}
+			lease := &Lease{
+				channelID: channelID,
+				member:    member,
+				redis:     true,
+				stop:      make(chan struct{}),
+			}
+			go lease.keepAlive()
+			return lease, true
+		}
+		log.Error("redis acquire channel concurrency error: " + err.Error())
+	}
+
+	if !memLimiter.acquire(channelID, maxConcurrency) {
+		return nil, false
+	}
+	return &Lease{channelID: channelID}, true
+}
+
+// Release gives the slot back, it is safe to call multiple times
+func (l *Lease) Release() {
+	if l == nil || !l.released.CompareAndSwap(false, true) {
+		return
+	}
+	outstanding.release(l.channelID)
+	if l.unlimited {
+		return
+	}
+	if !l.redis {
+		memLimiter.release(l.channelID)
+		return
+	}
+	close(l.stop)
+	if err := redisRelease(context.Background(), l.channelID, l.member); err != nil {
+		log.Error("redis release channel concurrency error: " + err.Error())
+	}
+}
+
+// keepAlive extends the expiry of the redis slot until the lease is released,
+// a slot already gone from redis, e.g. expired during a redis outage, is not taken back
+func (l *Lease) keepAlive() {
+	ticker := time.NewTicker(leaseRefreshInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		held, err := redisRefresh(context.Background(), l.channelID, l.member)
+		if err != nil {
+			log.Error("redis refresh channel concurrency error: " + err.Error())
+			continue
+		}
+		if !held {
+			return
+		}
+	}
+}
+
+// InFlight returns the number of requests currently holding a slot of the channel
+func InFlight(ctx context.Context, channelID int) int64 {
+	if common.RedisEnabled {
+		count, err := redisCount(ctx, channelID)
+		if err == nil {
+			return count
+		}
+		log.Error("redis get channel concurrency error: " + err.Error())
+	}
+	return memLimiter.count(channelID)
+}
+
+// Outstanding returns the number of requests of this instance holding a lease of the channel,
+// unlike InFlight it also counts the channels without a concurrency limit
+func Outstanding(channelID int) int64 {
+	return outstanding.count(channelID)
+}
@@ -0,0 +1,114 @@
+package concurrency_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/concurrency"
+	"github.com/redis/go-redis/v9"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func testAcquireRelease(ctx context.Context, channelID int) {
+	first, ok := concurrency.Acquire(ctx, channelID, 2)
+	convey.So(ok, convey.ShouldBeTrue)
+	second, ok := concurrency.Acquire(ctx, channelID, 2)
+	convey.So(ok, convey.ShouldBeTrue)
+	convey.So(concurrency.InFlight(ctx, channelID), convey.ShouldEqual, 2)
+	convey.So(concurrency.Outstanding(channelID), convey.ShouldEqual, 2)
+
+	// the channel is saturated until a slot is released
+	_, ok = concurrency.Acquire(ctx, channelID, 2)
+	convey.So(ok, convey.ShouldBeFalse)
+	convey.So(concurrency.InFlight(ctx, channelID), convey.ShouldEqual, 2)
+
+	first.Release()
+	// releasing twice gives back a single slot
+	first.Release()
+	convey.So(concurrency.InFlight(ctx, channelID), convey.ShouldEqual, 1)
+	convey.So(concurrency.Outstanding(channelID), convey.ShouldEqual, 1)
+
+	third, ok := concurrency.Acquire(ctx, channelID, 2)
+	convey.So(ok, convey.ShouldBeTrue)
+	second.Release()
+	third.Release()
+	convey.So(concurrency.InFlight(ctx, channelID), convey.ShouldEqual, 0)
+	convey.So(concurrency.Outstanding(channelID), convey.ShouldEqual, 0)
+
+	// a channel without limit is never saturated, its leases are only counted as outstanding
+	unlimited := make([]*concurrency.Lease, 0, 10)
+	for range 10 {
+		lease, ok := concurrency.Acquire(ctx, channelID+1, 0)
+		convey.So(ok, convey.ShouldBeTrue)
+		unlimited = append(unlimited, lease)
+	}
+	convey.So(concurrency.InFlight(ctx, channelID+1), convey.ShouldEqual, 0)
+	convey.So(concurrency.Outstanding(channelID+1), convey.ShouldEqual, 10)
+	for _, lease := range unlimited {
+		lease.Release()
+	}
+	convey.So(concurrency.Outstanding(channelID+1), convey.ShouldEqual, 0)
+
+	// a nil lease releases nothing
+	var lease *concurrency.Lease
+	lease.Release()
+}
+
+func TestAcquire(t *testing.T) {
+	convey.Convey("TestAcquire", t, func() {
+		ctx := context.Background()
+
+		convey.Convey("memory", func() {
+			testAcquireRelease(ctx, 100)
+		})
+
+		convey.Convey("redis", func() {
+			mr := miniredis.RunT(t)
+			common.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			common.RedisEnabled = true
+			defer func() {
+				common.RedisEnabled = false
+			}()
+
+			testAcquireRelease(ctx, 200)
+
+			convey.Convey("the slot of a holder that never released it expires", func() {
+				key := fmt.Sprintf("channel_concurrency:%d", 300)
+				// a crashed instance stopped refreshing its slot a while ago
+				_, err := mr.ZAdd(key, float64(time.Now().Add(-time.Second).UnixMilli()), "crashed")
+				convey.So(err, convey.ShouldBeNil)
+				_, err = mr.ZAdd(key, float64(time.Now().Add(time.Minute).UnixMilli()), "alive")
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(concurrency.InFlight(ctx, 300), convey.ShouldEqual, 1)
+
+				lease, ok := concurrency.Acquire(ctx, 300, 2)
+				convey.So(ok, convey.ShouldBeTrue)
+				_, ok = concurrency.Acquire(ctx, 300, 2)
+				convey.So(ok, convey.ShouldBeFalse)
+
+				// the slot of a held lease expires with the key when it is not refreshed
+				convey.So(mr.TTL(key), convey.ShouldEqual, time.Minute)
+				mr.FastForward(time.Minute)
+				convey.So(mr.Exists(key), convey.ShouldBeFalse)
+				lease.Release()
+				convey.So(concurrency.InFlight(ctx, 300), convey.ShouldEqual, 0)
+			})
+
+			convey.Convey("the memory limiter takes over when redis is unavailable", func() {
+				mr.Close()
+				lease, ok := concurrency.Acquire(ctx, 400, 1)
+				convey.So(ok, convey.ShouldBeTrue)
+				_, ok = concurrency.Acquire(ctx, 400, 1)
+				convey.So(ok, convey.ShouldBeFalse)
+				lease.Release()
+				lease, ok = concurrency.Acquire(ctx, 400, 1)
+				convey.So(ok, convey.ShouldBeTrue)
+				lease.Release()
+			})
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package concurrency
+
+import (
+	"sync"
+)
+
+type memoryLimiter struct {
+	mu       sync.Mutex
+	inFlight map[int]int64
+}
+
+var (
+	memLimiter = &memoryLimiter{
+		inFlight: make(map[int]int64),
+	}
+	outstanding = &memoryLimiter{
+		inFlight: make(map[int]int64),
+	}
+)
+
+func (m *memoryLimiter) acquire(channelID int, maxConcurrency int64) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.inFlight[channelID] >= maxConcurrency {
+		return false
+	}
+	m.inFlight[channelID]++
+	return true
+}
+
+func (m *memoryLimiter) add(channelID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight[channelID]++
+}
+
+func (m *memoryLimiter) release(channelID int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.inFlight[channelID] <= 1 {
+		delete(m.inFlight, channelID)
+		return
+	}
+	m.inFlight[channelID]--
+}
+
+func (m *memoryLimiter) count(channelID int) int64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.inFlight[channelID]
+}
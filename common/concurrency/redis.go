@@ -0,0 +1,102 @@
+package concurrency
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy/common"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	channelConcurrencyKey = "channel_concurrency:%d"
+)
+
+const acquireLuaScript = `
+local key = KEYS[1]
+local max_concurrency = tonumber(ARGV[1])
+local now_ms = tonumber(ARGV[2])
+local ttl_ms = tonumber(ARGV[3])
+local member = ARGV[4]
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now_ms)
+if redis.call('ZCARD', key) >= max_concurrency then
+    return 0
+end
+redis.call('ZADD', key, now_ms + ttl_ms, member)
+redis.call('PEXPIRE', key, ttl_ms)
+return 1
+`
+
+const countLuaScript = `
+local key = KEYS[1]
+local now_ms = tonumber(ARGV[1])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now_ms)
+return redis.call('ZCARD', key)
+`
+
+const refreshLuaScript = `
+local key = KEYS[1]
+local now_ms = tonumber(ARGV[1])
+local ttl_ms = tonumber(ARGV[2])
+local member = ARGV[3]
+
+if not redis.call('ZSCORE', key, member) then
+    return 0
+end
+redis.call('ZADD', key, now_ms + ttl_ms, member)
+redis.call('PEXPIRE', key, ttl_ms)
+return 1
+`
+
+var (
+	acquireScript = redis.NewScript(acquireLuaScript)
+	countScript   = redis.NewScript(countLuaScript)
+	refreshScript = redis.NewScript(refreshLuaScript)
+)
+
+func redisAcquire(ctx context.Context, channelID int, maxConcurrency int64, member string) (bool, error) {
+	result, err := acquireScript.Run(
+		ctx,
+		common.RDB,
+		[]string{fmt.Sprintf(channelConcurrencyKey, channelID)},
+		maxConcurrency,
+		time.Now().UnixMilli(),
+		leaseTTL.Milliseconds(),
+		member,
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func redisRefresh(ctx context.Context, channelID int, member string) (bool, error) {
+	result, err := refreshScript.Run(
+		ctx,
+		common.RDB,
+		[]string{fmt.Sprintf(channelConcurrencyKey, channelID)},
+		time.Now().UnixMilli(),
+		leaseTTL.Milliseconds(),
+		member,
+	).Int64()
+	if err != nil {
+		return false, err
+	}
+	return result == 1, nil
+}
+
+func redisRelease(ctx context.Context, channelID int, member string) error {
+	return common.RDB.ZRem(ctx, fmt.Sprintf(channelConcurrencyKey, channelID), member).Err()
+}
+
+func redisCount(ctx context.Context, channelID int) (int64, error) {
+	return countScript.Run(
+		ctx,
+		common.RDB,
+		[]string{fmt.Sprintf(channelConcurrencyKey, channelID)},
+		time.Now().UnixMilli(),
+	).Int64()
+}
@@ -35,29 +35,42 @@ var (
 var (
 	retryTimes              atomic.Int64
 	enableModelErrorAutoBan atomic.Bool
+	enableStreamFailover    atomic.Bool
 	modelErrorAutoBanRate   = math.Float64bits(0.3)
 	timeoutWithModelType    atomic.Value
+	clientDisconnectPolicy  atomic.Value
 	disableModelConfig      = env.Bool("DISABLE_MODEL_CONFIG", false)
+
+	channelConcurrencyQueueTimeout int64 = 30 // seconds
+	rateLimitQueueTimeout          int64 = 30 // seconds
+	rateLimitQueueMaxLength        int64 = 100
 )
 
 var (
 	defaultChannelModels       atomic.Value
 	defaultChannelModelMapping atomic.Value
+	modelAliases               atomic.Value
+	priorityClassCapacity      atomic.Value
 	groupMaxTokenNum           atomic.Int64
 	groupConsumeLevelRatio     atomic.Value
 )
 
 var geminiSafetySetting atomic.Value
 
-var billingEnabled atomic.Bool
+var (
+	billingEnabled     atomic.Bool
+	balanceHoldEnabled atomic.Bool
+)
 
 func init() {
 	timeoutWithModelType.Store(make(map[int]int64))
+	clientDisconnectPolicy.Store(make(map[int]string))
 	defaultChannelModels.Store(make(map[int][]string))
 	defaultChannelModelMapping.Store(make(map[int]map[string]string))
 	groupConsumeLevelRatio.Store(make(map[float64]float64))
 	geminiSafetySetting.Store("BLOCK_NONE")
 	billingEnabled.Store(true)
+	balanceHoldEnabled.Store(true)
 	internalToken.Store(os.Getenv("INTERNAL_TOKEN"))
 	notifyNote.Store(os.Getenv("NOTIFY_NOTE"))
 }
@@ -84,6 +97,17 @@ func SetEnableModelErrorAutoBan(enabled bool) {
 	enableModelErrorAutoBan.Store(enabled)
 }
 
+// GetEnableStreamFailover returns whether an interrupted chat stream is continued on another channel,
+// it only applies to the channels whose stream handler tracks the output, see enableStreamFailover of the controller
+func GetEnableStreamFailover() bool {
+	return enableStreamFailover.Load()
+}
+
+func SetEnableStreamFailover(enabled bool) {
+	enabled = env.Bool("ENABLE_STREAM_FAILOVER", enabled)
+	enableStreamFailover.Store(enabled)
+}
+
 func GetModelErrorAutoBanRate() float64 {
 	return math.Float64frombits(atomic.LoadUint64(&modelErrorAutoBanRate))
 }
@@ -93,6 +117,38 @@ func SetModelErrorAutoBanRate(rate float64) {
 	atomic.StoreUint64(&modelErrorAutoBanRate, math.Float64bits(rate))
 }
 
+// GetChannelConcurrencyQueueTimeout returns how long (in seconds) a request waits
+// for a concurrency slot when all channels are saturated, 0 means do not wait
+func GetChannelConcurrencyQueueTimeout() int64 {
+	return atomic.LoadInt64(&channelConcurrencyQueueTimeout)
+}
+
+func SetChannelConcurrencyQueueTimeout(timeout int64) {
+	timeout = env.Int64("CHANNEL_CONCURRENCY_QUEUE_TIMEOUT", timeout)
+	atomic.StoreInt64(&channelConcurrencyQueueTimeout, timeout)
+}
+
+// GetRateLimitQueueTimeout returns how long (in seconds) a request of a waiting group or token
+// is queued when the group model rpm or tpm limit is exceeded
+func GetRateLimitQueueTimeout() int64 {
+	return atomic.LoadInt64(&rateLimitQueueTimeout)
+}
+
+func SetRateLimitQueueTimeout(timeout int64) {
+	timeout = env.Int64("RATE_LIMIT_QUEUE_TIMEOUT", timeout)
+	atomic.StoreInt64(&rateLimitQueueTimeout, timeout)
+}
+
+// GetRateLimitQueueMaxLength returns how many requests may wait for one group model at most
+func GetRateLimitQueueMaxLength() int64 {
+	return atomic.LoadInt64(&rateLimitQueueMaxLength)
+}
+
+func SetRateLimitQueueMaxLength(length int64) {
+	length = env.Int64("RATE_LIMIT_QUEUE_MAX_LENGTH", length)
+	atomic.StoreInt64(&rateLimitQueueMaxLength, length)
+}
+
 func GetTimeoutWithModelType() map[int]int64 {
 	t, _ := timeoutWithModelType.Load().(map[int]int64)
 	return t
@@ -103,6 +159,17 @@ func SetTimeoutWithModelType(timeout map[int]int64) {
 	timeoutWithModelType.Store(timeout)
 }
 
+// GetClientDisconnectPolicy returns the upstream policy of each mode when the client disconnects
+func GetClientDisconnectPolicy() map[int]string {
+	p, _ := clientDisconnectPolicy.Load().(map[int]string)
+	return p
+}
+
+func SetClientDisconnectPolicy(policy map[int]string) {
+	policy = env.JSON("CLIENT_DISCONNECT_POLICY", policy)
+	clientDisconnectPolicy.Store(policy)
+}
+
 func GetLogStorageHours() int64 {
 	return atomic.LoadInt64(&logStorageHours)
 }
@@ -181,6 +248,29 @@ func SetDefaultChannelModelMapping(mapping map[int]map[string]string) {
 	defaultChannelModelMapping.Store(mapping)
 }
 
+// GetModelAliases returns the global model aliases, alias to the real model
+func GetModelAliases() map[string]string {
+	a, _ := modelAliases.Load().(map[string]string)
+	return a
+}
+
+func SetModelAliases(aliases map[string]string) {
+	aliases = env.JSON("MODEL_ALIASES", aliases)
+	modelAliases.Store(aliases)
+}
+
+// GetPriorityClassCapacity returns the share of the channel capacity each priority class may use,
+// the rest is reserved for the higher classes, a missing class uses the whole capacity
+func GetPriorityClassCapacity() map[string]float64 {
+	c, _ := priorityClassCapacity.Load().(map[string]float64)
+	return c
+}
+
+func SetPriorityClassCapacity(capacity map[string]float64) {
+	capacity = env.JSON("PRIORITY_CLASS_CAPACITY", capacity)
+	priorityClassCapacity.Store(capacity)
+}
+
 func GetGroupConsumeLevelRatio() map[float64]float64 {
 	r, _ := groupConsumeLevelRatio.Load().(map[float64]float64)
 	return r
@@ -229,6 +319,16 @@ func SetBillingEnabled(enabled bool) {
 	billingEnabled.Store(enabled)
 }
 
+// GetBalanceHoldEnabled returns whether the estimated amount of a request is held from the group balance until it is settled
+func GetBalanceHoldEnabled() bool {
+	return balanceHoldEnabled.Load()
+}
+
+func SetBalanceHoldEnabled(enabled bool) {
+	enabled = env.Bool("BALANCE_HOLD_ENABLED", enabled)
+	balanceHoldEnabled.Store(enabled)
+}
+
 func GetInternalToken() string {
 	t, _ := internalToken.Load().(string)
 	return t
@@ -7,6 +7,7 @@ import (
 
 	"github.com/labring/aiproxy/common/balance"
 	"github.com/labring/aiproxy/common/notify"
+	"github.com/labring/aiproxy/common/periodquota"
 	"github.com/labring/aiproxy/model"
 	"github.com/labring/aiproxy/relay/meta"
 	relaymodel "github.com/labring/aiproxy/relay/model"
@@ -68,9 +69,18 @@ func Consume(
 	requestDetail *model.RequestDetail,
 	downstreamResult bool,
 ) {
-	amount := CalculateAmount(usage, modelPrice)
+	amount := CalculateAmount(meta.RequestAt, usage, modelPrice)
 
-	amount = consumeAmount(ctx, amount, postGroupConsumer, meta)
+	amount = consumeAmount(ctx, amount, postGroupConsumer, meta, retryTimes)
+
+	recordPeriodicQuotas(ctx, meta, usage, amount)
+
+	// the hold of the request is settled by the consumed amount
+	if downstreamResult && postGroupConsumer != nil && meta.Group != nil {
+		if err := balance.Release(ctx, meta.Group.ID, meta.RequestID); err != nil {
+			log.Errorf("release group (%s) balance hold failed: %s", meta.Group.ID, err)
+		}
+	}
 
 	err := recordConsume(meta,
 		code,
@@ -89,29 +99,60 @@ func Consume(
 	}
 }
 
+// recordPeriodicQuotas counts the consumption against the periodic quotas of the token and the group
+func recordPeriodicQuotas(ctx context.Context, meta *meta.Meta, usage relaymodel.Usage, amount float64) {
+	tokens := int64(usage.PromptTokens + usage.CompletionTokens)
+	if meta.Token != nil {
+		if err := periodquota.Record(ctx, periodquota.TokenSubject(meta.Token.ID), meta.Token.PeriodicQuotas, meta.RequestAt, amount, tokens); err != nil {
+			log.Errorf("record token (%d) periodic quotas failed: %s", meta.Token.ID, err)
+		}
+	}
+	if meta.Group != nil {
+		if err := periodquota.Record(ctx, periodquota.GroupSubject(meta.Group.ID), meta.Group.PeriodicQuotas, meta.RequestAt, amount, tokens); err != nil {
+			log.Errorf("record group (%s) periodic quotas failed: %s", meta.Group.ID, err)
+		}
+	}
+}
+
 func consumeAmount(
 	ctx context.Context,
 	amount float64,
 	postGroupConsumer balance.PostGroupConsumer,
 	meta *meta.Meta,
+	retryTimes int,
 ) float64 {
 	if amount > 0 && postGroupConsumer != nil {
-		return processGroupConsume(ctx, amount, postGroupConsumer, meta)
+		return processGroupConsume(ctx, amount, postGroupConsumer, meta, retryTimes)
 	}
 	return amount
 }
 
+// CalculateAmount bills the usage by the price effective at the request time
 func CalculateAmount(
+	requestAt time.Time,
 	usage relaymodel.Usage,
 	modelPrice model.Price,
 ) float64 {
+	modelPrice, _ = modelPrice.EffectiveAt(requestAt)
+	modelPrice, _ = modelPrice.SelectTier(usage.PromptTokens)
+
 	promptTokens := usage.PromptTokens
 	completionTokens := usage.CompletionTokens
 	var cachedTokens int
 	var cacheCreationTokens int
+	var audioInputTokens int
+	var imageInputTokens int
 	if usage.PromptTokensDetails != nil {
 		cachedTokens = usage.PromptTokensDetails.CachedTokens
 		cacheCreationTokens = usage.PromptTokensDetails.CacheCreationTokens
+		audioInputTokens = usage.PromptTokensDetails.AudioTokens
+		imageInputTokens = usage.PromptTokensDetails.ImageTokens
+	}
+	var reasoningTokens int
+	var audioOutputTokens int
+	if usage.CompletionTokensDetails != nil {
+		reasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+		audioOutputTokens = usage.CompletionTokensDetails.AudioTokens
 	}
 
 	if modelPrice.CachedPrice > 0 {
@@ -120,38 +161,58 @@ func CalculateAmount(
 	if modelPrice.CacheCreationPrice > 0 {
 		promptTokens -= cacheCreationTokens
 	}
+	if modelPrice.AudioInputPrice > 0 {
+		promptTokens -= audioInputTokens
+	}
+	if modelPrice.ImageInputPrice > 0 {
+		promptTokens -= imageInputTokens
+	}
+	if modelPrice.ReasoningPrice > 0 {
+		completionTokens -= reasoningTokens
+	}
+	if modelPrice.AudioOutputPrice > 0 {
+		completionTokens -= audioOutputTokens
+	}
 
-	promptAmount := decimal.NewFromInt(int64(promptTokens)).
-		Mul(decimal.NewFromFloat(modelPrice.InputPrice)).
-		Div(decimal.NewFromInt(model.PriceUnit))
-	completionAmount := decimal.NewFromInt(int64(completionTokens)).
-		Mul(decimal.NewFromFloat(modelPrice.OutputPrice)).
-		Div(decimal.NewFromInt(model.PriceUnit))
-	cachedAmount := decimal.NewFromInt(int64(cachedTokens)).
-		Mul(decimal.NewFromFloat(modelPrice.CachedPrice)).
-		Div(decimal.NewFromInt(model.PriceUnit))
-	cacheCreationAmount := decimal.NewFromInt(int64(cacheCreationTokens)).
-		Mul(decimal.NewFromFloat(modelPrice.CacheCreationPrice)).
-		Div(decimal.NewFromInt(model.PriceUnit))
-
-	return promptAmount.
-		Add(completionAmount).
-		Add(cachedAmount).
-		Add(cacheCreationAmount).
+	return tokensAmount(promptTokens, modelPrice.InputPrice).
+		Add(tokensAmount(completionTokens, modelPrice.OutputPrice)).
+		Add(tokensAmount(cachedTokens, modelPrice.CachedPrice)).
+		Add(tokensAmount(cacheCreationTokens, modelPrice.CacheCreationPrice)).
+		Add(tokensAmount(audioInputTokens, modelPrice.AudioInputPrice)).
+		Add(tokensAmount(imageInputTokens, modelPrice.ImageInputPrice)).
+		Add(tokensAmount(reasoningTokens, modelPrice.ReasoningPrice)).
+		Add(tokensAmount(audioOutputTokens, modelPrice.AudioOutputPrice)).
+		Add(unitsAmount(usage.Units, modelPrice.UnitPrice)).
 		InexactFloat64()
 }
 
+func unitsAmount(units int, price float64) decimal.Decimal {
+	return decimal.NewFromInt(int64(units)).
+		Mul(decimal.NewFromFloat(price))
+}
+
+func tokensAmount(tokens int, price float64) decimal.Decimal {
+	return decimal.NewFromInt(int64(tokens)).
+		Mul(decimal.NewFromFloat(price)).
+		Div(decimal.NewFromInt(model.PriceUnit))
+}
+
+// processGroupConsume charges the group for an attempt of the request,
+// each attempt with usage is a charge of its own, keyed by the request id and the retry times
 func processGroupConsume(
 	ctx context.Context,
 	amount float64,
 	postGroupConsumer balance.PostGroupConsumer,
 	meta *meta.Meta,
+	retryTimes int,
 ) float64 {
-	consumedAmount, err := postGroupConsumer.PostGroupConsume(ctx, meta.Token.Name, amount)
+	consumeID := balance.ConsumeID(meta.RequestID, retryTimes)
+	consumedAmount, err := postGroupConsumer.PostGroupConsume(ctx, meta.RequestID, consumeID, meta.Token.Name, amount)
 	if err != nil {
 		log.Error("error consuming token remain amount: " + err.Error())
 		if err := model.CreateConsumeError(
 			meta.RequestID,
+			consumeID,
 			meta.RequestAt,
 			meta.Group.ID,
 			meta.Token.Name,
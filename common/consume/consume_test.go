@@ -0,0 +1,59 @@
+package consume_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/common/consume"
+	"github.com/labring/aiproxy/model"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestCalculateAmount(t *testing.T) {
+	convey.Convey("TestCalculateAmount", t, func() {
+		price := model.Price{
+			InputPrice:      2,
+			OutputPrice:     8,
+			CachedPrice:     1,
+			ReasoningPrice:  10,
+			AudioInputPrice: 20,
+			UnitPrice:       0.5,
+			Tiers:           []model.PriceTier{{InputTokensOver: 10000, InputPrice: 4, OutputPrice: 16}},
+			Windows:         []model.PriceWindow{{Start: "00:00", End: "06:00", Multiplier: 0.5}},
+			Timezone:        "UTC",
+		}
+		noon := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		night := time.Date(2025, 1, 1, 3, 0, 0, 0, time.UTC)
+		usage := relaymodel.Usage{
+			PromptTokens:     20000,
+			CompletionTokens: 3000,
+			PromptTokensDetails: &relaymodel.PromptTokensDetails{
+				CachedTokens: 4000,
+				AudioTokens:  1000,
+			},
+			CompletionTokensDetails: &relaymodel.CompletionTokensDetails{
+				ReasoningTokens: 1000,
+			},
+			Units: 2,
+		}
+
+		// the tier prices the plain input and output, the cached, audio, reasoning tokens and units have their own prices:
+		// 15000*4 + 2000*16 + 4000*1 + 1000*20 + 1000*10 per 1000 tokens + 2*0.5
+		convey.So(consume.CalculateAmount(noon, usage, price), convey.ShouldEqual, 127)
+
+		// the window scales the tier, the token and the unit prices
+		convey.So(consume.CalculateAmount(night, usage, price), convey.ShouldEqual, 63.5)
+
+		// below the tier threshold the base prices apply
+		convey.So(consume.CalculateAmount(noon, relaymodel.Usage{
+			PromptTokens:     1000,
+			CompletionTokens: 500,
+			Units:            1,
+		}, price), convey.ShouldEqual, 6.5)
+
+		// the reasoning tokens are output tokens when they have no price of their own
+		price.ReasoningPrice = 0
+		convey.So(consume.CalculateAmount(noon, usage, price), convey.ShouldEqual, 133)
+	})
+}
@@ -0,0 +1,141 @@
+package consume
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/labring/aiproxy/common/balance"
+	"github.com/labring/aiproxy/common/env"
+	"github.com/labring/aiproxy/common/notify"
+	"github.com/labring/aiproxy/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	consumeErrorMaxAttempts    = int(env.Int64("CONSUME_ERROR_MAX_ATTEMPTS", 10))
+	consumeErrorRetryBaseDelay = time.Duration(env.Int64("CONSUME_ERROR_RETRY_BASE_DELAY_SECONDS", 60)) * time.Second
+)
+
+const consumeErrorRetryMaxDelay = 6 * time.Hour
+
+// consumeErrorRetryDelay doubles the delay after each attempt
+func consumeErrorRetryDelay(attempts int) time.Duration {
+	delay := consumeErrorRetryBaseDelay
+	for i := 1; i < attempts && delay < consumeErrorRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, consumeErrorRetryMaxDelay)
+}
+
+// ReconcileConsumeErrors retries the consume errors due to be retried,
+// an error whose retries are exhausted is notified and left for manual handling
+func ReconcileConsumeErrors(ctx context.Context, batchSize int) error {
+	consumeErrors, err := model.GetRetryableConsumeErrors(time.Now(), batchSize)
+	if err != nil {
+		return err
+	}
+	for _, consumeError := range consumeErrors {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := retryConsumeError(ctx, consumeError); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var ErrConsumeErrorResolved = errors.New("consume error is resolved")
+
+// RetryConsumeError retries a pending, exhausted or legacy consume error immediately,
+// the returned error is the error of the consumption if it failed again
+func RetryConsumeError(ctx context.Context, id int) (*model.ConsumeError, error) {
+	consumeError, err := model.GetConsumeErrorByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(model.ConsumeErrorManualStatuses, consumeError.Status) {
+		return consumeError, fmt.Errorf("%w: %s", ErrConsumeErrorResolved, consumeError.Status)
+	}
+	claimed, err := retryConsumeError(ctx, consumeError)
+	if err != nil {
+		return consumeError, err
+	}
+	if !claimed {
+		return consumeError, errors.New("consume error is being retried")
+	}
+	if consumeError.Status != model.ConsumeErrorStatusSucceeded {
+		return consumeError, errors.New(consumeError.LastError)
+	}
+	return consumeError, nil
+}
+
+// retryConsumeError consumes the amount of the consume error again with the request id as the idempotency key,
+// false is returned when the attempt is claimed by another instance
+func retryConsumeError(ctx context.Context, consumeError *model.ConsumeError) (bool, error) {
+	claimed, err := model.ClaimConsumeErrorRetry(
+		consumeError,
+		time.Now().Add(consumeErrorRetryDelay(consumeError.Attempts+1)),
+	)
+	if err != nil || !claimed {
+		return false, err
+	}
+
+	consumeErr := postConsumeError(ctx, consumeError)
+	exhausted := consumeErr != nil && consumeError.Attempts >= consumeErrorMaxAttempts
+	if err := model.UpdateConsumeErrorRetryResult(consumeError, consumeErr, exhausted); err != nil {
+		return true, err
+	}
+
+	switch {
+	case consumeErr == nil:
+		log.Infof("consume error %d of group (%s) request %s retried successfully",
+			consumeError.ID, consumeError.GroupID, consumeError.RequestID)
+	case exhausted:
+		notify.Error(
+			fmt.Sprintf("consume error %d retries exhausted", consumeError.ID),
+			fmt.Sprintf("group: %s\nrequest id: %s\nmodel: %s\namount: %f\nattempts: %d\nerror: %s",
+				consumeError.GroupID,
+				consumeError.RequestID,
+				consumeError.Model,
+				consumeError.UsedAmount,
+				consumeError.Attempts,
+				consumeErr.Error(),
+			),
+		)
+	default:
+		log.Warnf("retry consume error %d of group (%s) request %s failed: %s",
+			consumeError.ID, consumeError.GroupID, consumeError.RequestID, consumeErr)
+	}
+	return true, nil
+}
+
+func postConsumeError(ctx context.Context, consumeError *model.ConsumeError) error {
+	group, err := model.CacheGetGroup(consumeError.GroupID)
+	if err != nil {
+		return err
+	}
+	if group.Status == model.GroupStatusInternal {
+		return nil
+	}
+	_, consumer, err := balance.GetGroupRemainBalance(ctx, *group)
+	if err != nil {
+		return err
+	}
+	// the errors recorded before the consume id existed are keyed by the request id
+	consumeID := string(consumeError.ConsumeID)
+	if consumeID == "" {
+		consumeID = consumeError.RequestID
+	}
+	_, err = consumer.PostGroupConsume(
+		ctx,
+		consumeError.RequestID,
+		consumeID,
+		string(consumeError.TokenName),
+		consumeError.UsedAmount,
+	)
+	return err
+}
@@ -0,0 +1,191 @@
+package consume_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/balance"
+	"github.com/labring/aiproxy/common/consume"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/meta"
+	"github.com/labring/aiproxy/relay/mode"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// fakeGroupBalance fails the first consumptions, then consumes every consume id once
+type fakeGroupBalance struct {
+	mu       sync.Mutex
+	failures int
+	consumed map[string]float64
+}
+
+func (f *fakeGroupBalance) GetGroupRemainBalance(_ context.Context, _ model.GroupCache) (float64, balance.PostGroupConsumer, error) {
+	return 100, f, nil
+}
+
+func (f *fakeGroupBalance) PostGroupConsume(_ context.Context, _, consumeID, _ string, usage float64) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.failures > 0 {
+		f.failures--
+		return 0, errors.New("balance service unavailable")
+	}
+	if _, ok := f.consumed[consumeID]; !ok {
+		f.consumed[consumeID] = usage
+	}
+	return usage, nil
+}
+
+func initTestDB(t *testing.T) {
+	t.Helper()
+	common.SQLitePath = filepath.Join(t.TempDir(), "aiproxy.db")
+	model.InitDB()
+	model.InitLogDB()
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+	})
+}
+
+func initFakeGroupBalance(t *testing.T, failures int) *fakeGroupBalance {
+	t.Helper()
+	fake := &fakeGroupBalance{failures: failures, consumed: map[string]float64{}}
+	old := balance.Default
+	balance.Default = fake
+	t.Cleanup(func() {
+		balance.Default = old
+	})
+	return fake
+}
+
+func getConsumeError(requestID string) *model.ConsumeError {
+	consumeErrors, _, err := model.SearchConsumeError("", requestID, "", "", "", "", 0, 1, 1, "")
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(consumeErrors, convey.ShouldHaveLength, 1)
+	return consumeErrors[0]
+}
+
+func TestReconcileConsumeErrors(t *testing.T) {
+	convey.Convey("TestReconcileConsumeErrors", t, func() {
+		initTestDB(t)
+		ctx := context.Background()
+		convey.So(model.CreateGroup(&model.Group{ID: "g1", Status: model.GroupStatusEnabled}), convey.ShouldBeNil)
+		convey.So(model.CreateConsumeError("r1", "r1:0", time.Now(), "g1", "t", "gpt-4o", "post consume failed", 2, 1), convey.ShouldBeNil)
+
+		convey.Convey("a failed retry is scheduled again", func() {
+			fake := initFakeGroupBalance(t, 1)
+
+			convey.So(consume.ReconcileConsumeErrors(ctx, 10), convey.ShouldBeNil)
+			consumeError := getConsumeError("r1")
+			convey.So(consumeError.Status, convey.ShouldEqual, model.ConsumeErrorStatusPending)
+			convey.So(consumeError.Attempts, convey.ShouldEqual, 1)
+			convey.So(consumeError.LastError, convey.ShouldEqual, "balance service unavailable")
+			convey.So(consumeError.NextRetryAt, convey.ShouldHappenAfter, time.Now())
+
+			// not due yet
+			convey.So(consume.ReconcileConsumeErrors(ctx, 10), convey.ShouldBeNil)
+			convey.So(getConsumeError("r1").Attempts, convey.ShouldEqual, 1)
+
+			consumeError, err := consume.RetryConsumeError(ctx, consumeError.ID)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(consumeError.Status, convey.ShouldEqual, model.ConsumeErrorStatusSucceeded)
+			convey.So(fake.consumed, convey.ShouldResemble, map[string]float64{"r1:0": 2})
+
+			_, err = consume.RetryConsumeError(ctx, consumeError.ID)
+			convey.So(errors.Is(err, consume.ErrConsumeErrorResolved), convey.ShouldBeTrue)
+			_, err = model.WriteOffConsumeError(consumeError.ID, "paid")
+			convey.So(err, convey.ShouldNotBeNil)
+		})
+
+		convey.Convey("an error whose retries are exhausted is left for manual handling", func() {
+			initFakeGroupBalance(t, 100)
+			id := getConsumeError("r1").ID
+
+			for range 10 {
+				_, err := consume.RetryConsumeError(ctx, id)
+				convey.So(err, convey.ShouldNotBeNil)
+			}
+			consumeError := getConsumeError("r1")
+			convey.So(consumeError.Status, convey.ShouldEqual, model.ConsumeErrorStatusExhausted)
+			convey.So(consumeError.Attempts, convey.ShouldEqual, 10)
+
+			retryable, err := model.GetRetryableConsumeErrors(time.Now().Add(24*time.Hour), 10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(retryable, convey.ShouldBeEmpty)
+
+			consumeError, err = model.WriteOffConsumeError(id, "waived")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(consumeError.Status, convey.ShouldEqual, model.ConsumeErrorStatusWrittenOff)
+			convey.So(consumeError.Remark, convey.ShouldEqual, "waived")
+
+			_, err = consume.RetryConsumeError(ctx, id)
+			convey.So(errors.Is(err, consume.ErrConsumeErrorResolved), convey.ShouldBeTrue)
+		})
+
+		convey.Convey("legacy errors are only retried manually", func() {
+			fake := initFakeGroupBalance(t, 0)
+			convey.So(model.LogDB.Create(&model.ConsumeError{
+				RequestID:  "r2",
+				RequestAt:  time.Now(),
+				GroupID:    "g1",
+				TokenName:  "t",
+				UsedAmount: 3,
+				Status:     model.ConsumeErrorStatusLegacy,
+			}).Error, convey.ShouldBeNil)
+			retryable, err := model.GetRetryableConsumeErrors(time.Now(), 10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(retryable, convey.ShouldHaveLength, 1)
+			convey.So(retryable[0].RequestID, convey.ShouldEqual, "r1")
+
+			consumeError, err := consume.RetryConsumeError(ctx, getConsumeError("r2").ID)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(consumeError.Status, convey.ShouldEqual, model.ConsumeErrorStatusSucceeded)
+			convey.So(fake.consumed["r2"], convey.ShouldEqual, 3)
+		})
+	})
+}
+
+func TestReconcileConsumeErrorsPerCharge(t *testing.T) {
+	convey.Convey("TestReconcileConsumeErrorsPerCharge", t, func() {
+		initTestDB(t)
+		ctx := context.Background()
+		convey.So(model.CreateGroup(&model.Group{ID: "g1", Status: model.GroupStatusEnabled}), convey.ShouldBeNil)
+		fake := initFakeGroupBalance(t, 2)
+
+		m := meta.NewMeta(
+			&model.Channel{ID: 1, Name: "c1"},
+			mode.ChatCompletions,
+			"gpt-4o",
+			&model.ModelConfig{Model: "gpt-4o"},
+			meta.WithRequestID("r3"),
+			meta.WithGroup(&model.GroupCache{ID: "g1"}),
+			meta.WithToken(&model.TokenCache{ID: 1, Name: "t"}),
+		)
+		usage := relaymodel.Usage{PromptTokens: 1000, CompletionTokens: 500}
+		price := model.Price{InputPrice: 2, OutputPrice: 8}
+
+		// both charged attempts of the request fail to be posted
+		consume.Consume(ctx, fake, http.StatusOK, m, usage, price, "", "", 0, nil, false)
+		consume.Consume(ctx, fake, http.StatusOK, m, usage, price, "", "", 1, nil, true)
+		consumeErrors, total, err := model.SearchConsumeError("", "r3", "", "", "", "", 0, 1, 10, "")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(total, convey.ShouldEqual, 2)
+		consumeIDs := []string{string(consumeErrors[0].ConsumeID), string(consumeErrors[1].ConsumeID)}
+		convey.So(consumeIDs, convey.ShouldContain, "r3:0")
+		convey.So(consumeIDs, convey.ShouldContain, "r3:1")
+
+		// every charge is posted again under its own key, a replay is not charged twice
+		convey.So(consume.ReconcileConsumeErrors(ctx, 10), convey.ShouldBeNil)
+		convey.So(fake.consumed, convey.ShouldResemble, map[string]float64{"r3:0": 6, "r3:1": 6})
+		for _, consumeError := range consumeErrors {
+			_, err := consume.RetryConsumeError(ctx, consumeError.ID)
+			convey.So(errors.Is(err, consume.ErrConsumeErrorResolved), convey.ShouldBeTrue)
+		}
+	})
+}
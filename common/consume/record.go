@@ -22,11 +22,21 @@ func recordConsume(
 		InputTokens:  usage.PromptTokens,
 		OutputTokens: usage.CompletionTokens,
 		TotalTokens:  usage.PromptTokens + usage.CompletionTokens,
+		Units:        usage.Units,
 	}
 	if usage.PromptTokensDetails != nil {
 		us.CachedTokens = usage.PromptTokensDetails.CachedTokens
 		us.CacheCreationTokens = usage.PromptTokensDetails.CacheCreationTokens
+		us.AudioInputTokens = usage.PromptTokensDetails.AudioTokens
+		us.ImageInputTokens = usage.PromptTokensDetails.ImageTokens
 	}
+	if usage.CompletionTokensDetails != nil {
+		us.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+		us.AudioOutputTokens = usage.CompletionTokensDetails.AudioTokens
+	}
+
+	modelPrice, priceMultiplier := modelPrice.EffectiveAt(meta.RequestAt)
+	modelPrice, priceTier := modelPrice.SelectTier(usage.PromptTokens)
 
 	var channelID int
 	if meta.Channel != nil {
@@ -51,6 +61,9 @@ func recordConsume(
 		downstreamResult,
 		us,
 		modelPrice,
+		priceTier,
+		priceMultiplier,
+		meta.PriceAdjustment,
 		amount,
 	)
 }
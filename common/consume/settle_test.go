@@ -0,0 +1,52 @@
+package consume_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/labring/aiproxy/common/balance"
+	"github.com/labring/aiproxy/common/consume"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/meta"
+	"github.com/labring/aiproxy/relay/mode"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestConsumeSettlesHold(t *testing.T) {
+	convey.Convey("TestConsumeSettlesHold", t, func() {
+		initTestDB(t)
+		fake := initFakeGroupBalance(t, 0)
+		ctx := context.Background()
+
+		m := meta.NewMeta(
+			&model.Channel{ID: 1, Name: "c1"},
+			mode.ChatCompletions,
+			"gpt-4o",
+			&model.ModelConfig{Model: "gpt-4o"},
+			meta.WithRequestID("r1"),
+			meta.WithGroup(&model.GroupCache{ID: "g1"}),
+			meta.WithToken(&model.TokenCache{ID: 1, Name: "t"}),
+		)
+		usage := relaymodel.Usage{PromptTokens: 1000, CompletionTokens: 500}
+		price := model.Price{InputPrice: 2, OutputPrice: 8}
+
+		ok, err := balance.Hold(ctx, "g1", "r1", 100, 20)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(ok, convey.ShouldBeTrue)
+
+		// a retried attempt does not settle the request
+		consume.Consume(ctx, fake, http.StatusTooManyRequests, m, relaymodel.Usage{}, price, "", "", 0, nil, false)
+		held, err := balance.GetHeldAmount(ctx, "g1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(held, convey.ShouldEqual, 20)
+
+		// the downstream result consumes the actual amount and frees the hold
+		consume.Consume(ctx, fake, http.StatusOK, m, usage, price, "", "", 1, nil, true)
+		held, err = balance.GetHeldAmount(ctx, "g1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(held, convey.ShouldEqual, 0)
+		convey.So(fake.consumed, convey.ShouldResemble, map[string]float64{"r1:1": 6})
+	})
+}
@@ -85,6 +85,14 @@ func GetRequestBody(req *http.Request) ([]byte, error) {
 	return buf, nil
 }
 
+// SetRequestBody replaces the request body and the cached body returned by GetRequestBody
+func SetRequestBody(req *http.Request, body []byte) {
+	bufCtx := context.WithValue(req.Context(), RequestBodyKey{}, body)
+	*req = *req.WithContext(bufCtx)
+	req.Body = io.NopCloser(bytes.NewBuffer(body))
+	req.ContentLength = int64(len(body))
+}
+
 func UnmarshalBodyReusable(req *http.Request, v any) error {
 	requestBody, err := GetRequestBody(req)
 	if err != nil {
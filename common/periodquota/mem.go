@@ -0,0 +1,66 @@
+package periodquota
+
+import (
+	"sync"
+	"time"
+)
+
+type memoryEntry struct {
+	usage     Usage
+	expiresAt time.Time
+}
+
+type inMemoryCounter struct {
+	mu      sync.Mutex
+	entries map[string]*memoryEntry
+}
+
+func newInMemoryCounter() *inMemoryCounter {
+	c := &inMemoryCounter{
+		entries: make(map[string]*memoryEntry),
+	}
+	go c.cleanupExpiredEntries(time.Hour)
+	return c
+}
+
+var memoryCounter = newInMemoryCounter()
+
+func (c *inMemoryCounter) get(key string) Usage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		return e.usage
+	}
+	return Usage{}
+}
+
+func (c *inMemoryCounter) add(key string, periodEnd time.Time, amount float64, tokens int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		e = &memoryEntry{expiresAt: periodEnd}
+		c.entries[key] = e
+	}
+	if amount > 0 {
+		e.usage.Amount += amount
+	}
+	if tokens > 0 {
+		e.usage.Tokens += tokens
+	}
+}
+
+func (c *inMemoryCounter) cleanupExpiredEntries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now()
+		c.mu.Lock()
+		for key, e := range c.entries {
+			if now.After(e.expiresAt) {
+				delete(c.entries, key)
+			}
+		}
+		c.mu.Unlock()
+	}
+}
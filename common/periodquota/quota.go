@@ -0,0 +1,104 @@
+package periodquota
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/model"
+)
+
+// Usage is the amount and the tokens used by a subject in a period
+type Usage struct {
+	Amount float64
+	Tokens int64
+}
+
+// Remaining is the state of a periodic quota in the current period
+type Remaining struct {
+	Period     string    `json:"period"`
+	ResetAt    time.Time `json:"reset_at"`
+	Amount     float64   `json:"amount,omitempty"`
+	UsedAmount float64   `json:"used_amount"`
+	Tokens     int64     `json:"tokens,omitempty"`
+	UsedTokens int64     `json:"used_tokens"`
+}
+
+func (r *Remaining) Exhausted() bool {
+	return (r.Amount > 0 && r.UsedAmount >= r.Amount) ||
+		(r.Tokens > 0 && r.UsedTokens >= r.Tokens)
+}
+
+// RemainingAmount is the amount left in the period, -1 is unlimited
+func (r *Remaining) RemainingAmount() float64 {
+	if r.Amount <= 0 {
+		return -1
+	}
+	return max(r.Amount-r.UsedAmount, 0)
+}
+
+func TokenSubject(id int) string {
+	return fmt.Sprintf("token:%d", id)
+}
+
+func GroupSubject(id string) string {
+	return "group:" + id
+}
+
+func counterKey(subject, period string, start time.Time) string {
+	return fmt.Sprintf("periodic_quota:%s:%s:%d", subject, period, start.Unix())
+}
+
+// GetRemaining returns the quotas of the subject in their current periods
+func GetRemaining(ctx context.Context, subject string, quotas model.PeriodicQuotas) ([]Remaining, error) {
+	if len(quotas) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	remaining := make([]Remaining, 0, len(quotas))
+	for _, quota := range quotas {
+		start, end := quota.PeriodRange(now)
+		var (
+			usage Usage
+			err   error
+		)
+		if common.RedisEnabled {
+			usage, err = redisGetUsage(ctx, counterKey(subject, quota.Period, start))
+		} else {
+			usage = memoryCounter.get(counterKey(subject, quota.Period, start))
+		}
+		if err != nil {
+			return nil, err
+		}
+		remaining = append(remaining, Remaining{
+			Period:     quota.Period,
+			ResetAt:    end,
+			Amount:     quota.Amount,
+			UsedAmount: usage.Amount,
+			Tokens:     quota.Tokens,
+			UsedTokens: usage.Tokens,
+		})
+	}
+	return remaining, nil
+}
+
+// Record adds the usage of a request made at the time to the counters of the periods of the quotas of the subject,
+// the counters of a period expire after it ends
+func Record(ctx context.Context, subject string, quotas model.PeriodicQuotas, requestAt time.Time, amount float64, tokens int64) error {
+	if len(quotas) == 0 || (amount <= 0 && tokens <= 0) {
+		return nil
+	}
+	for _, quota := range quotas {
+		start, end := quota.PeriodRange(requestAt)
+		key := counterKey(subject, quota.Period, start)
+		if common.RedisEnabled {
+			if err := redisAddUsage(ctx, key, end, amount, tokens); err != nil {
+				return err
+			}
+			continue
+		}
+		memoryCounter.add(key, end, amount, tokens)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package periodquota
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/labring/aiproxy/common"
+)
+
+const (
+	fieldAmount = "amount"
+	fieldTokens = "tokens"
+)
+
+func redisGetUsage(ctx context.Context, key string) (Usage, error) {
+	values, err := common.RDB.HMGet(ctx, key, fieldAmount, fieldTokens).Result()
+	if err != nil {
+		return Usage{}, err
+	}
+	var usage Usage
+	if s, ok := values[0].(string); ok {
+		usage.Amount, _ = strconv.ParseFloat(s, 64)
+	}
+	if s, ok := values[1].(string); ok {
+		usage.Tokens, _ = strconv.ParseInt(s, 10, 64)
+	}
+	return usage, nil
+}
+
+func redisAddUsage(ctx context.Context, key string, periodEnd time.Time, amount float64, tokens int64) error {
+	pipe := common.RDB.Pipeline()
+	if amount > 0 {
+		pipe.HIncrByFloat(ctx, key, fieldAmount, amount)
+	}
+	if tokens > 0 {
+		pipe.HIncrBy(ctx, key, fieldTokens, tokens)
+	}
+	pipe.ExpireAt(ctx, key, periodEnd.Add(time.Hour))
+	_, err := pipe.Exec(ctx)
+	return err
+}
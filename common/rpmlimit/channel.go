@@ -0,0 +1,135 @@
+package rpmlimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/labring/aiproxy/common"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	channelModelRPMHashKey = "channel_model_rpm_hash:%d:%s"
+	channelModelTPMHashKey = "channel_model_tpm_hash:%d:%s"
+)
+
+// channel quotas are tracked apart from groups so that the group rpm summary never counts them
+var (
+	channelMemoryRateLimiter    = newInMemoryRateLimiter()
+	channelMemoryTokenLimiter   = newInMemoryRateLimiter()
+	tryPushChannelRequestScript = redis.NewScript(tryPushRequestLuaScript)
+	pushChannelTokensScript     = redis.NewScript(pushCountLuaScript)
+)
+
+// tryPushRequestLuaScript records a request only while the accepted requests in the window are below the limit,
+// the check and the push are one script, so concurrent requests never exceed the limit together
+const tryPushRequestLuaScript = `
+local key = KEYS[1]
+local window_seconds = tonumber(ARGV[1])
+local current_time = tonumber(ARGV[2])
+local max_requests = tonumber(ARGV[3])
+local cutoff_slice = current_time - window_seconds
+
+local function parse_count(value)
+    if not value then return 0, 0 end
+    local r, e = value:match("^(%d+):(%d+)$")
+    return tonumber(r) or 0, tonumber(e) or 0
+end
+
+local count = 0
+
+local all_fields = redis.call('HGETALL', key)
+for i = 1, #all_fields, 2 do
+    if tonumber(all_fields[i]) < cutoff_slice then
+        redis.call('HDEL', key, all_fields[i])
+    else
+        local c = parse_count(all_fields[i+1])
+        count = count + c
+    end
+end
+
+if max_requests > 0 and count >= max_requests then
+    return 0
+end
+
+local c, oc = parse_count(redis.call('HGET', key, tostring(current_time)))
+redis.call('HSET', key, current_time, (c+1) .. ":" .. oc)
+redis.call('EXPIRE', key, window_seconds)
+return 1
+`
+
+// pushCountLuaScript adds a count to the current second of the window and returns the sum of the window
+const pushCountLuaScript = `
+local key = KEYS[1]
+local window_seconds = tonumber(ARGV[1])
+local current_time = tonumber(ARGV[2])
+local count = tonumber(ARGV[3])
+local cutoff_slice = current_time - window_seconds
+
+if count > 0 then
+    redis.call('HINCRBY', key, current_time, count)
+    redis.call('EXPIRE', key, window_seconds)
+end
+
+local total = 0
+
+local all_fields = redis.call('HGETALL', key)
+for i = 1, #all_fields, 2 do
+    if tonumber(all_fields[i]) < cutoff_slice then
+        redis.call('HDEL', key, all_fields[i])
+    else
+        total = total + (tonumber(all_fields[i+1]) or 0)
+    end
+end
+
+return total
+`
+
+// TryPushChannelRequest records a request sent to the channel model if the channel is below its rpm quota,
+// it reports false without recording the request when the quota is reached, 0 means unlimited,
+// falling back to the memory limiter when redis is unavailable
+func TryPushChannelRequest(ctx context.Context, channelID int, model string, maxRequestNum int64, duration time.Duration) bool {
+	if common.RedisEnabled {
+		accepted, err := tryPushChannelRequestScript.Run(
+			ctx,
+			common.RDB,
+			[]string{fmt.Sprintf(channelModelRPMHashKey, channelID, model)},
+			duration.Seconds(),
+			time.Now().Unix(),
+			maxRequestNum,
+		).Int64()
+		if err == nil {
+			return accepted == 1
+		}
+		log.Error("redis try push channel request error: " + err.Error())
+	}
+	return channelMemoryRateLimiter.tryPushRequest(strconv.Itoa(channelID), model, maxRequestNum, duration)
+}
+
+// PushChannelTokens records the tokens used by a request of the channel model and returns the tokens in the window,
+// falling back to the memory limiter when redis is unavailable
+func PushChannelTokens(ctx context.Context, channelID int, model string, tokens int64, duration time.Duration) int64 {
+	if common.RedisEnabled {
+		total, err := pushChannelTokensScript.Run(
+			ctx,
+			common.RDB,
+			[]string{fmt.Sprintf(channelModelTPMHashKey, channelID, model)},
+			duration.Seconds(),
+			time.Now().Unix(),
+			tokens,
+		).Int64()
+		if err == nil {
+			return total
+		}
+		log.Error("redis push channel tokens error: " + err.Error())
+	}
+	return channelMemoryTokenLimiter.pushCount(strconv.Itoa(channelID), model, tokens, duration)
+}
+
+// GetChannelTokens returns the tokens used by the channel model in the window
+func GetChannelTokens(ctx context.Context, channelID int, model string, duration time.Duration) int64 {
+	return PushChannelTokens(ctx, channelID, model, 0, duration)
+}
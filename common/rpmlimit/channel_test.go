@@ -0,0 +1,88 @@
+package rpmlimit_test
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/rpmlimit"
+	"github.com/redis/go-redis/v9"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func testChannelRequest(ctx context.Context, channelID int) {
+	// the requests are only recorded below the limit
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID, "gpt-4o", 2, time.Minute), convey.ShouldBeTrue)
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID, "gpt-4o", 2, time.Minute), convey.ShouldBeTrue)
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID, "gpt-4o", 2, time.Minute), convey.ShouldBeFalse)
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID, "gpt-4o", 3, time.Minute), convey.ShouldBeTrue)
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID, "gpt-4o", 3, time.Minute), convey.ShouldBeFalse)
+	// the models and the channels have their own windows, 0 is unlimited
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID, "gpt-4o-mini", 1, time.Minute), convey.ShouldBeTrue)
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID+1, "gpt-4o", 1, time.Minute), convey.ShouldBeTrue)
+	for range 10 {
+		convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID, "gpt-4o", 0, time.Minute), convey.ShouldBeTrue)
+	}
+
+	// the check and the push are atomic, concurrent requests never exceed the limit together
+	var accepted atomic.Int64
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if rpmlimit.TryPushChannelRequest(ctx, channelID+2, "gpt-4o", 10, time.Minute) {
+				accepted.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	convey.So(accepted.Load(), convey.ShouldEqual, 10)
+
+	// the requests leave the window once it passed
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID+3, "gpt-4o", 1, time.Second), convey.ShouldBeTrue)
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID+3, "gpt-4o", 1, time.Second), convey.ShouldBeFalse)
+	time.Sleep(2 * time.Second)
+	convey.So(rpmlimit.TryPushChannelRequest(ctx, channelID+3, "gpt-4o", 1, time.Second), convey.ShouldBeTrue)
+}
+
+func testChannelTokens(ctx context.Context, channelID int) {
+	convey.So(rpmlimit.GetChannelTokens(ctx, channelID, "gpt-4o", time.Minute), convey.ShouldEqual, 0)
+	convey.So(rpmlimit.PushChannelTokens(ctx, channelID, "gpt-4o", 100, time.Minute), convey.ShouldEqual, 100)
+	convey.So(rpmlimit.PushChannelTokens(ctx, channelID, "gpt-4o", 250, time.Minute), convey.ShouldEqual, 350)
+	convey.So(rpmlimit.GetChannelTokens(ctx, channelID, "gpt-4o", time.Minute), convey.ShouldEqual, 350)
+	convey.So(rpmlimit.GetChannelTokens(ctx, channelID, "gpt-4o-mini", time.Minute), convey.ShouldEqual, 0)
+	convey.So(rpmlimit.GetChannelTokens(ctx, channelID+1, "gpt-4o", time.Minute), convey.ShouldEqual, 0)
+
+	// the tokens leave the window once it passed
+	convey.So(rpmlimit.PushChannelTokens(ctx, channelID+2, "gpt-4o", 100, time.Second), convey.ShouldEqual, 100)
+	time.Sleep(2 * time.Second)
+	convey.So(rpmlimit.GetChannelTokens(ctx, channelID+2, "gpt-4o", time.Second), convey.ShouldEqual, 0)
+}
+
+func TestChannelQuota(t *testing.T) {
+	convey.Convey("TestChannelQuota", t, func() {
+		ctx := context.Background()
+
+		convey.Convey("memory", func() {
+			testChannelRequest(ctx, 100)
+			testChannelTokens(ctx, 200)
+		})
+
+		convey.Convey("redis", func() {
+			mr := miniredis.RunT(t)
+			common.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			common.RedisEnabled = true
+			defer func() {
+				common.RedisEnabled = false
+			}()
+
+			testChannelRequest(ctx, 300)
+			testChannelTokens(ctx, 400)
+		})
+	})
+}
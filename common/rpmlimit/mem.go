@@ -91,6 +91,68 @@ func (m *InMemoryRateLimiter) pushRequest(group, model string, maxReq int64, dur
 	return normalCount, overCount
 }
 
+// tryPushRequest records a request only while the accepted requests in the window are below maxReq, 0 means unlimited
+func (m *InMemoryRateLimiter) tryPushRequest(group, model string, maxReq int64, duration time.Duration) bool {
+	e := m.getEntry(group, model)
+
+	e.Lock()
+	defer e.Unlock()
+
+	now := time.Now()
+
+	e.lastAccess.Store(now)
+
+	windowStart := now.Unix()
+	normalCount, _ := m.cleanupAndCount(e, windowStart-int64(duration.Seconds()))
+	if maxReq > 0 && normalCount >= maxReq {
+		return false
+	}
+
+	wc, exists := e.windows[windowStart]
+	if !exists {
+		wc = &windowCounts{}
+		e.windows[windowStart] = wc
+	}
+	wc.normal++
+	return true
+}
+
+// pushCount adds count to the current second of the window and returns the sum of the window
+func (m *InMemoryRateLimiter) pushCount(group, model string, count int64, duration time.Duration) int64 {
+	e := m.getEntry(group, model)
+
+	e.Lock()
+	defer e.Unlock()
+
+	now := time.Now()
+
+	e.lastAccess.Store(now)
+
+	windowStart := now.Unix()
+	normalCount, _ := m.cleanupAndCount(e, windowStart-int64(duration.Seconds()))
+	if count <= 0 {
+		return normalCount
+	}
+
+	wc, exists := e.windows[windowStart]
+	if !exists {
+		wc = &windowCounts{}
+		e.windows[windowStart] = wc
+	}
+	wc.normal += count
+	return normalCount + count
+}
+
+func (m *InMemoryRateLimiter) peekRequest(group, model string, duration time.Duration) int64 {
+	e := m.getEntry(group, model)
+
+	e.Lock()
+	defer e.Unlock()
+
+	normalCount, _ := m.cleanupAndCount(e, time.Now().Unix()-int64(duration.Seconds()))
+	return normalCount
+}
+
 func (m *InMemoryRateLimiter) getRPM(group, model string, duration time.Duration) int {
 	total := 0
 	cutoff := time.Now().Unix() - int64(duration.Seconds())
@@ -144,6 +206,10 @@ func MemoryPushRequest(group, model string, maxReq int64, duration time.Duration
 	return memoryRateLimiter.pushRequest(group, model, maxReq, duration)
 }
 
+func MemoryPeekRequest(group, model string, duration time.Duration) int64 {
+	return memoryRateLimiter.peekRequest(group, model, duration)
+}
+
 func MemoryRateLimit(group, model string, maxReq int64, duration time.Duration) bool {
 	current, _ := memoryRateLimiter.pushRequest(group, model, maxReq, duration)
 	return current <= maxReq
@@ -98,9 +98,29 @@ end
 return total
 `
 
+const peekRequestCountLuaScript = `
+local key = KEYS[1]
+local window_seconds = tonumber(ARGV[1])
+local current_time = tonumber(ARGV[2])
+local cutoff_slice = current_time - window_seconds
+
+local count = 0
+
+local all_fields = redis.call('HGETALL', key)
+for i = 1, #all_fields, 2 do
+    if tonumber(all_fields[i]) >= cutoff_slice then
+        local r = all_fields[i+1]:match("^(%d+):%d+$")
+        count = count + (tonumber(r) or 0)
+    end
+end
+
+return count
+`
+
 var (
-	pushRequestScript     = redis.NewScript(pushRequestLuaScript)
-	getRequestCountScript = redis.NewScript(getRequestCountLuaScript)
+	pushRequestScript      = redis.NewScript(pushRequestLuaScript)
+	getRequestCountScript  = redis.NewScript(getRequestCountLuaScript)
+	peekRequestCountScript = redis.NewScript(peekRequestCountLuaScript)
 )
 
 func redisGetRPM(ctx context.Context, group, model string) (int64, error) {
@@ -157,6 +177,16 @@ func redisPushRequest(ctx context.Context, group, model string, maxRequestNum in
 	return countInt, overLimitCountInt, nil
 }
 
+func redisPeekRequest(ctx context.Context, group, model string, duration time.Duration) (int64, error) {
+	return peekRequestCountScript.Run(
+		ctx,
+		common.RDB,
+		[]string{fmt.Sprintf(groupModelRPMHashKey, group, model)},
+		duration.Seconds(),
+		time.Now().Unix(),
+	).Int64()
+}
+
 func redisRateLimitRequest(ctx context.Context, group, model string, maxRequestNum int64, duration time.Duration) (bool, error) {
 	count, _, err := PushRequest(ctx, group, model, maxRequestNum, duration)
 	if err != nil {
@@ -184,6 +214,18 @@ func PushRequestAnyWay(ctx context.Context, group, model string, maxRequestNum i
 	return MemoryPushRequest(group, model, maxRequestNum, duration)
 }
 
+// PeekRequest returns the accepted requests of the window without recording a new one
+func PeekRequest(ctx context.Context, group, model string, duration time.Duration) int64 {
+	if common.RedisEnabled {
+		count, err := redisPeekRequest(ctx, group, model, duration)
+		if err == nil {
+			return count
+		}
+		log.Error("redis peek request error: " + err.Error())
+	}
+	return MemoryPeekRequest(group, model, duration)
+}
+
 func RateLimit(ctx context.Context, group, model string, maxRequestNum int64, duration time.Duration) (bool, error) {
 	if maxRequestNum == 0 {
 		return true, nil
@@ -0,0 +1,144 @@
+package waitqueue
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrQueueFull = errors.New("wait queue is full")
+
+type waiter struct {
+	head chan struct{}
+}
+
+// Queue holds waiting requests in fifo order per key,
+// only the head of a key polls for capacity so later requests can not overtake it
+type Queue struct {
+	mu      sync.Mutex
+	waiters map[string][]*waiter
+
+	admitted atomic.Int64
+	rejected atomic.Int64
+	timeout  atomic.Int64
+}
+
+func New() *Queue {
+	return &Queue{
+		waiters: make(map[string][]*waiter),
+	}
+}
+
+func (q *Queue) enqueue(key string, maxLength int) (*waiter, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiters := q.waiters[key]
+	if maxLength > 0 && len(waiters) >= maxLength {
+		return nil, ErrQueueFull
+	}
+	w := &waiter{head: make(chan struct{})}
+	if len(waiters) == 0 {
+		close(w.head)
+	}
+	q.waiters[key] = append(waiters, w)
+	return w, nil
+}
+
+func (q *Queue) dequeue(key string, w *waiter) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiters := q.waiters[key]
+	for i, v := range waiters {
+		if v != w {
+			continue
+		}
+		waiters = append(waiters[:i], waiters[i+1:]...)
+		if i == 0 && len(waiters) > 0 {
+			close(waiters[0].head)
+		}
+		break
+	}
+	if len(waiters) == 0 {
+		delete(q.waiters, key)
+		return
+	}
+	q.waiters[key] = waiters
+}
+
+// Wait queues the caller behind the earlier waiters of the key,
+// once at the head it calls try every interval until try succeeds or ctx is done
+func (q *Queue) Wait(ctx context.Context, key string, maxLength int, interval time.Duration, try func() bool) error {
+	w, err := q.enqueue(key, maxLength)
+	if err != nil {
+		q.rejected.Add(1)
+		return err
+	}
+	defer q.dequeue(key, w)
+
+	select {
+	case <-w.head:
+	case <-ctx.Done():
+		q.timeout.Add(1)
+		return ctx.Err()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if try() {
+			q.admitted.Add(1)
+			return nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			q.timeout.Add(1)
+			return ctx.Err()
+		}
+	}
+}
+
+type KeyStats struct {
+	Key   string `json:"key"`
+	Depth int    `json:"depth"`
+}
+
+type Stats struct {
+	Keys     []KeyStats `json:"keys"`
+	Depth    int        `json:"depth"`
+	Admitted int64      `json:"admitted"`
+	Rejected int64      `json:"rejected"`
+	Timeout  int64      `json:"timeout"`
+}
+
+// Stats returns the current queue depth of each key and the counters since start
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	keys := make([]KeyStats, 0, len(q.waiters))
+	depth := 0
+	for key, waiters := range q.waiters {
+		keys = append(keys, KeyStats{Key: key, Depth: len(waiters)})
+		depth += len(waiters)
+	}
+	q.mu.Unlock()
+
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Depth != keys[j].Depth {
+			return keys[i].Depth > keys[j].Depth
+		}
+		return keys[i].Key < keys[j].Key
+	})
+
+	return Stats{
+		Keys:     keys,
+		Depth:    depth,
+		Admitted: q.admitted.Load(),
+		Rejected: q.rejected.Load(),
+		Timeout:  q.timeout.Load(),
+	}
+}
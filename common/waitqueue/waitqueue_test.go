@@ -0,0 +1,195 @@
+package waitqueue_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/common/waitqueue"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+const interval = time.Millisecond
+
+// waitDepth blocks until the key has depth waiters, so the waiters are queued in a known order
+func waitDepth(q *waitqueue.Queue, key string, depth int) {
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		for _, k := range q.Stats().Keys {
+			if k.Key == key && k.Depth == depth {
+				return
+			}
+		}
+		time.Sleep(interval)
+	}
+	panic("wait queue depth not reached")
+}
+
+func TestWaitFIFO(t *testing.T) {
+	convey.Convey("TestWaitFIFO", t, func() {
+		q := waitqueue.New()
+		var (
+			capacity atomic.Int64
+			mu       sync.Mutex
+			order    []int
+			wg       sync.WaitGroup
+		)
+		// try records the admission order itself, the waiter returns after the next one is released
+		try := func(i int) func() bool {
+			return func() bool {
+				if capacity.Add(-1) < 0 {
+					capacity.Add(1)
+					return false
+				}
+				mu.Lock()
+				order = append(order, i)
+				mu.Unlock()
+				return true
+			}
+		}
+
+		for i := range 3 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_ = q.Wait(context.Background(), "a", 0, interval, try(i))
+			}()
+			waitDepth(q, "a", i+1)
+		}
+
+		// other keys are not queued behind a blocked key
+		convey.So(q.Wait(context.Background(), "b", 0, interval, func() bool { return true }), convey.ShouldBeNil)
+
+		// the later waiters do not poll, so capacity freed at once is taken in queue order
+		capacity.Store(3)
+		wg.Wait()
+
+		convey.So(order, convey.ShouldResemble, []int{0, 1, 2})
+		stats := q.Stats()
+		convey.So(stats.Depth, convey.ShouldEqual, 0)
+		convey.So(stats.Keys, convey.ShouldBeEmpty)
+		convey.So(stats.Admitted, convey.ShouldEqual, 4)
+		convey.So(stats.Rejected, convey.ShouldEqual, 0)
+		convey.So(stats.Timeout, convey.ShouldEqual, 0)
+	})
+}
+
+func TestWaitTimeout(t *testing.T) {
+	convey.Convey("TestWaitTimeout", t, func() {
+		q := waitqueue.New()
+		never := func() bool { return false }
+
+		release := make(chan struct{})
+		done := make(chan error, 1)
+		go func() {
+			done <- q.Wait(context.Background(), "a", 0, interval, func() bool {
+				select {
+				case <-release:
+					return true
+				default:
+					return false
+				}
+			})
+		}()
+		waitDepth(q, "a", 1)
+
+		convey.Convey("a waiter behind the head times out", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := q.Wait(ctx, "a", 0, interval, func() bool { return true })
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+
+			// the timed out waiter left the queue
+			convey.So(q.Stats().Depth, convey.ShouldEqual, 1)
+
+			close(release)
+			convey.So(<-done, convey.ShouldBeNil)
+			stats := q.Stats()
+			convey.So(stats.Depth, convey.ShouldEqual, 0)
+			convey.So(stats.Admitted, convey.ShouldEqual, 1)
+			convey.So(stats.Timeout, convey.ShouldEqual, 1)
+		})
+
+		convey.Convey("the head times out and the next waiter takes its place", func() {
+			close(release)
+			convey.So(<-done, convey.ShouldBeNil)
+
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			err := q.Wait(ctx, "a", 0, interval, never)
+			convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+
+			convey.So(q.Wait(context.Background(), "a", 0, interval, func() bool { return true }), convey.ShouldBeNil)
+			stats := q.Stats()
+			convey.So(stats.Depth, convey.ShouldEqual, 0)
+			convey.So(stats.Admitted, convey.ShouldEqual, 2)
+			convey.So(stats.Timeout, convey.ShouldEqual, 1)
+		})
+	})
+}
+
+func TestWaitQueueFull(t *testing.T) {
+	convey.Convey("TestWaitQueueFull", t, func() {
+		q := waitqueue.New()
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan error, 2)
+		for i := range 2 {
+			go func() {
+				done <- q.Wait(ctx, "a", 2, interval, func() bool { return false })
+			}()
+			waitDepth(q, "a", i+1)
+		}
+
+		err := q.Wait(context.Background(), "a", 2, interval, func() bool { return true })
+		convey.So(err, convey.ShouldEqual, waitqueue.ErrQueueFull)
+
+		// the limit is per key
+		convey.So(q.Wait(context.Background(), "b", 2, interval, func() bool { return true }), convey.ShouldBeNil)
+
+		stats := q.Stats()
+		convey.So(stats.Depth, convey.ShouldEqual, 2)
+		convey.So(stats.Keys, convey.ShouldResemble, []waitqueue.KeyStats{{Key: "a", Depth: 2}})
+		convey.So(stats.Rejected, convey.ShouldEqual, 1)
+		convey.So(stats.Admitted, convey.ShouldEqual, 1)
+
+		cancel()
+		convey.So(errors.Is(<-done, context.Canceled), convey.ShouldBeTrue)
+		convey.So(errors.Is(<-done, context.Canceled), convey.ShouldBeTrue)
+		stats = q.Stats()
+		convey.So(stats.Depth, convey.ShouldEqual, 0)
+		convey.So(stats.Timeout, convey.ShouldEqual, 2)
+	})
+}
+
+func TestStatsOrder(t *testing.T) {
+	convey.Convey("TestStatsOrder", t, func() {
+		q := waitqueue.New()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		var wg sync.WaitGroup
+		for key, depth := range map[string]int{"a": 1, "b": 2, "c": 2} {
+			for i := range depth {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_ = q.Wait(ctx, key, 0, interval, func() bool { return false })
+				}()
+				waitDepth(q, key, i+1)
+			}
+		}
+
+		stats := q.Stats()
+		convey.So(stats.Depth, convey.ShouldEqual, 5)
+		convey.So(stats.Keys, convey.ShouldResemble, []waitqueue.KeyStats{
+			{Key: "b", Depth: 2},
+			{Key: "c", Depth: 2},
+			{Key: "a", Depth: 1},
+		})
+
+		cancel()
+		wg.Wait()
+	})
+}
@@ -24,6 +24,13 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 		return 0, fmt.Errorf("invalid channel type: %d, channel: %s(%d)", channel.Type, channel.Name, channel.ID)
 	}
 	if getBalance, ok := adaptorI.(adaptor.Balancer); ok {
+		keys, err := model.GetChannelKeys(channel.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to get channel[%d] %s(%d) keys: %s", channel.Type, channel.Name, channel.ID, err.Error())
+		}
+		if len(keys) > 0 {
+			return updateChannelKeysBalance(getBalance, channel, keys)
+		}
 		balance, err := getBalance.GetBalance(channel)
 		if err != nil && !errors.Is(err, adaptor.ErrGetBalanceNotImplemented) {
 			return 0, fmt.Errorf("failed to get channel[%d] %s(%d) balance: %s", channel.Type, channel.Name, channel.ID, err.Error())
@@ -40,6 +47,49 @@ func updateChannelBalance(channel *model.Channel) (float64, error) {
 	return 0, nil
 }
 
+// updateChannelKeysBalance checks the balance of every enabled key, keys below the threshold are disabled,
+// the channel balance is the sum of the remaining keys
+func updateChannelKeysBalance(getBalance adaptor.Balancer, channel *model.Channel, keys []*model.ChannelKey) (float64, error) {
+	var total float64
+	for _, key := range keys {
+		if key.Status != model.ChannelKeyStatusEnabled {
+			continue
+		}
+		keyChannel := *channel
+		keyChannel.Key = key.Key
+		balance, err := getBalance.GetBalance(&keyChannel)
+		if err != nil {
+			if errors.Is(err, adaptor.ErrGetBalanceNotImplemented) {
+				return 0, nil
+			}
+			notify.Error(
+				fmt.Sprintf("check channel[%d] %s(%d) key %d balance error", channel.Type, channel.Name, channel.ID, key.ID),
+				err.Error(),
+			)
+			continue
+		}
+		if err := model.UpdateChannelKeyBalance(key.ID, balance); err != nil {
+			return 0, fmt.Errorf("failed to update channel [%d] %s(%d) key %d balance: %s", channel.Type, channel.Name, channel.ID, key.ID, err.Error())
+		}
+		if balance < channel.GetBalanceThreshold() {
+			reason := fmt.Sprintf("balance is less than threshold: %f", balance)
+			disabled, err := model.DisableChannelKey(key.ID, reason)
+			if err != nil {
+				return 0, fmt.Errorf("failed to disable channel [%d] %s(%d) key %d: %s", channel.Type, channel.Name, channel.ID, key.ID, err.Error())
+			}
+			if disabled {
+				notify.Error(fmt.Sprintf("channel[%d] %s(%d) key %d is auto disabled", channel.Type, channel.Name, channel.ID, key.ID), reason)
+			}
+			continue
+		}
+		total += balance
+	}
+	if err := channel.UpdateBalance(total); err != nil {
+		return 0, fmt.Errorf("failed to update channel [%d] %s(%d) balance: %s", channel.Type, channel.Name, channel.ID, err.Error())
+	}
+	return total, nil
+}
+
 // UpdateChannelBalance godoc
 //
 //	@Summary		Update channel balance
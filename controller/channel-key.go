@@ -0,0 +1,170 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+)
+
+// GetChannelKeys godoc
+//
+//	@Summary		Get channel keys
+//	@Description	Returns all keys of a channel with their secrets masked
+//	@Tags			channel
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id	path		int	true	"Channel ID"
+//	@Success		200	{object}	middleware.APIResponse{data=[]model.ChannelKey}
+//	@Router			/api/channel/{id}/keys [get]
+func GetChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	keys, err := model.GetChannelKeys(id)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, model.MaskChannelKeys(keys))
+}
+
+// AddChannelKeysRequest represents the request body for adding keys to a channel
+type AddChannelKeysRequest struct {
+	Keys []string `json:"keys"`
+}
+
+// AddChannelKeys godoc
+//
+//	@Summary		Add channel keys
+//	@Description	Adds keys to the key pool of a channel
+//	@Tags			channel
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id		path		int						true	"Channel ID"
+//	@Param			keys	body		AddChannelKeysRequest	true	"Keys"
+//	@Success		200		{object}	middleware.APIResponse{data=[]model.ChannelKey}
+//	@Router			/api/channel/{id}/keys [post]
+func AddChannelKeys(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	req := AddChannelKeysRequest{}
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	keys := make([]string, 0, len(req.Keys))
+	for _, key := range req.Keys {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		middleware.ErrorResponse(c, http.StatusOK, "keys is empty")
+		return
+	}
+
+	channel, err := model.GetChannelByID(id)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	for _, key := range keys {
+		if err := validateChannelKey(channel.Type, channel.Name, key); err != nil {
+			middleware.ErrorResponse(c, http.StatusOK, err.Error())
+			return
+		}
+	}
+
+	channelKeys, err := model.AddChannelKeys(id, keys)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, model.MaskChannelKeys(channelKeys))
+}
+
+// DeleteChannelKey godoc
+//
+//	@Summary		Delete a channel key
+//	@Description	Removes a key from the key pool of a channel
+//	@Tags			channel
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id		path		int	true	"Channel ID"
+//	@Param			key_id	path		int	true	"Channel key ID"
+//	@Success		200		{object}	middleware.APIResponse
+//	@Router			/api/channel/{id}/keys/{key_id} [delete]
+func DeleteChannelKey(c *gin.Context) {
+	id, keyID, err := parseChannelKeyParams(c)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	err = model.DeleteChannelKey(id, keyID)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, nil)
+}
+
+// UpdateChannelKeyStatus godoc
+//
+//	@Summary		Update channel key status
+//	@Description	Enables or disables a key of a channel
+//	@Tags			channel
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id		path		int							true	"Channel ID"
+//	@Param			key_id	path		int							true	"Channel key ID"
+//	@Param			status	body		UpdateChannelStatusRequest	true	"Status information"
+//	@Success		200		{object}	middleware.APIResponse
+//	@Router			/api/channel/{id}/keys/{key_id}/status [post]
+func UpdateChannelKeyStatus(c *gin.Context) {
+	id, keyID, err := parseChannelKeyParams(c)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	status := UpdateChannelStatusRequest{}
+	err = c.ShouldBindJSON(&status)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	if status.Status != model.ChannelKeyStatusEnabled &&
+		status.Status != model.ChannelKeyStatusDisabled {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid status")
+		return
+	}
+	err = model.UpdateChannelKeyStatus(id, keyID, status.Status)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, nil)
+}
+
+func parseChannelKeyParams(c *gin.Context) (int, int, error) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return 0, 0, err
+	}
+	keyID, err := strconv.Atoi(c.Param("key_id"))
+	if err != nil {
+		return 0, 0, errors.New("invalid key id")
+	}
+	return id, keyID, nil
+}
@@ -1,7 +1,6 @@
 package controller
 
 import (
-	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -19,11 +18,10 @@ import (
 	"github.com/labring/aiproxy/common"
 	"github.com/labring/aiproxy/common/notify"
 	"github.com/labring/aiproxy/common/render"
-	"github.com/labring/aiproxy/common/trylock"
 	"github.com/labring/aiproxy/middleware"
 	"github.com/labring/aiproxy/model"
-	"github.com/labring/aiproxy/monitor"
 	"github.com/labring/aiproxy/relay/channeltype"
+	"github.com/labring/aiproxy/relay/controller"
 	"github.com/labring/aiproxy/relay/meta"
 	"github.com/labring/aiproxy/relay/mode"
 	"github.com/labring/aiproxy/relay/utils"
@@ -54,8 +52,7 @@ func guessModelConfig(model string) *model.ModelConfig {
 	return nil
 }
 
-// testSingleModel tests a single model in the channel
-func testSingleModel(mc *model.ModelCaches, channel *model.Channel, modelName string) (*model.ChannelTest, error) {
+func getTestModelConfig(mc *model.ModelCaches, modelName string) (*model.ModelConfig, error) {
 	modelConfig, ok := mc.ModelConfig.GetModelConfig(modelName)
 	if !ok {
 		return nil, errors.New(modelName + " model config not found")
@@ -66,24 +63,20 @@ func testSingleModel(mc *model.ModelCaches, channel *model.Channel, modelName st
 			modelConfig = newModelConfig
 		}
 	}
+	return modelConfig, nil
+}
 
-	if modelConfig.ExcludeFromTests {
-		return &model.ChannelTest{
-			TestAt:      time.Now(),
-			Model:       modelName,
-			ActualModel: modelName,
-			Success:     true,
-			Code:        http.StatusOK,
-			Mode:        modelConfig.Type,
-			ChannelName: channel.Name,
-			ChannelType: channel.Type,
-			ChannelID:   channel.ID,
-		}, nil
-	}
-
+// doChannelTest relays a test request of the model to the channel,
+// with the key the channel rotation picks or with the given key
+func doChannelTest(
+	channel *model.Channel,
+	modelName string,
+	modelConfig *model.ModelConfig,
+	key *model.ChannelKey,
+) (*meta.Meta, *httptest.ResponseRecorder, *controller.HandleResult, error) {
 	body, m, err := utils.BuildRequest(modelConfig)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
 
 	w := httptest.NewRecorder()
@@ -102,7 +95,41 @@ func testSingleModel(mc *model.ModelCaches, channel *model.Channel, modelName st
 		modelConfig,
 		meta.WithRequestID(channelTestRequestID),
 	)
-	result := relayHandler(meta, newc)
+	if key != nil {
+		meta.Channel.Key = key.Key
+		meta.Channel.KeyID = key.ID
+	} else {
+		useChannelKey(meta, channel)
+	}
+	return meta, w, handleWithChannelKey(meta, newc, relayHandler), nil
+}
+
+// testSingleModel tests a single model in the channel with the key the channel rotation picks,
+// the key is disabled when the upstream rejects it
+func testSingleModel(mc *model.ModelCaches, channel *model.Channel, modelName string) (*model.ChannelTest, error) {
+	modelConfig, err := getTestModelConfig(mc, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	if modelConfig.ExcludeFromTests {
+		return &model.ChannelTest{
+			TestAt:      time.Now(),
+			Model:       modelName,
+			ActualModel: modelName,
+			Success:     true,
+			Code:        http.StatusOK,
+			Mode:        modelConfig.Type,
+			ChannelName: channel.Name,
+			ChannelType: channel.Type,
+			ChannelID:   channel.ID,
+		}, nil
+	}
+
+	meta, w, result, err := doChannelTest(channel, modelName, modelConfig, nil)
+	if err != nil {
+		return nil, err
+	}
 	success := result.Error == nil
 	var respStr string
 	var code int
@@ -118,6 +145,9 @@ func testSingleModel(mc *model.ModelCaches, channel *model.Channel, modelName st
 	} else {
 		respStr = result.Error.JSONOrEmpty()
 		code = result.Error.StatusCode
+		if meta.Channel.KeyID != 0 && !channelHasPermission(code) {
+			disableTestedChannelKey(channel, meta.Channel.KeyID, respStr)
+		}
 	}
 
 	return channel.UpdateModelTest(
@@ -132,6 +162,56 @@ func testSingleModel(mc *model.ModelCaches, channel *model.Channel, modelName st
 	)
 }
 
+func disableTestedChannelKey(channel *model.Channel, keyID int, reason string) {
+	disabled, err := model.DisableChannelKey(keyID, reason)
+	if err != nil {
+		log.Errorf("failed to disable channel %s(%d) key %d: %s", channel.Name, channel.ID, keyID, err.Error())
+		return
+	}
+	if disabled {
+		notify.Error(fmt.Sprintf("channel[%d] %s(%d) key %d is auto disabled by test", channel.Type, channel.Name, channel.ID, keyID), reason)
+	}
+}
+
+// recheckDisabledChannelKeys tests the auto disabled keys of the channel with the first testable model,
+// a key that passes is enabled again, keys disabled by an admin have no reason and are left alone
+func recheckDisabledChannelKeys(mc *model.ModelCaches, channel *model.Channel, models []string) {
+	keys, err := model.GetChannelKeys(channel.ID)
+	if err != nil {
+		log.Errorf("failed to get channel %s(%d) keys: %s", channel.Name, channel.ID, err.Error())
+		return
+	}
+	for _, key := range keys {
+		if key.Status != model.ChannelKeyStatusDisabled || key.DisabledReason == "" {
+			continue
+		}
+		for _, modelName := range models {
+			modelConfig, err := getTestModelConfig(mc, modelName)
+			if err != nil || modelConfig.ExcludeFromTests {
+				continue
+			}
+			_, _, result, err := doChannelTest(channel, modelName, modelConfig, key)
+			if err != nil {
+				e := &utils.UnsupportedModelTypeError{}
+				if errors.As(err, &e) {
+					continue
+				}
+				log.Errorf("failed to test channel %s(%d) key %d: %s", channel.Name, channel.ID, key.ID, err.Error())
+				break
+			}
+			if result.Error != nil {
+				break
+			}
+			if err := model.UpdateChannelKeyStatus(channel.ID, key.ID, model.ChannelKeyStatusEnabled); err != nil {
+				log.Errorf("failed to enable channel %s(%d) key %d: %s", channel.Name, channel.ID, key.ID, err.Error())
+				break
+			}
+			log.Infof("channel %s(%d) key %d passed the test and is enabled again", channel.Name, channel.ID, key.ID)
+			break
+		}
+	}
+}
+
 // TestChannel godoc
 //
 //	@Summary		Test channel model
@@ -324,6 +404,8 @@ func TestChannelModels(c *gin.Context) {
 
 	wg.Wait()
 
+	recheckDisabledChannelKeys(mc, channel, models)
+
 	if !hasError.Load() {
 		err := model.ClearLastTestErrorAt(channel.ID)
 		if err != nil {
@@ -431,6 +513,20 @@ func TestAllChannels(c *gin.Context) {
 
 	wg.Wait()
 
+	for _, channel := range newChannels {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(ch *model.Channel) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			recheckDisabledChannelKeys(mc, ch, ch.Models)
+		}(channel)
+	}
+
+	wg.Wait()
+
 	for id, hasError := range hasErrorMap {
 		if !hasError.Load() {
 			err := model.ClearLastTestErrorAt(id)
@@ -447,51 +543,3 @@ func TestAllChannels(c *gin.Context) {
 		})
 	}
 }
-
-func tryTestChannel(channelID int, modelName string) bool {
-	return trylock.Lock(fmt.Sprintf("channel_test_lock:%d:%s", channelID, modelName), 30*time.Second)
-}
-
-func AutoTestBannedModels() {
-	log := log.WithFields(log.Fields{
-		"auto_test_banned_models": "true",
-	})
-	channels, err := monitor.GetAllBannedModelChannels(context.Background())
-	if err != nil {
-		log.Errorf("failed to get banned channels: %s", err.Error())
-		return
-	}
-	if len(channels) == 0 {
-		return
-	}
-
-	mc := model.LoadModelCaches()
-
-	for modelName, ids := range channels {
-		for _, id := range ids {
-			if !tryTestChannel(int(id), modelName) {
-				continue
-			}
-			channel, err := model.LoadChannelByID(int(id))
-			if err != nil {
-				log.Errorf("failed to get channel by model %s: %s", modelName, err.Error())
-				continue
-			}
-			result, err := testSingleModel(mc, channel, modelName)
-			if err != nil {
-				notify.Error(fmt.Sprintf("channel[%d] %s(%d) model %s test failed", channel.Type, channel.Name, channel.ID, modelName), err.Error())
-				continue
-			}
-			if result.Success {
-				notify.Info(fmt.Sprintf("channel[%d] %s(%d) model %s test success", channel.Type, channel.Name, channel.ID, modelName), "unban it")
-				err = monitor.ClearChannelModelErrors(context.Background(), modelName, channel.ID)
-				if err != nil {
-					log.Errorf("clear channel errors failed: %+v", err)
-				}
-			} else {
-				notify.Error(fmt.Sprintf("channel[%d] %s(%d) model %s test failed", channel.Type, channel.Name, channel.ID, modelName),
-					fmt.Sprintf("code: %d, response: %s", result.Code, result.Response))
-			}
-		}
-	}
-}
@@ -0,0 +1,107 @@
+package controller_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/controller"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/mode"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+const testCompletion = `{"id":"1","object":"chat.completion","model":"gpt-4o",` +
+	`"choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],` +
+	`"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+
+// newKeyCheckingUpstream accepts the keys only
+func newKeyCheckingUpstream(keys ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, key := range keys {
+			if r.Header.Get("Authorization") == "Bearer "+key {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(testCompletion))
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error":{"message":"invalid api key","type":"invalid_request_error","code":"invalid_api_key"}}`))
+	}))
+}
+
+func testChannelModels(channelID int) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/channel/"+strconv.Itoa(channelID)+"/models", nil)
+	c.Params = gin.Params{{Key: "id", Value: strconv.Itoa(channelID)}}
+	controller.TestChannelModels(c)
+	convey.So(w.Code, convey.ShouldEqual, http.StatusOK)
+}
+
+func channelKeyStatus(channelID int) map[string]int {
+	keys, err := model.GetChannelKeys(channelID)
+	convey.So(err, convey.ShouldBeNil)
+	status := make(map[string]int, len(keys))
+	for _, key := range keys {
+		status[key.Key] = key.Status
+	}
+	return status
+}
+
+func TestChannelTestKeys(t *testing.T) {
+	convey.Convey("TestChannelTestKeys", t, func() {
+		initTestDB(t)
+		upstream := newKeyCheckingUpstream("sk-good", "sk-recovered", "sk-admin")
+		defer upstream.Close()
+
+		convey.So(model.SaveModelConfig(&model.ModelConfig{Model: "gpt-4o", Type: mode.ChatCompletions}), convey.ShouldBeNil)
+		channel := &model.Channel{
+			Name:    "c1",
+			Type:    1,
+			BaseURL: upstream.URL,
+			Key:     "sk-channel",
+			Models:  []string{"gpt-4o"},
+			Status:  model.ChannelStatusEnabled,
+		}
+		convey.So(model.BatchInsertChannels([]*model.Channel{channel}), convey.ShouldBeNil)
+		keys, err := model.AddChannelKeys(channel.ID, []string{"sk-good", "sk-bad", "sk-recovered", "sk-admin"})
+		convey.So(err, convey.ShouldBeNil)
+
+		// a key disabled by a failed request is rechecked, a key disabled by an admin is not
+		_, err = model.DisableChannelKey(keys[2].ID, "invalid api key")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(model.UpdateChannelKeyStatus(channel.ID, keys[3].ID, model.ChannelKeyStatusDisabled), convey.ShouldBeNil)
+
+		// between them the two tests pick both enabled keys
+		testChannelModels(channel.ID)
+		testChannelModels(channel.ID)
+
+		convey.So(channelKeyStatus(channel.ID), convey.ShouldResemble, map[string]int{
+			"sk-good":      model.ChannelKeyStatusEnabled,
+			"sk-bad":       model.ChannelKeyStatusDisabled,
+			"sk-recovered": model.ChannelKeyStatusEnabled,
+			"sk-admin":     model.ChannelKeyStatusDisabled,
+		})
+
+		keys, err = model.GetChannelKeys(channel.ID)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(keys[1].DisabledReason, convey.ShouldContainSubstring, "invalid api key")
+		convey.So(keys[2].DisabledReason, convey.ShouldBeEmpty)
+
+		convey.Convey("a channel whose keys are all disabled fails its test", func() {
+			convey.So(model.UpdateChannelKeyStatus(channel.ID, keys[0].ID, model.ChannelKeyStatusDisabled), convey.ShouldBeNil)
+			convey.So(model.UpdateChannelKeyStatus(channel.ID, keys[2].ID, model.ChannelKeyStatusDisabled), convey.ShouldBeNil)
+			testChannelModels(channel.ID)
+
+			var tests []*model.ChannelTest
+			convey.So(model.DB.Where("channel_id = ?", channel.ID).Find(&tests).Error, convey.ShouldBeNil)
+			convey.So(tests, convey.ShouldHaveLength, 1)
+			convey.So(tests[0].Success, convey.ShouldBeFalse)
+			convey.So(tests[0].Response, convey.ShouldContainSubstring, "channel_keys_disabled")
+		})
+	})
+}
@@ -191,49 +191,68 @@ func GetChannel(c *gin.Context) {
 		middleware.ErrorResponse(c, http.StatusOK, err.Error())
 		return
 	}
+	channel.Keys = model.MaskChannelKeys(channel.Keys)
 	middleware.SuccessResponse(c, channel)
 }
 
 // AddChannelRequest represents the request body for adding a channel
 type AddChannelRequest struct {
-	ModelMapping map[string]string    `json:"model_mapping"`
-	Config       *model.ChannelConfig `json:"config"`
-	Name         string               `json:"name"`
-	Key          string               `json:"key"`
-	BaseURL      string               `json:"base_url"`
-	Models       []string             `json:"models"`
-	Type         int                  `json:"type"`
-	Priority     int32                `json:"priority"`
-	Status       int                  `json:"status"`
-	Sets         []string             `json:"sets"`
+	ModelMapping   map[string]string      `json:"model_mapping"`
+	Config         *model.ChannelConfig   `json:"config"`
+	Name           string                 `json:"name"`
+	Key            string                 `json:"key"`
+	BaseURL        string                 `json:"base_url"`
+	Models         []string               `json:"models"`
+	Type           int                    `json:"type"`
+	Priority       int32                  `json:"priority"`
+	Status         int                    `json:"status"`
+	Sets           []string               `json:"sets"`
+	MaxConcurrency int64                  `json:"max_concurrency"`
+	RPM            map[string]int64       `json:"rpm"`
+	TPM            map[string]int64       `json:"tpm"`
+	Schedule       *model.ChannelSchedule `json:"schedule"`
 }
 
-func (r *AddChannelRequest) ToChannel() (*model.Channel, error) {
-	channelType, ok := channeltype.GetAdaptor(r.Type)
+func validateChannelKey(typ int, name string, key string) error {
+	channelType, ok := channeltype.GetAdaptor(typ)
 	if !ok {
-		return nil, fmt.Errorf("invalid channel type: %d", r.Type)
+		return fmt.Errorf("invalid channel type: %d", typ)
 	}
 	if validator, ok := channelType.(adaptor.KeyValidator); ok {
-		err := validator.ValidateKey(r.Key)
+		err := validator.ValidateKey(key)
 		if err != nil {
 			keyHelp := validator.KeyHelp()
 			if keyHelp == "" {
-				return nil, fmt.Errorf("%s [%s(%d)] invalid key: %w", r.Name, channeltype.ChannelNames[r.Type], r.Type, err)
+				return fmt.Errorf("%s [%s(%d)] invalid key: %w", name, channeltype.ChannelNames[typ], typ, err)
 			}
-			return nil, fmt.Errorf("%s [%s(%d)] invalid key: %w, %s", r.Name, channeltype.ChannelNames[r.Type], r.Type, err, keyHelp)
+			return fmt.Errorf("%s [%s(%d)] invalid key: %w, %s", name, channeltype.ChannelNames[typ], typ, err, keyHelp)
 		}
 	}
+	return nil
+}
+
+func (r *AddChannelRequest) ToChannel() (*model.Channel, error) {
+	if err := validateChannelKey(r.Type, r.Name, r.Key); err != nil {
+		return nil, err
+	}
+	if err := r.Schedule.Validate(); err != nil {
+		return nil, err
+	}
 	return &model.Channel{
-		Type:         r.Type,
-		Name:         r.Name,
-		Key:          r.Key,
-		BaseURL:      r.BaseURL,
-		Models:       slices.Clone(r.Models),
-		ModelMapping: maps.Clone(r.ModelMapping),
-		Priority:     r.Priority,
-		Status:       r.Status,
-		Config:       r.Config,
-		Sets:         slices.Clone(r.Sets),
+		Type:           r.Type,
+		Name:           r.Name,
+		Key:            r.Key,
+		BaseURL:        r.BaseURL,
+		Models:         slices.Clone(r.Models),
+		ModelMapping:   maps.Clone(r.ModelMapping),
+		Priority:       r.Priority,
+		Status:         r.Status,
+		Config:         r.Config,
+		Sets:           slices.Clone(r.Sets),
+		MaxConcurrency: r.MaxConcurrency,
+		RPM:            maps.Clone(r.RPM),
+		TPM:            maps.Clone(r.TPM),
+		Schedule:       r.Schedule,
 	}, nil
 }
 
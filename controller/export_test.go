@@ -0,0 +1,8 @@
+package controller
+
+// the unexported helpers used by the tests of the controller package
+var (
+	WaitChannelSlot        = waitChannelSlot
+	WriteRelayError        = writeRelayError
+	RecordClientDisconnect = recordClientDisconnect
+)
@@ -201,6 +201,42 @@ func UpdateGroupRPM(c *gin.Context) {
 	middleware.SuccessResponse(c, nil)
 }
 
+// UpdateGroupPricing godoc
+//
+//	@Summary		Update group pricing
+//	@Description	Updates the price overrides and the discounts by model or owner of a group
+//	@Tags			group
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string				true	"Group name"
+//	@Param			data	body		model.GroupPricing	true	"Group pricing"
+//	@Success		200		{object}	middleware.APIResponse
+//	@Router			/api/group/{group}/pricing [post]
+func UpdateGroupPricing(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+		return
+	}
+	req := model.GroupPricing{}
+	err := sonic.ConfigDefault.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+		return
+	}
+	if err := req.Validate(); err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	err = model.UpdateGroupPricing(group, req)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, nil)
+}
+
 type UpdateGroupTPMRequest struct {
 	TPM map[string]int64 `json:"tpm"`
 }
@@ -360,11 +396,15 @@ func DeleteGroups(c *gin.Context) {
 }
 
 type CreateGroupRequest struct {
-	RPM          map[string]int64 `json:"rpm"`
-	RPMRatio     float64          `json:"rpm_ratio"`
-	TPM          map[string]int64 `json:"tpm"`
-	TPMRatio     float64          `json:"tpm_ratio"`
-	AvailableSet []string         `json:"available_set"`
+	RPM            map[string]int64     `json:"rpm"`
+	RPMRatio       float64              `json:"rpm_ratio"`
+	TPM            map[string]int64     `json:"tpm"`
+	TPMRatio       float64              `json:"tpm_ratio"`
+	AvailableSet   []string             `json:"available_set"`
+	RateLimitWait  bool                 `json:"rate_limit_wait"`
+	ModelAliases   map[string]string    `json:"model_aliases"`
+	PeriodicQuotas model.PeriodicQuotas `json:"periodic_quotas"`
+	Pricing        model.GroupPricing   `json:"pricing"`
 }
 
 // CreateGroup godoc
@@ -391,13 +431,29 @@ func CreateGroup(c *gin.Context) {
 		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
 		return
 	}
+	if err := model.ValidateModelAliases(req.ModelAliases); err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	if err := req.PeriodicQuotas.Validate(); err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	if err := req.Pricing.Validate(); err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
 	g := &model.Group{
-		ID:            group,
-		RPMRatio:      req.RPMRatio,
-		RPM:           req.RPM,
-		TPMRatio:      req.TPMRatio,
-		TPM:           req.TPM,
-		AvailableSets: req.AvailableSet,
+		ID:             group,
+		RPMRatio:       req.RPMRatio,
+		RPM:            req.RPM,
+		TPMRatio:       req.TPMRatio,
+		TPM:            req.TPM,
+		AvailableSets:  req.AvailableSet,
+		RateLimitWait:  req.RateLimitWait,
+		ModelAliases:   req.ModelAliases,
+		PeriodicQuotas: req.PeriodicQuotas,
+		Pricing:        req.Pricing,
 	}
 	if err := model.CreateGroup(g); err != nil {
 		middleware.ErrorResponse(c, http.StatusOK, err.Error())
@@ -430,12 +486,28 @@ func UpdateGroup(c *gin.Context) {
 		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
 		return
 	}
+	if err := model.ValidateModelAliases(req.ModelAliases); err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	if err := req.PeriodicQuotas.Validate(); err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	if err := req.Pricing.Validate(); err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
 	g := &model.Group{
-		RPMRatio:      req.RPMRatio,
-		RPM:           req.RPM,
-		TPMRatio:      req.TPMRatio,
-		TPM:           req.TPM,
-		AvailableSets: req.AvailableSet,
+		RPMRatio:       req.RPMRatio,
+		RPM:            req.RPM,
+		TPMRatio:       req.TPMRatio,
+		TPM:            req.TPM,
+		AvailableSets:  req.AvailableSet,
+		RateLimitWait:  req.RateLimitWait,
+		ModelAliases:   req.ModelAliases,
+		PeriodicQuotas: req.PeriodicQuotas,
+		Pricing:        req.Pricing,
 	}
 	err = model.UpdateGroup(group, g)
 	if err != nil {
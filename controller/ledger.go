@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+)
+
+type CreditGroupLedgerRequest struct {
+	Type   string  `json:"type"`
+	Remark string  `json:"remark"`
+	Amount float64 `json:"amount"`
+}
+
+// CreditGroupLedger godoc
+//
+//	@Summary		Credit group ledger
+//	@Description	Adds a top-up, adjustment or refund entry to the local balance ledger of a group
+//	@Tags			group
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string						true	"Group name"
+//	@Param			data	body		CreditGroupLedgerRequest	true	"Ledger entry"
+//	@Success		200		{object}	middleware.APIResponse{data=map[string]any{entry=model.LedgerEntry,balance=float64}}
+//	@Router			/api/group/{group}/ledger [post]
+func CreditGroupLedger(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+		return
+	}
+	req := CreditGroupLedgerRequest{}
+	err := sonic.ConfigDefault.NewDecoder(c.Request.Body).Decode(&req)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+		return
+	}
+	entry, err := model.CreditGroupLedger(group, req.Type, req.Amount, req.Remark)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	balance, err := model.GetGroupLedgerBalance(group)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, gin.H{
+		"entry":   entry,
+		"balance": balance,
+	})
+}
+
+// GetGroupLedger godoc
+//
+//	@Summary		Get group ledger
+//	@Description	Returns the local balance and the ledger entries of a group with pagination, newest first
+//	@Tags			group
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			group			path		string	true	"Group name"
+//	@Param			type			query		string	false	"Entry type"
+//	@Param			start_timestamp	query		int64	false	"Start timestamp"
+//	@Param			end_timestamp	query		int64	false	"End timestamp"
+//	@Param			page			query		int		false	"Page number"
+//	@Param			per_page		query		int		false	"Items per page"
+//	@Success		200				{object}	middleware.APIResponse{data=map[string]any{entries=[]model.LedgerEntry,total=int,balance=float64}}
+//	@Router			/api/group/{group}/ledger [get]
+func GetGroupLedger(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+		return
+	}
+	page, perPage := parsePageParams(c)
+	var startTime, endTime time.Time
+	if startTimestamp, _ := strconv.ParseInt(c.Query("start_timestamp"), 10, 64); startTimestamp != 0 {
+		startTime = time.UnixMilli(startTimestamp)
+	}
+	if endTimestamp, _ := strconv.ParseInt(c.Query("end_timestamp"), 10, 64); endTimestamp != 0 {
+		endTime = time.UnixMilli(endTimestamp)
+	}
+	entries, total, err := model.GetGroupLedgerEntries(group, c.Query("type"), startTime, endTime, page, perPage)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	balance, err := model.GetGroupLedgerBalance(group)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, gin.H{
+		"entries": entries,
+		"total":   total,
+		"balance": balance,
+	})
+}
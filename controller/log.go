@@ -5,7 +5,9 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/bytedance/sonic"
 	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/consume"
 	"github.com/labring/aiproxy/middleware"
 	"github.com/labring/aiproxy/model"
 )
@@ -488,7 +490,8 @@ func DeleteHistoryLogs(c *gin.Context) {
 //	@Param			token_id		query		int		false	"Token ID"
 //	@Param			order			query		string	false	"Order"
 //	@Param			request_id		query		string	false	"Request ID"
-//	@Success		200				{object}	middleware.APIResponse{data=map[string]any{logs=[]model.RequestDetail,total=int}}
+//	@Param			status			query		string	false	"Status, pending, succeeded, exhausted, written_off or legacy"
+//	@Success		200				{object}	middleware.APIResponse{data=map[string]any{logs=[]model.ConsumeError,total=int}}
 //	@Router			/api/logs/consume_error [get]
 func SearchConsumeError(c *gin.Context) {
 	keyword := c.Query("keyword")
@@ -506,6 +509,7 @@ func SearchConsumeError(c *gin.Context) {
 		group,
 		tokenName,
 		modelName,
+		c.Query("status"),
 		tokenID,
 		page,
 		perPage,
@@ -520,3 +524,64 @@ func SearchConsumeError(c *gin.Context) {
 		"total": total,
 	})
 }
+
+// RetryConsumeError godoc
+//
+//	@Summary		Retry consumption error
+//	@Description	Consumes the amount of a pending, exhausted or legacy consumption error again with its request id as the idempotency key
+//	@Tags			logs
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id	path		int	true	"Consume error ID"
+//	@Success		200	{object}	middleware.APIResponse{data=model.ConsumeError}
+//	@Router			/api/logs/consume_error/{id}/retry [post]
+func RetryConsumeError(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+		return
+	}
+	consumeError, err := consume.RetryConsumeError(c.Request.Context(), id)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, consumeError)
+}
+
+type WriteOffConsumeErrorRequest struct {
+	Remark string `json:"remark"`
+}
+
+// WriteOffConsumeError godoc
+//
+//	@Summary		Write off consumption error
+//	@Description	Gives up a pending, exhausted or legacy consumption error, its amount is never consumed
+//	@Tags			logs
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id		path		int							true	"Consume error ID"
+//	@Param			data	body		WriteOffConsumeErrorRequest	false	"Write-off remark"
+//	@Success		200		{object}	middleware.APIResponse{data=model.ConsumeError}
+//	@Router			/api/logs/consume_error/{id}/write_off [post]
+func WriteOffConsumeError(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+		return
+	}
+	req := WriteOffConsumeErrorRequest{}
+	if c.Request.ContentLength != 0 {
+		if err := sonic.ConfigDefault.NewDecoder(c.Request.Body).Decode(&req); err != nil {
+			middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+			return
+		}
+	}
+	consumeError, err := model.WriteOffConsumeError(id, req.Remark)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, consumeError)
+}
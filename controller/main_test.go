@@ -0,0 +1,20 @@
+package controller_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/model"
+)
+
+// initTestDB opens a fresh sqlite database for the test
+func initTestDB(t *testing.T) {
+	t.Helper()
+	common.SQLitePath = filepath.Join(t.TempDir(), "aiproxy.db")
+	model.InitDB()
+	model.InitLogDB()
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+	})
+}
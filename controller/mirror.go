@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+)
+
+// SearchMirrorResults godoc
+//
+//	@Summary		Search mirror results
+//	@Description	Returns a paginated list of the mirrored requests compared with the served ones
+//	@Tags			mirror
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			page			query		int		false	"Page number"
+//	@Param			per_page		query		int		false	"Items per page"
+//	@Param			model_name		query		string	false	"Model name"
+//	@Param			channel			query		int		false	"Mirror channel ID"
+//	@Param			start_timestamp	query		int		false	"Start timestamp (milliseconds)"
+//	@Param			end_timestamp	query		int		false	"End timestamp (milliseconds)"
+//	@Success		200				{object}	middleware.APIResponse{data=map[string]any{results=[]model.MirrorResult,total=int}}
+//	@Router			/api/mirror/results [get]
+func SearchMirrorResults(c *gin.Context) {
+	page, perPage := parsePageParams(c)
+	startTime, endTime := parseTimeRange(c)
+	channelID, _ := strconv.Atoi(c.Query("channel"))
+	results, total, err := model.SearchMirrorResults(
+		c.Query("model_name"),
+		channelID,
+		startTime,
+		endTime,
+		page,
+		perPage,
+	)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, gin.H{
+		"results": results,
+		"total":   total,
+	})
+}
+
+// GetMirrorReport godoc
+//
+//	@Summary		Get mirror comparison report
+//	@Description	Compares the error rate, latency and output of the mirror channels with the channels that served the requests
+//	@Tags			mirror
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			model_name		query		string	false	"Model name"
+//	@Param			channel			query		int		false	"Mirror channel ID"
+//	@Param			start_timestamp	query		int		false	"Start timestamp (milliseconds)"
+//	@Param			end_timestamp	query		int		false	"End timestamp (milliseconds)"
+//	@Success		200				{object}	middleware.APIResponse{data=[]model.MirrorReport}
+//	@Router			/api/mirror/report [get]
+func GetMirrorReport(c *gin.Context) {
+	startTime, endTime := parseTimeRange(c)
+	channelID, _ := strconv.Atoi(c.Query("channel"))
+	reports, err := model.GetMirrorReport(
+		c.Query("model_name"),
+		channelID,
+		startTime,
+		endTime,
+	)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, reports)
+}
@@ -133,6 +133,10 @@ func SaveModelConfigs(c *gin.Context) {
 	}
 	modelConfigs := make([]*model.ModelConfig, len(configs))
 	for i, config := range configs {
+		if err := config.Validate(); err != nil {
+			middleware.ErrorResponse(c, http.StatusOK, err.Error())
+			return
+		}
 		modelConfigs[i] = config.ModelConfig
 	}
 	err := model.SaveModelConfigs(modelConfigs)
@@ -159,6 +163,10 @@ func SaveModelConfig(c *gin.Context) {
 		middleware.ErrorResponse(c, http.StatusOK, err.Error())
 		return
 	}
+	if err := config.Validate(); err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
 	err := model.SaveModelConfig(config.ModelConfig)
 	if err != nil {
 		middleware.ErrorResponse(c, http.StatusOK, err.Error())
@@ -6,6 +6,7 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
 	"github.com/labring/aiproxy/monitor"
 )
 
@@ -154,3 +155,134 @@ func GetAllBannedModelChannels(c *gin.Context) {
 	}
 	middleware.SuccessResponse(c, channels)
 }
+
+// GetAllBreakers godoc
+//
+//	@Summary		Get all channel model circuit breakers
+//	@Description	Returns the circuit breakers that are open or half-open
+//	@Tags			monitor
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Success		200	{object}	middleware.APIResponse{data=[]monitor.Breaker}
+//	@Router			/api/monitor/breakers [get]
+func GetAllBreakers(c *gin.Context) {
+	breakers, err := monitor.GetAllBreakers(c.Request.Context())
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, breakers)
+}
+
+// GetRateLimitQueues godoc
+//
+//	@Summary		Get rate limit wait queues
+//	@Description	Returns the depth of the group model rpm and tpm wait queues of this instance
+//	@Tags			monitor
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Success		200	{object}	middleware.APIResponse{data=waitqueue.Stats}
+//	@Router			/api/monitor/rate_limit_queues [get]
+func GetRateLimitQueues(c *gin.Context) {
+	middleware.SuccessResponse(c, middleware.RateLimitQueueStats())
+}
+
+// GetClientDisconnects godoc
+//
+//	@Summary		Get client disconnect stats
+//	@Description	Returns the requests of this instance whose client disconnected, per mode, and the spend canceled, continued and avoided
+//	@Tags			monitor
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Success		200	{object}	middleware.APIResponse{data=[]ClientDisconnectStats}
+//	@Router			/api/monitor/client_disconnects [get]
+func GetClientDisconnects(c *gin.Context) {
+	middleware.SuccessResponse(c, GetClientDisconnectStats())
+}
+
+// SearchBreakerTransitions godoc
+//
+//	@Summary		Search channel model circuit breaker transitions
+//	@Description	Returns a paginated list of circuit breaker state transitions
+//	@Tags			monitor
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			page			query		int		false	"Page number"
+//	@Param			per_page		query		int		false	"Items per page"
+//	@Param			model_name		query		string	false	"Model name"
+//	@Param			channel			query		int		false	"Channel ID"
+//	@Param			start_timestamp	query		int		false	"Start timestamp (milliseconds)"
+//	@Param			end_timestamp	query		int		false	"End timestamp (milliseconds)"
+//	@Success		200				{object}	middleware.APIResponse{data=map[string]any{transitions=[]model.ChannelBreakerTransition,total=int}}
+//	@Router			/api/monitor/breaker_transitions [get]
+func SearchBreakerTransitions(c *gin.Context) {
+	page, perPage := parsePageParams(c)
+	startTime, endTime := parseTimeRange(c)
+	channelID, _ := strconv.Atoi(c.Query("channel"))
+	transitions, total, err := model.SearchChannelBreakerTransitions(
+		c.Query("model_name"),
+		channelID,
+		startTime,
+		endTime,
+		page,
+		perPage,
+	)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, gin.H{
+		"transitions": transitions,
+		"total":       total,
+	})
+}
+
+type BreakerDashboardResponse struct {
+	ChartData []*model.BreakerChartData `json:"chart_data"`
+	Breakers  []*monitor.Breaker        `json:"breakers"`
+}
+
+// GetBreakerDashboard godoc
+//
+//	@Summary		Get circuit breaker dashboard
+//	@Description	Returns circuit breaker transitions over time and the breakers that are not closed
+//	@Tags			monitor
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			type		query		string	false	"Type of time span (day, week, two_week, month)"
+//	@Param			model_name	query		string	false	"Model name"
+//	@Param			channel		query		int		false	"Channel ID"
+//	@Success		200			{object}	middleware.APIResponse{data=BreakerDashboardResponse}
+//	@Router			/api/monitor/breaker_dashboard [get]
+func GetBreakerDashboard(c *gin.Context) {
+	start, end, timeSpan := getDashboardTime(c.Query("type"))
+	modelName := c.Query("model_name")
+	channelID, _ := strconv.Atoi(c.Query("channel"))
+
+	chartData, err := model.GetChannelBreakerChartData(modelName, channelID, start, end, timeSpan)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+
+	breakers, err := monitor.GetAllBreakers(c.Request.Context())
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	filtered := make([]*monitor.Breaker, 0, len(breakers))
+	for _, breaker := range breakers {
+		if modelName != "" && breaker.Model != modelName {
+			continue
+		}
+		if channelID != 0 && breaker.ChannelID != int64(channelID) {
+			continue
+		}
+		filtered = append(filtered, breaker)
+	}
+
+	middleware.SuccessResponse(c, BreakerDashboardResponse{
+		ChartData: chartData,
+		Breakers:  filtered,
+	})
+}
@@ -0,0 +1,124 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/mode"
+)
+
+var ErrNoCapableChannel = errors.New("no channel is able to serve the request")
+
+// channelRequirement is what a request needs from a channel,
+// the body is only parsed and the input tokens are only counted when a channel limits them,
+// a body which can not be parsed has no requirement
+type channelRequirement struct {
+	c           *gin.Context
+	m           mode.Mode
+	mc          *model.ModelConfig
+	getUsage    GetRequestUsage
+	usage       model.Usage
+	usageErr    error
+	usageCached bool
+	attrs       *middleware.RequestAttrs
+}
+
+func newChannelRequirement(c *gin.Context, m mode.Mode, mc *model.ModelConfig, getUsage GetRequestUsage) *channelRequirement {
+	return &channelRequirement{
+		c:        c,
+		m:        m,
+		mc:       mc,
+		getUsage: getUsage,
+	}
+}
+
+// requestAttrs returns the attributes of the request body, it is parsed once
+func (r *channelRequirement) requestAttrs() middleware.RequestAttrs {
+	if r.attrs != nil {
+		return *r.attrs
+	}
+	attrs, err := middleware.GetRequestAttrs(r.c, r.m)
+	if err != nil {
+		middleware.GetLogger(r.c).Warnf("parse request attributes failed, the channel capabilities are not checked: %s", err)
+	}
+	r.attrs = &attrs
+	return attrs
+}
+
+// Usage returns the request usage, it is computed once
+func (r *channelRequirement) Usage() (model.Usage, error) {
+	if r.usageCached || r.getUsage == nil {
+		return r.usage, r.usageErr
+	}
+	r.usage, r.usageErr = r.getUsage(r.c, r.mc)
+	r.usageCached = true
+	return r.usage, r.usageErr
+}
+
+func (r *channelRequirement) check(capability model.ModelCapability) error {
+	if capability.SupportVision != nil && !*capability.SupportVision && r.requestAttrs().HasImage {
+		return errors.New("image input is not supported")
+	}
+	if capability.SupportToolChoice != nil && !*capability.SupportToolChoice && r.requestAttrs().ToolChoice {
+		return errors.New("tool_choice is not supported")
+	}
+	if capability.MaxContextTokens > 0 {
+		usage, err := r.Usage()
+		if err != nil {
+			// the context can not be measured, let the upstream decide
+			return nil //nolint:nilerr
+		}
+		contextTokens := int64(usage.InputTokens) + r.requestAttrs().MaxTokens
+		if contextTokens > int64(capability.MaxContextTokens) {
+			return fmt.Errorf("the request needs %d context tokens, more than the max context tokens %d",
+				contextTokens, capability.MaxContextTokens)
+		}
+	}
+	return nil
+}
+
+// getChannelCapability resolves the capability from the channel override,
+// then the model config of the mapped model, then the model config of the request model
+func getChannelCapability(mcs *model.ModelCaches, channel *model.Channel, mc *model.ModelConfig) model.ModelCapability {
+	capability := channel.GetModelCapability(mc.Model)
+	if mapped, ok := channel.ModelMapping[mc.Model]; ok && mapped != "" && mapped != mc.Model {
+		if mappedConfig, ok := mcs.ModelConfig.GetModelConfig(mapped); ok {
+			capability = capability.Merge(mappedConfig.Capability())
+		}
+	}
+	return capability.Merge(mc.Capability())
+}
+
+func checkChannelCapability(mcs *model.ModelCaches, channel *model.Channel, mc *model.ModelConfig, req *channelRequirement) error {
+	if req == nil {
+		return nil
+	}
+	if err := req.check(getChannelCapability(mcs, channel, mc)); err != nil {
+		return fmt.Errorf("%w: %w", ErrNoCapableChannel, err)
+	}
+	return nil
+}
+
+// filterCapableChannels drops the channels unable to serve the request,
+// an error is returned when channels exist but none of them is capable
+func filterCapableChannels(mcs *model.ModelCaches, channels []*model.Channel, mc *model.ModelConfig, req *channelRequirement) ([]*model.Channel, error) {
+	if req == nil || len(channels) == 0 {
+		return channels, nil
+	}
+	var lastErr error
+	capable := make([]*model.Channel, 0, len(channels))
+	for _, channel := range channels {
+		if err := checkChannelCapability(mcs, channel, mc, req); err != nil {
+			lastErr = err
+			continue
+		}
+		capable = append(capable, channel)
+	}
+	if len(capable) == 0 {
+		return nil, lastErr
+	}
+	return capable, nil
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/notify"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/adaptor/openai"
+	"github.com/labring/aiproxy/relay/controller"
+	"github.com/labring/aiproxy/relay/meta"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// channel id -> *atomic.Uint64
+	channelKeyRoundRobin sync.Map
+	// channel key id -> *atomic.Int64
+	channelKeyInFlight sync.Map
+)
+
+func loadCounter[T any](m *sync.Map, id int) *T {
+	v, _ := m.LoadOrStore(id, new(T))
+	counter, _ := v.(*T)
+	return counter
+}
+
+func pickChannelKey(channel *model.Channel) *model.ChannelKey {
+	switch len(channel.Keys) {
+	case 0:
+		return nil
+	case 1:
+		return channel.Keys[0]
+	}
+
+	if channel.Config != nil && channel.Config.KeyRotation == model.ChannelKeyRotationLeastUsed {
+		var picked *model.ChannelKey
+		var pickedInFlight int64
+		for _, key := range channel.Keys {
+			inFlight := loadCounter[atomic.Int64](&channelKeyInFlight, key.ID).Load()
+			if picked == nil || inFlight < pickedInFlight {
+				picked = key
+				pickedInFlight = inFlight
+			}
+		}
+		return picked
+	}
+
+	next := loadCounter[atomic.Uint64](&channelKeyRoundRobin, channel.ID).Add(1)
+	return channel.Keys[(next-1)%uint64(len(channel.Keys))]
+}
+
+// metaChannelKeysDisabled marks a meta whose channel has a key pool with every key disabled
+const metaChannelKeysDisabled = "channel_keys_disabled"
+
+// useChannelKey replaces the channel key of the meta with the next key of the channel pool,
+// a channel whose keys are all disabled is marked instead of falling back to Channel.Key
+func useChannelKey(m *meta.Meta, channel *model.Channel) {
+	if channel.AllKeysDisabled() {
+		m.Set(metaChannelKeysDisabled, true)
+		return
+	}
+	key := pickChannelKey(channel)
+	if key == nil {
+		return
+	}
+	m.Channel.Key = key.Key
+	m.Channel.KeyID = key.ID
+}
+
+// handleWithChannelKey relays the request with the channel key of the meta,
+// a channel whose keys are all disabled fails without a permission so that it is banned
+func handleWithChannelKey(m *meta.Meta, c *gin.Context, handle RelayHandler) *controller.HandleResult {
+	if m.GetBool(metaChannelKeysDisabled) {
+		return &controller.HandleResult{
+			Error: openai.ErrorWrapperWithMessage(
+				"all keys of the channel are disabled",
+				"channel_keys_disabled",
+				http.StatusUnauthorized,
+			),
+		}
+	}
+	release := acquireChannelKey(m)
+	defer release()
+	return handle(m, c)
+}
+
+func acquireChannelKey(m *meta.Meta) func() {
+	if m.Channel == nil || m.Channel.KeyID == 0 {
+		return func() {}
+	}
+	counter := loadCounter[atomic.Int64](&channelKeyInFlight, m.Channel.KeyID)
+	counter.Add(1)
+	return func() {
+		counter.Add(-1)
+	}
+}
+
+func recordChannelKeyResult(m *meta.Meta, isError, hasPermission bool, reason string) {
+	if m.Channel == nil || m.Channel.KeyID == 0 {
+		return
+	}
+
+	model.BatchRecordChannelKeyRequest(m.Channel.KeyID, isError)
+
+	if hasPermission {
+		return
+	}
+	disabled, err := model.DisableChannelKey(m.Channel.KeyID, reason)
+	if err != nil {
+		log.Errorf("disable channel key %d failed: %+v", m.Channel.KeyID, err)
+		return
+	}
+	if disabled {
+		notify.ErrorThrottle(
+			fmt.Sprintf("channelKeyDisabled:%d", m.Channel.KeyID),
+			time.Minute,
+			fmt.Sprintf("channel[%d] %s(%d) key %d is auto disabled",
+				m.Channel.Type, m.Channel.Name, m.Channel.ID, m.Channel.KeyID),
+			reason,
+		)
+	}
+}
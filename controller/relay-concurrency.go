@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/concurrency"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/common/rpmlimit"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/monitor"
+	"github.com/labring/aiproxy/relay/meta"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	ErrChannelsSaturated  = errors.New("channels saturated")
+	ErrChannelBreakerOpen = errors.New("channel circuit breaker is open")
+)
+
+const (
+	channelSlotPollMin    = 100 * time.Millisecond
+	channelSlotPollJitter = 200 * time.Millisecond
+)
+
+// priorityWaiters counts the requests of each priority class waiting for a channel slot on this instance,
+// a waiting request only picks a channel while no request of a higher class is waiting,
+// so a freed slot goes to the higher classes first, the order is not kept across instances
+var priorityWaiters = map[string]*atomic.Int64{
+	model.PriorityClassHigh:   {},
+	model.PriorityClassNormal: {},
+	model.PriorityClassLow:    {},
+}
+
+func higherPriorityClassWaiting(priorityClass string) bool {
+	for class, waiters := range priorityWaiters {
+		if model.HigherPriorityClass(class, priorityClass) && waiters.Load() > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleChannelLimit returns the part of a channel limit usable by the priority class,
+// ok is false when the whole limit is reserved for the higher classes
+func scaleChannelLimit(limit int64, priorityClass string) (int64, bool) {
+	return model.ScaleChannelLimit(limit, model.GetPriorityClassCapacity(priorityClass))
+}
+
+// acquireChannelSlot takes a concurrency slot of the channel and a request of its rpm quota once the circuit breaker
+// of the channel model lets the request through, a channel at its concurrency, rpm or tpm quota is treated as saturated,
+// the capacity share of the priority class scales the limits, so lower classes saturate first
+func acquireChannelSlot(ctx context.Context, modelName, priorityClass string, channel *model.Channel) (*model.Channel, *concurrency.Lease, error) {
+	tpmLimit, ok := scaleChannelLimit(channel.GetModelTPM(modelName), priorityClass)
+	if !ok {
+		return nil, nil, ErrChannelsSaturated
+	}
+	if tpmLimit > 0 && rpmlimit.GetChannelTokens(ctx, channel.ID, modelName, time.Minute) >= tpmLimit {
+		return nil, nil, ErrChannelsSaturated
+	}
+
+	rpmLimit, ok := scaleChannelLimit(channel.GetModelRPM(modelName), priorityClass)
+	if !ok {
+		return nil, nil, ErrChannelsSaturated
+	}
+
+	maxConcurrency, ok := scaleChannelLimit(channel.MaxConcurrency, priorityClass)
+	if !ok {
+		return nil, nil, ErrChannelsSaturated
+	}
+	lease, ok := concurrency.Acquire(ctx, channel.ID, maxConcurrency)
+	if !ok {
+		return nil, nil, ErrChannelsSaturated
+	}
+
+	if !allowChannelRequest(ctx, modelName, channel) {
+		lease.Release()
+		return nil, nil, ErrChannelBreakerOpen
+	}
+
+	// the request is counted against the rpm quota only when it is sent to the channel
+	if !rpmlimit.TryPushChannelRequest(ctx, channel.ID, modelName, rpmLimit, time.Minute) {
+		lease.Release()
+		return nil, nil, ErrChannelsSaturated
+	}
+
+	return channel, lease, nil
+}
+
+// recordChannelTokens counts the tokens used by a request of the channel against its upstream tpm quota
+func recordChannelTokens(m *meta.Meta, usage relaymodel.Usage) {
+	tokens := int64(usage.PromptTokens + usage.CompletionTokens)
+	if tokens <= 0 || m.Channel.TPM <= 0 {
+		return
+	}
+	rpmlimit.PushChannelTokens(context.Background(), m.Channel.ID, m.OriginModel, tokens, time.Minute)
+}
+
+// getAvailableChannel picks a channel by the selector that still has a free concurrency slot and quota,
+// it returns ErrChannelsSaturated when the remaining channels are all at their limit
+func getAvailableChannel(ctx context.Context, modelName, priorityClass string, selector model.ChannelSelector, channels []*model.Channel, errorRates map[int64]float64, ignoreChannel ...int64) (*model.Channel, *concurrency.Lease, error) {
+	ignoreChannel = slices.Clone(ignoreChannel)
+	saturated := false
+	for {
+		channel, err := selectChannel(selector, modelName, channels, errorRates, ignoreChannel...)
+		if err != nil {
+			if saturated && errors.Is(err, ErrChannelsExhausted) {
+				return nil, nil, ErrChannelsSaturated
+			}
+			return nil, nil, err
+		}
+		_, lease, err := acquireChannelSlot(ctx, modelName, priorityClass, channel)
+		if err != nil {
+			if errors.Is(err, ErrChannelsSaturated) {
+				saturated = true
+			}
+			ignoreChannel = append(ignoreChannel, int64(channel.ID))
+			continue
+		}
+		return channel, lease, nil
+	}
+}
+
+// allowChannelRequest asks the circuit breaker of the channel model,
+// a half-open breaker only lets a limited number of probe requests through
+func allowChannelRequest(ctx context.Context, modelName string, channel *model.Channel) bool {
+	allowed, transition, err := monitor.AllowRequest(ctx, modelName, int64(channel.ID))
+	if err != nil {
+		log.Errorf("get channel model breaker (%d:%s) error: %s", channel.ID, modelName, err.Error())
+		return true
+	}
+	handleBreakerTransition(&meta.ChannelMeta{
+		Name: channel.Name,
+		ID:   channel.ID,
+		Type: channel.Type,
+	}, modelName, transition, "")
+	return allowed
+}
+
+// waitChannelSlot retries pick while all candidate channels are saturated,
+// until the channel concurrency queue timeout is reached or the request is gone,
+// the waiting requests of a lower priority class yield to those of the higher classes
+func waitChannelSlot(ctx context.Context, log *log.Entry, priorityClass string, pick func() (*model.Channel, *concurrency.Lease, error)) (*concurrency.Lease, error) {
+	pickInOrder := func() (*concurrency.Lease, error) {
+		if higherPriorityClassWaiting(priorityClass) {
+			return nil, ErrChannelsSaturated
+		}
+		_, lease, err := pick()
+		return lease, err
+	}
+
+	lease, err := pickInOrder()
+	if !errors.Is(err, ErrChannelsSaturated) {
+		return lease, err
+	}
+
+	timeout := time.Duration(config.GetChannelConcurrencyQueueTimeout()) * time.Second
+	if timeout <= 0 {
+		return nil, err
+	}
+
+	if waiters, ok := priorityWaiters[priorityClass]; ok {
+		waiters.Add(1)
+		defer waiters.Add(-1)
+	}
+
+	start := time.Now()
+	defer func() {
+		log.Data["queue_wait"] = time.Since(start).Round(time.Millisecond).String()
+	}()
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+
+	for {
+		//nolint:gosec
+		poll := time.NewTimer(channelSlotPollMin + time.Duration(rand.Int64N(int64(channelSlotPollJitter))))
+		select {
+		case <-ctx.Done():
+			poll.Stop()
+			return nil, ctx.Err()
+		case <-deadline.C:
+			poll.Stop()
+			return nil, ErrChannelsSaturated
+		case <-poll.C:
+		}
+
+		lease, err = pickInOrder()
+		if !errors.Is(err, ErrChannelsSaturated) {
+			return lease, err
+		}
+	}
+}
+
+// abortInitialChannelError aborts the request when no channel could be picked for it,
+// the errors of the concurrency queue and the circuit breaker get their own response,
+// the others keep the saturated response
+func abortInitialChannelError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		middleware.AbortLogWithMessage(c,
+			http.StatusRequestTimeout,
+			"the request is canceled while waiting for a channel slot",
+			&middleware.ErrorField{Code: "channel_slot_wait_canceled"},
+		)
+	case errors.Is(err, ErrChannelsSaturated):
+		middleware.AbortLogWithMessage(c,
+			http.StatusServiceUnavailable,
+			"all channels are at their concurrency or rate limit, please try again later",
+			&middleware.ErrorField{Code: "channels_saturated"},
+		)
+	case errors.Is(err, ErrChannelBreakerOpen):
+		middleware.AbortLogWithMessage(c,
+			http.StatusServiceUnavailable,
+			"the channel is temporarily unavailable, please try again later",
+			&middleware.ErrorField{Code: "channel_breaker_open"},
+		)
+	default:
+		middleware.AbortLogWithMessage(c,
+			http.StatusServiceUnavailable,
+			"the upstream load is saturated, please try again later",
+		)
+	}
+}
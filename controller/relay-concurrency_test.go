@@ -0,0 +1,91 @@
+package controller_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/concurrency"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/controller"
+	"github.com/labring/aiproxy/model"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func acquireSlot(ctx context.Context, channelID int) func() (*model.Channel, *concurrency.Lease, error) {
+	return func() (*model.Channel, *concurrency.Lease, error) {
+		lease, ok := concurrency.Acquire(ctx, channelID, 1)
+		if !ok {
+			return nil, nil, controller.ErrChannelsSaturated
+		}
+		return &model.Channel{ID: channelID}, lease, nil
+	}
+}
+
+func testWaitChannelSlot(ctx context.Context, channelID int) {
+	entry := log.NewEntry(log.StandardLogger())
+	entry.Data = log.Fields{}
+
+	held, ok := concurrency.Acquire(ctx, channelID, 1)
+	convey.So(ok, convey.ShouldBeTrue)
+
+	// a saturated channel is waited for until the queue timeout
+	start := time.Now()
+	_, err := controller.WaitChannelSlot(ctx, entry, model.PriorityClassNormal, acquireSlot(ctx, channelID))
+	convey.So(errors.Is(err, controller.ErrChannelsSaturated), convey.ShouldBeTrue)
+	convey.So(time.Since(start), convey.ShouldBeGreaterThanOrEqualTo, time.Second)
+	convey.So(entry.Data["queue_wait"], convey.ShouldNotBeEmpty)
+
+	// a request gone while waiting stops waiting
+	canceled, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	_, err = controller.WaitChannelSlot(canceled, entry, model.PriorityClassNormal, acquireSlot(ctx, channelID))
+	cancel()
+	convey.So(errors.Is(err, context.DeadlineExceeded), convey.ShouldBeTrue)
+
+	// a slot released while waiting is taken
+	time.AfterFunc(300*time.Millisecond, held.Release)
+	lease, err := controller.WaitChannelSlot(ctx, entry, model.PriorityClassNormal, acquireSlot(ctx, channelID))
+	convey.So(err, convey.ShouldBeNil)
+	convey.So(concurrency.InFlight(ctx, channelID), convey.ShouldEqual, 1)
+	lease.Release()
+
+	// without queue timeout a saturated channel fails at once
+	held, ok = concurrency.Acquire(ctx, channelID, 1)
+	convey.So(ok, convey.ShouldBeTrue)
+	defer held.Release()
+	config.SetChannelConcurrencyQueueTimeout(0)
+	defer config.SetChannelConcurrencyQueueTimeout(1)
+	start = time.Now()
+	_, err = controller.WaitChannelSlot(ctx, entry, model.PriorityClassNormal, acquireSlot(ctx, channelID))
+	convey.So(errors.Is(err, controller.ErrChannelsSaturated), convey.ShouldBeTrue)
+	convey.So(time.Since(start), convey.ShouldBeLessThan, 100*time.Millisecond)
+}
+
+func TestWaitChannelSlot(t *testing.T) {
+	convey.Convey("TestWaitChannelSlot", t, func() {
+		ctx := context.Background()
+		queueTimeout := config.GetChannelConcurrencyQueueTimeout()
+		config.SetChannelConcurrencyQueueTimeout(1)
+		defer config.SetChannelConcurrencyQueueTimeout(queueTimeout)
+
+		convey.Convey("memory", func() {
+			testWaitChannelSlot(ctx, 100)
+		})
+
+		convey.Convey("redis", func() {
+			mr := miniredis.RunT(t)
+			common.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+			common.RedisEnabled = true
+			defer func() {
+				common.RedisEnabled = false
+			}()
+
+			testWaitChannelSlot(ctx, 200)
+		})
+	})
+}
@@ -14,12 +14,14 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/concurrency"
 	"github.com/labring/aiproxy/common/config"
 	"github.com/labring/aiproxy/common/consume"
 	"github.com/labring/aiproxy/common/notify"
 	"github.com/labring/aiproxy/middleware"
 	"github.com/labring/aiproxy/model"
 	"github.com/labring/aiproxy/monitor"
+	"github.com/labring/aiproxy/relay/adaptor/openai"
 	"github.com/labring/aiproxy/relay/controller"
 	"github.com/labring/aiproxy/relay/meta"
 	"github.com/labring/aiproxy/relay/mode"
@@ -42,6 +44,17 @@ type RelayController struct {
 	Handler         RelayHandler
 }
 
+// getRequestPrice returns the price of the request with the pricing of the group applied,
+// every price used to bill a request must come from here
+func getRequestPrice(c *gin.Context, mc *model.ModelConfig, getPrice GetRequestPrice) (model.Price, model.GroupPriceAdjustment, error) {
+	price, err := getPrice(c, mc)
+	if err != nil {
+		return model.Price{}, model.GroupPriceAdjustment{}, err
+	}
+	price, priceAdjustment := middleware.GetGroup(c).Pricing.Apply(mc, price)
+	return price, priceAdjustment, nil
+}
+
 func relayHandler(meta *meta.Meta, c *gin.Context) *controller.HandleResult {
 	log := middleware.GetLogger(c)
 	middleware.SetLogFieldsFromMeta(meta, log.Data)
@@ -82,41 +95,52 @@ func relayController(m mode.Mode) RelayController {
 }
 
 func RelayHelper(meta *meta.Meta, c *gin.Context, handel RelayHandler) (*controller.HandleResult, bool) {
-	result := handel(meta, c)
+	result := handleWithChannelKey(meta, c, handel)
+	recordChannelTokens(meta, result.Usage)
 	if result.Error == nil {
-		if _, _, err := monitor.AddRequest(
+		recordChannelKeyResult(meta, false, true, "")
+		_, transition, err := monitor.AddRequest(
 			context.Background(),
 			meta.OriginModel,
 			int64(meta.Channel.ID),
 			false,
 			false,
-		); err != nil {
+		)
+		if err != nil {
 			log.Errorf("add request failed: %+v", err)
 		}
+		handleBreakerTransition(meta.Channel, meta.OriginModel, transition, "")
 		return result, false
 	}
 	shouldRetry := shouldRetry(c, result.Error.StatusCode)
-	if shouldRetry {
+	switch {
+	case !shouldRetry:
+		recordChannelKeyResult(meta, false, true, "")
+	case isCooldownError(result.Error):
+		recordChannelKeyResult(meta, true, true, result.Error.JSONOrEmpty())
+		cooldownChannel(meta, result.Error.RetryAfter)
+	case result.Error.StatusCode == http.StatusTooManyRequests:
+		// a rate limit without a reset hint is no channel failure,
+		// it is neither counted in the error rate nor able to ban the channel
+		recordChannelKeyResult(meta, true, true, result.Error.JSONOrEmpty())
+	default:
 		hasPermission := channelHasPermission(result.Error.StatusCode)
-		beyondThreshold, banExecution, err := monitor.AddRequest(
+		recordChannelKeyResult(meta, true, hasPermission, result.Error.JSONOrEmpty())
+		// a key without permission is disabled alone, the rest of the channel keys keep serving
+		keyOnly := meta.Channel.KeyID != 0
+		beyondThreshold, transition, err := monitor.AddRequest(
 			context.Background(),
 			meta.OriginModel,
 			int64(meta.Channel.ID),
 			true,
-			!hasPermission,
+			!hasPermission && !keyOnly,
 		)
 		if err != nil {
 			log.Errorf("add request failed: %+v", err)
 		}
 		switch {
-		case banExecution:
-			notify.ErrorThrottle(
-				fmt.Sprintf("autoBanned:%d:%s", meta.Channel.ID, meta.OriginModel),
-				time.Minute,
-				fmt.Sprintf("channel[%d] %s(%d) model %s is auto banned",
-					meta.Channel.Type, meta.Channel.Name, meta.Channel.ID, meta.OriginModel),
-				result.Error.JSONOrEmpty(),
-			)
+		case transition.Changed():
+			handleBreakerTransition(meta.Channel, meta.OriginModel, transition, result.Error.JSONOrEmpty())
 		case beyondThreshold:
 			notify.WarnThrottle(
 				fmt.Sprintf("beyondThreshold:%d:%s", meta.Channel.ID, meta.OriginModel),
@@ -125,7 +149,7 @@ func RelayHelper(meta *meta.Meta, c *gin.Context, handel RelayHandler) (*control
 					meta.Channel.Type, meta.Channel.Name, meta.Channel.ID, meta.OriginModel),
 				result.Error.JSONOrEmpty(),
 			)
-		case !hasPermission:
+		case !hasPermission && !keyOnly:
 			notify.ErrorThrottle(
 				fmt.Sprintf("channelHasPermission:%d:%s", meta.Channel.ID, meta.OriginModel),
 				time.Minute,
@@ -138,6 +162,40 @@ func RelayHelper(meta *meta.Meta, c *gin.Context, handel RelayHandler) (*control
 	return result, shouldRetry
 }
 
+func handleBreakerTransition(channel *meta.ChannelMeta, modelName string, transition monitor.BreakerTransition, reason string) {
+	if !transition.Changed() {
+		return
+	}
+
+	if err := model.RecordChannelBreakerTransition(
+		modelName,
+		channel.ID,
+		string(transition.From),
+		string(transition.To),
+		transition.OpenUntil,
+		reason,
+	); err != nil {
+		log.Errorf("record channel breaker transition failed: %+v", err)
+	}
+
+	switch transition.To {
+	case monitor.BreakerStateOpen:
+		notify.ErrorThrottle(
+			fmt.Sprintf("breakerOpened:%d:%s", channel.ID, modelName),
+			time.Minute,
+			fmt.Sprintf("channel[%d] %s(%d) model %s circuit breaker is opened until %s",
+				channel.Type, channel.Name, channel.ID, modelName, transition.OpenUntil.Format(time.DateTime)),
+			reason,
+		)
+	case monitor.BreakerStateClosed:
+		notify.Info(
+			fmt.Sprintf("channel[%d] %s(%d) model %s circuit breaker is closed",
+				channel.Type, channel.Name, channel.ID, modelName),
+			"half-open probes succeeded",
+		)
+	}
+}
+
 func filterChannels(channels []*model.Channel, ignoreChannel ...int64) []*model.Channel {
 	filtered := make([]*model.Channel, 0)
 	for _, channel := range channels {
@@ -157,7 +215,7 @@ var (
 	ErrChannelsExhausted = errors.New("channels exhausted")
 )
 
-func GetRandomChannel(mc *model.ModelCaches, availableSet []string, modelName string, errorRates map[int64]float64, ignoreChannel ...int64) (*model.Channel, []*model.Channel, error) {
+func getModelChannels(mc *model.ModelCaches, availableSet []string, modelName string) []*model.Channel {
 	channelMap := make(map[int]*model.Channel)
 	for _, set := range availableSet {
 		for _, channel := range mc.EnabledModel2ChannelsBySet[set][modelName] {
@@ -168,22 +226,39 @@ func GetRandomChannel(mc *model.ModelCaches, availableSet []string, modelName st
 	for _, channel := range channelMap {
 		migratedChannels = append(migratedChannels, channel)
 	}
-	channel, err := getRandomChannel(migratedChannels, errorRates, ignoreChannel...)
-	return channel, migratedChannels, err
+	return migratedChannels
 }
 
-func getPriority(channel *model.Channel, errorRate float64) int32 {
-	priority := channel.GetPriority()
-	if errorRate > 1 {
-		errorRate = 1
-	} else if errorRate < 0.1 {
-		errorRate = 0.1
+// applyPriorityMultipliers returns copies of the channels whose priority is scaled by the multipliers
+func applyPriorityMultipliers(channels []*model.Channel, multipliers map[int]float64) []*model.Channel {
+	if len(multipliers) == 0 {
+		return channels
 	}
-	return int32(float64(priority) / errorRate)
+	scaled := make([]*model.Channel, 0, len(channels))
+	for _, channel := range channels {
+		multiplier, ok := multipliers[channel.ID]
+		if !ok {
+			scaled = append(scaled, channel)
+			continue
+		}
+		copied := *channel
+		copied.Priority = max(int32(float64(channel.GetPriority())*multiplier), 1)
+		scaled = append(scaled, &copied)
+	}
+	return scaled
+}
+
+func GetRandomChannel(mc *model.ModelCaches, availableSet []string, modelName string, errorRates map[int64]float64, ignoreChannel ...int64) (*model.Channel, []*model.Channel, error) {
+	migratedChannels := getModelChannels(mc, availableSet, modelName)
+	channel, err := getRandomChannel(migratedChannels, errorRates, ignoreChannel...)
+	return channel, migratedChannels, err
 }
 
-//nolint:gosec
 func getRandomChannel(channels []*model.Channel, errorRates map[int64]float64, ignoreChannel ...int64) (*model.Channel, error) {
+	return selectChannel(defaultChannelSelector, "", channels, errorRates, ignoreChannel...)
+}
+
+func selectChannel(selector model.ChannelSelector, modelName string, channels []*model.Channel, errorRates map[int64]float64, ignoreChannel ...int64) (*model.Channel, error) {
 	if len(channels) == 0 {
 		return nil, ErrChannelsNotFound
 	}
@@ -197,39 +272,18 @@ func getRandomChannel(channels []*model.Channel, errorRates map[int64]float64, i
 		return channels[0], nil
 	}
 
-	var totalWeight int32
-	cachedPrioritys := make([]int32, len(channels))
-	for i, ch := range channels {
-		priority := getPriority(ch, errorRates[int64(ch.ID)])
-		totalWeight += priority
-		cachedPrioritys[i] = priority
-	}
-
-	if totalWeight == 0 {
-		return channels[rand.IntN(len(channels))], nil
-	}
-
-	r := rand.Int32N(totalWeight)
-	for i, ch := range channels {
-		r -= cachedPrioritys[i]
-		if r < 0 {
-			return ch, nil
-		}
-	}
-
-	return channels[rand.IntN(len(channels))], nil
+	return selector.Select(modelName, channels, errorRates), nil
 }
 
-func getChannelWithFallback(cache *model.ModelCaches, availableSet []string, modelName string, errorRates map[int64]float64, ignoreChannelIDs ...int64) (*model.Channel, []*model.Channel, error) {
-	channel, migratedChannels, err := GetRandomChannel(cache, availableSet, modelName, errorRates, ignoreChannelIDs...)
+func getChannelWithFallback(ctx context.Context, modelName, priorityClass string, selector model.ChannelSelector, channels []*model.Channel, errorRates map[int64]float64, ignoreChannelIDs ...int64) (*model.Channel, *concurrency.Lease, error) {
+	channel, lease, err := getAvailableChannel(ctx, modelName, priorityClass, selector, channels, errorRates, ignoreChannelIDs...)
 	if err == nil {
-		return channel, migratedChannels, nil
+		return channel, lease, nil
 	}
 	if !errors.Is(err, ErrChannelsExhausted) {
-		return nil, migratedChannels, err
+		return nil, nil, err
 	}
-	channel, migratedChannels, err = GetRandomChannel(cache, availableSet, modelName, errorRates)
-	return channel, migratedChannels, err
+	return getAvailableChannel(ctx, modelName, priorityClass, selector, channels, errorRates)
 }
 
 func NewRelay(mode mode.Mode) func(c *gin.Context) {
@@ -244,21 +298,33 @@ func relay(c *gin.Context, mode mode.Mode, relayController RelayController) {
 	requestModel := middleware.GetRequestModel(c)
 	mc := middleware.GetModelConfig(c)
 
+	requirement := newChannelRequirement(c, mode, mc, relayController.GetRequestUsage)
+
 	// Get initial channel
-	initialChannel, err := getInitialChannel(c, requestModel, log)
+	initialChannel, err := getInitialChannel(c, requestModel, requirement, log)
+	if errors.Is(err, ErrChannelsCoolingDown) {
+		abortChannelsCoolingDown(c, err)
+		return
+	}
+	if errors.Is(err, ErrNoCapableChannel) {
+		middleware.AbortLogWithMessage(c, http.StatusBadRequest, err.Error(), &middleware.ErrorField{
+			Type: "invalid_request_error",
+			Code: "no_capable_channel",
+		})
+		return
+	}
 	if err != nil || initialChannel == nil || initialChannel.channel == nil {
-		middleware.AbortLogWithMessage(c,
-			http.StatusServiceUnavailable,
-			"the upstream load is saturated, please try again later",
-		)
+		abortInitialChannelError(c, err)
 		return
 	}
+	defer initialChannel.lease.Release()
 
 	billingEnabled := config.GetBillingEnabled()
 
 	price := model.Price{}
+	var priceAdjustment model.GroupPriceAdjustment
 	if billingEnabled && relayController.GetRequestPrice != nil {
-		price, err = relayController.GetRequestPrice(c, mc)
+		price, priceAdjustment, err = getRequestPrice(c, mc, relayController.GetRequestPrice)
 		if err != nil {
 			middleware.AbortLogWithMessage(c,
 				http.StatusInternalServerError,
@@ -268,10 +334,12 @@ func relay(c *gin.Context, mode mode.Mode, relayController RelayController) {
 		}
 	}
 
-	meta := middleware.NewMetaByContext(c, initialChannel.channel, mode)
+	meta := middleware.NewMetaByContext(c, initialChannel.channel, mode, meta.WithPriceAdjustment(priceAdjustment))
+	useChannelKey(meta, initialChannel.channel)
+	enableStreamFailover(c, meta)
 
 	if billingEnabled && relayController.GetRequestUsage != nil {
-		requestUsage, err := relayController.GetRequestUsage(c, mc)
+		requestUsage, err := requirement.Usage()
 		if err != nil {
 			middleware.AbortLogWithMessage(c,
 				http.StatusInternalServerError,
@@ -280,7 +348,7 @@ func relay(c *gin.Context, mode mode.Mode, relayController RelayController) {
 			return
 		}
 		gbc := middleware.GetGroupBalanceConsumerFromContext(c)
-		if !gbc.CheckBalance(getPreConsumedAmount(requestUsage, price)) {
+		if !checkRequestBalance(c, gbc, meta, requestUsage, price) {
 			middleware.AbortLogWithMessage(c,
 				http.StatusForbidden,
 				fmt.Sprintf("group (%s) balance not enough", gbc.Group),
@@ -292,14 +360,17 @@ func relay(c *gin.Context, mode mode.Mode, relayController RelayController) {
 		}
 
 		meta.InputTokens = requestUsage.InputTokens
+		meta.RequestUnits = requestUsage.Units
 	}
 
 	// First attempt
 	result, retry := RelayHelper(meta, c, relayController.Handler)
+	initialChannel.lease.Release()
 
 	retryTimes := int(config.GetRetryTimes())
 	if handleRelayResult(c, result.Error, retry, retryTimes) {
 		recordResult(c, meta, price, result, 0, true)
+		mirrorTraffic(c, meta, price, result, nil, "")
 		return
 	}
 
@@ -310,20 +381,21 @@ func relay(c *gin.Context, mode mode.Mode, relayController RelayController) {
 		meta,
 		result,
 		price,
+		relayController.GetRequestUsage,
 	)
 
 	// Retry loop
 	retryLoop(c, mode, retryState, relayController.Handler, log)
 }
 
-func getPreConsumedAmount(usage model.Usage, price model.Price) float64 {
-	if usage.InputTokens == 0 || price.InputPrice == 0 {
-		return 0
-	}
+func getPreConsumedAmount(requestAt time.Time, usage model.Usage, price model.Price) float64 {
+	price, _ = price.EffectiveAt(requestAt)
+	price, _ = price.SelectTier(usage.InputTokens)
 	return decimal.
 		NewFromInt(int64(usage.InputTokens)).
 		Mul(decimal.NewFromFloat(price.InputPrice)).
 		Div(decimal.NewFromInt(model.PriceUnit)).
+		Add(decimal.NewFromInt(int64(usage.Units)).Mul(decimal.NewFromFloat(price.UnitPrice))).
 		InexactFloat64()
 }
 
@@ -343,7 +415,10 @@ func recordResult(c *gin.Context, meta *meta.Meta, price model.Price, result *co
 
 	gbc := middleware.GetGroupBalanceConsumerFromContext(c)
 
+	recordClientDisconnect(c, meta, price, result)
+
 	amount := consume.CalculateAmount(
+		meta.RequestAt,
 		result.Usage,
 		price,
 	)
@@ -372,30 +447,59 @@ type retryState struct {
 	ignoreChannelIDs         []int64
 	errorRates               map[int64]float64
 	exhausted                bool
+	priorityClass            string
+	selector                 model.ChannelSelector
 
 	meta             *meta.Meta
 	price            model.Price
+	priceAdjustment  model.GroupPriceAdjustment
 	inputTokens      int
+	requestUnits     int
+	getRequestUsage  GetRequestUsage
 	result           *controller.HandleResult
 	migratedChannels []*model.Channel
+
+	streamRequestBody []byte
+	streamPartialText string
 }
 
 type initialChannel struct {
 	channel           *model.Channel
+	lease             *concurrency.Lease
 	designatedChannel bool
 	ignoreChannelIDs  []int64
 	errorRates        map[int64]float64
 	migratedChannels  []*model.Channel
+	priorityClass     string
+	selector          model.ChannelSelector
 }
 
-func getInitialChannel(c *gin.Context, modelName string, log *log.Entry) (*initialChannel, error) {
+func getInitialChannel(c *gin.Context, modelName string, requirement *channelRequirement, log *log.Entry) (*initialChannel, error) {
+	mc := middleware.GetModelCaches(c)
+	modelConfig := middleware.GetModelConfig(c)
+	priorityClass := middleware.GetPriorityClass(c)
+	selector := getChannelSelector(modelConfig)
+
 	if channel := middleware.GetChannel(c); channel != nil {
 		log.Data["designated_channel"] = "true"
-		return &initialChannel{channel: channel, designatedChannel: true}, nil
+		if err := checkChannelCapability(mc, channel, modelConfig, requirement); err != nil {
+			return nil, err
+		}
+		lease, err := waitChannelSlot(c.Request.Context(), log, priorityClass, func() (*model.Channel, *concurrency.Lease, error) {
+			return acquireChannelSlot(c.Request.Context(), modelName, priorityClass, channel)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &initialChannel{
+			channel:           channel,
+			lease:             lease,
+			designatedChannel: true,
+			priorityClass:     priorityClass,
+			selector:          selector,
+		}, nil
 	}
 
-	mc := middleware.GetModelCaches(c)
-
 	ids, err := monitor.GetBannedChannelsWithModel(c.Request.Context(), modelName)
 	if err != nil {
 		log.Errorf("get %s auto banned channels failed: %+v", modelName, err)
@@ -407,17 +511,38 @@ func getInitialChannel(c *gin.Context, modelName string, log *log.Entry) (*initi
 		log.Errorf("get channel model error rates failed: %+v", err)
 	}
 
-	group := middleware.GetGroup(c)
-	availableSet := group.GetAvailableSets()
+	availableSet := middleware.GetAvailableSets(c)
+
+	migratedChannels := getModelChannels(mc, availableSet, modelName)
+	if rule := middleware.GetRoutingRule(c); rule != nil {
+		migratedChannels = applyPriorityMultipliers(migratedChannels, rule.Action.PriorityMultipliers)
+	}
+	migratedChannels, err = filterCapableChannels(mc, migratedChannels, modelConfig, requirement)
+	if err != nil {
+		return nil, err
+	}
+	migratedChannels, err = filterCooldownChannels(c.Request.Context(), modelName, migratedChannels)
+	if err != nil {
+		return nil, err
+	}
 
-	channel, migratedChannels, err := getChannelWithFallback(mc, availableSet, modelName, errorRates, ids...)
+	var channel *model.Channel
+	lease, err := waitChannelSlot(c.Request.Context(), log, priorityClass, func() (*model.Channel, *concurrency.Lease, error) {
+		var err error
+		var lease *concurrency.Lease
+		channel, lease, err = getChannelWithFallback(c.Request.Context(), modelName, priorityClass, selector, migratedChannels, errorRates, ids...)
+		return channel, lease, err
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &initialChannel{
 		channel:          channel,
+		lease:            lease,
 		ignoreChannelIDs: ids,
+		priorityClass:    priorityClass,
+		selector:         selector,
 		errorRates:       errorRates,
 		migratedChannels: migratedChannels,
 	}, nil
@@ -430,14 +555,13 @@ func handleRelayResult(c *gin.Context, bizErr *relaymodel.ErrorWithStatusCode, r
 	if !retry ||
 		retryTimes == 0 ||
 		c.Request.Context().Err() != nil {
-		bizErr.Error.Message = middleware.MessageWithRequestID(c, bizErr.Error.Message)
-		c.JSON(bizErr.StatusCode, bizErr)
+		writeRelayError(c, bizErr)
 		return true
 	}
 	return false
 }
 
-func initRetryState(retryTimes int, channel *initialChannel, meta *meta.Meta, result *controller.HandleResult, price model.Price) *retryState {
+func initRetryState(retryTimes int, channel *initialChannel, meta *meta.Meta, result *controller.HandleResult, price model.Price, getRequestUsage GetRequestUsage) *retryState {
 	state := &retryState{
 		retryTimes:       retryTimes,
 		ignoreChannelIDs: channel.ignoreChannelIDs,
@@ -445,15 +569,24 @@ func initRetryState(retryTimes int, channel *initialChannel, meta *meta.Meta, re
 		meta:             meta,
 		result:           result,
 		price:            price,
+		priceAdjustment:  meta.PriceAdjustment,
 		inputTokens:      meta.InputTokens,
+		requestUnits:     meta.RequestUnits,
+		getRequestUsage:  getRequestUsage,
 		migratedChannels: channel.migratedChannels,
+		priorityClass:    channel.priorityClass,
+		selector:         channel.selector,
 	}
 
 	if channel.designatedChannel {
 		state.exhausted = true
 	}
 
-	if !channelHasPermission(result.Error.StatusCode) {
+	// a channel in cooldown is not retried until the upstream reset time,
+	// an interrupted stream is continued on another channel
+	if !channelHasPermission(result.Error.StatusCode) ||
+		isCooldownError(result.Error) ||
+		openai.IsStreamInterrupted(result.Error) {
 		state.ignoreChannelIDs = append(state.ignoreChannelIDs, int64(channel.channel.ID))
 	} else {
 		state.lastHasPermissionChannel = channel.channel
@@ -467,17 +600,19 @@ func retryLoop(c *gin.Context, mode mode.Mode, state *retryState, relayControlle
 	i := 0
 
 	for {
-		newChannel, err := getRetryChannel(state)
+		newChannel, lease, err := getRetryChannel(c.Request.Context(), state, log)
 		if err == nil {
-			err = prepareRetry(c)
+			err = prepareRetry(c, state)
 		}
 		if err != nil {
+			lease.Release()
 			if !errors.Is(err, ErrChannelsExhausted) {
 				log.Errorf("prepare retry failed: %+v", err)
 			}
 			// when the last request has not recorded the result, record the result
 			if state.meta != nil && state.result != nil {
 				recordResult(c, state.meta, state.price, state.result, i, true)
+				state.mirror(c)
 			}
 			break
 		}
@@ -502,13 +637,19 @@ func retryLoop(c *gin.Context, mode mode.Mode, state *retryState, relayControlle
 			newChannel,
 			mode,
 			meta.WithInputTokens(state.inputTokens),
+			meta.WithRequestUnits(state.requestUnits),
+			meta.WithPriceAdjustment(state.priceAdjustment),
 		)
+		useChannelKey(state.meta, newChannel)
+		enableStreamFailover(c, state.meta)
 		var retry bool
 		state.result, retry = RelayHelper(state.meta, c, relayController)
+		lease.Release()
 
 		done := handleRetryResult(c, retry, newChannel, state)
 		if done || i == state.retryTimes-1 {
 			recordResult(c, state.meta, state.price, state.result, i+1, true)
+			state.mirror(c)
 			break
 		}
 
@@ -516,40 +657,60 @@ func retryLoop(c *gin.Context, mode mode.Mode, state *retryState, relayControlle
 	}
 
 	if state.result.Error != nil {
-		state.result.Error.Error.Message = middleware.MessageWithRequestID(c, state.result.Error.Error.Message)
-		c.JSON(state.result.Error.StatusCode, state.result.Error)
+		writeRelayError(c, state.result.Error)
 	}
 }
 
-func getRetryChannel(state *retryState) (*model.Channel, error) {
+// mirror mirrors the final result with the request the client sent,
+// a stream continued on other channels is compared by its whole output
+func (s *retryState) mirror(c *gin.Context) {
+	mirrorTraffic(c, s.meta, s.price, s.result, s.streamRequestBody, s.streamPartialText)
+}
+
+func getRetryChannel(ctx context.Context, state *retryState, log *log.Entry) (*model.Channel, *concurrency.Lease, error) {
 	if state.exhausted {
-		if state.lastHasPermissionChannel == nil {
-			return nil, ErrChannelsExhausted
-		}
-		if shouldDelay(state.result.Error.StatusCode) {
-			//nolint:gosec
-			time.Sleep(time.Duration(rand.Float64()*float64(time.Second)) + time.Second)
-		}
-		return state.lastHasPermissionChannel, nil
+		return getLastHasPermissionChannel(ctx, state, log)
 	}
 
-	newChannel, err := getRandomChannel(state.migratedChannels, state.errorRates, state.ignoreChannelIDs...)
+	var newChannel *model.Channel
+	lease, err := waitChannelSlot(ctx, log, state.priorityClass, func() (*model.Channel, *concurrency.Lease, error) {
+		var err error
+		var lease *concurrency.Lease
+		newChannel, lease, err = getAvailableChannel(ctx, state.meta.OriginModel, state.priorityClass, state.selector, state.migratedChannels, state.errorRates, state.ignoreChannelIDs...)
+		return newChannel, lease, err
+	})
 	if err != nil {
 		if !errors.Is(err, ErrChannelsExhausted) || state.lastHasPermissionChannel == nil {
-			return nil, err
+			return nil, nil, err
 		}
 		state.exhausted = true
-		if shouldDelay(state.result.Error.StatusCode) {
-			//nolint:gosec
-			time.Sleep(time.Duration(rand.Float64()*float64(time.Second)) + time.Second)
-		}
-		return state.lastHasPermissionChannel, nil
+		return getLastHasPermissionChannel(ctx, state, log)
 	}
 
-	return newChannel, nil
+	return newChannel, lease, nil
 }
 
-func prepareRetry(c *gin.Context) error {
+func getLastHasPermissionChannel(ctx context.Context, state *retryState, log *log.Entry) (*model.Channel, *concurrency.Lease, error) {
+	if state.lastHasPermissionChannel == nil {
+		return nil, nil, ErrChannelsExhausted
+	}
+	if shouldDelay(state.result.Error.StatusCode) {
+		//nolint:gosec
+		time.Sleep(time.Duration(rand.Float64()*float64(time.Second)) + time.Second)
+	}
+	lease, err := waitChannelSlot(ctx, log, state.priorityClass, func() (*model.Channel, *concurrency.Lease, error) {
+		return acquireChannelSlot(ctx, state.meta.OriginModel, state.priorityClass, state.lastHasPermissionChannel)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return state.lastHasPermissionChannel, lease, nil
+}
+
+func prepareRetry(c *gin.Context, state *retryState) error {
+	if openai.IsStreamInterrupted(state.result.Error) {
+		return prepareStreamContinuation(c, state)
+	}
 	requestBody, err := common.GetRequestBody(c.Request)
 	if err != nil {
 		return fmt.Errorf("get request body failed in prepare retry: %w", err)
@@ -567,14 +728,20 @@ func handleRetryResult(ctx *gin.Context, retry bool, newChannel *model.Channel,
 	}
 
 	if state.exhausted {
-		if !channelHasPermission(state.result.Error.StatusCode) {
+		if !channelHasPermission(state.result.Error.StatusCode) ||
+			isCooldownError(state.result.Error) ||
+			openai.IsStreamInterrupted(state.result.Error) {
 			return true
 		}
 	} else {
-		if !channelHasPermission(state.result.Error.StatusCode) {
+		switch {
+		case !channelHasPermission(state.result.Error.StatusCode):
 			state.ignoreChannelIDs = append(state.ignoreChannelIDs, int64(newChannel.ID))
 			state.retryTimes++
-		} else {
+		case isCooldownError(state.result.Error),
+			openai.IsStreamInterrupted(state.result.Error):
+			state.ignoreChannelIDs = append(state.ignoreChannelIDs, int64(newChannel.ID))
+		default:
 			state.lastHasPermissionChannel = newChannel
 		}
 	}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/monitor"
+	"github.com/labring/aiproxy/relay/meta"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+	log "github.com/sirupsen/logrus"
+)
+
+var ErrChannelsCoolingDown = errors.New("all channels are cooling down after upstream rate limits")
+
+type channelsCoolingDownError struct {
+	retryAfter time.Duration
+}
+
+func (e *channelsCoolingDownError) Error() string {
+	return fmt.Sprintf("%s, please retry after %s", ErrChannelsCoolingDown.Error(), e.retryAfter.Round(time.Second))
+}
+
+func (e *channelsCoolingDownError) Is(target error) bool {
+	return target == ErrChannelsCoolingDown
+}
+
+// isCooldownError reports whether the upstream rate limited the channel and told when to come back
+func isCooldownError(err *relaymodel.ErrorWithStatusCode) bool {
+	return err != nil && err.RetryAfter > 0
+}
+
+// cooldownChannel skips the channel model until the upstream reset time,
+// the rate limit is not counted as a channel error
+func cooldownChannel(m *meta.Meta, retryAfter time.Duration) {
+	if err := monitor.CooldownChannel(context.Background(), m.OriginModel, int64(m.Channel.ID), retryAfter); err != nil {
+		log.Errorf("cooldown channel %d model %s failed: %+v", m.Channel.ID, m.OriginModel, err)
+	}
+}
+
+// filterCooldownChannels drops the channels in cooldown,
+// when every channel is cooling down the error tells when the first one is back
+func filterCooldownChannels(ctx context.Context, modelName string, channels []*model.Channel) ([]*model.Channel, error) {
+	if len(channels) == 0 {
+		return channels, nil
+	}
+	cooldowns, err := monitor.GetCooldownChannels(ctx, modelName)
+	if err != nil {
+		log.Errorf("get %s cooldown channels failed: %+v", modelName, err)
+		return channels, nil
+	}
+	if len(cooldowns) == 0 {
+		return channels, nil
+	}
+
+	var earliest time.Time
+	available := make([]*model.Channel, 0, len(channels))
+	for _, channel := range channels {
+		until, ok := cooldowns[int64(channel.ID)]
+		if !ok {
+			available = append(available, channel)
+			continue
+		}
+		if earliest.IsZero() || until.Before(earliest) {
+			earliest = until
+		}
+	}
+	if len(available) == 0 {
+		return nil, &channelsCoolingDownError{retryAfter: time.Until(earliest)}
+	}
+	return available, nil
+}
+
+func setRetryAfterHeader(c *gin.Context, retryAfter time.Duration) {
+	if retryAfter <= 0 {
+		return
+	}
+	c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+}
+
+func abortChannelsCoolingDown(c *gin.Context, err error) {
+	var coolingDown *channelsCoolingDownError
+	if errors.As(err, &coolingDown) {
+		setRetryAfterHeader(c, coolingDown.retryAfter)
+	}
+	middleware.AbortLogWithMessage(c, http.StatusTooManyRequests, err.Error(), &middleware.ErrorField{
+		Code: "channels_cooling_down",
+	})
+}
@@ -7,7 +7,9 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy/common/balance"
+	"github.com/labring/aiproxy/common/periodquota"
 	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
 	"github.com/labring/aiproxy/relay/adaptor/openai"
 	log "github.com/sirupsen/logrus"
 )
@@ -42,9 +44,40 @@ func GetSubscription(c *gin.Context) {
 		HardLimitUSD:       quota + token.UsedAmount,
 		SoftLimitUSD:       b,
 		SystemHardLimitUSD: quota + token.UsedAmount,
+		PeriodicQuotas: append(
+			getSubscriptionPeriodicQuotas(c, "token", periodquota.TokenSubject(token.ID), token.PeriodicQuotas),
+			getSubscriptionPeriodicQuotas(c, "group", periodquota.GroupSubject(group.ID), group.PeriodicQuotas)...,
+		),
 	})
 }
 
+func getSubscriptionPeriodicQuotas(c *gin.Context, scope, subject string, quotas model.PeriodicQuotas) []openai.SubscriptionPeriodicQuota {
+	remaining, err := periodquota.GetRemaining(c.Request.Context(), subject, quotas)
+	if err != nil {
+		log.Errorf("get %s (%s) periodic quotas failed: %s", scope, subject, err)
+		return nil
+	}
+	result := make([]openai.SubscriptionPeriodicQuota, 0, len(remaining))
+	for _, r := range remaining {
+		remainingTokens := int64(-1)
+		if r.Tokens > 0 {
+			remainingTokens = max(r.Tokens-r.UsedTokens, 0)
+		}
+		result = append(result, openai.SubscriptionPeriodicQuota{
+			Scope:           scope,
+			Period:          r.Period,
+			ResetAt:         r.ResetAt.Unix(),
+			AmountUSD:       r.Amount,
+			UsedAmountUSD:   r.UsedAmount,
+			RemainingUSD:    r.RemainingAmount(),
+			Tokens:          r.Tokens,
+			UsedTokens:      r.UsedTokens,
+			RemainingTokens: remainingTokens,
+		})
+	}
+	return result
+}
+
 // GetUsage godoc
 //
 //	@Summary		Get usage
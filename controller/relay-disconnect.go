@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/consume"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/controller"
+	"github.com/labring/aiproxy/relay/meta"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+)
+
+// ClientDisconnectStats counts the requests of a mode whose client disconnected before the response was done.
+// CanceledAmount is billed for the canceled upstream requests, ContinuedAmount is spent on requests
+// that kept running without a client, AvoidedAmount estimates the output not generated
+// by the canceled requests up to their max tokens
+type ClientDisconnectStats struct {
+	Mode            string  `json:"mode"`
+	Canceled        int64   `json:"canceled"`
+	Continued       int64   `json:"continued"`
+	CanceledAmount  float64 `json:"canceled_amount"`
+	ContinuedAmount float64 `json:"continued_amount"`
+	AvoidedAmount   float64 `json:"avoided_amount"`
+}
+
+var (
+	clientDisconnectStatsLock sync.Mutex
+	clientDisconnectStats     = make(map[string]*ClientDisconnectStats)
+)
+
+// GetClientDisconnectStats returns the client disconnect counters of this instance since start
+func GetClientDisconnectStats() []ClientDisconnectStats {
+	clientDisconnectStatsLock.Lock()
+	stats := make([]ClientDisconnectStats, 0, len(clientDisconnectStats))
+	for _, s := range clientDisconnectStats {
+		stats = append(stats, *s)
+	}
+	clientDisconnectStatsLock.Unlock()
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Mode < stats[j].Mode
+	})
+	return stats
+}
+
+// recordClientDisconnect counts the request when its client is gone,
+// whether the upstream was canceled follows the client disconnect policy of the mode
+func recordClientDisconnect(c *gin.Context, m *meta.Meta, price model.Price, result *controller.HandleResult) {
+	if c.Request.Context().Err() == nil {
+		return
+	}
+
+	amount := consume.CalculateAmount(m.RequestAt, result.Usage, price)
+	canceled := m.GetBool(controller.MetaUpstreamCanceled)
+	var avoided float64
+	if canceled {
+		avoided = avoidedAmount(c, m, price, result.Usage)
+		log := middleware.GetLogger(c)
+		log.Data["upstream_canceled"] = "true"
+	}
+
+	clientDisconnectStatsLock.Lock()
+	defer clientDisconnectStatsLock.Unlock()
+
+	stats, ok := clientDisconnectStats[m.Mode.String()]
+	if !ok {
+		stats = &ClientDisconnectStats{Mode: m.Mode.String()}
+		clientDisconnectStats[m.Mode.String()] = stats
+	}
+	if canceled {
+		stats.Canceled++
+		stats.CanceledAmount += amount
+		stats.AvoidedAmount += avoided
+	} else {
+		stats.Continued++
+		stats.ContinuedAmount += amount
+	}
+}
+
+// avoidedAmount prices the output tokens the canceled request could still have generated,
+// bounded by the requested max tokens or the max output tokens of the model
+func avoidedAmount(c *gin.Context, m *meta.Meta, price model.Price, usage relaymodel.Usage) float64 {
+	remaining := requestMaxTokens(c, m) - int64(usage.CompletionTokens)
+	if remaining <= 0 {
+		return 0
+	}
+	price, _ = price.EffectiveAt(m.RequestAt)
+	price, _ = price.SelectTier(usage.PromptTokens)
+	return consume.CalculateAmount(m.RequestAt, relaymodel.Usage{CompletionTokens: int(remaining)}, price)
+}
+
+// requestMaxTokens returns the requested max tokens or the max output tokens of the model
+func requestMaxTokens(c *gin.Context, m *meta.Meta) int64 {
+	var maxTokens int64
+	if attrs, err := middleware.GetRequestAttrs(c, m.Mode); err == nil {
+		maxTokens = attrs.MaxTokens
+	}
+	if maxTokens <= 0 && m.ModelConfig != nil {
+		if maxOutputTokens, ok := m.ModelConfig.MaxOutputTokens(); ok {
+			maxTokens = int64(maxOutputTokens)
+		}
+	}
+	return maxTokens
+}
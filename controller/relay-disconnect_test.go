@@ -0,0 +1,118 @@
+package controller_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/consume"
+	"github.com/labring/aiproxy/controller"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+	relaycontroller "github.com/labring/aiproxy/relay/controller"
+	"github.com/labring/aiproxy/relay/meta"
+	"github.com/labring/aiproxy/relay/mode"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func clientDisconnectStats(m mode.Mode) controller.ClientDisconnectStats {
+	for _, s := range controller.GetClientDisconnectStats() {
+		if s.Mode == m.String() {
+			return s
+		}
+	}
+	return controller.ClientDisconnectStats{Mode: m.String()}
+}
+
+// recordDisconnect records a request of the mode whose client is gone unless connected is set
+func recordDisconnect(
+	m mode.Mode,
+	body string,
+	modelConfig *model.ModelConfig,
+	upstreamCanceled bool,
+	connected bool,
+	price model.Price,
+	usage relaymodel.Usage,
+) *gin.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+	if !connected {
+		cancel()
+	} else {
+		defer cancel()
+	}
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+
+	relayMeta := meta.NewMeta(nil, m, "gpt-4o", modelConfig)
+	if upstreamCanceled {
+		relayMeta.Set(relaycontroller.MetaUpstreamCanceled, true)
+	}
+	controller.RecordClientDisconnect(c, relayMeta, price, &relaycontroller.HandleResult{Usage: usage})
+	return c
+}
+
+func TestRecordClientDisconnect(t *testing.T) {
+	convey.Convey("TestRecordClientDisconnect", t, func() {
+		price := model.Price{InputPrice: 1, OutputPrice: 2}
+		usage := relaymodel.Usage{PromptTokens: 1000, CompletionTokens: 200, TotalTokens: 1200}
+		amount := consume.CalculateAmount(time.Now(), usage, price)
+		modelConfig := &model.ModelConfig{
+			Model:  "gpt-4o",
+			Config: model.NewModelConfig(model.WithModelConfigMaxOutputTokens(4000)),
+		}
+
+		convey.Convey("a connected client is not counted", func() {
+			before := clientDisconnectStats(mode.ChatCompletions)
+			recordDisconnect(mode.ChatCompletions, `{"max_tokens":1000}`, modelConfig, false, true, price, usage)
+			convey.So(clientDisconnectStats(mode.ChatCompletions), convey.ShouldResemble, before)
+		})
+
+		convey.Convey("a continued request counts its amount", func() {
+			before := clientDisconnectStats(mode.ChatCompletions)
+			c := recordDisconnect(mode.ChatCompletions, `{"max_tokens":1000}`, modelConfig, false, false, price, usage)
+			after := clientDisconnectStats(mode.ChatCompletions)
+
+			convey.So(after.Continued-before.Continued, convey.ShouldEqual, 1)
+			convey.So(after.ContinuedAmount-before.ContinuedAmount, convey.ShouldAlmostEqual, amount)
+			convey.So(after.Canceled, convey.ShouldEqual, before.Canceled)
+			convey.So(after.AvoidedAmount, convey.ShouldEqual, before.AvoidedAmount)
+			convey.So(middleware.GetLogger(c).Data, convey.ShouldNotContainKey, "upstream_canceled")
+		})
+
+		convey.Convey("a canceled request counts the output it avoided up to the requested max tokens", func() {
+			before := clientDisconnectStats(mode.ChatCompletions)
+			c := recordDisconnect(mode.ChatCompletions, `{"max_tokens":1000}`, modelConfig, true, false, price, usage)
+			after := clientDisconnectStats(mode.ChatCompletions)
+
+			avoided := consume.CalculateAmount(time.Now(), relaymodel.Usage{CompletionTokens: 800}, price)
+			convey.So(after.Canceled-before.Canceled, convey.ShouldEqual, 1)
+			convey.So(after.CanceledAmount-before.CanceledAmount, convey.ShouldAlmostEqual, amount)
+			convey.So(after.AvoidedAmount-before.AvoidedAmount, convey.ShouldAlmostEqual, avoided)
+			convey.So(after.Continued, convey.ShouldEqual, before.Continued)
+			convey.So(middleware.GetLogger(c).Data["upstream_canceled"], convey.ShouldEqual, "true")
+		})
+
+		convey.Convey("the avoided output falls back to the max output tokens of the model", func() {
+			before := clientDisconnectStats(mode.Completions)
+			recordDisconnect(mode.Completions, `{}`, modelConfig, true, false, price, usage)
+			after := clientDisconnectStats(mode.Completions)
+
+			avoided := consume.CalculateAmount(time.Now(), relaymodel.Usage{CompletionTokens: 3800}, price)
+			convey.So(after.AvoidedAmount-before.AvoidedAmount, convey.ShouldAlmostEqual, avoided)
+		})
+
+		convey.Convey("no output is avoided once the max tokens are generated", func() {
+			before := clientDisconnectStats(mode.ChatCompletions)
+			recordDisconnect(mode.ChatCompletions, `{"max_tokens":100}`, modelConfig, true, false, price, usage)
+			after := clientDisconnectStats(mode.ChatCompletions)
+
+			convey.So(after.Canceled-before.Canceled, convey.ShouldEqual, 1)
+			convey.So(after.AvoidedAmount, convey.ShouldEqual, before.AvoidedAmount)
+		})
+	})
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/meta"
+	"github.com/shopspring/decimal"
+)
+
+// checkRequestBalance holds the estimated amount of the request, its input and max output tokens,
+// from the group balance until the request is consumed, so that concurrent long requests
+// can not spend more than the balance, without holds only the input amount is checked
+func checkRequestBalance(c *gin.Context, gbc *middleware.GroupBalanceConsumer, m *meta.Meta, usage model.Usage, price model.Price) bool {
+	preConsumedAmount := getPreConsumedAmount(m.RequestAt, usage, price)
+	if gbc.Hold == nil || !config.GetBalanceHoldEnabled() {
+		return gbc.CheckBalance(preConsumedAmount)
+	}
+
+	amount := decimal.NewFromFloat(preConsumedAmount).
+		Add(decimal.NewFromFloat(getHoldOutputAmount(c, m, usage, price))).
+		InexactFloat64()
+	log := middleware.GetLogger(c)
+	ok, err := gbc.Hold(c.Request.Context(), m.RequestID, amount)
+	if err != nil {
+		log.Errorf("hold group (%s) balance failed: %s", gbc.Group, err)
+		return gbc.CheckBalance(preConsumedAmount)
+	}
+	if ok && amount > 0 {
+		log.Data["held"] = strconv.FormatFloat(amount, 'f', -1, 64)
+	}
+	return ok
+}
+
+// getHoldOutputAmount prices the max output tokens of the request
+func getHoldOutputAmount(c *gin.Context, m *meta.Meta, usage model.Usage, price model.Price) float64 {
+	maxTokens := requestMaxTokens(c, m)
+	if maxTokens <= 0 {
+		return 0
+	}
+	price, _ = price.EffectiveAt(m.RequestAt)
+	price, _ = price.SelectTier(usage.InputTokens)
+	return decimal.NewFromInt(maxTokens).
+		Mul(decimal.NewFromFloat(price.OutputPrice)).
+		Div(decimal.NewFromInt(model.PriceUnit)).
+		InexactFloat64()
+}
@@ -0,0 +1,181 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/consume"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/adaptor/openai"
+	"github.com/labring/aiproxy/relay/controller"
+	"github.com/labring/aiproxy/relay/meta"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	maxConcurrentMirrors  = 64
+	mirrorTimeout         = 5 * time.Minute
+	maxMirrorOutputLength = 4096
+)
+
+// mirrors are dropped instead of queued when too many are running
+var mirrorSemaphore = make(chan struct{}, maxConcurrentMirrors)
+
+type mirrorRequest struct {
+	method string
+	url    string
+	header http.Header
+	body   []byte
+
+	meta    *meta.Meta
+	price   model.Price
+	channel *model.Channel
+	result  *model.MirrorResult
+
+	primaryOutput string
+}
+
+// mirrorTraffic replays a sample of the model requests on the mirror channel in the background,
+// the mirrored response is discarded and compared with the one the client received,
+// its usage and cost are kept in the mirror result only, so they are neither charged to the group
+// nor counted by its logs, statements, dashboards and limits.
+// originalBody is the request the client sent when the body was replaced by a stream continuation,
+// primaryPrefix the output streamed before the continuation
+func mirrorTraffic(c *gin.Context, m *meta.Meta, price model.Price, result *controller.HandleResult, originalBody []byte, primaryPrefix string) {
+	if m.ModelConfig == nil || m.ModelConfig.Mirror == nil {
+		return
+	}
+	mirror := m.ModelConfig.Mirror
+	if !mirror.Sample(m.Channel.ID) {
+		return
+	}
+	channel, ok := middleware.GetModelCaches(c).ChannelsByID[mirror.ChannelID]
+	if !ok {
+		return
+	}
+	body := originalBody
+	if body == nil {
+		var err error
+		body, err = common.GetRequestBody(c.Request)
+		if err != nil {
+			return
+		}
+	}
+	if len(body) == 0 {
+		return
+	}
+
+	select {
+	case mirrorSemaphore <- struct{}{}:
+	default:
+		log.Warnf("too many mirror requests, drop mirror of %s to channel %d", m.OriginModel, channel.ID)
+		return
+	}
+
+	req := &mirrorRequest{
+		method:  c.Request.Method,
+		url:     c.Request.URL.String(),
+		header:  c.Request.Header.Clone(),
+		body:    body,
+		price:   price,
+		channel: channel,
+		meta: meta.NewMeta(
+			channel,
+			m.Mode,
+			m.OriginModel,
+			m.ModelConfig,
+			meta.WithRequestID(m.RequestID),
+			meta.WithGroup(m.Group),
+			meta.WithToken(m.Token),
+			meta.WithEndpoint(m.Endpoint),
+			meta.WithInputTokens(m.InputTokens),
+			meta.WithRequestUnits(m.RequestUnits),
+			meta.WithPriceAdjustment(m.PriceAdjustment),
+		),
+		result: &model.MirrorResult{
+			RequestID:          m.RequestID,
+			Model:              m.OriginModel,
+			PrimaryChannelID:   m.Channel.ID,
+			MirrorChannelID:    channel.ID,
+			PrimaryCode:        http.StatusOK,
+			PrimaryLatency:     time.Since(m.RequestAt).Milliseconds(),
+			PrimaryOutputToken: result.Usage.CompletionTokens,
+		},
+	}
+	if result.Error != nil {
+		req.result.PrimaryCode = result.Error.StatusCode
+	} else if result.Detail != nil {
+		req.primaryOutput = primaryPrefix + openai.ExtractOutputText(result.Detail.ResponseBody)
+	}
+
+	go func() {
+		defer func() { <-mirrorSemaphore }()
+		req.do()
+	}()
+}
+
+func (r *mirrorRequest) do() {
+	ctx, cancel := context.WithTimeout(context.Background(), mirrorTimeout)
+	defer cancel()
+
+	// the mirror takes a slot of the channel at the lowest priority class and is dropped when saturated,
+	// so it never takes the channel limits from the served traffic, its result is reported to the
+	// circuit breaker and the keys of the channel like the one of a relayed request
+	_, lease, err := acquireChannelSlot(ctx, r.meta.OriginModel, model.PriorityClassLow, r.channel)
+	if err != nil {
+		log.Debugf("mirror channel %d is unavailable, drop mirror of %s: %v", r.channel.ID, r.meta.OriginModel, err)
+		return
+	}
+	defer lease.Release()
+
+	httpReq, err := http.NewRequestWithContext(ctx, r.method, r.url, bytes.NewReader(r.body))
+	if err != nil {
+		log.Errorf("create mirror request failed: %+v", err)
+		return
+	}
+	httpReq.Header = r.header
+
+	w := httptest.NewRecorder()
+	newc, _ := gin.CreateTestContext(w)
+	newc.Request = httpReq
+	middleware.SetRequestID(newc, r.meta.RequestID)
+
+	useChannelKey(r.meta, r.channel)
+	start := time.Now()
+	handleResult, _ := RelayHelper(r.meta, newc, relayHandler)
+	latency := time.Since(start)
+
+	result := r.result
+	result.MirrorLatency = latency.Milliseconds()
+	result.MirrorInputToken = handleResult.Usage.PromptTokens
+	result.MirrorOutputToken = handleResult.Usage.CompletionTokens
+	result.PrimaryOutput = truncateMirrorOutput(r.primaryOutput)
+	result.MirrorAmount = consume.CalculateAmount(r.meta.RequestAt, handleResult.Usage, r.price)
+
+	if handleResult.Error != nil {
+		result.MirrorCode = handleResult.Error.StatusCode
+		result.MirrorError = handleResult.Error.JSONOrEmpty()
+	} else {
+		result.MirrorCode = http.StatusOK
+		mirrorOutput := openai.ExtractOutputText(w.Body.String())
+		result.MirrorOutput = truncateMirrorOutput(mirrorOutput)
+		if result.PrimaryCode == http.StatusOK && (r.primaryOutput != "" || mirrorOutput != "") {
+			similarity := model.OutputSimilarity(r.primaryOutput, mirrorOutput)
+			result.Similarity = &similarity
+		}
+	}
+
+	if err := model.RecordMirrorResult(result); err != nil {
+		log.Errorf("record mirror result failed: %+v", err)
+	}
+}
+
+func truncateMirrorOutput(output string) string {
+	return common.TruncateByRune(output, maxMirrorOutputLength)
+}
@@ -3,10 +3,12 @@ package controller
 import (
 	"fmt"
 	"net/http"
+	"slices"
 
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy/middleware"
-	model "github.com/labring/aiproxy/relay/model"
+	"github.com/labring/aiproxy/model"
+	relaymodel "github.com/labring/aiproxy/relay/model"
 )
 
 // ListModels godoc
@@ -23,8 +25,13 @@ func ListModels(c *gin.Context) {
 	token := middleware.GetToken(c)
 
 	availableOpenAIModels := make([]*OpenAIModels, 0)
+	aliases := model.GetModelAliases(middleware.GetGroup(c))
 
 	token.Range(func(model string) bool {
+		// the alias takes precedence over the model of the same name
+		if _, ok := aliases[model]; ok {
+			return true
+		}
 		if mc, ok := enabledModelConfigsMap[model]; ok {
 			availableOpenAIModels = append(availableOpenAIModels, &OpenAIModels{
 				ID:         model,
@@ -39,6 +46,28 @@ func ListModels(c *gin.Context) {
 		return true
 	})
 
+	aliasNames := make([]string, 0, len(aliases))
+	for alias := range aliases {
+		aliasNames = append(aliasNames, alias)
+	}
+	slices.Sort(aliasNames)
+	for _, alias := range aliasNames {
+		target := aliases[alias]
+		mc, ok := enabledModelConfigsMap[target]
+		if !ok || !token.ContainsAliasModel(alias, target) {
+			continue
+		}
+		availableOpenAIModels = append(availableOpenAIModels, &OpenAIModels{
+			ID:         alias,
+			Object:     "model",
+			Created:    1626777600,
+			OwnedBy:    string(mc.Owner),
+			Root:       target,
+			Permission: permission,
+			Parent:     nil,
+		})
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"object": "list",
 		"data":   availableOpenAIModels,
@@ -57,16 +86,26 @@ func ListModels(c *gin.Context) {
 func RetrieveModel(c *gin.Context) {
 	modelName := c.Param("model")
 	enabledModelConfigsMap := middleware.GetModelCaches(c).EnabledModelConfigsMap
+	token := middleware.GetToken(c)
 
-	mc, ok := enabledModelConfigsMap[modelName]
+	root := modelName
+	target, isAlias := model.ResolveModelAlias(middleware.GetGroup(c), modelName)
+	if isAlias {
+		root = target
+	}
+
+	mc, ok := enabledModelConfigsMap[root]
 	if ok {
-		token := middleware.GetToken(c)
-		ok = token.ContainsModel(modelName)
+		if isAlias {
+			ok = token.ContainsAliasModel(modelName, root)
+		} else {
+			ok = token.ContainsModel(modelName)
+		}
 	}
 
 	if !ok {
 		c.JSON(200, gin.H{
-			"error": &model.Error{
+			"error": &relaymodel.Error{
 				Message: fmt.Sprintf("the model '%s' does not exist", modelName),
 				Type:    "invalid_request_error",
 				Param:   "model",
@@ -81,7 +120,7 @@ func RetrieveModel(c *gin.Context) {
 		Object:     "model",
 		Created:    1626777600,
 		OwnedBy:    string(mc.Owner),
-		Root:       modelName,
+		Root:       root,
 		Permission: permission,
 		Parent:     nil,
 	})
@@ -0,0 +1,76 @@
+package controller_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/controller"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func listModels(group *model.GroupCache, token *model.TokenCache, modelCaches *model.ModelCaches) []*controller.OpenAIModels {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/models", nil)
+	c.Set(middleware.Group, group)
+	c.Set(middleware.Token, token)
+	c.Set(middleware.ModelCaches, modelCaches)
+	controller.ListModels(c)
+
+	var resp struct {
+		Data []*controller.OpenAIModels `json:"data"`
+	}
+	convey.So(sonic.Unmarshal(w.Body.Bytes(), &resp), convey.ShouldBeNil)
+	return resp.Data
+}
+
+func TestListModelsAliases(t *testing.T) {
+	convey.Convey("TestListModelsAliases", t, func() {
+		config.SetModelAliases(map[string]string{"fast": "gpt-4o-mini", "gpt-4o": "claude-3-5-sonnet"})
+		defer config.SetModelAliases(nil)
+
+		modelCaches := &model.ModelCaches{
+			EnabledModelConfigsMap: map[string]*model.ModelConfig{
+				"gpt-4o":      {Model: "gpt-4o", Owner: model.ModelOwnerOpenAI},
+				"gpt-4o-mini": {Model: "gpt-4o-mini", Owner: model.ModelOwnerOpenAI},
+				"o1":          {Model: "o1", Owner: model.ModelOwnerOpenAI},
+			},
+		}
+		group := &model.GroupCache{ID: "g1", ModelAliases: map[string]string{"smart": "o1", "missing": "not-enabled"}}
+		token := &model.TokenCache{}
+		token.SetAvailableSets([]string{"default"})
+		token.SetModelsBySet(map[string][]string{"default": {"gpt-4o", "gpt-4o-mini", "o1"}})
+
+		ids := func(models []*controller.OpenAIModels) map[string]string {
+			roots := make(map[string]string, len(models))
+			for _, m := range models {
+				roots[m.ID] = m.Root
+			}
+			return roots
+		}
+
+		convey.Convey("the aliases are listed with their real model as root", func() {
+			convey.So(ids(listModels(group, token, modelCaches)), convey.ShouldResemble, map[string]string{
+				"gpt-4o-mini": "gpt-4o-mini",
+				"o1":          "o1",
+				"fast":        "gpt-4o-mini",
+				"smart":       "o1",
+			})
+		})
+
+		convey.Convey("a token limited to some models lists the aliases it may use", func() {
+			token.Models = []string{"fast", "o1"}
+			convey.So(ids(listModels(group, token, modelCaches)), convey.ShouldResemble, map[string]string{
+				"o1":    "o1",
+				"fast":  "gpt-4o-mini",
+				"smart": "o1",
+			})
+		})
+	})
+}
@@ -0,0 +1,15 @@
+package controller
+
+import (
+	"github.com/labring/aiproxy/model"
+)
+
+var defaultChannelSelector = model.GetChannelSelector(model.ChannelSelectorRandom)
+
+// getChannelSelector returns the selector of the model config, random by priority by default
+func getChannelSelector(mc *model.ModelConfig) model.ChannelSelector {
+	if mc == nil {
+		return defaultChannelSelector
+	}
+	return model.GetChannelSelector(mc.Selector)
+}
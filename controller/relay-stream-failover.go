@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/common/render"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/relay/adaptor/openai"
+	"github.com/labring/aiproxy/relay/meta"
+	"github.com/labring/aiproxy/relay/mode"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+)
+
+// enableStreamFailover lets the stream handlers report an abnormally terminated chat stream,
+// the relay then continues it on another channel in the same client stream,
+// only the openai, anthropic and gemini stream handlers and the adaptors built on them report it,
+// a stream of the other adaptors (aws, baidu, cohere, coze, ollama) that breaks just ends as before
+func enableStreamFailover(c *gin.Context, m *meta.Meta) {
+	if !config.GetEnableStreamFailover() || m.Mode != mode.ChatCompletions {
+		return
+	}
+	attrs, err := middleware.GetRequestAttrs(c, m.Mode)
+	if err != nil || !attrs.Stream {
+		return
+	}
+	m.Set(openai.MetaStreamFailover, true)
+}
+
+// prepareStreamContinuation appends the output the client has already received
+// as an assistant prefill, so the next channel continues where the stream stopped,
+// the input tokens are counted again from the continuation body
+func prepareStreamContinuation(c *gin.Context, state *retryState) error {
+	if state.streamRequestBody == nil {
+		body, err := common.GetRequestBody(c.Request)
+		if err != nil {
+			return fmt.Errorf("get request body failed in prepare stream continuation: %w", err)
+		}
+		state.streamRequestBody = body
+	}
+	state.streamPartialText += state.meta.GetString(openai.MetaStreamPartialText)
+
+	body, err := openai.ContinuationRequestBody(state.streamRequestBody, state.streamPartialText)
+	if err != nil {
+		return fmt.Errorf("build stream continuation request failed: %w", err)
+	}
+	common.SetRequestBody(c.Request, body)
+
+	if state.getRequestUsage != nil && config.GetBillingEnabled() {
+		usage, err := state.getRequestUsage(c, middleware.GetModelConfig(c))
+		if err != nil {
+			return fmt.Errorf("get stream continuation request usage failed: %w", err)
+		}
+		state.inputTokens = usage.InputTokens
+	}
+	return nil
+}
+
+// writeRelayError responds the error, a stream that has been partially sent
+// to the client is ended with an error event instead
+func writeRelayError(c *gin.Context, bizErr *relaymodel.ErrorWithStatusCode) {
+	bizErr.Error.Message = middleware.MessageWithRequestID(c, bizErr.Error.Message)
+	if c.Writer.Written() {
+		_ = render.ObjectData(c, bizErr)
+		return
+	}
+	setRetryAfterHeader(c, bizErr.RetryAfter)
+	c.JSON(bizErr.StatusCode, bizErr)
+}
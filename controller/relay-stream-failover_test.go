@@ -0,0 +1,51 @@
+package controller_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/render"
+	"github.com/labring/aiproxy/controller"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/relay/adaptor/openai"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestWriteRelayError(t *testing.T) {
+	convey.Convey("TestWriteRelayError", t, func() {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+		middleware.SetRequestID(c, "r1")
+
+		convey.Convey("an error before any output is responded as json", func() {
+			bizErr := openai.ErrorWrapperWithMessage("rate limited", "rate_limited", http.StatusTooManyRequests)
+			bizErr.RetryAfter = 1500 * time.Millisecond
+			controller.WriteRelayError(c, bizErr)
+
+			convey.So(w.Code, convey.ShouldEqual, http.StatusTooManyRequests)
+			convey.So(w.Header().Get("Retry-After"), convey.ShouldEqual, "2")
+			convey.So(w.Header().Get("Content-Type"), convey.ShouldStartWith, "application/json")
+			convey.So(w.Body.String(), convey.ShouldContainSubstring, "rate limited (aiproxy: r1)")
+			convey.So(w.Body.String(), convey.ShouldNotStartWith, "data:")
+		})
+
+		convey.Convey("a stream already sent to the client is ended with an error event", func() {
+			convey.So(render.ObjectData(c, map[string]any{"choices": []any{}}), convey.ShouldBeNil)
+			bizErr := openai.ErrorWrapperWithMessage("upstream stream interrupted", openai.ErrorCodeStreamInterrupted, http.StatusBadGateway)
+			controller.WriteRelayError(c, bizErr)
+
+			// the status of the stream was sent with its first event
+			convey.So(w.Code, convey.ShouldEqual, http.StatusOK)
+			events := strings.Split(strings.TrimSpace(w.Body.String()), "\n\n")
+			convey.So(events, convey.ShouldHaveLength, 2)
+			convey.So(events[1], convey.ShouldStartWith, "data: ")
+			convey.So(events[1], convey.ShouldContainSubstring, openai.ErrorCodeStreamInterrupted)
+			convey.So(events[1], convey.ShouldContainSubstring, "upstream stream interrupted (aiproxy: r1)")
+		})
+	})
+}
@@ -0,0 +1,292 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+)
+
+// GetRoutingRules godoc
+//
+//	@Summary		Get routing rules
+//	@Description	Returns all routing rules in evaluation order
+//	@Tags			routing_rule
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Success		200	{object}	middleware.APIResponse{data=[]model.RoutingRule}
+//	@Router			/api/routing_rules [get]
+func GetRoutingRules(c *gin.Context) {
+	rules, err := model.GetRoutingRules()
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, rules)
+}
+
+// GetRoutingRule godoc
+//
+//	@Summary		Get a routing rule
+//	@Description	Returns a routing rule by its ID
+//	@Tags			routing_rule
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id	path		int	true	"Routing rule ID"
+//	@Success		200	{object}	middleware.APIResponse{data=model.RoutingRule}
+//	@Router			/api/routing_rules/{id} [get]
+func GetRoutingRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	rule, err := model.GetRoutingRuleByID(id)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, rule)
+}
+
+type AddRoutingRuleRequest struct {
+	Conditions  model.RoutingConditions `json:"conditions"`
+	Action      model.RoutingAction     `json:"action"`
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Priority    int                     `json:"priority"`
+	Status      int                     `json:"status"`
+}
+
+func (r *AddRoutingRuleRequest) ToRoutingRule() (*model.RoutingRule, error) {
+	rule := &model.RoutingRule{
+		Conditions:  r.Conditions,
+		Action:      r.Action,
+		Name:        r.Name,
+		Description: r.Description,
+		Priority:    r.Priority,
+		Status:      r.Status,
+	}
+	if rule.Status == 0 {
+		rule.Status = model.RoutingRuleStatusEnabled
+	}
+	return rule, rule.Validate()
+}
+
+// AddRoutingRule godoc
+//
+//	@Summary		Add a routing rule
+//	@Description	Adds a new routing rule
+//	@Tags			routing_rule
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			rule	body		AddRoutingRuleRequest	true	"Routing rule information"
+//	@Success		200		{object}	middleware.APIResponse{data=model.RoutingRule}
+//	@Router			/api/routing_rules [post]
+func AddRoutingRule(c *gin.Context) {
+	req := AddRoutingRuleRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	rule, err := req.ToRoutingRule()
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	err = model.CreateRoutingRule(rule)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, rule)
+}
+
+// UpdateRoutingRule godoc
+//
+//	@Summary		Update a routing rule
+//	@Description	Updates a routing rule by its ID
+//	@Tags			routing_rule
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id		path		int						true	"Routing rule ID"
+//	@Param			rule	body		AddRoutingRuleRequest	true	"Updated routing rule information"
+//	@Success		200		{object}	middleware.APIResponse{data=model.RoutingRule}
+//	@Router			/api/routing_rules/{id} [put]
+func UpdateRoutingRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	req := AddRoutingRuleRequest{}
+	err = c.ShouldBindJSON(&req)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	rule, err := req.ToRoutingRule()
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	rule.ID = id
+	err = model.UpdateRoutingRule(rule)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, rule)
+}
+
+type UpdateRoutingRuleStatusRequest struct {
+	Status int `json:"status"`
+}
+
+// UpdateRoutingRuleStatus godoc
+//
+//	@Summary		Update routing rule status
+//	@Description	Enables or disables a routing rule
+//	@Tags			routing_rule
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id		path		int								true	"Routing rule ID"
+//	@Param			status	body		UpdateRoutingRuleStatusRequest	true	"Status information"
+//	@Success		200		{object}	middleware.APIResponse
+//	@Router			/api/routing_rules/{id}/status [post]
+func UpdateRoutingRuleStatus(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	status := UpdateRoutingRuleStatusRequest{}
+	err = c.ShouldBindJSON(&status)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	if status.Status != model.RoutingRuleStatusEnabled &&
+		status.Status != model.RoutingRuleStatusDisabled {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid status")
+		return
+	}
+	err = model.UpdateRoutingRuleStatus(id, status.Status)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, nil)
+}
+
+// DeleteRoutingRule godoc
+//
+//	@Summary		Delete a routing rule
+//	@Description	Deletes a routing rule by its ID
+//	@Tags			routing_rule
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			id	path		int	true	"Routing rule ID"
+//	@Success		200	{object}	middleware.APIResponse
+//	@Router			/api/routing_rules/{id} [delete]
+func DeleteRoutingRule(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	err = model.DeleteRoutingRuleByID(id)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, nil)
+}
+
+type DryRunRoutingRuleRequest struct {
+	Headers   map[string]string `json:"headers"`
+	Body      json.RawMessage   `json:"body"`
+	Model     string            `json:"model"`
+	Group     string            `json:"group"`
+	TokenName string            `json:"token_name"`
+}
+
+type DryRunRoutingRuleResponse struct {
+	Rule    *model.RoutingRule      `json:"rule,omitempty"`
+	Model   string                  `json:"model"`
+	Attrs   middleware.RequestAttrs `json:"attrs"`
+	Matched bool                    `json:"matched"`
+}
+
+// DryRunRoutingRule godoc
+//
+//	@Summary		Dry run routing rules
+//	@Description	Returns the enabled routing rule a sample request matches, a model alias is resolved first like in the relay
+//	@Tags			routing_rule
+//	@Accept			json
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			request	body		DryRunRoutingRuleRequest	true	"Sample request"
+//	@Success		200		{object}	middleware.APIResponse{data=DryRunRoutingRuleResponse}
+//	@Router			/api/routing_rules/dry_run [post]
+func DryRunRoutingRule(c *gin.Context) {
+	req := DryRunRoutingRuleRequest{}
+	err := c.ShouldBindJSON(&req)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+
+	var attrs middleware.RequestAttrs
+	if len(req.Body) > 0 {
+		attrs, err = middleware.ParseRequestAttrs(req.Body)
+		if err != nil {
+			middleware.ErrorResponse(c, http.StatusOK, err.Error())
+			return
+		}
+		if req.Model == "" {
+			req.Model, _ = middleware.GetModelFromJSON(req.Body)
+		}
+	}
+
+	var group *model.GroupCache
+	if req.Group != "" {
+		group, err = model.CacheGetGroup(req.Group)
+		if err != nil {
+			middleware.ErrorResponse(c, http.StatusOK, err.Error())
+			return
+		}
+	}
+	// the rules are matched against the real model of an alias
+	if target, ok := model.ResolveModelAlias(group, req.Model); ok {
+		req.Model = target
+	}
+
+	header := make(http.Header, len(req.Headers))
+	for k, v := range req.Headers {
+		header.Set(k, v)
+	}
+
+	rule := model.LoadModelCaches().RoutingRules.Match(&model.RoutingRequest{
+		Model:        req.Model,
+		Group:        req.Group,
+		TokenName:    req.TokenName,
+		Header:       header,
+		PromptLength: attrs.PromptLength,
+		HasImage:     attrs.HasImage,
+		Stream:       attrs.Stream,
+	})
+	middleware.SuccessResponse(c, DryRunRoutingRuleResponse{
+		Rule:    rule,
+		Model:   req.Model,
+		Attrs:   attrs,
+		Matched: rule != nil,
+	})
+}
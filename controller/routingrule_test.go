@@ -0,0 +1,64 @@
+package controller_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/controller"
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func dryRunRoutingRule(body string) *controller.DryRunRoutingRuleResponse {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/routing_rules/dry_run", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	controller.DryRunRoutingRule(c)
+
+	var resp struct {
+		Data    *controller.DryRunRoutingRuleResponse `json:"data"`
+		Message string                                `json:"message"`
+		Success bool                                  `json:"success"`
+	}
+	convey.So(sonic.Unmarshal(w.Body.Bytes(), &resp), convey.ShouldBeNil)
+	convey.So(resp.Message, convey.ShouldBeEmpty)
+	convey.So(resp.Success, convey.ShouldBeTrue)
+	return resp.Data
+}
+
+func TestDryRunRoutingRule(t *testing.T) {
+	convey.Convey("TestDryRunRoutingRule", t, func() {
+		initTestDB(t)
+		convey.So(model.CreateGroup(&model.Group{
+			ID:           "g1",
+			Status:       model.GroupStatusEnabled,
+			ModelAliases: map[string]string{"smart": "gpt-4o"},
+		}), convey.ShouldBeNil)
+		convey.So(model.CreateRoutingRule(&model.RoutingRule{
+			Name:       "gpt-4o to the premium set",
+			Conditions: model.RoutingConditions{Models: []string{"gpt-4o"}},
+			Action:     model.RoutingAction{Sets: []string{"premium"}},
+		}), convey.ShouldBeNil)
+		convey.So(model.InitModelConfigAndChannelCache(), convey.ShouldBeNil)
+
+		// the alias of the group is resolved before the rules are matched
+		resp := dryRunRoutingRule(`{"model":"smart","group":"g1"}`)
+		convey.So(resp.Matched, convey.ShouldBeTrue)
+		convey.So(resp.Model, convey.ShouldEqual, "gpt-4o")
+		convey.So(resp.Rule.Name, convey.ShouldEqual, "gpt-4o to the premium set")
+
+		resp = dryRunRoutingRule(`{"body":{"model":"smart","messages":[{"role":"user","content":"hi"}]},"group":"g1"}`)
+		convey.So(resp.Matched, convey.ShouldBeTrue)
+		convey.So(resp.Model, convey.ShouldEqual, "gpt-4o")
+
+		// the alias is unknown without the group
+		resp = dryRunRoutingRule(`{"model":"smart"}`)
+		convey.So(resp.Matched, convey.ShouldBeFalse)
+		convey.So(resp.Model, convey.ShouldEqual, "smart")
+	})
+}
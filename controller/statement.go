@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/middleware"
+	"github.com/labring/aiproxy/model"
+)
+
+// GetStatements godoc
+//
+//	@Summary		Get statements
+//	@Description	Returns the closed monthly statements of all groups with pagination
+//	@Tags			statement
+//	@Produce		json
+//	@Security		ApiKeyAuth
+//	@Param			period		query		string	false	"Billing period, e.g. 2025-01"
+//	@Param			page		query		int		false	"Page number"
+//	@Param			per_page	query		int		false	"Items per page"
+//	@Success		200			{object}	middleware.APIResponse{data=map[string]any{statements=[]model.Statement,total=int}}
+//	@Router			/api/statements [get]
+func GetStatements(c *gin.Context) {
+	page, perPage := parsePageParams(c)
+	statements, total, err := model.GetStatements(c.Query("period"), page, perPage)
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	middleware.SuccessResponse(c, gin.H{
+		"statements": statements,
+		"total":      total,
+	})
+}
+
+// GetGroupStatement godoc
+//
+//	@Summary		Get group statement
+//	@Description	Returns the monthly statement of a group, an ended period is closed and no longer changes, csv format exports it as a file
+//	@Tags			statement
+//	@Produce		json
+//	@Produce		text/csv
+//	@Security		ApiKeyAuth
+//	@Param			group	path		string	true	"Group name"
+//	@Param			period	query		string	false	"Billing period, e.g. 2025-01, the current month by default"
+//	@Param			format	query		string	false	"json or csv"
+//	@Success		200		{object}	middleware.APIResponse{data=model.Statement}
+//	@Router			/api/statement/{group} [get]
+func GetGroupStatement(c *gin.Context) {
+	group := c.Param("group")
+	if group == "" {
+		middleware.ErrorResponse(c, http.StatusOK, "invalid parameter")
+		return
+	}
+	statement, err := model.GetGroupStatement(group, c.Query("period"))
+	if err != nil {
+		middleware.ErrorResponse(c, http.StatusOK, err.Error())
+		return
+	}
+	switch c.Query("format") {
+	case "", "json":
+		middleware.SuccessResponse(c, statement)
+	case "csv":
+		data, err := statementCSV(statement)
+		if err != nil {
+			middleware.ErrorResponse(c, http.StatusOK, err.Error())
+			return
+		}
+		c.Header("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="statement-%s-%s.csv"`, statement.GroupID, statement.Period))
+		c.Data(http.StatusOK, "text/csv; charset=utf-8", data)
+	default:
+		middleware.ErrorResponse(c, http.StatusOK, "invalid format, must be json or csv")
+	}
+}
+
+var statementCSVHeader = []string{
+	"group",
+	"period",
+	"type",
+	"name",
+	"request_count",
+	"exception_count",
+	"input_tokens",
+	"output_tokens",
+	"cached_tokens",
+	"cache_creation_tokens",
+	"reasoning_tokens",
+	"audio_input_tokens",
+	"audio_output_tokens",
+	"image_input_tokens",
+	"units",
+	"total_tokens",
+	"used_amount",
+}
+
+// statementCSV writes a row for each model and token of the statement and the total row
+func statementCSV(s *model.Statement) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if err := w.Write(statementCSVHeader); err != nil {
+		return nil, err
+	}
+	writeItem := func(itemType string, item model.StatementItem) error {
+		return w.Write([]string{
+			s.GroupID,
+			s.Period,
+			itemType,
+			item.Name,
+			strconv.FormatInt(item.RequestCount, 10),
+			strconv.FormatInt(item.ExceptionCount, 10),
+			strconv.FormatInt(item.InputTokens, 10),
+			strconv.FormatInt(item.OutputTokens, 10),
+			strconv.FormatInt(item.CachedTokens, 10),
+			strconv.FormatInt(item.CacheCreationTokens, 10),
+			strconv.FormatInt(item.ReasoningTokens, 10),
+			strconv.FormatInt(item.AudioInputTokens, 10),
+			strconv.FormatInt(item.AudioOutputTokens, 10),
+			strconv.FormatInt(item.ImageInputTokens, 10),
+			strconv.FormatInt(item.Units, 10),
+			strconv.FormatInt(item.TotalTokens, 10),
+			strconv.FormatFloat(item.UsedAmount, 'f', -1, 64),
+		})
+	}
+	for _, item := range s.Models {
+		if err := writeItem("model", item); err != nil {
+			return nil, err
+		}
+	}
+	for _, item := range s.Tokens {
+		if err := writeItem("token", item); err != nil {
+			return nil, err
+		}
+	}
+	if err := writeItem("total", s.Total); err != nil {
+		return nil, err
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
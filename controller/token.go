@@ -37,11 +37,14 @@ func (t *TokenResponse) MarshalJSON() ([]byte, error) {
 
 type (
 	AddTokenRequest struct {
-		Name      string   `json:"name"`
-		Subnets   []string `json:"subnets"`
-		Models    []string `json:"models"`
-		ExpiredAt int64    `json:"expiredAt"`
-		Quota     float64  `json:"quota"`
+		Name           string               `json:"name"`
+		Subnets        []string             `json:"subnets"`
+		Models         []string             `json:"models"`
+		ExpiredAt      int64                `json:"expiredAt"`
+		Quota          float64              `json:"quota"`
+		RateLimitWait  bool                 `json:"rate_limit_wait"`
+		PriorityClass  string               `json:"priority_class"`
+		PeriodicQuotas model.PeriodicQuotas `json:"periodic_quotas"`
 	}
 
 	UpdateTokenStatusRequest struct {
@@ -59,11 +62,14 @@ func (at *AddTokenRequest) ToToken() *model.Token {
 		expiredAt = time.UnixMilli(at.ExpiredAt)
 	}
 	return &model.Token{
-		Name:      model.EmptyNullString(at.Name),
-		Subnets:   at.Subnets,
-		Models:    at.Models,
-		ExpiredAt: expiredAt,
-		Quota:     at.Quota,
+		Name:           model.EmptyNullString(at.Name),
+		Subnets:        at.Subnets,
+		Models:         at.Models,
+		ExpiredAt:      expiredAt,
+		Quota:          at.Quota,
+		RateLimitWait:  at.RateLimitWait,
+		PriorityClass:  at.PriorityClass,
+		PeriodicQuotas: at.PeriodicQuotas,
 	}
 }
 
@@ -77,14 +83,20 @@ func validateToken(token AddTokenRequest) error {
 	if err := network.IsValidSubnets(token.Subnets); err != nil {
 		return fmt.Errorf("invalid subnet: %w", err)
 	}
-	return nil
+	if err := token.PeriodicQuotas.Validate(); err != nil {
+		return err
+	}
+	return model.ValidatePriorityClass(token.PriorityClass)
 }
 
 func validateTokenUpdate(token AddTokenRequest) error {
 	if err := network.IsValidSubnets(token.Subnets); err != nil {
 		return fmt.Errorf("invalid subnet: %w", err)
 	}
-	return nil
+	if err := token.PeriodicQuotas.Validate(); err != nil {
+		return err
+	}
+	return model.ValidatePriorityClass(token.PriorityClass)
 }
 
 func buildTokenResponse(token *model.Token) *TokenResponse {
@@ -20,6 +20,7 @@ import (
 	"github.com/labring/aiproxy/common/balance"
 	"github.com/labring/aiproxy/common/config"
 	"github.com/labring/aiproxy/common/consume"
+	"github.com/labring/aiproxy/common/env"
 	"github.com/labring/aiproxy/common/notify"
 	"github.com/labring/aiproxy/controller"
 	"github.com/labring/aiproxy/middleware"
@@ -53,6 +54,11 @@ func initializeServices() error {
 func initializeBalance() error {
 	sealosJwtKey := os.Getenv("SEALOS_JWT_KEY")
 	if sealosJwtKey == "" {
+		if env.Bool("BALANCE_LOCAL_ENABLED", false) {
+			log.Info("BALANCE_LOCAL_ENABLED is set, balance will be kept in the local ledger")
+			balance.InitLocal()
+			return nil
+		}
 		log.Info("SEALOS_JWT_KEY is not set, balance will not be enabled")
 		return nil
 	}
@@ -150,9 +156,10 @@ func setupHTTPServer() (*http.Server, *gin.Engine) {
 	}, server
 }
 
-func autoTestBannedModels(ctx context.Context) {
-	log.Info("auto test banned models start")
-	ticker := time.NewTicker(time.Second * 30)
+func cleanLog(ctx context.Context) {
+	log.Info("clean log start")
+	// the interval should not be too large to avoid cleaning too much at once
+	ticker := time.NewTicker(time.Second * 15)
 	defer ticker.Stop()
 
 	for {
@@ -160,15 +167,17 @@ func autoTestBannedModels(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			controller.AutoTestBannedModels()
+			err := model.CleanLog(1000)
+			if err != nil {
+				notify.ErrorThrottle("cleanLog", time.Minute, "clean log failed", err.Error())
+			}
 		}
 	}
 }
 
-func cleanLog(ctx context.Context) {
-	log.Info("clean log start")
-	// the interval should not be too large to avoid cleaning too much at once
-	ticker := time.NewTicker(time.Second * 15)
+func reconcileConsumeErrors(ctx context.Context) {
+	log.Info("reconcile consume errors start")
+	ticker := time.NewTicker(time.Minute)
 	defer ticker.Stop()
 
 	for {
@@ -176,9 +185,9 @@ func cleanLog(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			err := model.CleanLog(1000)
-			if err != nil {
-				notify.ErrorThrottle("cleanLog", time.Minute, "clean log failed", err.Error())
+			err := consume.ReconcileConsumeErrors(ctx, 100)
+			if err != nil && !errors.Is(err, context.Canceled) {
+				notify.ErrorThrottle("reconcileConsumeErrors", time.Minute, "reconcile consume errors failed", err.Error())
 			}
 		}
 	}
@@ -217,8 +226,8 @@ func main() {
 		}
 	}()
 
-	go autoTestBannedModels(ctx)
 	go cleanLog(ctx)
+	go reconcileConsumeErrors(ctx)
 	go controller.UpdateChannelsBalance(time.Minute * 10)
 
 	batchProcessorCtx, batchProcessorCancel := context.WithCancel(context.Background())
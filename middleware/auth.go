@@ -10,6 +10,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/labring/aiproxy/common/config"
 	"github.com/labring/aiproxy/common/network"
+	"github.com/labring/aiproxy/common/periodquota"
 	"github.com/labring/aiproxy/model"
 	"github.com/labring/aiproxy/relay/meta"
 	"github.com/labring/aiproxy/relay/mode"
@@ -97,6 +98,15 @@ func TokenAuth(c *gin.Context) {
 		}
 	}
 
+	if !useInternalToken &&
+		!checkPeriodicQuotas(c,
+			periodquota.TokenSubject(token.ID),
+			fmt.Sprintf("token (%s[%d])", token.Name, token.ID),
+			token.PeriodicQuotas,
+		) {
+		return
+	}
+
 	modelCaches := model.LoadModelCaches()
 
 	var group *model.GroupCache
@@ -1,12 +1,16 @@
 package middleware
 
 const (
-	Channel      = "channel"
-	Group        = "group"
-	Token        = "token"
-	GroupBalance = "group_balance"
-	RequestModel = "request_model"
-	RequestID    = "X-Request-Id"
-	ModelCaches  = "model_caches"
-	ModelConfig  = "model_config"
+	Channel         = "channel"
+	Group           = "group"
+	Token           = "token"
+	GroupBalance    = "group_balance"
+	RequestModel    = "request_model"
+	ModelAlias      = "model_alias"
+	PriorityClass   = "priority_class"
+	RequestID       = "X-Request-Id"
+	ModelCaches     = "model_caches"
+	ModelConfig     = "model_config"
+	RoutingRule     = "routing_rule"
+	RequestAttrsKey = "request_attrs"
 )
@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -16,7 +17,9 @@ import (
 	"github.com/labring/aiproxy/common/config"
 	"github.com/labring/aiproxy/common/consume"
 	"github.com/labring/aiproxy/common/notify"
+	"github.com/labring/aiproxy/common/periodquota"
 	"github.com/labring/aiproxy/common/rpmlimit"
+	"github.com/labring/aiproxy/common/waitqueue"
 	"github.com/labring/aiproxy/model"
 	"github.com/labring/aiproxy/relay/meta"
 	"github.com/labring/aiproxy/relay/mode"
@@ -142,10 +145,81 @@ func checkGroupModelRPMAndTPM(c *gin.Context, group *model.GroupCache, mc *model
 	return nil
 }
 
+const rateLimitQueuePollInterval = 500 * time.Millisecond
+
+var rateLimitQueue = waitqueue.New()
+
+// RateLimitQueueStats returns the depth of the rpm and tpm wait queue of this instance
+func RateLimitQueueStats() waitqueue.Stats {
+	return rateLimitQueue.Stats()
+}
+
+func rateLimitWaitEnabled(c *gin.Context, group *model.GroupCache) bool {
+	if group.RateLimitWait {
+		return true
+	}
+	return GetToken(c).RateLimitWait
+}
+
+// hasGroupModelRPMAndTPMRoom reports whether the rpm and tpm windows can take a request, without recording it
+func hasGroupModelRPMAndTPMRoom(c *gin.Context, group *model.GroupCache, mc *model.ModelConfig) bool {
+	adjustedModelConfig := GetGroupAdjustedModelConfig(group, mc)
+	if adjustedModelConfig.RPM > 0 &&
+		rpmlimit.PeekRequest(c.Request.Context(), group.ID, mc.Model, time.Minute) >= adjustedModelConfig.RPM {
+		return false
+	}
+	if adjustedModelConfig.TPM > 0 {
+		tpm, err := model.CacheGetGroupModelTPM(group.ID, mc.Model)
+		if err == nil && tpm >= adjustedModelConfig.TPM {
+			return false
+		}
+	}
+	return true
+}
+
+// waitGroupModelRPMAndTPM holds the request in the group model queue until the rpm and tpm windows have room
+func waitGroupModelRPMAndTPM(c *gin.Context, group *model.GroupCache, mc *model.ModelConfig) error {
+	timeout := config.GetRateLimitQueueTimeout()
+	if timeout <= 0 {
+		return ErrRequestRateLimitExceeded
+	}
+
+	log := GetLogger(c)
+	ctx, cancel := context.WithTimeout(c.Request.Context(), time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	var checkErr error
+	err := rateLimitQueue.Wait(
+		ctx,
+		group.ID+":"+mc.Model,
+		int(config.GetRateLimitQueueMaxLength()),
+		rateLimitQueuePollInterval,
+		func() bool {
+			if !hasGroupModelRPMAndTPMRoom(c, group, mc) {
+				return false
+			}
+			checkErr = checkGroupModelRPMAndTPM(c, group, mc)
+			return checkErr == nil
+		},
+	)
+	log.Data["rate_limit_wait"] = time.Since(start).String()
+	if err != nil {
+		if checkErr != nil {
+			return checkErr
+		}
+		return ErrRequestRateLimitExceeded
+	}
+	return nil
+}
+
 type GroupBalanceConsumer struct {
 	Group        string
 	CheckBalance func(amount float64) bool
-	Consumer     balance.PostGroupConsumer
+	// Hold reserves the amount for the request from the balance minus the outstanding holds,
+	// it is released when the request is consumed, nil when the balance is not limited
+	Hold     func(ctx context.Context, requestID string, amount float64) (bool, error)
+	Consumer balance.PostGroupConsumer
 }
 
 func GetGroupBalanceConsumerFromContext(c *gin.Context) *GroupBalanceConsumer {
@@ -187,6 +261,9 @@ func GetGroupBalanceConsumer(c *gin.Context, group *model.GroupCache) (*GroupBal
 			CheckBalance: func(amount float64) bool {
 				return groupBalance >= amount
 			},
+			Hold: func(ctx context.Context, requestID string, amount float64) (bool, error) {
+				return balance.Hold(ctx, group.ID, requestID, groupBalance, amount)
+			},
 			Consumer: consumer,
 		}
 	}
@@ -221,6 +298,24 @@ func checkGroupBalance(c *gin.Context, group *model.GroupCache) bool {
 		})
 		return false
 	}
+
+	if gbc.Hold != nil && config.GetBalanceHoldEnabled() {
+		held, err := balance.GetHeldAmount(c.Request.Context(), group.ID)
+		if err != nil {
+			GetLogger(c).Errorf("get group (%s) held balance failed: %s", group.ID, err)
+			return true
+		}
+		if held > 0 && !gbc.CheckBalance(held) {
+			AbortLogWithMessage(c, http.StatusForbidden,
+				fmt.Sprintf("group (%s) balance not enough, %s is held by the requests in progress",
+					group.ID, strconv.FormatFloat(held, 'f', -1, 64)),
+				&ErrorField{
+					Code: GroupBalanceNotEnough,
+				},
+			)
+			return false
+		}
+	}
 	return true
 }
 
@@ -231,7 +326,8 @@ func NewDistribute(mode mode.Mode) gin.HandlerFunc {
 }
 
 const (
-	AIProxyChannelHeader = "Aiproxy-Channel"
+	AIProxyChannelHeader  = "Aiproxy-Channel"
+	AIProxyPriorityHeader = "Aiproxy-Priority"
 )
 
 func getChannelFromHeader(header string, mc *model.ModelCaches, availableSet []string, model string) (*model.Channel, error) {
@@ -277,6 +373,14 @@ func distribute(c *gin.Context, mode mode.Mode) {
 		return
 	}
 
+	if !checkPeriodicQuotas(c,
+		periodquota.GroupSubject(group.ID),
+		fmt.Sprintf("group (%s)", group.ID),
+		group.PeriodicQuotas,
+	) {
+		return
+	}
+
 	requestModel, err := getRequestModel(c, mode)
 	if err != nil {
 		AbortLogWithMessage(c, http.StatusInternalServerError, err.Error(), &ErrorField{
@@ -293,6 +397,13 @@ func distribute(c *gin.Context, mode mode.Mode) {
 		return
 	}
 
+	requestModel = applyModelAlias(c, group, requestModel)
+
+	requestModel, ok := applyRoutingRule(c, mode, group, requestModel)
+	if !ok {
+		return
+	}
+
 	c.Set(RequestModel, requestModel)
 
 	SetLogModelFields(log.Data, requestModel)
@@ -312,15 +423,14 @@ func distribute(c *gin.Context, mode mode.Mode) {
 	c.Set(ModelConfig, mc)
 
 	if channelHeader := c.Request.Header.Get(AIProxyChannelHeader); group.Status == model.GroupStatusInternal && channelHeader != "" {
-		channel, err := getChannelFromHeader(channelHeader, GetModelCaches(c), group.GetAvailableSets(), requestModel)
+		channel, err := getChannelFromHeader(channelHeader, GetModelCaches(c), GetAvailableSets(c), requestModel)
 		if err != nil {
 			AbortLogWithMessage(c, http.StatusBadRequest, err.Error())
 			return
 		}
 		c.Set(Channel, channel)
 	} else {
-		token := GetToken(c)
-		if !token.ContainsModel(requestModel) {
+		if !tokenContainsModel(c, requestModel) {
 			AbortLogWithMessage(c,
 				http.StatusNotFound,
 				fmt.Sprintf("The model `%s` does not exist or you do not have access to it.", requestModel),
@@ -333,7 +443,13 @@ func distribute(c *gin.Context, mode mode.Mode) {
 		}
 	}
 
-	if err := checkGroupModelRPMAndTPM(c, group, mc); err != nil {
+	setPriorityClass(c)
+
+	err = checkGroupModelRPMAndTPM(c, group, mc)
+	if err != nil && rateLimitWaitEnabled(c, group) {
+		err = waitGroupModelRPMAndTPM(c, group, mc)
+	}
+	if err != nil {
 		errMsg := err.Error()
 		consume.AsyncConsume(
 			nil,
@@ -357,6 +473,125 @@ func distribute(c *gin.Context, mode mode.Mode) {
 	c.Next()
 }
 
+// applyModelAlias resolves a group or global alias to the real model,
+// which is then served, logged and billed instead of the alias
+func applyModelAlias(c *gin.Context, group *model.GroupCache, requestModel string) string {
+	target, ok := model.ResolveModelAlias(group, requestModel)
+	if !ok {
+		return requestModel
+	}
+	c.Set(ModelAlias, requestModel)
+	GetLogger(c).Data["model_alias"] = requestModel
+	return target
+}
+
+// GetModelAlias returns the alias the request was sent with, empty if none
+func GetModelAlias(c *gin.Context) string {
+	return c.GetString(ModelAlias)
+}
+
+// setPriorityClass resolves the priority class of the request from the token and the priority header
+func setPriorityClass(c *gin.Context) {
+	class := model.ResolvePriorityClass(GetToken(c).PriorityClass, c.Request.Header.Get(AIProxyPriorityHeader))
+	c.Set(PriorityClass, class)
+	if class != model.PriorityClassNormal {
+		GetLogger(c).Data["priority_class"] = class
+	}
+}
+
+// GetPriorityClass returns the priority class of the request, normal if not resolved
+func GetPriorityClass(c *gin.Context) string {
+	if class := c.GetString(PriorityClass); class != "" {
+		return class
+	}
+	return model.PriorityClassNormal
+}
+
+func tokenContainsModel(c *gin.Context, requestModel string) bool {
+	token := GetToken(c)
+	if alias := GetModelAlias(c); alias != "" {
+		return token.ContainsAliasModel(alias, requestModel)
+	}
+	return token.ContainsModel(requestModel)
+}
+
+// applyRoutingRule matches the request against the routing rules,
+// returns the model to serve and false if the request was rejected
+func applyRoutingRule(c *gin.Context, m mode.Mode, group *model.GroupCache, requestModel string) (string, bool) {
+	rules := GetModelCaches(c).RoutingRules
+	if len(rules) == 0 {
+		return requestModel, true
+	}
+
+	req := &model.RoutingRequest{
+		Model:     requestModel,
+		Group:     group.ID,
+		TokenName: GetToken(c).Name,
+		Header:    c.Request.Header,
+	}
+	if rules.NeedsRequestBody() {
+		// a body which can not be parsed is matched without its attributes
+		attrs, err := GetRequestAttrs(c, m)
+		if err != nil {
+			GetLogger(c).Warnf("parse request attributes failed, the routing rules are matched without them: %s", err)
+		}
+		req.PromptLength = attrs.PromptLength
+		req.HasImage = attrs.HasImage
+		req.Stream = attrs.Stream
+	}
+
+	rule := rules.Match(req)
+	if rule == nil {
+		return requestModel, true
+	}
+
+	log := GetLogger(c)
+	log.Data["routing_rule"] = rule.ID
+
+	if rule.Action.Reject {
+		message := rule.Action.RejectMessage
+		if message == "" {
+			message = "request rejected by routing rule"
+		}
+		AbortLogWithMessage(c, rule.Action.GetRejectStatus(), message, &ErrorField{
+			Type: "invalid_request_error",
+			Code: "routing_rule_rejected",
+		})
+		return "", false
+	}
+
+	c.Set(RoutingRule, rule)
+
+	if len(rule.Action.Sets) > 0 {
+		GetToken(c).SetAvailableSets(rule.Action.Sets)
+	}
+
+	if rule.Action.Model != "" && rule.Action.Model != requestModel {
+		log.Data["routed_from_model"] = requestModel
+		return rule.Action.Model, true
+	}
+	return requestModel, true
+}
+
+// GetRoutingRule returns the matched routing rule of the request, nil if none matched
+func GetRoutingRule(c *gin.Context) *model.RoutingRule {
+	rule, ok := c.Get(RoutingRule)
+	if !ok {
+		return nil
+	}
+	r, _ := rule.(*model.RoutingRule)
+	return r
+}
+
+// GetAvailableSets returns the channel sets the request may use,
+// the sets pinned by the matched routing rule take precedence over the group sets
+func GetAvailableSets(c *gin.Context) []string {
+	if rule := GetRoutingRule(c); rule != nil && len(rule.Action.Sets) > 0 {
+		return rule.Action.Sets
+	}
+	return GetGroup(c).GetAvailableSets()
+}
+
 func GetRequestModel(c *gin.Context) string {
 	return c.GetString(RequestModel)
 }
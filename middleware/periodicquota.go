@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/periodquota"
+	"github.com/labring/aiproxy/model"
+)
+
+const (
+	PeriodicQuotaExhausted = "periodic_quota_exhausted"
+)
+
+// checkPeriodicQuotas aborts the request when a quota of the subject is exhausted in its current period,
+// the counters failing to load does not block the request
+func checkPeriodicQuotas(c *gin.Context, subject, name string, quotas model.PeriodicQuotas) bool {
+	remaining, err := periodquota.GetRemaining(c.Request.Context(), subject, quotas)
+	if err != nil {
+		GetLogger(c).Errorf("get %s periodic quotas failed: %s", name, err)
+		return true
+	}
+	for _, r := range remaining {
+		if r.Exhausted() {
+			AbortLogWithMessage(c, http.StatusForbidden,
+				fmt.Sprintf("%s %s quota is exhausted, it resets at %s", name, r.Period, r.ResetAt.Format(time.RFC3339)),
+				&ErrorField{
+					Code: PeriodicQuotaExhausted,
+				},
+			)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,142 @@
+package middleware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/conv"
+	"github.com/labring/aiproxy/relay/mode"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+)
+
+// RequestAttrs are the request body properties used to route a request
+type RequestAttrs struct {
+	// PromptLength is the number of characters of the prompt text
+	PromptLength int64 `json:"prompt_length"`
+	// MaxTokens is the requested completion tokens limit
+	MaxTokens  int64 `json:"max_tokens"`
+	HasImage   bool  `json:"has_image"`
+	Stream     bool  `json:"stream"`
+	ToolChoice bool  `json:"tool_choice"`
+}
+
+type requestAttrsBody struct {
+	Prompt              any                   `json:"prompt"`
+	Input               any                   `json:"input"`
+	ToolChoice          any                   `json:"tool_choice"`
+	Messages            []*relaymodel.Message `json:"messages"`
+	MaxTokens           lenientInt64          `json:"max_tokens"`
+	MaxCompletionTokens lenientInt64          `json:"max_completion_tokens"`
+	Stream              bool                  `json:"stream"`
+}
+
+// lenientInt64 accepts an integer sent as a float or a string, a value which is not a number is 0
+type lenientInt64 int64
+
+func (i *lenientInt64) UnmarshalJSON(data []byte) error {
+	f, err := strconv.ParseFloat(strings.Trim(conv.BytesToString(data), `"`), 64)
+	if err != nil {
+		*i = 0
+		return nil
+	}
+	*i = lenientInt64(f)
+	return nil
+}
+
+func isImageContentType(typ any) bool {
+	switch typ {
+	case relaymodel.ContentTypeImageURL, "image", "input_image":
+		return true
+	default:
+		return false
+	}
+}
+
+func textLength(v any) int64 {
+	switch v := v.(type) {
+	case string:
+		return int64(utf8.RuneCountInString(v))
+	case []any:
+		var length int64
+		for _, item := range v {
+			if str, ok := item.(string); ok {
+				length += int64(utf8.RuneCountInString(str))
+			}
+		}
+		return length
+	default:
+		return 0
+	}
+}
+
+// ParseRequestAttrs reads the routing attributes of a json request body
+func ParseRequestAttrs(body []byte) (RequestAttrs, error) {
+	var req requestAttrsBody
+	if err := sonic.Unmarshal(body, &req); err != nil {
+		return RequestAttrs{}, fmt.Errorf("parse request body failed: %w", err)
+	}
+
+	attrs := RequestAttrs{
+		Stream:       req.Stream,
+		PromptLength: textLength(req.Prompt) + textLength(req.Input),
+		MaxTokens:    int64(max(req.MaxTokens, req.MaxCompletionTokens)),
+		ToolChoice:   req.ToolChoice != nil,
+	}
+	for _, message := range req.Messages {
+		if message == nil {
+			continue
+		}
+		switch content := message.Content.(type) {
+		case string:
+			attrs.PromptLength += int64(utf8.RuneCountInString(content))
+		case []any:
+			for _, item := range content {
+				part, ok := item.(map[string]any)
+				if !ok {
+					continue
+				}
+				if isImageContentType(part["type"]) {
+					attrs.HasImage = true
+					continue
+				}
+				if text, ok := part["text"].(string); ok {
+					attrs.PromptLength += int64(utf8.RuneCountInString(text))
+				}
+			}
+		}
+	}
+	return attrs, nil
+}
+
+// GetRequestAttrs only parses json bodies, form requests have empty attributes,
+// a body which can not be parsed has empty attributes and the error is returned once
+func GetRequestAttrs(c *gin.Context, m mode.Mode) (RequestAttrs, error) {
+	if attrs, ok := c.Get(RequestAttrsKey); ok {
+		return attrs.(RequestAttrs), nil
+	}
+	attrs, err := parseRequestAttrs(c, m)
+	c.Set(RequestAttrsKey, attrs)
+	return attrs, err
+}
+
+func parseRequestAttrs(c *gin.Context, m mode.Mode) (RequestAttrs, error) {
+	switch m {
+	case mode.ParsePdf,
+		mode.AudioTranscription,
+		mode.AudioTranslation:
+		return RequestAttrs{}, nil
+	}
+	body, err := common.GetRequestBody(c.Request)
+	if err != nil {
+		return RequestAttrs{}, err
+	}
+	if len(body) == 0 {
+		return RequestAttrs{}, nil
+	}
+	return ParseRequestAttrs(body)
+}
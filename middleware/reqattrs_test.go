@@ -0,0 +1,28 @@
+package middleware_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/middleware"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseRequestAttrs(t *testing.T) {
+	convey.Convey("TestParseRequestAttrs", t, func() {
+		attrs, err := middleware.ParseRequestAttrs([]byte(`{"max_tokens":1024.0,"stream":true}`))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(attrs.MaxTokens, convey.ShouldEqual, 1024)
+		convey.So(attrs.Stream, convey.ShouldBeTrue)
+
+		attrs, err = middleware.ParseRequestAttrs([]byte(`{"max_tokens":"256","max_completion_tokens":512}`))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(attrs.MaxTokens, convey.ShouldEqual, 512)
+
+		attrs, err = middleware.ParseRequestAttrs([]byte(`{"max_tokens":"unlimited"}`))
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(attrs.MaxTokens, convey.ShouldEqual, 0)
+
+		_, err = middleware.ParseRequestAttrs([]byte(`{"messages":`))
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
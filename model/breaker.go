@@ -0,0 +1,144 @@
+package model
+
+import (
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/common/config"
+	"gorm.io/gorm"
+)
+
+type ChannelBreakerTransition struct {
+	CreatedAt time.Time `gorm:"index;index:idx_breaker_transition_model_created,priority:2"  json:"created_at"`
+	OpenUntil time.Time `json:"open_until"`
+	Model     string    `gorm:"index:idx_breaker_transition_model_created,priority:1"        json:"model"`
+	FromState string    `json:"from"`
+	ToState   string    `json:"to"`
+	Reason    string    `gorm:"type:text"                                                    json:"reason,omitempty"`
+	ID        int       `gorm:"primaryKey"                                                   json:"id"`
+	ChannelID int       `gorm:"index"                                                        json:"channel_id"`
+}
+
+func (t *ChannelBreakerTransition) MarshalJSON() ([]byte, error) {
+	type Alias ChannelBreakerTransition
+	var openUntil int64
+	if !t.OpenUntil.IsZero() {
+		openUntil = t.OpenUntil.UnixMilli()
+	}
+	return sonic.Marshal(&struct {
+		*Alias
+		CreatedAt int64 `json:"created_at"`
+		OpenUntil int64 `json:"open_until,omitempty"`
+	}{
+		Alias:     (*Alias)(t),
+		CreatedAt: t.CreatedAt.UnixMilli(),
+		OpenUntil: openUntil,
+	})
+}
+
+func RecordChannelBreakerTransition(model string, channelID int, from, to string, openUntil time.Time, reason string) error {
+	return LogDB.Create(&ChannelBreakerTransition{
+		Model:     model,
+		ChannelID: channelID,
+		FromState: from,
+		ToState:   to,
+		OpenUntil: openUntil,
+		Reason:    reason,
+	}).Error
+}
+
+func filterChannelBreakerTransitions(tx *gorm.DB, model string, channelID int, start, end time.Time) *gorm.DB {
+	if model != "" {
+		tx = tx.Where("model = ?", model)
+	}
+	if channelID != 0 {
+		tx = tx.Where("channel_id = ?", channelID)
+	}
+	switch {
+	case !start.IsZero() && !end.IsZero():
+		tx = tx.Where("created_at BETWEEN ? AND ?", start, end)
+	case !start.IsZero():
+		tx = tx.Where("created_at >= ?", start)
+	case !end.IsZero():
+		tx = tx.Where("created_at <= ?", end)
+	}
+	return tx
+}
+
+func SearchChannelBreakerTransitions(model string, channelID int, start, end time.Time, page int, perPage int) ([]*ChannelBreakerTransition, int64, error) {
+	tx := filterChannelBreakerTransitions(LogDB.Model(&ChannelBreakerTransition{}), model, channelID, start, end)
+
+	var total int64
+	err := tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	if total <= 0 {
+		return nil, 0, nil
+	}
+
+	var transitions []*ChannelBreakerTransition
+	limit, offset := toLimitOffset(page, perPage)
+	err = tx.Order("created_at desc").Limit(limit).Offset(offset).Find(&transitions).Error
+	return transitions, total, err
+}
+
+type BreakerChartData struct {
+	Timestamp     int64 `json:"timestamp"`
+	OpenCount     int64 `json:"open_count"`
+	HalfOpenCount int64 `json:"half_open_count"`
+	CloseCount    int64 `json:"close_count"`
+}
+
+// GetChannelBreakerChartData counts the transitions into each state per time span
+func GetChannelBreakerChartData(model string, channelID int, start, end time.Time, timeSpan TimeSpanType) ([]*BreakerChartData, error) {
+	var transitions []*ChannelBreakerTransition
+	err := filterChannelBreakerTransitions(LogDB.Model(&ChannelBreakerTransition{}), model, channelID, start, end).
+		Select("created_at", "to_state").
+		Order("created_at asc").
+		Find(&transitions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	span := time.Hour
+	if timeSpan == TimeSpanDay {
+		span = 24 * time.Hour
+	}
+
+	chartData := []*BreakerChartData{}
+	for _, t := range transitions {
+		timestamp := t.CreatedAt.Truncate(span).Unix()
+		if len(chartData) == 0 || chartData[len(chartData)-1].Timestamp != timestamp {
+			chartData = append(chartData, &BreakerChartData{Timestamp: timestamp})
+		}
+		data := chartData[len(chartData)-1]
+		switch t.ToState {
+		case "open":
+			data.OpenCount++
+		case "half_open":
+			data.HalfOpenCount++
+		case "closed":
+			data.CloseCount++
+		}
+	}
+	return chartData, nil
+}
+
+func cleanChannelBreakerTransition(batchSize int) error {
+	logStorageHours := config.GetLogStorageHours()
+	if logStorageHours <= 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = defaultCleanLogBatchSize
+	}
+	return LogDB.
+		Session(&gorm.Session{SkipDefaultTransaction: true}).
+		Where(
+			"created_at < ?",
+			time.Now().Add(-time.Duration(logStorageHours)*time.Hour),
+		).
+		Limit(batchSize).
+		Delete(&ChannelBreakerTransition{}).Error
+}
@@ -60,18 +60,21 @@ func (t redisTime) MarshalBinary() ([]byte, error) {
 }
 
 type TokenCache struct {
-	ExpiredAt     redisTime        `json:"expired_at"  redis:"e"`
-	Group         string           `json:"group"       redis:"g"`
-	Key           string           `json:"-"           redis:"-"`
-	Name          string           `json:"name"        redis:"n"`
-	Subnets       redisStringSlice `json:"subnets"     redis:"s"`
-	Models        redisStringSlice `json:"models"      redis:"m"`
-	ID            int              `json:"id"          redis:"i"`
-	Status        int              `json:"status"      redis:"st"`
-	Quota         float64          `json:"quota"       redis:"q"`
-	UsedAmount    float64          `json:"used_amount" redis:"u"`
-	availableSets []string
-	modelsBySet   map[string][]string
+	ExpiredAt      redisTime        `json:"expired_at"      redis:"e"`
+	Group          string           `json:"group"           redis:"g"`
+	Key            string           `json:"-"               redis:"-"`
+	Name           string           `json:"name"            redis:"n"`
+	Subnets        redisStringSlice `json:"subnets"         redis:"s"`
+	Models         redisStringSlice `json:"models"          redis:"m"`
+	ID             int              `json:"id"              redis:"i"`
+	Status         int              `json:"status"          redis:"st"`
+	Quota          float64          `json:"quota"           redis:"q"`
+	UsedAmount     float64          `json:"used_amount"     redis:"u"`
+	RateLimitWait  bool             `json:"rate_limit_wait" redis:"rlw"`
+	PriorityClass  string           `json:"priority_class"  redis:"pc"`
+	PeriodicQuotas PeriodicQuotas   `json:"periodic_quotas" redis:"pq"`
+	availableSets  []string
+	modelsBySet    map[string][]string
 }
 
 func (t *TokenCache) SetAvailableSets(availableSets []string) {
@@ -91,6 +94,17 @@ func (t *TokenCache) ContainsModel(model string) bool {
 	return containsModel(model, t.availableSets, t.modelsBySet)
 }
 
+// ContainsAliasModel reports whether the token may use the alias resolved to the model,
+// a token limited to some models may list either the alias or the model
+func (t *TokenCache) ContainsAliasModel(alias, model string) bool {
+	if len(t.Models) != 0 {
+		if !slices.Contains(t.Models, alias) && !slices.Contains(t.Models, model) {
+			return false
+		}
+	}
+	return containsModel(model, t.availableSets, t.modelsBySet)
+}
+
 func containsModel(model string, sets []string, modelsBySet map[string][]string) bool {
 	for _, set := range sets {
 		if slices.Contains(modelsBySet[set], model) {
@@ -128,16 +142,19 @@ func (t *TokenCache) Range(fn func(model string) bool) {
 
 func (t *Token) ToTokenCache() *TokenCache {
 	return &TokenCache{
-		ID:         t.ID,
-		Group:      t.GroupID,
-		Key:        t.Key,
-		Name:       t.Name.String(),
-		Models:     t.Models,
-		Subnets:    t.Subnets,
-		Status:     t.Status,
-		ExpiredAt:  redisTime(t.ExpiredAt),
-		Quota:      t.Quota,
-		UsedAmount: t.UsedAmount,
+		ID:             t.ID,
+		Group:          t.GroupID,
+		Key:            t.Key,
+		Name:           t.Name.String(),
+		Models:         t.Models,
+		Subnets:        t.Subnets,
+		Status:         t.Status,
+		ExpiredAt:      redisTime(t.ExpiredAt),
+		Quota:          t.Quota,
+		UsedAmount:     t.UsedAmount,
+		RateLimitWait:  t.RateLimitWait,
+		PriorityClass:  t.PriorityClass,
+		PeriodicQuotas: t.PeriodicQuotas,
 	}
 }
 
@@ -242,6 +259,21 @@ func CacheUpdateTokenStatus(key string, status int) error {
 	return updateTokenStatusScript.Run(context.Background(), common.RDB, []string{fmt.Sprintf(TokenCacheKey, key)}, status).Err()
 }
 
+type redisMapStringString map[string]string
+
+var (
+	_ redis.Scanner            = (*redisMapStringString)(nil)
+	_ encoding.BinaryMarshaler = (*redisMapStringString)(nil)
+)
+
+func (r *redisMapStringString) ScanRedis(value string) error {
+	return sonic.Unmarshal(conv.StringToBytes(value), r)
+}
+
+func (r redisMapStringString) MarshalBinary() ([]byte, error) {
+	return sonic.Marshal(r)
+}
+
 type redisMapStringInt64 map[string]int64
 
 var (
@@ -258,14 +290,18 @@ func (r redisMapStringInt64) MarshalBinary() ([]byte, error) {
 }
 
 type GroupCache struct {
-	ID            string              `json:"-"              redis:"-"`
-	Status        int                 `json:"status"         redis:"st"`
-	UsedAmount    float64             `json:"used_amount"    redis:"ua"`
-	RPMRatio      float64             `json:"rpm_ratio"      redis:"rpm_r"`
-	RPM           redisMapStringInt64 `json:"rpm"            redis:"rpm"`
-	TPMRatio      float64             `json:"tpm_ratio"      redis:"tpm_r"`
-	TPM           redisMapStringInt64 `json:"tpm"            redis:"tpm"`
-	AvailableSets redisStringSlice    `json:"available_sets" redis:"ass"`
+	ID             string               `json:"-"               redis:"-"`
+	Status         int                  `json:"status"          redis:"st"`
+	UsedAmount     float64              `json:"used_amount"     redis:"ua"`
+	RPMRatio       float64              `json:"rpm_ratio"       redis:"rpm_r"`
+	RPM            redisMapStringInt64  `json:"rpm"             redis:"rpm"`
+	TPMRatio       float64              `json:"tpm_ratio"       redis:"tpm_r"`
+	TPM            redisMapStringInt64  `json:"tpm"             redis:"tpm"`
+	AvailableSets  redisStringSlice     `json:"available_sets"  redis:"ass"`
+	RateLimitWait  bool                 `json:"rate_limit_wait" redis:"rlw"`
+	ModelAliases   redisMapStringString `json:"model_aliases"   redis:"mas"`
+	PeriodicQuotas PeriodicQuotas       `json:"periodic_quotas" redis:"pq"`
+	Pricing        GroupPricing         `json:"pricing"         redis:"gp"`
 }
 
 func (g *GroupCache) GetAvailableSets() []string {
@@ -277,14 +313,18 @@ func (g *GroupCache) GetAvailableSets() []string {
 
 func (g *Group) ToGroupCache() *GroupCache {
 	return &GroupCache{
-		ID:            g.ID,
-		Status:        g.Status,
-		UsedAmount:    g.UsedAmount,
-		RPMRatio:      g.RPMRatio,
-		RPM:           g.RPM,
-		TPMRatio:      g.TPMRatio,
-		TPM:           g.TPM,
-		AvailableSets: g.AvailableSets,
+		ID:             g.ID,
+		Status:         g.Status,
+		UsedAmount:     g.UsedAmount,
+		RPMRatio:       g.RPMRatio,
+		RPM:            g.RPM,
+		TPMRatio:       g.TPMRatio,
+		TPM:            g.TPM,
+		AvailableSets:  g.AvailableSets,
+		RateLimitWait:  g.RateLimitWait,
+		ModelAliases:   g.ModelAliases,
+		PeriodicQuotas: g.PeriodicQuotas,
+		Pricing:        g.Pricing,
 	}
 }
 
@@ -487,6 +527,11 @@ type ModelCaches struct {
 
 	EnabledModel2ChannelsBySet  map[string]map[string][]*Channel
 	DisabledModel2ChannelsBySet map[string]map[string][]*Channel
+
+	RoutingRules RoutingRules
+
+	// ChannelsByID contains the enabled and disabled channels, e.g. a disabled candidate channel of a mirror
+	ChannelsByID map[int]*Channel
 }
 
 var modelCaches atomic.Pointer[ModelCaches]
@@ -499,6 +544,29 @@ func LoadModelCaches() *ModelCaches {
 	return modelCaches.Load()
 }
 
+var (
+	modelConfigAndChannelCacheRefresh       = make(chan struct{}, 1)
+	modelConfigAndChannelCacheRefresherOnce sync.Once
+)
+
+// RefreshModelConfigAndChannelCacheAsync rebuilds the channel cache in the background,
+// the refreshes requested while a rebuild is pending share it
+func RefreshModelConfigAndChannelCacheAsync() {
+	modelConfigAndChannelCacheRefresherOnce.Do(func() {
+		go func() {
+			for range modelConfigAndChannelCacheRefresh {
+				if err := InitModelConfigAndChannelCache(); err != nil {
+					log.Errorf("refresh model config and channel cache failed: %+v", err)
+				}
+			}
+		}()
+	})
+	select {
+	case modelConfigAndChannelCacheRefresh <- struct{}{}:
+	default:
+	}
+}
+
 // InitModelConfigAndChannelCache initializes the channel cache from database
 func InitModelConfigAndChannelCache() error {
 	modelConfig, err := initializeModelConfigCache()
@@ -512,6 +580,11 @@ func InitModelConfigAndChannelCache() error {
 		return err
 	}
 
+	// Channels outside their schedule are served as disabled until the next schedule change
+	now := time.Now()
+	enabledChannels, scheduledOffChannels := applyChannelSchedules(enabledChannels, now)
+	defer scheduleChannelScheduleRefresh(slices.Concat(enabledChannels, scheduledOffChannels), now)
+
 	// Build model to channels map by set
 	enabledModel2ChannelsBySet := buildModelToChannelsBySetMap(enabledChannels)
 
@@ -528,7 +601,23 @@ func InitModelConfigAndChannelCache() error {
 	}
 
 	// Build disabled model to channels map by set
-	disabledModel2ChannelsBySet := buildModelToChannelsBySetMap(disabledChannels)
+	disabledModel2ChannelsBySet := buildModelToChannelsBySetMap(append(disabledChannels, scheduledOffChannels...))
+
+	routingRules, err := LoadEnabledRoutingRules()
+	if err != nil {
+		return err
+	}
+
+	channelsByID := make(map[int]*Channel, len(enabledChannels)+len(scheduledOffChannels)+len(disabledChannels))
+	for _, channel := range enabledChannels {
+		channelsByID[channel.ID] = channel
+	}
+	for _, channel := range scheduledOffChannels {
+		channelsByID[channel.ID] = channel
+	}
+	for _, channel := range disabledChannels {
+		channelsByID[channel.ID] = channel
+	}
 
 	// Update global cache atomically
 	modelCaches.Store(&ModelCaches{
@@ -540,6 +629,10 @@ func InitModelConfigAndChannelCache() error {
 
 		EnabledModel2ChannelsBySet:  enabledModel2ChannelsBySet,
 		DisabledModel2ChannelsBySet: disabledModel2ChannelsBySet,
+
+		RoutingRules: routingRules,
+
+		ChannelsByID: channelsByID,
 	})
 
 	return nil
@@ -547,7 +640,10 @@ func InitModelConfigAndChannelCache() error {
 
 func LoadEnabledChannels() ([]*Channel, error) {
 	var channels []*Channel
-	err := DB.Where("status = ?", ChannelStatusEnabled).Find(&channels).Error
+	err := DB.
+		Preload("Keys").
+		Where("status = ?", ChannelStatusEnabled).
+		Find(&channels).Error
 	if err != nil {
 		return nil, err
 	}
@@ -555,6 +651,7 @@ func LoadEnabledChannels() ([]*Channel, error) {
 	for _, channel := range channels {
 		initializeChannelModels(channel)
 		initializeChannelModelMapping(channel)
+		initializeChannelKeys(channel)
 	}
 
 	return channels, nil
@@ -577,7 +674,7 @@ func LoadDisabledChannels() ([]*Channel, error) {
 
 func LoadChannels() ([]*Channel, error) {
 	var channels []*Channel
-	err := DB.Find(&channels).Error
+	err := DB.Preload("Keys").Find(&channels).Error
 	if err != nil {
 		return nil, err
 	}
@@ -585,6 +682,7 @@ func LoadChannels() ([]*Channel, error) {
 	for _, channel := range channels {
 		initializeChannelModels(channel)
 		initializeChannelModelMapping(channel)
+		initializeChannelKeys(channel)
 	}
 
 	return channels, nil
@@ -592,13 +690,14 @@ func LoadChannels() ([]*Channel, error) {
 
 func LoadChannelByID(id int) (*Channel, error) {
 	var channel Channel
-	err := DB.First(&channel, id).Error
+	err := DB.Preload("Keys").First(&channel, id).Error
 	if err != nil {
 		return nil, err
 	}
 
 	initializeChannelModels(&channel)
 	initializeChannelModelMapping(&channel)
+	initializeChannelKeys(&channel)
 
 	return &channel, nil
 }
@@ -644,6 +743,17 @@ func initializeModelConfigCache() (ModelConfigCache, error) {
 	return configs, nil
 }
 
+// initializeChannelKeys keeps only the enabled keys of the channel for rotation
+func initializeChannelKeys(channel *Channel) {
+	if len(channel.Keys) == 0 {
+		return
+	}
+	channel.Keys = slices.DeleteFunc(channel.Keys, func(key *ChannelKey) bool {
+		return key.Status != ChannelKeyStatusEnabled
+	})
+	channel.allKeysDisabled = len(channel.Keys) == 0
+}
+
 func initializeChannelModels(channel *Channel) {
 	if len(channel.Models) == 0 {
 		channel.Models = config.GetDefaultChannelModels()[channel.Type]
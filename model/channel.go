@@ -32,12 +32,45 @@ const (
 
 type ChannelConfig struct {
 	SplitThink bool `json:"split_think"`
+	// KeyRotation is how requests pick one of the channel keys, round_robin by default
+	KeyRotation string `json:"key_rotation,omitempty"`
+	// ModelCapabilities overrides the model config capabilities by model name
+	ModelCapabilities map[string]ModelCapability `json:"model_capabilities,omitempty"`
+}
+
+// ModelCapability describes the requests a channel can serve for a model, unset fields mean no restriction
+type ModelCapability struct {
+	MaxContextTokens  int   `json:"max_context_tokens,omitempty"`
+	SupportVision     *bool `json:"support_vision,omitempty"`
+	SupportToolChoice *bool `json:"support_tool_choice,omitempty"`
+}
+
+// Merge fills the unset fields from the fallback capability
+func (c ModelCapability) Merge(fallback ModelCapability) ModelCapability {
+	if c.MaxContextTokens == 0 {
+		c.MaxContextTokens = fallback.MaxContextTokens
+	}
+	if c.SupportVision == nil {
+		c.SupportVision = fallback.SupportVision
+	}
+	if c.SupportToolChoice == nil {
+		c.SupportToolChoice = fallback.SupportToolChoice
+	}
+	return c
+}
+
+func (c *Channel) GetModelCapability(model string) ModelCapability {
+	if c.Config == nil {
+		return ModelCapability{}
+	}
+	return c.Config.ModelCapabilities[model]
 }
 
 type Channel struct {
 	CreatedAt               time.Time         `gorm:"index"                              json:"created_at"`
 	LastTestErrorAt         time.Time         `json:"last_test_error_at"`
 	ChannelTests            []*ChannelTest    `gorm:"foreignKey:ChannelID;references:ID" json:"channel_tests,omitempty"`
+	Keys                    []*ChannelKey     `gorm:"foreignKey:ChannelID;references:ID" json:"keys,omitempty"`
 	BalanceUpdatedAt        time.Time         `json:"balance_updated_at"`
 	ModelMapping            map[string]string `gorm:"serializer:fastjson;type:text"      json:"model_mapping"`
 	Key                     string            `gorm:"type:text;index"                    json:"key"`
@@ -55,6 +88,28 @@ type Channel struct {
 	BalanceThreshold        float64           `json:"balance_threshold"`
 	Config                  *ChannelConfig    `gorm:"serializer:fastjson;type:text"      json:"config,omitempty"`
 	Sets                    []string          `gorm:"serializer:fastjson;type:text"      json:"sets,omitempty"`
+	MaxConcurrency          int64             `json:"max_concurrency,omitempty"`
+	RPM                     map[string]int64  `gorm:"serializer:fastjson;type:text"      json:"rpm,omitempty"`
+	TPM                     map[string]int64  `gorm:"serializer:fastjson;type:text"      json:"tpm,omitempty"`
+	Schedule                *ChannelSchedule  `gorm:"serializer:fastjson;type:text"      json:"schedule,omitempty"`
+
+	allKeysDisabled bool
+}
+
+// AllKeysDisabled reports whether the channel has a key pool whose keys are all disabled,
+// such a channel must not fall back to Channel.Key, it is only known for the cached channels
+func (c *Channel) AllKeysDisabled() bool {
+	return c.allKeysDisabled
+}
+
+// GetModelRPM returns the upstream rpm quota of the model, 0 means unlimited
+func (c *Channel) GetModelRPM(model string) int64 {
+	return c.RPM[model]
+}
+
+// GetModelTPM returns the upstream tpm quota of the model, 0 means unlimited
+func (c *Channel) GetModelTPM(model string) int64 {
+	return c.TPM[model]
 }
 
 func (c *Channel) GetSets() []string {
@@ -65,7 +120,11 @@ func (c *Channel) GetSets() []string {
 }
 
 func (c *Channel) BeforeDelete(tx *gorm.DB) (err error) {
-	return tx.Model(&ChannelTest{}).Where("channel_id = ?", c.ID).Delete(&ChannelTest{}).Error
+	err = tx.Model(&ChannelTest{}).Where("channel_id = ?", c.ID).Delete(&ChannelTest{}).Error
+	if err != nil {
+		return err
+	}
+	return deleteChannelKeysByChannelID(tx, c.ID)
 }
 
 func (c *Channel) GetBalanceThreshold() float64 {
@@ -295,7 +354,7 @@ func SearchChannels(keyword string, page int, perPage int, id int, name string,
 
 func GetChannelByID(id int) (*Channel, error) {
 	channel := Channel{ID: id}
-	err := DB.First(&channel, "id = ?", id).Error
+	err := DB.Preload("Keys").First(&channel, "id = ?", id).Error
 	return &channel, HandleNotFound(err, ErrChannelNotFound)
 }
 
@@ -339,6 +398,10 @@ func UpdateChannel(channel *Channel) (err error) {
 			"enabled_auto_balance_check",
 			"balance_threshold",
 			"sets",
+			"max_concurrency",
+			"rpm",
+			"tpm",
+			"schedule",
 		).
 		Clauses(clause.Returning{}).
 		Where("id = ?", channel.ID).
@@ -0,0 +1,161 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ErrChannelKeyNotFound = "channel key"
+)
+
+const (
+	ChannelKeyStatusEnabled  = 1
+	ChannelKeyStatusDisabled = 2
+)
+
+const (
+	ChannelKeyRotationRoundRobin = "round_robin"
+	ChannelKeyRotationLeastUsed  = "least_used"
+)
+
+// ChannelKey is an extra credential of a channel,
+// once a channel has enabled keys requests rotate among them instead of using Channel.Key
+type ChannelKey struct {
+	CreatedAt        time.Time `json:"created_at"`
+	DisabledAt       time.Time `json:"disabled_at"`
+	BalanceUpdatedAt time.Time `json:"balance_updated_at"`
+	Key              string    `gorm:"type:text"             json:"key"`
+	DisabledReason   string    `gorm:"type:text"             json:"disabled_reason,omitempty"`
+	ID               int       `gorm:"primaryKey"            json:"id"`
+	ChannelID        int       `gorm:"index"                 json:"channel_id"`
+	Status           int       `gorm:"default:1;index"       json:"status"`
+	Balance          float64   `json:"balance"`
+	RequestCount     int       `json:"request_count"`
+	ErrorCount       int       `json:"error_count"`
+}
+
+// MaskChannelKey hides the secret of a key for the admin responses
+func MaskChannelKey(key string) string {
+	if len(key) <= 8 {
+		return "*****"
+	}
+	return key[:4] + "*****" + key[len(key)-4:]
+}
+
+// MaskChannelKeys returns copies of the keys with their secrets hidden
+func MaskChannelKeys(keys []*ChannelKey) []*ChannelKey {
+	masked := make([]*ChannelKey, 0, len(keys))
+	for _, key := range keys {
+		k := *key
+		k.Key = MaskChannelKey(k.Key)
+		masked = append(masked, &k)
+	}
+	return masked
+}
+
+func GetChannelKeys(channelID int) ([]*ChannelKey, error) {
+	var keys []*ChannelKey
+	err := DB.Where("channel_id = ?", channelID).Order("id asc").Find(&keys).Error
+	return keys, err
+}
+
+func AddChannelKeys(channelID int, keys []string) (channelKeys []*ChannelKey, err error) {
+	defer func() {
+		if err == nil {
+			_ = InitModelConfigAndChannelCache()
+		}
+	}()
+	channelKeys = make([]*ChannelKey, 0, len(keys))
+	for _, key := range keys {
+		channelKeys = append(channelKeys, &ChannelKey{
+			ChannelID: channelID,
+			Key:       key,
+			Status:    ChannelKeyStatusEnabled,
+		})
+	}
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Select("id").First(&Channel{}, "id = ?", channelID).Error; err != nil {
+			return HandleNotFound(err, ErrChannelNotFound)
+		}
+		return tx.Create(&channelKeys).Error
+	})
+	return channelKeys, err
+}
+
+func DeleteChannelKey(channelID int, id int) (err error) {
+	defer func() {
+		if err == nil {
+			_ = InitModelConfigAndChannelCache()
+		}
+	}()
+	result := DB.Where("channel_id = ? AND id = ?", channelID, id).Delete(&ChannelKey{})
+	return HandleUpdateResult(result, ErrChannelKeyNotFound)
+}
+
+func UpdateChannelKeyStatus(channelID int, id int, status int) (err error) {
+	defer func() {
+		if err == nil {
+			_ = InitModelConfigAndChannelCache()
+		}
+	}()
+	updates := map[string]any{
+		"status": status,
+	}
+	if status == ChannelKeyStatusEnabled {
+		updates["disabled_reason"] = ""
+	} else {
+		updates["disabled_at"] = time.Now()
+	}
+	result := DB.Model(&ChannelKey{}).
+		Where("channel_id = ? AND id = ?", channelID, id).
+		Updates(updates)
+	return HandleUpdateResult(result, ErrChannelKeyNotFound)
+}
+
+// DisableChannelKey disables an enabled key, it reports whether the key was enabled before,
+// it is called while relaying, so the channel cache is rebuilt in the background
+func DisableChannelKey(id int, reason string) (disabled bool, err error) {
+	defer func() {
+		if err == nil && disabled {
+			RefreshModelConfigAndChannelCacheAsync()
+		}
+	}()
+	result := DB.Model(&ChannelKey{}).
+		Where("id = ? AND status = ?", id, ChannelKeyStatusEnabled).
+		Updates(map[string]any{
+			"status":          ChannelKeyStatusDisabled,
+			"disabled_at":     time.Now(),
+			"disabled_reason": reason,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func UpdateChannelKeyBalance(id int, balance float64) error {
+	result := DB.Model(&ChannelKey{}).
+		Select("balance_updated_at", "balance").
+		Where("id = ?", id).
+		Updates(ChannelKey{
+			BalanceUpdatedAt: time.Now(),
+			Balance:          balance,
+		})
+	return HandleUpdateResult(result, ErrChannelKeyNotFound)
+}
+
+func UpdateChannelKeyRequestCount(id int, count int, errorCount int) error {
+	result := DB.Model(&ChannelKey{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"request_count": gorm.Expr("request_count + ?", count),
+			"error_count":   gorm.Expr("error_count + ?", errorCount),
+		})
+	return HandleUpdateResult(result, ErrChannelKeyNotFound)
+}
+
+func deleteChannelKeysByChannelID(tx *gorm.DB, channelID int) error {
+	return tx.Where("channel_id = ?", channelID).Delete(&ChannelKey{}).Error
+}
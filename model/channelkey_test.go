@@ -0,0 +1,62 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelKeyPool(t *testing.T) {
+	convey.Convey("TestChannelKeyPool", t, func() {
+		initTestDB(t)
+		channel := &model.Channel{Name: "pool", Key: "legacy-key", Status: model.ChannelStatusEnabled}
+		convey.So(model.DB.Create(channel).Error, convey.ShouldBeNil)
+		keys, err := model.AddChannelKeys(channel.ID, []string{"sk-first-key-0001", "sk-second-key-0002"})
+		convey.So(err, convey.ShouldBeNil)
+
+		cached, err := model.LoadChannelByID(channel.ID)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(cached.Keys, convey.ShouldHaveLength, 2)
+		convey.So(cached.AllKeysDisabled(), convey.ShouldBeFalse)
+
+		disabled, err := model.DisableChannelKey(keys[0].ID, "401")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(disabled, convey.ShouldBeTrue)
+		disabled, err = model.DisableChannelKey(keys[0].ID, "401")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(disabled, convey.ShouldBeFalse)
+
+		cached, err = model.LoadChannelByID(channel.ID)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(cached.Keys, convey.ShouldHaveLength, 1)
+		convey.So(cached.Keys[0].ID, convey.ShouldEqual, keys[1].ID)
+		convey.So(cached.AllKeysDisabled(), convey.ShouldBeFalse)
+
+		// the legacy key is not used once every key of the pool is disabled
+		_, err = model.DisableChannelKey(keys[1].ID, "401")
+		convey.So(err, convey.ShouldBeNil)
+		cached, err = model.LoadChannelByID(channel.ID)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(cached.Keys, convey.ShouldBeEmpty)
+		convey.So(cached.AllKeysDisabled(), convey.ShouldBeTrue)
+
+		// a channel without a key pool uses its own key
+		plain := &model.Channel{Name: "plain", Key: "legacy-key", Status: model.ChannelStatusEnabled}
+		convey.So(model.DB.Create(plain).Error, convey.ShouldBeNil)
+		cached, err = model.LoadChannelByID(plain.ID)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(cached.AllKeysDisabled(), convey.ShouldBeFalse)
+	})
+}
+
+func TestMaskChannelKeys(t *testing.T) {
+	convey.Convey("TestMaskChannelKeys", t, func() {
+		keys := []*model.ChannelKey{{ID: 1, Key: "sk-1234567890abcd"}, {ID: 2, Key: "short"}}
+		masked := model.MaskChannelKeys(keys)
+		convey.So(masked[0].Key, convey.ShouldEqual, "sk-1*****abcd")
+		convey.So(masked[1].Key, convey.ShouldEqual, "*****")
+		convey.So(masked[0].ID, convey.ShouldEqual, 1)
+		convey.So(keys[0].Key, convey.ShouldEqual, "sk-1234567890abcd")
+	})
+}
@@ -0,0 +1,209 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ChannelSchedule enables, disables or reprioritizes a channel in weekday time windows
+// of the IANA time zone (default UTC), it is evaluated every time the channel cache is rebuilt,
+// the cache is also rebuilt at the next window start or end.
+// With DisableOutsideWindows the channel only serves inside the windows, e.g. business hours contracts.
+type ChannelSchedule struct {
+	Timezone              string                  `json:"timezone,omitempty"`
+	Windows               []ChannelScheduleWindow `json:"windows"`
+	DisableOutsideWindows bool                    `json:"disable_outside_windows,omitempty"`
+}
+
+// ChannelScheduleWindow is a HH:MM time range on the weekdays (0 is Sunday, empty means every day).
+// An end before the start crosses midnight and belongs to the weekday it starts on,
+// an equal start and end is the whole day.
+// Inside the window the channel is disabled, or serves with the priority when it is not 0.
+type ChannelScheduleWindow struct {
+	Weekdays []time.Weekday `json:"weekdays,omitempty"`
+	Start    string         `json:"start"`
+	End      string         `json:"end"`
+	Disabled bool           `json:"disabled,omitempty"`
+	Priority int32          `json:"priority,omitempty"`
+}
+
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, must be HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (s *ChannelSchedule) Validate() error {
+	if s == nil {
+		return nil
+	}
+	if _, err := time.LoadLocation(s.Timezone); err != nil {
+		return fmt.Errorf("invalid schedule timezone: %w", err)
+	}
+	if len(s.Windows) == 0 {
+		return errors.New("schedule windows are required")
+	}
+	for _, window := range s.Windows {
+		if _, err := parseClock(window.Start); err != nil {
+			return err
+		}
+		if _, err := parseClock(window.End); err != nil {
+			return err
+		}
+		for _, weekday := range window.Weekdays {
+			if weekday < time.Sunday || weekday > time.Saturday {
+				return fmt.Errorf("invalid weekday %d, must be 0 to 6", weekday)
+			}
+		}
+		if window.Priority < 0 {
+			return errors.New("schedule priority must not be negative")
+		}
+	}
+	return nil
+}
+
+func (w *ChannelScheduleWindow) onWeekday(weekday time.Weekday) bool {
+	if len(w.Weekdays) == 0 {
+		return true
+	}
+	for _, d := range w.Weekdays {
+		if d == weekday {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *ChannelScheduleWindow) contains(now time.Time) bool {
+	start, err := parseClock(w.Start)
+	if err != nil {
+		return false
+	}
+	end, err := parseClock(w.End)
+	if err != nil {
+		return false
+	}
+	clock := time.Duration(now.Hour())*time.Hour +
+		time.Duration(now.Minute())*time.Minute +
+		time.Duration(now.Second())*time.Second
+	switch {
+	case start == end:
+		return w.onWeekday(now.Weekday())
+	case start < end:
+		return w.onWeekday(now.Weekday()) && clock >= start && clock < end
+	default:
+		// the window crosses midnight, after midnight it belongs to the previous day
+		if clock >= start {
+			return w.onWeekday(now.Weekday())
+		}
+		return clock < end && w.onWeekday((now.Weekday()+6)%7)
+	}
+}
+
+// Active returns whether the channel serves at the time and its priority, 0 keeps the channel priority,
+// the first matching window wins
+func (s *ChannelSchedule) Active(now time.Time) (enabled bool, priority int32) {
+	if s == nil {
+		return true, 0
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	now = now.In(loc)
+	for i := range s.Windows {
+		window := &s.Windows[i]
+		if window.contains(now) {
+			return !window.Disabled, window.Priority
+		}
+	}
+	return !s.DisableOutsideWindows, 0
+}
+
+// NextChange returns the first window start or end after the time, zero without windows
+func (s *ChannelSchedule) NextChange(now time.Time) time.Time {
+	if s == nil {
+		return time.Time{}
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		loc = time.UTC
+	}
+	local := now.In(loc)
+	var next time.Time
+	for _, window := range s.Windows {
+		for _, clock := range []string{window.Start, window.End} {
+			offset, err := parseClock(clock)
+			if err != nil {
+				continue
+			}
+			for day := 0; day <= 1; day++ {
+				edge := time.Date(local.Year(), local.Month(), local.Day()+day,
+					int(offset/time.Hour), int(offset%time.Hour/time.Minute), 0, 0, loc)
+				if edge.After(now) {
+					if next.IsZero() || edge.Before(next) {
+						next = edge
+					}
+					break
+				}
+			}
+		}
+	}
+	return next
+}
+
+// nextChannelScheduleChange returns the first schedule change of the channels after the time
+func nextChannelScheduleChange(channels []*Channel, now time.Time) time.Time {
+	var next time.Time
+	for _, channel := range channels {
+		change := channel.Schedule.NextChange(now)
+		if !change.IsZero() && (next.IsZero() || change.Before(next)) {
+			next = change
+		}
+	}
+	return next
+}
+
+var (
+	channelScheduleRefreshTimer   *time.Timer
+	channelScheduleRefreshTimerMu sync.Mutex
+)
+
+// scheduleChannelScheduleRefresh rebuilds the channel cache at the next schedule change of the channels,
+// so a window takes effect on time instead of at the next periodic sync
+func scheduleChannelScheduleRefresh(channels []*Channel, now time.Time) {
+	next := nextChannelScheduleChange(channels, now)
+
+	channelScheduleRefreshTimerMu.Lock()
+	defer channelScheduleRefreshTimerMu.Unlock()
+	if channelScheduleRefreshTimer != nil {
+		channelScheduleRefreshTimer.Stop()
+		channelScheduleRefreshTimer = nil
+	}
+	if next.IsZero() {
+		return
+	}
+	channelScheduleRefreshTimer = time.AfterFunc(next.Sub(now), RefreshModelConfigAndChannelCacheAsync)
+}
+
+// applyChannelSchedules splits the enabled channels by their schedules at the time,
+// the channels outside their schedule are served as disabled channels
+func applyChannelSchedules(channels []*Channel, now time.Time) (active []*Channel, inactive []*Channel) {
+	active = make([]*Channel, 0, len(channels))
+	for _, channel := range channels {
+		enabled, priority := channel.Schedule.Active(now)
+		if !enabled {
+			inactive = append(inactive, channel)
+			continue
+		}
+		if priority > 0 {
+			channel.Priority = priority
+		}
+		active = append(active, channel)
+	}
+	return active, inactive
+}
@@ -0,0 +1,90 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelScheduleActive(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	// 2025-01-06 is a Monday
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 1, day, hour, minute, 0, 0, loc)
+	}
+	convey.Convey("TestChannelScheduleActive", t, func() {
+		var schedule *model.ChannelSchedule
+		enabled, priority := schedule.Active(at(6, 12, 0))
+		convey.So(enabled, convey.ShouldBeTrue)
+		convey.So(priority, convey.ShouldEqual, 0)
+
+		businessHours := &model.ChannelSchedule{
+			Timezone: "Asia/Shanghai",
+			Windows: []model.ChannelScheduleWindow{
+				{
+					Weekdays: []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday},
+					Start:    "09:00",
+					End:      "18:00",
+				},
+			},
+			DisableOutsideWindows: true,
+		}
+		convey.So(businessHours.Validate(), convey.ShouldBeNil)
+		enabled, _ = businessHours.Active(at(6, 9, 0))
+		convey.So(enabled, convey.ShouldBeTrue)
+		enabled, _ = businessHours.Active(at(6, 18, 0))
+		convey.So(enabled, convey.ShouldBeFalse)
+		enabled, _ = businessHours.Active(at(5, 12, 0))
+		convey.So(enabled, convey.ShouldBeFalse)
+		enabled, _ = businessHours.Active(at(6, 1, 0).UTC())
+		convey.So(enabled, convey.ShouldBeFalse)
+
+		offPeak := &model.ChannelSchedule{
+			Timezone: "Asia/Shanghai",
+			Windows: []model.ChannelScheduleWindow{
+				{Weekdays: []time.Weekday{time.Friday}, Start: "22:00", End: "06:00", Priority: 100},
+			},
+		}
+		convey.So(offPeak.Validate(), convey.ShouldBeNil)
+		enabled, priority = offPeak.Active(at(10, 23, 0))
+		convey.So(enabled, convey.ShouldBeTrue)
+		convey.So(priority, convey.ShouldEqual, 100)
+		_, priority = offPeak.Active(at(11, 5, 59))
+		convey.So(priority, convey.ShouldEqual, 100)
+		_, priority = offPeak.Active(at(11, 6, 0))
+		convey.So(priority, convey.ShouldEqual, 0)
+		_, priority = offPeak.Active(at(9, 23, 0))
+		convey.So(priority, convey.ShouldEqual, 0)
+
+		convey.So((&model.ChannelSchedule{Timezone: "Mars/Base"}).Validate(), convey.ShouldNotBeNil)
+		convey.So((&model.ChannelSchedule{
+			Windows: []model.ChannelScheduleWindow{{Start: "9:00pm", End: "10:00"}},
+		}).Validate(), convey.ShouldNotBeNil)
+	})
+}
+
+func TestChannelScheduleNextChange(t *testing.T) {
+	loc, _ := time.LoadLocation("Asia/Shanghai")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2025, 1, day, hour, minute, 0, 0, loc)
+	}
+	convey.Convey("TestChannelScheduleNextChange", t, func() {
+		var schedule *model.ChannelSchedule
+		convey.So(schedule.NextChange(at(6, 12, 0)).IsZero(), convey.ShouldBeTrue)
+
+		schedule = &model.ChannelSchedule{
+			Timezone: "Asia/Shanghai",
+			Windows: []model.ChannelScheduleWindow{
+				{Start: "09:00", End: "18:00"},
+				{Start: "22:00", End: "06:00", Priority: 100},
+			},
+		}
+		convey.So(schedule.NextChange(at(6, 8, 0)).Equal(at(6, 9, 0)), convey.ShouldBeTrue)
+		convey.So(schedule.NextChange(at(6, 9, 0)).Equal(at(6, 18, 0)), convey.ShouldBeTrue)
+		convey.So(schedule.NextChange(at(6, 20, 0).UTC()).Equal(at(6, 22, 0)), convey.ShouldBeTrue)
+		// the next edge is on the following day
+		convey.So(schedule.NextChange(at(6, 23, 0)).Equal(at(7, 6, 0)), convey.ShouldBeTrue)
+	})
+}
@@ -0,0 +1,182 @@
+package model
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+
+	"github.com/labring/aiproxy/common/concurrency"
+)
+
+// strategies selecting a channel among the channels of a model, weighted by the channel priority
+const (
+	// ChannelSelectorRandom picks a random channel, the default
+	ChannelSelectorRandom = "random"
+	// ChannelSelectorSmoothWRR rotates the channels by smooth weighted round-robin
+	ChannelSelectorSmoothWRR = "smooth_wrr"
+	// ChannelSelectorLeastOutstanding picks the channel with the fewest outstanding requests per weight
+	ChannelSelectorLeastOutstanding = "least_outstanding"
+	// ChannelSelectorP2C picks the less loaded of two random channels
+	ChannelSelectorP2C = "p2c"
+)
+
+// ValidateChannelSelector accepts the channel selectors, empty means random
+func ValidateChannelSelector(selector string) error {
+	switch selector {
+	case "",
+		ChannelSelectorRandom,
+		ChannelSelectorSmoothWRR,
+		ChannelSelectorLeastOutstanding,
+		ChannelSelectorP2C:
+		return nil
+	default:
+		return fmt.Errorf("invalid channel selector %q, must be one of %s, %s, %s, %s",
+			selector,
+			ChannelSelectorRandom,
+			ChannelSelectorSmoothWRR,
+			ChannelSelectorLeastOutstanding,
+			ChannelSelectorP2C,
+		)
+	}
+}
+
+// ChannelSelector picks one of the candidate channels of the model,
+// the candidates are the remaining channels and there are at least two of them
+type ChannelSelector interface {
+	Select(modelName string, channels []*Channel, errorRates map[int64]float64) *Channel
+}
+
+var channelSelectors = map[string]ChannelSelector{
+	ChannelSelectorRandom:           randomSelector{},
+	ChannelSelectorSmoothWRR:        &smoothWRRSelector{current: make(map[string]map[int]int64)},
+	ChannelSelectorLeastOutstanding: leastOutstandingSelector{},
+	ChannelSelectorP2C:              p2cSelector{},
+}
+
+// GetChannelSelector returns the named channel selector, random by priority by default
+func GetChannelSelector(selector string) ChannelSelector {
+	if s, ok := channelSelectors[selector]; ok {
+		return s
+	}
+	return randomSelector{}
+}
+
+// GetPriorityByErrorRate lowers the priority of the channel by its error rate
+func (c *Channel) GetPriorityByErrorRate(errorRate float64) int32 {
+	priority := c.GetPriority()
+	if errorRate > 1 {
+		errorRate = 1
+	} else if errorRate < 0.1 {
+		errorRate = 0.1
+	}
+	return int32(float64(priority) / errorRate)
+}
+
+func channelWeight(channel *Channel, errorRates map[int64]float64) int32 {
+	return max(channel.GetPriorityByErrorRate(errorRates[int64(channel.ID)]), 1)
+}
+
+// channelLoad is the outstanding requests of this instance per weight, counting the new request
+func channelLoad(channel *Channel, errorRates map[int64]float64) float64 {
+	return float64(concurrency.Outstanding(channel.ID)+1) / float64(channelWeight(channel, errorRates))
+}
+
+type randomSelector struct{}
+
+//nolint:gosec
+func (randomSelector) Select(_ string, channels []*Channel, errorRates map[int64]float64) *Channel {
+	var totalWeight int32
+	cachedPrioritys := make([]int32, len(channels))
+	for i, ch := range channels {
+		priority := ch.GetPriorityByErrorRate(errorRates[int64(ch.ID)])
+		totalWeight += priority
+		cachedPrioritys[i] = priority
+	}
+
+	if totalWeight == 0 {
+		return channels[rand.IntN(len(channels))]
+	}
+
+	r := rand.Int32N(totalWeight)
+	for i, ch := range channels {
+		r -= cachedPrioritys[i]
+		if r < 0 {
+			return ch
+		}
+	}
+
+	return channels[rand.IntN(len(channels))]
+}
+
+// smoothWRRSelector spreads the requests of each model evenly by the channel weights,
+// the rotation state is kept per instance
+type smoothWRRSelector struct {
+	mu      sync.Mutex
+	current map[string]map[int]int64
+}
+
+func (s *smoothWRRSelector) Select(modelName string, channels []*Channel, errorRates map[int64]float64) *Channel {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.current[modelName]
+	if !ok {
+		current = make(map[int]int64)
+		s.current[modelName] = current
+	}
+
+	var total int64
+	var best *Channel
+	for _, ch := range channels {
+		weight := int64(channelWeight(ch, errorRates))
+		current[ch.ID] += weight
+		total += weight
+		if best == nil || current[ch.ID] > current[best.ID] {
+			best = ch
+		}
+	}
+	current[best.ID] -= total
+	return best
+}
+
+// leastOutstandingSelector picks the channel with the fewest outstanding requests of this instance per weight,
+// ties are broken randomly
+type leastOutstandingSelector struct{}
+
+//nolint:gosec
+func (leastOutstandingSelector) Select(_ string, channels []*Channel, errorRates map[int64]float64) *Channel {
+	var best *Channel
+	var bestLoad float64
+	ties := 0
+	for _, ch := range channels {
+		load := channelLoad(ch, errorRates)
+		switch {
+		case best == nil || load < bestLoad:
+			best, bestLoad, ties = ch, load, 1
+		case load == bestLoad:
+			ties++
+			if rand.IntN(ties) == 0 {
+				best = ch
+			}
+		}
+	}
+	return best
+}
+
+// p2cSelector picks two random channels by priority and keeps the one with fewer outstanding requests per weight
+type p2cSelector struct{}
+
+func (p2cSelector) Select(modelName string, channels []*Channel, errorRates map[int64]float64) *Channel {
+	first := randomSelector{}.Select(modelName, channels, errorRates)
+	others := make([]*Channel, 0, len(channels)-1)
+	for _, ch := range channels {
+		if ch != first {
+			others = append(others, ch)
+		}
+	}
+	second := randomSelector{}.Select(modelName, others, errorRates)
+	if channelLoad(second, errorRates) < channelLoad(first, errorRates) {
+		return second
+	}
+	return first
+}
@@ -0,0 +1,73 @@
+package model_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/labring/aiproxy/common/concurrency"
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestChannelSelector(t *testing.T) {
+	convey.Convey("TestChannelSelector", t, func() {
+		convey.Convey("random picks one of the channels", func() {
+			channels := []*model.Channel{{ID: 1}, {ID: 2}, {ID: 3}}
+			for range 20 {
+				channel := model.GetChannelSelector("unknown").Select("m", channels, nil)
+				convey.So(channels, convey.ShouldContain, channel)
+			}
+		})
+
+		convey.Convey("smooth weighted round-robin follows the priorities", func() {
+			selector := model.GetChannelSelector(model.ChannelSelectorSmoothWRR)
+			channels := []*model.Channel{{ID: 11, Priority: 30}, {ID: 12, Priority: 10}}
+			counts := map[int]int{}
+			last := 0
+			for range 40 {
+				channel := selector.Select("smooth-wrr-model", channels, nil)
+				counts[channel.ID]++
+				// the lighter channel is never picked twice in a row
+				if channel.ID == 12 {
+					convey.So(last, convey.ShouldNotEqual, 12)
+				}
+				last = channel.ID
+			}
+			convey.So(counts, convey.ShouldResemble, map[int]int{11: 30, 12: 10})
+
+			// the priority is divided by the error rate, at least 0.1
+			counts = map[int]int{}
+			for range 130 {
+				channel := selector.Select("smooth-wrr-error-model", channels, map[int64]float64{11: 1})
+				counts[channel.ID]++
+			}
+			convey.So(counts, convey.ShouldResemble, map[int]int{11: 30, 12: 100})
+		})
+
+		convey.Convey("least outstanding and p2c avoid the busy channel", func() {
+			ctx := context.Background()
+			channels := []*model.Channel{{ID: 21}, {ID: 22}}
+			lease, ok := concurrency.Acquire(ctx, 21, 0)
+			convey.So(ok, convey.ShouldBeTrue)
+			defer lease.Release()
+
+			for range 20 {
+				channel := model.GetChannelSelector(model.ChannelSelectorLeastOutstanding).Select("m", channels, nil)
+				convey.So(channel.ID, convey.ShouldEqual, 22)
+
+				// with two channels both are drawn
+				channel = model.GetChannelSelector(model.ChannelSelectorP2C).Select("m", channels, nil)
+				convey.So(channel.ID, convey.ShouldEqual, 22)
+			}
+
+			lease.Release()
+			picked := map[int]bool{}
+			for range 50 {
+				channel := model.GetChannelSelector(model.ChannelSelectorLeastOutstanding).Select("m", channels, nil)
+				picked[channel.ID] = true
+			}
+			// ties are broken randomly
+			convey.So(picked, convey.ShouldResemble, map[int]bool{21: true, 22: true})
+		})
+	})
+}
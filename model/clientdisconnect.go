@@ -0,0 +1,39 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/labring/aiproxy/common/config"
+)
+
+// policies of the upstream request when the client disconnects
+const (
+	// ClientDisconnectPolicyContinue keeps the upstream request running so its usage can be recorded
+	ClientDisconnectPolicyContinue = "continue"
+	// ClientDisconnectPolicyCancelStream cancels streams, the part streamed so far is billed,
+	// non-streaming requests continue
+	ClientDisconnectPolicyCancelStream = "cancel_stream"
+	// ClientDisconnectPolicyCancel cancels every request, non-streaming requests are billed by the input tokens
+	ClientDisconnectPolicyCancel = "cancel"
+)
+
+// ValidateClientDisconnectPolicy checks the policies of the modes
+func ValidateClientDisconnectPolicy(policy map[int]string) error {
+	for mode, p := range policy {
+		switch p {
+		case ClientDisconnectPolicyContinue, ClientDisconnectPolicyCancelStream, ClientDisconnectPolicyCancel:
+		default:
+			return fmt.Errorf("invalid client disconnect policy %q of mode %d, must be one of %s, %s, %s",
+				p, mode, ClientDisconnectPolicyContinue, ClientDisconnectPolicyCancelStream, ClientDisconnectPolicyCancel)
+		}
+	}
+	return nil
+}
+
+// GetClientDisconnectPolicy returns the policy of the mode, continue by default
+func GetClientDisconnectPolicy(mode int) string {
+	if p, ok := config.GetClientDisconnectPolicy()[mode]; ok && p != "" {
+		return p
+	}
+	return ClientDisconnectPolicyContinue
+}
@@ -7,48 +7,179 @@ import (
 
 	"github.com/bytedance/sonic"
 	"github.com/labring/aiproxy/common"
+	"gorm.io/gorm"
 )
 
+const ErrConsumeErrorNotFound = "consume error"
+
+// states of the consume errors, a pending error is retried by the reconciler
+// until it succeeds or the retries are exhausted, an exhausted error can be retried or written off manually,
+// the errors recorded before the reconciler existed are legacy, they are never retried automatically
+const (
+	ConsumeErrorStatusPending    = "pending"
+	ConsumeErrorStatusSucceeded  = "succeeded"
+	ConsumeErrorStatusExhausted  = "exhausted"
+	ConsumeErrorStatusWrittenOff = "written_off"
+	ConsumeErrorStatusLegacy     = "legacy"
+)
+
+// ConsumeErrorManualStatuses are the states of the consume errors which can be retried or written off manually
+var ConsumeErrorManualStatuses = []string{
+	ConsumeErrorStatusPending,
+	ConsumeErrorStatusExhausted,
+	ConsumeErrorStatusLegacy,
+}
+
 type ConsumeError struct {
-	RequestAt  time.Time       `gorm:"index;index:idx_consume_error_group_reqat,priority:2" json:"request_at"`
-	CreatedAt  time.Time       `json:"created_at"`
-	GroupID    string          `gorm:"index;index:idx_consume_error_group_reqat,priority:1" json:"group_id"`
-	RequestID  string          `gorm:"index"                                                json:"request_id"`
-	TokenName  EmptyNullString `gorm:"not null"                                             json:"token_name"`
-	Model      string          `json:"model"`
-	Content    string          `gorm:"type:text"                                            json:"content"`
-	ID         int             `gorm:"primaryKey"                                           json:"id"`
-	UsedAmount float64         `json:"used_amount"`
-	TokenID    int             `json:"token_id"`
+	RequestAt   time.Time       `gorm:"index;index:idx_consume_error_group_reqat,priority:2" json:"request_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	NextRetryAt time.Time       `gorm:"index"                                                json:"next_retry_at"`
+	ResolvedAt  time.Time       `json:"resolved_at"`
+	Status      string          `gorm:"type:varchar(16);index"                               json:"status"`
+	LastError   string          `gorm:"type:text"                                            json:"last_error,omitempty"`
+	Remark      string          `gorm:"type:text"                                            json:"remark,omitempty"`
+	Attempts    int             `gorm:"default:0"                                            json:"attempts"`
+	GroupID     string          `gorm:"index;index:idx_consume_error_group_reqat,priority:1" json:"group_id"`
+	RequestID   string          `gorm:"index"                                                json:"request_id"`
+	ConsumeID   EmptyNullString `gorm:"type:varchar(80)"                                     json:"consume_id,omitempty"`
+	TokenName   EmptyNullString `gorm:"not null"                                             json:"token_name"`
+	Model       string          `json:"model"`
+	Content     string          `gorm:"type:text"                                            json:"content"`
+	ID          int             `gorm:"primaryKey"                                           json:"id"`
+	UsedAmount  float64         `json:"used_amount"`
+	TokenID     int             `json:"token_id"`
 }
 
 func (c *ConsumeError) MarshalJSON() ([]byte, error) {
 	type Alias ConsumeError
 	return sonic.Marshal(&struct {
 		*Alias
-		CreatedAt int64 `json:"created_at"`
-		RequestAt int64 `json:"request_at"`
+		CreatedAt   int64 `json:"created_at"`
+		RequestAt   int64 `json:"request_at"`
+		NextRetryAt int64 `json:"next_retry_at,omitempty"`
+		ResolvedAt  int64 `json:"resolved_at,omitempty"`
 	}{
-		Alias:     (*Alias)(c),
-		CreatedAt: c.CreatedAt.UnixMilli(),
-		RequestAt: c.RequestAt.UnixMilli(),
+		Alias:       (*Alias)(c),
+		CreatedAt:   c.CreatedAt.UnixMilli(),
+		RequestAt:   c.RequestAt.UnixMilli(),
+		NextRetryAt: unixMilliOrZero(c.NextRetryAt),
+		ResolvedAt:  unixMilliOrZero(c.ResolvedAt),
 	})
 }
 
-func CreateConsumeError(requestID string, requestAt time.Time, group string, tokenName string, model string, content string, usedAmount float64, tokenID int) error {
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+// CreateConsumeError records a charge which failed to be posted, the consume id is the idempotency key
+// of the charge and is posted again by every retry, so a charge whose response was lost is not charged twice
+func CreateConsumeError(requestID string, consumeID string, requestAt time.Time, group string, tokenName string, model string, content string, usedAmount float64, tokenID int) error {
 	return LogDB.Create(&ConsumeError{
-		RequestID:  requestID,
-		RequestAt:  requestAt,
-		GroupID:    group,
-		TokenName:  EmptyNullString(tokenName),
-		Model:      model,
-		Content:    content,
-		UsedAmount: usedAmount,
-		TokenID:    tokenID,
+		RequestID:   requestID,
+		ConsumeID:   EmptyNullString(consumeID),
+		RequestAt:   requestAt,
+		GroupID:     group,
+		TokenName:   EmptyNullString(tokenName),
+		Model:       model,
+		Content:     content,
+		UsedAmount:  usedAmount,
+		TokenID:     tokenID,
+		Status:      ConsumeErrorStatusPending,
+		NextRetryAt: time.Now(),
 	}).Error
 }
 
-func SearchConsumeError(keyword string, requestID string, group string, tokenName string, model string, tokenID int, page int, perPage int, order string) ([]*ConsumeError, int64, error) {
+func GetConsumeErrorByID(id int) (*ConsumeError, error) {
+	var consumeError ConsumeError
+	err := LogDB.Where("id = ?", id).First(&consumeError).Error
+	return &consumeError, HandleNotFound(err, ErrConsumeErrorNotFound)
+}
+
+// GetRetryableConsumeErrors returns the pending consume errors due to be retried, oldest first
+func GetRetryableConsumeErrors(now time.Time, limit int) ([]*ConsumeError, error) {
+	var consumeErrors []*ConsumeError
+	err := LogDB.
+		Where("status = ? AND next_retry_at <= ?", ConsumeErrorStatusPending, now).
+		Order("id asc").
+		Limit(limit).
+		Find(&consumeErrors).Error
+	return consumeErrors, err
+}
+
+// ClaimConsumeErrorRetry counts an attempt of the consume error and schedules the next one,
+// the attempt is claimed by one instance only, false is returned when it is claimed by another one
+// or the error has been resolved
+func ClaimConsumeErrorRetry(consumeError *ConsumeError, nextRetryAt time.Time) (bool, error) {
+	result := LogDB.Model(&ConsumeError{}).
+		Where("id = ? AND attempts = ?", consumeError.ID, consumeError.Attempts).
+		Where("status IN (?)", ConsumeErrorManualStatuses).
+		Updates(map[string]any{
+			"attempts":      consumeError.Attempts + 1,
+			"next_retry_at": nextRetryAt,
+			"status":        ConsumeErrorStatusPending,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+	consumeError.Attempts++
+	consumeError.NextRetryAt = nextRetryAt
+	consumeError.Status = ConsumeErrorStatusPending
+	return true, nil
+}
+
+// UpdateConsumeErrorRetryResult records the result of the claimed attempt,
+// the error is succeeded without retry error, exhausted when no retry is left, otherwise still pending
+func UpdateConsumeErrorRetryResult(consumeError *ConsumeError, retryErr error, exhausted bool) error {
+	updates := map[string]any{}
+	switch {
+	case retryErr == nil:
+		consumeError.Status = ConsumeErrorStatusSucceeded
+		consumeError.ResolvedAt = time.Now()
+		updates["resolved_at"] = consumeError.ResolvedAt
+	case exhausted:
+		consumeError.Status = ConsumeErrorStatusExhausted
+		consumeError.LastError = retryErr.Error()
+		updates["last_error"] = consumeError.LastError
+	default:
+		consumeError.LastError = retryErr.Error()
+		updates["last_error"] = consumeError.LastError
+	}
+	updates["status"] = consumeError.Status
+	return LogDB.Model(&ConsumeError{}).
+		Where("id = ? AND status = ?", consumeError.ID, ConsumeErrorStatusPending).
+		Updates(updates).Error
+}
+
+// WriteOffConsumeError gives up a pending, exhausted or legacy consume error, the amount is never consumed
+func WriteOffConsumeError(id int, remark string) (*ConsumeError, error) {
+	result := LogDB.Model(&ConsumeError{}).
+		Where("id = ?", id).
+		Where("status IN (?)", ConsumeErrorManualStatuses).
+		Updates(map[string]any{
+			"status":      ConsumeErrorStatusWrittenOff,
+			"remark":      remark,
+			"resolved_at": time.Now(),
+		})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	consumeError, err := GetConsumeErrorByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("consume error %d is %s", id, consumeError.Status)
+	}
+	return consumeError, nil
+}
+
+func SearchConsumeError(keyword string, requestID string, group string, tokenName string, model string, status string, tokenID int, page int, perPage int, order string) ([]*ConsumeError, int64, error) {
 	tx := LogDB.Model(&ConsumeError{})
 
 	// Handle exact match conditions for non-zero values
@@ -67,6 +198,9 @@ func SearchConsumeError(keyword string, requestID string, group string, tokenNam
 	if tokenID != 0 {
 		tx = tx.Where("token_id = ?", tokenID)
 	}
+	if status != "" {
+		tx = tx.Where("status = ?", status)
+	}
 
 	// Handle keyword search for zero value fields
 	if keyword != "" {
@@ -129,3 +263,12 @@ func SearchConsumeError(keyword string, requestID string, group string, tokenNam
 	err = tx.Order(getLogOrder(order)).Limit(limit).Offset(offset).Find(&errors).Error
 	return errors, total, err
 }
+
+// backfillLegacyConsumeErrors marks the consume errors recorded before the reconciler existed as legacy,
+// so the reconciler does not charge the historical errors again,
+// the errors recorded since then always have the next retry time
+func backfillLegacyConsumeErrors(tx *gorm.DB) error {
+	return tx.Model(&ConsumeError{}).
+		Where("status IS NULL OR status = '' OR (status = ? AND next_retry_at IS NULL)", ConsumeErrorStatusPending).
+		Update("status", ConsumeErrorStatusLegacy).Error
+}
@@ -23,17 +23,21 @@ const (
 )
 
 type Group struct {
-	CreatedAt     time.Time        `json:"created_at"`
-	ID            string           `gorm:"primaryKey"                    json:"id"`
-	Tokens        []*Token         `gorm:"foreignKey:GroupID"            json:"-"`
-	Status        int              `gorm:"default:1;index"               json:"status"`
-	RPMRatio      float64          `gorm:"index"                         json:"rpm_ratio"`
-	RPM           map[string]int64 `gorm:"serializer:fastjson;type:text" json:"rpm"`
-	TPMRatio      float64          `gorm:"index"                         json:"tpm_ratio"`
-	TPM           map[string]int64 `gorm:"serializer:fastjson;type:text" json:"tpm"`
-	UsedAmount    float64          `gorm:"index"                         json:"used_amount"`
-	RequestCount  int              `gorm:"index"                         json:"request_count"`
-	AvailableSets []string         `gorm:"serializer:fastjson;type:text" json:"available_sets"`
+	CreatedAt      time.Time         `json:"created_at"`
+	ID             string            `gorm:"primaryKey"                    json:"id"`
+	Tokens         []*Token          `gorm:"foreignKey:GroupID"            json:"-"`
+	Status         int               `gorm:"default:1;index"               json:"status"`
+	RPMRatio       float64           `gorm:"index"                         json:"rpm_ratio"`
+	RPM            map[string]int64  `gorm:"serializer:fastjson;type:text" json:"rpm"`
+	TPMRatio       float64           `gorm:"index"                         json:"tpm_ratio"`
+	TPM            map[string]int64  `gorm:"serializer:fastjson;type:text" json:"tpm"`
+	UsedAmount     float64           `gorm:"index"                         json:"used_amount"`
+	RequestCount   int               `gorm:"index"                         json:"request_count"`
+	AvailableSets  []string          `gorm:"serializer:fastjson;type:text" json:"available_sets"`
+	RateLimitWait  bool              `json:"rate_limit_wait"`
+	ModelAliases   map[string]string `gorm:"serializer:fastjson;type:text" json:"model_aliases,omitempty"`
+	PeriodicQuotas PeriodicQuotas    `gorm:"serializer:fastjson;type:text" json:"periodic_quotas,omitempty"`
+	Pricing        GroupPricing      `gorm:"serializer:fastjson;type:text" json:"pricing"`
 }
 
 func (g *Group) BeforeDelete(tx *gorm.DB) (err error) {
@@ -151,11 +155,30 @@ func UpdateGroup(id string, group *Group) (err error) {
 			"tpm_ratio",
 			"tpm",
 			"available_sets",
+			"rate_limit_wait",
+			"model_aliases",
+			"periodic_quotas",
+			"pricing",
 		).
 		Updates(group)
 	return HandleUpdateResult(result, ErrGroupNotFound)
 }
 
+func UpdateGroupPricing(id string, pricing GroupPricing) (err error) {
+	defer func() {
+		if err == nil {
+			if err := CacheDeleteGroup(id); err != nil {
+				log.Error("cache delete group failed: " + err.Error())
+			}
+		}
+	}()
+	result := DB.Model(&Group{ID: id}).
+		Where("id = ?", id).
+		Select("pricing").
+		Updates(&Group{Pricing: pricing})
+	return HandleUpdateResult(result, ErrGroupNotFound)
+}
+
 func UpdateGroupUsedAmountAndRequestCount(id string, amount float64, count int) (err error) {
 	group := &Group{}
 	defer func() {
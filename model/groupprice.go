@@ -0,0 +1,89 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/common/conv"
+)
+
+// GroupPricing customizes the prices of a group, the price of a model replaces the price of its requests,
+// a discount is the percentage off the price, the discount of a model takes precedence over the discount of its owner,
+// the discounts do not apply to the replaced prices
+type GroupPricing struct {
+	Prices         map[string]Price       `json:"prices,omitempty"`
+	ModelDiscounts map[string]float64     `json:"model_discounts,omitempty"`
+	OwnerDiscounts map[ModelOwner]float64 `json:"owner_discounts,omitempty"`
+}
+
+func (p *GroupPricing) ScanRedis(value string) error {
+	return sonic.Unmarshal(conv.StringToBytes(value), p)
+}
+
+func (p GroupPricing) MarshalBinary() ([]byte, error) {
+	return sonic.Marshal(p)
+}
+
+func (p GroupPricing) Validate() error {
+	for model, price := range p.Prices {
+		if err := price.Validate(); err != nil {
+			return fmt.Errorf("invalid price of model %s: %w", model, err)
+		}
+	}
+	for model, discount := range p.ModelDiscounts {
+		if discount < 0 || discount > 100 {
+			return fmt.Errorf("discount of model %s must be between 0 and 100", model)
+		}
+	}
+	for owner, discount := range p.OwnerDiscounts {
+		if discount < 0 || discount > 100 {
+			return fmt.Errorf("discount of owner %s must be between 0 and 100", owner)
+		}
+	}
+	return nil
+}
+
+// GroupPriceAdjustment is how the pricing of the group changed the price of a request,
+// Discount is the percentage off the price
+type GroupPriceAdjustment struct {
+	Overridden bool
+	Discount   float64
+}
+
+// discount returns the discount of the model, false if neither the model nor its owner has one
+func (p *GroupPricing) discount(mc *ModelConfig) (float64, bool) {
+	if discount, ok := p.ModelDiscounts[mc.Model]; ok {
+		return discount, true
+	}
+	discount, ok := p.OwnerDiscounts[mc.Owner]
+	return discount, ok
+}
+
+// Apply returns the price of a request of the model for the group
+func (p *GroupPricing) Apply(mc *ModelConfig, price Price) (Price, GroupPriceAdjustment) {
+	if override, ok := p.Prices[mc.Model]; ok {
+		return override, GroupPriceAdjustment{Overridden: true}
+	}
+	discount, ok := p.discount(mc)
+	if !ok || discount == 0 {
+		return price, GroupPriceAdjustment{}
+	}
+	return price.scale(1 - discount/100), GroupPriceAdjustment{Discount: discount}
+}
+
+// ApplyModelConfig returns the model config with the prices of the group
+func (p *GroupPricing) ApplyModelConfig(mc *ModelConfig) *ModelConfig {
+	price, adjustment := p.Apply(mc, mc.Price)
+	if !adjustment.Overridden && adjustment.Discount == 0 {
+		return mc
+	}
+	newMc := *mc
+	newMc.Price = price
+	if adjustment.Discount != 0 && len(mc.ImagePrices) > 0 {
+		newMc.ImagePrices = make(map[string]float64, len(mc.ImagePrices))
+		for size, imagePrice := range mc.ImagePrices {
+			newMc.ImagePrices[size] = imagePrice * (1 - adjustment.Discount/100)
+		}
+	}
+	return &newMc
+}
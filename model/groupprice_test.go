@@ -0,0 +1,53 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroupPricingApply(t *testing.T) {
+	convey.Convey("TestGroupPricingApply", t, func() {
+		pricing := model.GroupPricing{
+			Prices: map[string]model.Price{
+				"gpt-4o": {InputPrice: 1, OutputPrice: 2},
+			},
+			ModelDiscounts: map[string]float64{
+				"claude-3-5-haiku": 0,
+			},
+			OwnerDiscounts: map[model.ModelOwner]float64{
+				model.ModelOwnerOpenAI:    20,
+				model.ModelOwnerAnthropic: 50,
+			},
+		}
+		convey.So(pricing.Validate(), convey.ShouldBeNil)
+
+		price := model.Price{
+			InputPrice:  10,
+			OutputPrice: 20,
+			Tiers:       []model.PriceTier{{InputTokensOver: 1000, InputPrice: 5}},
+		}
+
+		// the override is used as is
+		p, adjustment := pricing.Apply(&model.ModelConfig{Model: "gpt-4o", Owner: model.ModelOwnerOpenAI}, price)
+		convey.So(adjustment.Overridden, convey.ShouldBeTrue)
+		convey.So(p.InputPrice, convey.ShouldEqual, 1)
+		convey.So(p.OutputPrice, convey.ShouldEqual, 2)
+
+		p, adjustment = pricing.Apply(&model.ModelConfig{Model: "gpt-4o-mini", Owner: model.ModelOwnerOpenAI}, price)
+		convey.So(adjustment.Discount, convey.ShouldEqual, 20)
+		convey.So(p.InputPrice, convey.ShouldEqual, 8)
+		convey.So(p.OutputPrice, convey.ShouldEqual, 16)
+		convey.So(p.Tiers[0].InputPrice, convey.ShouldEqual, 4)
+		convey.So(price.Tiers[0].InputPrice, convey.ShouldEqual, 5)
+
+		// the model discount takes precedence over the owner discount
+		p, adjustment = pricing.Apply(&model.ModelConfig{Model: "claude-3-5-haiku", Owner: model.ModelOwnerAnthropic}, price)
+		convey.So(adjustment, convey.ShouldResemble, model.GroupPriceAdjustment{})
+		convey.So(p.InputPrice, convey.ShouldEqual, 10)
+
+		pricing.OwnerDiscounts[model.ModelOwnerOpenAI] = 120
+		convey.So(pricing.Validate(), convey.ShouldNotBeNil)
+	})
+}
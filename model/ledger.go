@@ -0,0 +1,304 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/common"
+	"github.com/redis/go-redis/v9"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const GroupLedgerBalanceKey = "group:%s:ledger_balance"
+
+// types of the ledger entries
+const (
+	LedgerEntryTopUp      = "topup"
+	LedgerEntryDeduction  = "deduction"
+	LedgerEntryAdjustment = "adjustment"
+	LedgerEntryRefund     = "refund"
+)
+
+// LedgerEntry is an immutable change of the local balance of a group,
+// the balance of a group is the sum of the amounts of its entries,
+// deductions are negative, adjustments may be either,
+// the consume id of a deduction is unique so a charge is deducted once, a request may be charged once per attempt,
+// the request and consume ids are null for the other entries
+type LedgerEntry struct {
+	CreatedAt time.Time       `gorm:"autoCreateTime;index"                                                        json:"created_at"`
+	GroupID   string          `gorm:"index;type:varchar(64);uniqueIndex:idx_ledger_group_consume_type,priority:1" json:"group"`
+	Type      string          `gorm:"type:varchar(32);index;uniqueIndex:idx_ledger_group_consume_type,priority:3" json:"type"`
+	TokenName string          `json:"token_name,omitempty"`
+	RequestID EmptyNullString `gorm:"type:varchar(64);index"                                                      json:"request_id,omitempty"`
+	ConsumeID EmptyNullString `gorm:"type:varchar(80);uniqueIndex:idx_ledger_group_consume_type,priority:2"       json:"consume_id,omitempty"`
+	Remark    string          `gorm:"type:text"                                                                   json:"remark,omitempty"`
+	ID        int             `gorm:"primaryKey"                                                                  json:"id"`
+	Amount    float64         `gorm:"type:decimal(20,6)"                                                          json:"amount"`
+}
+
+// GroupLedgerBalance is the running balance of a group, the sum of its ledger entries,
+// it is updated in the transaction adding an entry
+type GroupLedgerBalance struct {
+	UpdatedAt time.Time `json:"updated_at"`
+	GroupID   string    `gorm:"primaryKey;type:varchar(64)" json:"group"`
+	Balance   float64   `gorm:"type:decimal(20,6)"          json:"balance"`
+}
+
+func (e *LedgerEntry) MarshalJSON() ([]byte, error) {
+	type Alias LedgerEntry
+	return sonic.Marshal(&struct {
+		*Alias
+		CreatedAt int64 `json:"created_at"`
+	}{
+		Alias:     (*Alias)(e),
+		CreatedAt: e.CreatedAt.UnixMilli(),
+	})
+}
+
+// ValidateLedgerCredit checks an entry added by the admin, top-ups and refunds are positive,
+// adjustments must not be zero, deductions are only made by the consumption
+func ValidateLedgerCredit(entryType string, amount float64) error {
+	switch entryType {
+	case LedgerEntryTopUp, LedgerEntryRefund:
+		if amount <= 0 {
+			return fmt.Errorf("%s amount must be greater than 0", entryType)
+		}
+	case LedgerEntryAdjustment:
+		if amount == 0 {
+			return errors.New("adjustment amount must not be 0")
+		}
+	default:
+		return fmt.Errorf("invalid ledger entry type %q, must be one of %s, %s, %s",
+			entryType, LedgerEntryTopUp, LedgerEntryAdjustment, LedgerEntryRefund)
+	}
+	return nil
+}
+
+// CreditGroupLedger adds a top-up, adjustment or refund entry of the group
+func CreditGroupLedger(group, entryType string, amount float64, remark string) (*LedgerEntry, error) {
+	if group == "" {
+		return nil, errors.New("group id is empty")
+	}
+	if err := ValidateLedgerCredit(entryType, amount); err != nil {
+		return nil, err
+	}
+	if _, err := GetGroupByID(group); err != nil {
+		return nil, err
+	}
+	entry := &LedgerEntry{
+		GroupID: group,
+		Type:    entryType,
+		Amount:  amount,
+		Remark:  remark,
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return addLedgerEntry(tx, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := CacheDeleteGroupLedgerBalance(group); err != nil {
+		return entry, err
+	}
+	return entry, nil
+}
+
+// DeductGroupLedger adds the deduction entry of a charge of the group,
+// a charge is deducted once, false is returned when the consume id has been deducted
+func DeductGroupLedger(group, requestID, consumeID, tokenName string, amount float64) (bool, error) {
+	if amount <= 0 {
+		return false, nil
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return addLedgerEntry(tx, &LedgerEntry{
+			GroupID:   group,
+			Type:      LedgerEntryDeduction,
+			TokenName: tokenName,
+			RequestID: EmptyNullString(requestID),
+			ConsumeID: EmptyNullString(consumeID),
+			Amount:    -amount,
+		})
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// addLedgerEntry creates the entry and adds its amount to the running balance of the group
+func addLedgerEntry(tx *gorm.DB, entry *LedgerEntry) error {
+	if err := tx.Create(entry).Error; err != nil {
+		return err
+	}
+	updated, err := increaseGroupLedgerBalance(tx, entry.GroupID, entry.Amount)
+	if err != nil || updated {
+		return err
+	}
+	// the running balance is initialized from the entries including the new one,
+	// when it is initialized concurrently the amount is added to it
+	created, err := initGroupLedgerBalance(tx, entry.GroupID)
+	if err != nil || created {
+		return err
+	}
+	_, err = increaseGroupLedgerBalance(tx, entry.GroupID, entry.Amount)
+	return err
+}
+
+func increaseGroupLedgerBalance(tx *gorm.DB, group string, amount float64) (bool, error) {
+	result := tx.Model(&GroupLedgerBalance{}).
+		Where("group_id = ?", group).
+		Updates(map[string]any{
+			"balance":    gorm.Expr("balance + ?", amount),
+			"updated_at": time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// initGroupLedgerBalance creates the running balance of the group from the sum of its entries,
+// false is returned when it exists
+func initGroupLedgerBalance(tx *gorm.DB, group string) (bool, error) {
+	var sum float64
+	err := tx.Model(&LedgerEntry{}).
+		Where("group_id = ?", group).
+		Select("COALESCE(SUM(amount), 0)").
+		Scan(&sum).Error
+	if err != nil {
+		return false, err
+	}
+	result := tx.
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&GroupLedgerBalance{GroupID: group, Balance: sum})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetGroupLedgerBalance returns the running balance of the group,
+// it is initialized from the entries of the group the first time
+func GetGroupLedgerBalance(group string) (float64, error) {
+	var balance GroupLedgerBalance
+	err := DB.Where("group_id = ?", group).First(&balance).Error
+	if err == nil {
+		return balance.Balance, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, err
+	}
+	if _, err := initGroupLedgerBalance(DB, group); err != nil {
+		return 0, err
+	}
+	err = DB.Where("group_id = ?", group).First(&balance).Error
+	return balance.Balance, err
+}
+
+// migrateLedgerRequestID nulls the empty request ids written before they were unique,
+// and drops the unique index of the request ids replaced by the consume ids
+func migrateLedgerRequestID(tx *gorm.DB) error {
+	if !tx.Migrator().HasColumn(&LedgerEntry{}, "request_id") {
+		return nil
+	}
+	if tx.Migrator().HasIndex(&LedgerEntry{}, "idx_ledger_group_request_type") {
+		if err := tx.Migrator().DropIndex(&LedgerEntry{}, "idx_ledger_group_request_type"); err != nil {
+			return err
+		}
+	}
+	return tx.Model(&LedgerEntry{}).
+		Where("request_id = ''").
+		Update("request_id", nil).Error
+}
+
+// migrateLedgerConsumeID keys the deductions made before the consume ids by their request ids,
+// the consume errors of that time are retried with the request id as the consume id
+func migrateLedgerConsumeID(tx *gorm.DB) error {
+	return tx.Model(&LedgerEntry{}).
+		Where("type = ? AND consume_id IS NULL AND request_id IS NOT NULL", LedgerEntryDeduction).
+		Update("consume_id", gorm.Expr("request_id")).Error
+}
+
+// GetGroupLedgerEntries returns the ledger entries of the group, newest first
+func GetGroupLedgerEntries(group, entryType string, startTime, endTime time.Time, page, perPage int) (entries []*LedgerEntry, total int64, err error) {
+	tx := DB.Model(&LedgerEntry{}).Where("group_id = ?", group)
+	if entryType != "" {
+		tx = tx.Where("type = ?", entryType)
+	}
+	tx = applyLedgerTimeRange(tx, startTime, endTime)
+
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	if total <= 0 {
+		return nil, 0, nil
+	}
+	limit, offset := toLimitOffset(page, perPage)
+	err = tx.Order("id desc").Limit(limit).Offset(offset).Find(&entries).Error
+	return entries, total, err
+}
+
+func applyLedgerTimeRange(tx *gorm.DB, startTime, endTime time.Time) *gorm.DB {
+	switch {
+	case !startTime.IsZero() && !endTime.IsZero():
+		return tx.Where("created_at BETWEEN ? AND ?", startTime, endTime)
+	case !startTime.IsZero():
+		return tx.Where("created_at >= ?", startTime)
+	case !endTime.IsZero():
+		return tx.Where("created_at <= ?", endTime)
+	default:
+		return tx
+	}
+}
+
+// CacheGetGroupLedgerBalance returns the cached balance of the group, it is loaded from the ledger on miss
+//
+//nolint:gosec
+func CacheGetGroupLedgerBalance(group string) (float64, error) {
+	if !common.RedisEnabled {
+		return GetGroupLedgerBalance(group)
+	}
+
+	key := fmt.Sprintf(GroupLedgerBalanceKey, group)
+	balance, err := common.RDB.Get(context.Background(), key).Float64()
+	if err == nil {
+		return balance, nil
+	} else if !errors.Is(err, redis.Nil) {
+		log.Errorf("get group (%s) ledger balance from redis error: %s", group, err.Error())
+	}
+
+	balance, err = GetGroupLedgerBalance(group)
+	if err != nil {
+		return 0, err
+	}
+	expireTime := SyncFrequency + time.Duration(rand.Int64N(60)-30)*time.Second
+	if err := common.RDB.SetNX(context.Background(), key, strconv.FormatFloat(balance, 'f', -1, 64), expireTime).Err(); err != nil {
+		log.Error("redis set group ledger balance error: " + err.Error())
+	}
+	return balance, nil
+}
+
+var decreaseGroupLedgerBalanceScript = redis.NewScript(`
+	if redis.call("Exists", KEYS[1]) == 0 then
+		return redis.status_reply("ok")
+	end
+	redis.call("IncrByFloat", KEYS[1], -ARGV[1])
+	return redis.status_reply("ok")
+`)
+
+// CacheDecreaseGroupLedgerBalance decreases the cached balance of the group atomically, a missing cache is left to be loaded
+func CacheDecreaseGroupLedgerBalance(group string, amount float64) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return decreaseGroupLedgerBalanceScript.Run(context.Background(), common.RDB, []string{fmt.Sprintf(GroupLedgerBalanceKey, group)}, amount).Err()
+}
+
+func CacheDeleteGroupLedgerBalance(group string) error {
+	if !common.RedisEnabled {
+		return nil
+	}
+	return common.RDB.Del(context.Background(), fmt.Sprintf(GroupLedgerBalanceKey, group)).Err()
+}
@@ -0,0 +1,142 @@
+package model_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroupLedger(t *testing.T) {
+	convey.Convey("TestGroupLedger", t, func() {
+		initTestDB(t)
+		convey.So(model.CreateGroup(&model.Group{ID: "g1"}), convey.ShouldBeNil)
+
+		_, err := model.CreditGroupLedger("g1", model.LedgerEntryTopUp, 10, "")
+		convey.So(err, convey.ShouldBeNil)
+		_, err = model.CreditGroupLedger("g1", model.LedgerEntryTopUp, 5, "")
+		convey.So(err, convey.ShouldBeNil)
+
+		convey.Convey("a charge is deducted once", func() {
+			deducted, err := model.DeductGroupLedger("g1", "r1", "r1:0", "t", 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(deducted, convey.ShouldBeTrue)
+
+			deducted, err = model.DeductGroupLedger("g1", "r1", "r1:0", "t", 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(deducted, convey.ShouldBeFalse)
+
+			balance, err := model.GetGroupLedgerBalance("g1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(balance, convey.ShouldEqual, 13)
+		})
+
+		convey.Convey("concurrent deductions of a charge are deducted once", func() {
+			var wg sync.WaitGroup
+			var mu sync.Mutex
+			deductedCount := 0
+			for range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					deducted, err := model.DeductGroupLedger("g1", "r2", "r2:0", "t", 1)
+					if err == nil && deducted {
+						mu.Lock()
+						deductedCount++
+						mu.Unlock()
+					}
+				}()
+			}
+			wg.Wait()
+			convey.So(deductedCount, convey.ShouldEqual, 1)
+
+			balance, err := model.GetGroupLedgerBalance("g1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(balance, convey.ShouldEqual, 14)
+		})
+
+		convey.Convey("every attempt of a request is deducted", func() {
+			// the interrupted part of a failed over stream and its continuation
+			deducted, err := model.DeductGroupLedger("g1", "r3", "r3:0", "t", 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(deducted, convey.ShouldBeTrue)
+			deducted, err = model.DeductGroupLedger("g1", "r3", "r3:1", "t", 3)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(deducted, convey.ShouldBeTrue)
+
+			// the reconciler replaying the first charge is deduplicated
+			deducted, err = model.DeductGroupLedger("g1", "r3", "r3:0", "t", 2)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(deducted, convey.ShouldBeFalse)
+
+			balance, err := model.GetGroupLedgerBalance("g1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(balance, convey.ShouldEqual, 10)
+
+			entries, total, err := model.GetGroupLedgerEntries("g1", model.LedgerEntryDeduction, time.Time{}, time.Time{}, 1, 10)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(total, convey.ShouldEqual, 2)
+			convey.So(string(entries[0].RequestID), convey.ShouldEqual, "r3")
+			convey.So(string(entries[1].RequestID), convey.ShouldEqual, "r3")
+		})
+
+		convey.Convey("deductions without request id are not deduplicated", func() {
+			for range 2 {
+				deducted, err := model.DeductGroupLedger("g1", "", "", "t", 1)
+				convey.So(err, convey.ShouldBeNil)
+				convey.So(deducted, convey.ShouldBeTrue)
+			}
+			balance, err := model.GetGroupLedgerBalance("g1")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(balance, convey.ShouldEqual, 13)
+		})
+
+		convey.Convey("the running balance is initialized from the entries", func() {
+			convey.So(model.DB.Create(&model.LedgerEntry{
+				GroupID: "g2",
+				Type:    model.LedgerEntryTopUp,
+				Amount:  7,
+			}).Error, convey.ShouldBeNil)
+
+			balance, err := model.GetGroupLedgerBalance("g2")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(balance, convey.ShouldEqual, 7)
+
+			_, err = model.DeductGroupLedger("g2", "r3", "r3:0", "t", 3)
+			convey.So(err, convey.ShouldBeNil)
+			balance, err = model.GetGroupLedgerBalance("g2")
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(balance, convey.ShouldEqual, 4)
+		})
+	})
+}
+
+func TestCacheGroupLedgerBalance(t *testing.T) {
+	convey.Convey("TestCacheGroupLedgerBalance", t, func() {
+		initTestDB(t)
+		initTestRedis(t)
+		convey.So(model.CreateGroup(&model.Group{ID: "g1"}), convey.ShouldBeNil)
+		_, err := model.CreditGroupLedger("g1", model.LedgerEntryTopUp, 10, "")
+		convey.So(err, convey.ShouldBeNil)
+
+		// a missing cache is not decreased, it is loaded from the ledger
+		convey.So(model.CacheDecreaseGroupLedgerBalance("g1", 1), convey.ShouldBeNil)
+		balance, err := model.CacheGetGroupLedgerBalance("g1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(balance, convey.ShouldEqual, 10)
+
+		convey.So(model.CacheDecreaseGroupLedgerBalance("g1", 2.5), convey.ShouldBeNil)
+		balance, err = model.CacheGetGroupLedgerBalance("g1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(balance, convey.ShouldEqual, 7.5)
+
+		// a credit drops the cache
+		_, err = model.CreditGroupLedger("g1", model.LedgerEntryRefund, 1, "")
+		convey.So(err, convey.ShouldBeNil)
+		balance, err = model.CacheGetGroupLedgerBalance("g1")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(balance, convey.ShouldEqual, 11)
+	})
+}
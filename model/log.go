@@ -11,19 +11,21 @@ import (
 	"github.com/bytedance/sonic"
 	"github.com/labring/aiproxy/common"
 	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/relay/mode"
 	"github.com/shopspring/decimal"
+	log "github.com/sirupsen/logrus"
 	"golang.org/x/sync/errgroup"
 	"gorm.io/gorm"
 )
 
 type RequestDetail struct {
-	CreatedAt             time.Time `gorm:"autoCreateTime;index"              json:"-"`
-	RequestBody           string    `gorm:"type:text"                         json:"request_body,omitempty"`
-	ResponseBody          string    `gorm:"type:text"                         json:"response_body,omitempty"`
+	CreatedAt             time.Time `gorm:"autoCreateTime;index" json:"-"`
+	RequestBody           string    `gorm:"type:text"            json:"request_body,omitempty"`
+	ResponseBody          string    `gorm:"type:text"            json:"response_body,omitempty"`
 	RequestBodyTruncated  bool      `json:"request_body_truncated,omitempty"`
 	ResponseBodyTruncated bool      `json:"response_body_truncated,omitempty"`
-	ID                    int       `gorm:"primaryKey"                        json:"id"`
-	LogID                 int       `gorm:"index"                             json:"log_id"`
+	ID                    int       `gorm:"primaryKey"           json:"id"`
+	LogID                 int       `gorm:"index"                json:"log_id"`
 }
 
 func (d *RequestDetail) BeforeSave(_ *gorm.DB) (err error) {
@@ -38,11 +40,51 @@ func (d *RequestDetail) BeforeSave(_ *gorm.DB) (err error) {
 	return
 }
 
+// Price is per PriceUnit tokens, the cached, cache creation, reasoning, audio and image prices
+// bill those parts of the prompt and completion tokens, a zero price bills them as the other input or output tokens,
+// UnitPrice is per billing unit of the mode, e.g. a page, a character, a second of audio, an image or a request,
+// the windows multiply all prices by the time of day in the timezone
 type Price struct {
+	InputPrice         float64       `json:"input_price,omitempty"`
+	OutputPrice        float64       `json:"output_price,omitempty"`
+	CachedPrice        float64       `json:"cached_price,omitempty"`
+	CacheCreationPrice float64       `json:"cache_creation_price,omitempty"`
+	ReasoningPrice     float64       `json:"reasoning_price,omitempty"`
+	AudioInputPrice    float64       `json:"audio_input_price,omitempty"`
+	AudioOutputPrice   float64       `json:"audio_output_price,omitempty"`
+	ImageInputPrice    float64       `json:"image_input_price,omitempty"`
+	UnitPrice          float64       `json:"unit_price,omitempty"`
+	Tiers              []PriceTier   `gorm:"serializer:fastjson;type:text" json:"tiers,omitempty"`
+	Windows            []PriceWindow `gorm:"serializer:fastjson;type:text" json:"windows,omitempty"`
+	Timezone           string        `json:"timezone,omitempty"`
+}
+
+// LogPrice is the price a log was billed by, the tier and the window were resolved at the request time,
+// so the log keeps the flat prices only
+type LogPrice struct {
 	InputPrice         float64 `json:"input_price,omitempty"`
 	OutputPrice        float64 `json:"output_price,omitempty"`
 	CachedPrice        float64 `json:"cached_price,omitempty"`
 	CacheCreationPrice float64 `json:"cache_creation_price,omitempty"`
+	ReasoningPrice     float64 `json:"reasoning_price,omitempty"`
+	AudioInputPrice    float64 `json:"audio_input_price,omitempty"`
+	AudioOutputPrice   float64 `json:"audio_output_price,omitempty"`
+	ImageInputPrice    float64 `json:"image_input_price,omitempty"`
+	UnitPrice          float64 `json:"unit_price,omitempty"`
+}
+
+func NewLogPrice(p Price) LogPrice {
+	return LogPrice{
+		InputPrice:         p.InputPrice,
+		OutputPrice:        p.OutputPrice,
+		CachedPrice:        p.CachedPrice,
+		CacheCreationPrice: p.CacheCreationPrice,
+		ReasoningPrice:     p.ReasoningPrice,
+		AudioInputPrice:    p.AudioInputPrice,
+		AudioOutputPrice:   p.AudioOutputPrice,
+		ImageInputPrice:    p.ImageInputPrice,
+		UnitPrice:          p.UnitPrice,
+	}
 }
 
 type Usage struct {
@@ -50,9 +92,18 @@ type Usage struct {
 	OutputTokens        int `json:"output_tokens,omitempty"`
 	CachedTokens        int `json:"cached_tokens,omitempty"`
 	CacheCreationTokens int `json:"cache_creation_tokens,omitempty"`
+	ReasoningTokens     int `json:"reasoning_tokens,omitempty"`
+	AudioInputTokens    int `json:"audio_input_tokens,omitempty"`
+	AudioOutputTokens   int `json:"audio_output_tokens,omitempty"`
+	ImageInputTokens    int `json:"image_input_tokens,omitempty"`
+	Units               int `json:"units,omitempty"`
 	TotalTokens         int `json:"total_tokens,omitempty"`
 }
 
+// Log is the record of a request, PriceTier is the input tokens threshold of the price tier it was billed by,
+// 0 is the base price, PriceMultiplier is the multiplier of the price window at the request time,
+// PriceOverridden and PriceDiscount are the price override and the discount percentage of the group pricing,
+// Price is the effective price after all
 type Log struct {
 	RequestDetail        *RequestDetail `gorm:"foreignKey:LogID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"request_detail,omitempty"`
 	RequestAt            time.Time      `gorm:"index"                                                          json:"request_at"`
@@ -73,7 +124,11 @@ type Log struct {
 	IP                   string         `gorm:"index"                                                          json:"ip,omitempty"`
 	RetryTimes           int            `json:"retry_times,omitempty"`
 	DownstreamResult     bool           `json:"downstream_result,omitempty"`
-	Price                Price          `gorm:"embedded"                                                       json:"price,omitempty"`
+	Price                LogPrice       `gorm:"embedded"                                                       json:"price,omitempty"`
+	PriceTier            int64          `json:"price_tier,omitempty"`
+	PriceMultiplier      float64        `json:"price_multiplier,omitempty"`
+	PriceOverridden      bool           `json:"price_overridden,omitempty"`
+	PriceDiscount        float64        `json:"price_discount,omitempty"`
 	Usage                Usage          `gorm:"embedded"                                                       json:"usage,omitempty"`
 	UsedAmount           float64        `json:"used_amount,omitempty"`
 }
@@ -179,12 +234,14 @@ func (l *Log) MarshalJSON() ([]byte, error) {
 	type Alias Log
 	return sonic.Marshal(&struct {
 		*Alias
-		CreatedAt int64 `json:"created_at"`
-		RequestAt int64 `json:"request_at"`
+		BillingUnit string `json:"billing_unit"`
+		CreatedAt   int64  `json:"created_at"`
+		RequestAt   int64  `json:"request_at"`
 	}{
-		Alias:     (*Alias)(l),
-		CreatedAt: l.CreatedAt.UnixMilli(),
-		RequestAt: l.RequestAt.UnixMilli(),
+		Alias:       (*Alias)(l),
+		BillingUnit: BillingUnitOfMode(mode.Mode(l.Mode)),
+		CreatedAt:   l.CreatedAt.UnixMilli(),
+		RequestAt:   l.RequestAt.UnixMilli(),
 	})
 }
 
@@ -220,10 +277,23 @@ func GetGroupLogDetail(logID int, group string) (*RequestDetail, error) {
 const defaultCleanLogBatchSize = 1000
 
 func CleanLog(batchSize int) error {
+	// the statements of the last month are persisted before its logs are cleaned,
+	// a failure is retried on the next run and does not stop the cleaning
+	if err := CloseLastMonthStatements(); err != nil {
+		log.Errorf("close last month statements failed: %+v", err)
+	}
 	err := cleanLog(batchSize)
 	if err != nil {
 		return err
 	}
+	err = cleanChannelBreakerTransition(batchSize)
+	if err != nil {
+		return err
+	}
+	err = cleanMirrorResult(batchSize)
+	if err != nil {
+		return err
+	}
 	return cleanLogDetail(batchSize)
 }
 
@@ -281,6 +351,9 @@ func RecordConsumeLog(
 	downstreamResult bool,
 	usage Usage,
 	modelPrice Price,
+	priceTier int64,
+	priceMultiplier float64,
+	priceAdjustment GroupPriceAdjustment,
 	amount float64,
 ) error {
 	log := &Log{
@@ -300,7 +373,11 @@ func RecordConsumeLog(
 		RetryTimes:       retryTimes,
 		RequestDetail:    requestDetail,
 		DownstreamResult: downstreamResult,
-		Price:            modelPrice,
+		Price:            NewLogPrice(modelPrice),
+		PriceTier:        priceTier,
+		PriceMultiplier:  priceMultiplier,
+		PriceOverridden:  priceAdjustment.Overridden,
+		PriceDiscount:    priceAdjustment.Discount,
 		Usage:            usage,
 		UsedAmount:       amount,
 	}
@@ -919,19 +996,36 @@ func DeleteGroupLogs(groupID string) (int64, error) {
 }
 
 type ChartData struct {
-	Timestamp      int64   `json:"timestamp"`
-	RequestCount   int64   `json:"request_count"`
-	UsedAmount     float64 `json:"used_amount"`
-	ExceptionCount int64   `json:"exception_count"`
+	Timestamp         int64   `json:"timestamp"`
+	RequestCount      int64   `json:"request_count"`
+	UsedAmount        float64 `json:"used_amount"`
+	ExceptionCount    int64   `json:"exception_count"`
+	InputTokens       int64   `json:"input_tokens"`
+	OutputTokens      int64   `json:"output_tokens"`
+	ReasoningTokens   int64   `json:"reasoning_tokens"`
+	AudioInputTokens  int64   `json:"audio_input_tokens"`
+	AudioOutputTokens int64   `json:"audio_output_tokens"`
+	ImageInputTokens  int64   `json:"image_input_tokens"`
+}
+
+// DashboardUsage sums the tokens of the requests by kind
+type DashboardUsage struct {
+	InputTokens       int64 `json:"input_tokens"`
+	OutputTokens      int64 `json:"output_tokens"`
+	ReasoningTokens   int64 `json:"reasoning_tokens"`
+	AudioInputTokens  int64 `json:"audio_input_tokens"`
+	AudioOutputTokens int64 `json:"audio_output_tokens"`
+	ImageInputTokens  int64 `json:"image_input_tokens"`
 }
 
 type DashboardResponse struct {
-	ChartData      []*ChartData `json:"chart_data"`
-	TotalCount     int64        `json:"total_count"`
-	ExceptionCount int64        `json:"exception_count"`
-	UsedAmount     float64      `json:"used_amount"`
-	RPM            int64        `json:"rpm"`
-	TPM            int64        `json:"tpm"`
+	ChartData      []*ChartData   `json:"chart_data"`
+	TotalCount     int64          `json:"total_count"`
+	ExceptionCount int64          `json:"exception_count"`
+	UsedAmount     float64        `json:"used_amount"`
+	Usage          DashboardUsage `json:"usage"`
+	RPM            int64          `json:"rpm"`
+	TPM            int64          `json:"tpm"`
 }
 
 type GroupDashboardResponse struct {
@@ -967,7 +1061,13 @@ func getChartData(group string, start, end time.Time, tokenName, modelName strin
 	}
 
 	query := LogDB.Table("logs").
-		Select(timeSpanFormat + " as timestamp, count(*) as request_count, sum(used_amount) as used_amount, sum(case when code != 200 then 1 else 0 end) as exception_count").
+		Select(timeSpanFormat + ` as timestamp, count(*) as request_count, sum(used_amount) as used_amount,
+sum(case when code != 200 then 1 else 0 end) as exception_count,
+COALESCE(sum(input_tokens), 0) as input_tokens, COALESCE(sum(output_tokens), 0) as output_tokens,
+COALESCE(sum(reasoning_tokens), 0) as reasoning_tokens,
+COALESCE(sum(audio_input_tokens), 0) as audio_input_tokens,
+COALESCE(sum(audio_output_tokens), 0) as audio_output_tokens,
+COALESCE(sum(image_input_tokens), 0) as image_input_tokens`).
 		Group("timestamp").
 		Order("timestamp ASC")
 
@@ -1094,6 +1194,19 @@ func sumUsedAmount(chartData []*ChartData) float64 {
 	return amount.InexactFloat64()
 }
 
+func sumUsage(chartData []*ChartData) DashboardUsage {
+	var usage DashboardUsage
+	for _, data := range chartData {
+		usage.InputTokens += data.InputTokens
+		usage.OutputTokens += data.OutputTokens
+		usage.ReasoningTokens += data.ReasoningTokens
+		usage.AudioInputTokens += data.AudioInputTokens
+		usage.AudioOutputTokens += data.AudioOutputTokens
+		usage.ImageInputTokens += data.ImageInputTokens
+	}
+	return usage
+}
+
 func getRPM(group string, end time.Time, tokenName, modelName string, resultOnly bool) (int64, error) {
 	query := LogDB.Model(&Log{})
 
@@ -1200,6 +1313,7 @@ func GetDashboardData(
 		TotalCount:     totalCount,
 		ExceptionCount: exceptionCount,
 		UsedAmount:     usedAmount,
+		Usage:          sumUsage(chartData),
 		RPM:            rpm,
 		TPM:            tpm,
 	}, nil
@@ -1280,6 +1394,7 @@ func GetGroupDashboardData(
 			TotalCount:     totalCount,
 			ExceptionCount: exceptionCount,
 			UsedAmount:     usedAmount,
+			Usage:          sumUsage(chartData),
 			RPM:            rpm,
 			TPM:            tpm,
 		},
@@ -0,0 +1,29 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestLogPriceColumns(t *testing.T) {
+	convey.Convey("TestLogPriceColumns", t, func() {
+		initTestDB(t)
+		migrator := model.LogDB.Migrator()
+		convey.So(migrator.HasColumn(&model.Log{}, "input_price"), convey.ShouldBeTrue)
+		convey.So(migrator.HasColumn(&model.Log{}, "unit_price"), convey.ShouldBeTrue)
+		// the tiers and the windows are resolved before a log is recorded
+		for _, column := range []string{"tiers", "windows", "timezone"} {
+			convey.So(migrator.HasColumn(&model.Log{}, column), convey.ShouldBeFalse)
+		}
+
+		price := model.Price{
+			InputPrice: 1,
+			UnitPrice:  2,
+			Tiers:      []model.PriceTier{{InputTokensOver: 10, InputPrice: 3}},
+			Timezone:   "UTC",
+		}
+		convey.So(model.NewLogPrice(price), convey.ShouldResemble, model.LogPrice{InputPrice: 1, UnitPrice: 2})
+	})
+}
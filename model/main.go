@@ -133,18 +133,26 @@ func InitDB() {
 }
 
 func migrateDB() error {
+	if err := migrateLedgerRequestID(DB); err != nil {
+		return err
+	}
+
 	err := DB.AutoMigrate(
 		&Channel{},
 		&ChannelTest{},
+		&ChannelKey{},
 		&Token{},
 		&Group{},
 		&Option{},
 		&ModelConfig{},
+		&RoutingRule{},
+		&LedgerEntry{},
+		&GroupLedgerBalance{},
 	)
 	if err != nil {
 		return err
 	}
-	return nil
+	return migrateLedgerConsumeID(DB)
 }
 
 func InitLogDB() {
@@ -190,11 +198,18 @@ func migrateLOGDB() error {
 		&Log{},
 		&RequestDetail{},
 		&ConsumeError{},
+		&ChannelBreakerTransition{},
+		&MirrorResult{},
+		&Statement{},
 	)
 	if err != nil {
 		return err
 	}
 
+	if err := backfillLegacyConsumeErrors(LogDB); err != nil {
+		return err
+	}
+
 	return CreateLogIndexes(LogDB)
 }
 
@@ -0,0 +1,35 @@
+package model_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/model"
+	"github.com/redis/go-redis/v9"
+)
+
+// initTestDB opens a fresh sqlite database for the test
+func initTestDB(t *testing.T) {
+	t.Helper()
+	common.SQLitePath = filepath.Join(t.TempDir(), "aiproxy.db")
+	model.InitDB()
+	model.InitLogDB()
+	t.Cleanup(func() {
+		_ = model.CloseDB()
+	})
+}
+
+// initTestRedis enables redis backed by an in-memory server for the test
+func initTestRedis(t *testing.T) *miniredis.Miniredis {
+	t.Helper()
+	mr := miniredis.RunT(t)
+	common.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	common.RedisEnabled = true
+	t.Cleanup(func() {
+		common.RedisEnabled = false
+		_ = common.RDB.Close()
+	})
+	return mr
+}
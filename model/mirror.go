@@ -0,0 +1,224 @@
+package model
+
+import (
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/common/config"
+	"gorm.io/gorm"
+)
+
+// ModelMirror mirrors a sample of the model traffic to a candidate channel,
+// the mirrored responses are discarded and only compared with the served ones
+type ModelMirror struct {
+	ChannelID  int     `json:"channel_id"`
+	SampleRate float64 `json:"sample_rate"`
+}
+
+func (m *ModelMirror) Validate() error {
+	if m == nil {
+		return nil
+	}
+	if m.ChannelID <= 0 {
+		return errors.New("mirror channel id is required")
+	}
+	if m.SampleRate <= 0 || m.SampleRate > 1 {
+		return errors.New("mirror sample rate must be in (0, 1]")
+	}
+	return nil
+}
+
+// Sample reports whether a request served by the primary channel is mirrored,
+// the requests served by the mirror channel itself are never mirrored
+//
+//nolint:gosec
+func (m *ModelMirror) Sample(primaryChannelID int) bool {
+	if m == nil || m.ChannelID == primaryChannelID {
+		return false
+	}
+	return rand.Float64() < m.SampleRate
+}
+
+// OutputSimilarity is the dice coefficient of the character bigrams of the outputs, 1 means identical
+func OutputSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	bigramsA := runeBigrams(a)
+	bigramsB := runeBigrams(b)
+	if len(bigramsA) == 0 || len(bigramsB) == 0 {
+		return 0
+	}
+	counts := make(map[[2]rune]int, len(bigramsA))
+	for _, bigram := range bigramsA {
+		counts[bigram]++
+	}
+	var matched int
+	for _, bigram := range bigramsB {
+		if counts[bigram] > 0 {
+			counts[bigram]--
+			matched++
+		}
+	}
+	return float64(2*matched) / float64(len(bigramsA)+len(bigramsB))
+}
+
+func runeBigrams(s string) [][2]rune {
+	runes := []rune(s)
+	if len(runes) < 2 {
+		return nil
+	}
+	bigrams := make([][2]rune, 0, len(runes)-1)
+	for i := 0; i < len(runes)-1; i++ {
+		bigrams = append(bigrams, [2]rune{runes[i], runes[i+1]})
+	}
+	return bigrams
+}
+
+type MirrorResult struct {
+	CreatedAt          time.Time `gorm:"index;index:idx_mirror_result_model_created,priority:2" json:"created_at"`
+	Similarity         *float64  `json:"similarity,omitempty"`
+	RequestID          string    `gorm:"index"                                                  json:"request_id"`
+	Model              string    `gorm:"index:idx_mirror_result_model_created,priority:1"       json:"model"`
+	PrimaryOutput      string    `gorm:"type:text"                                              json:"primary_output,omitempty"`
+	MirrorOutput       string    `gorm:"type:text"                                              json:"mirror_output,omitempty"`
+	MirrorError        string    `gorm:"type:text"                                              json:"mirror_error,omitempty"`
+	ID                 int       `gorm:"primaryKey"                                             json:"id"`
+	PrimaryChannelID   int       `json:"primary_channel_id"`
+	MirrorChannelID    int       `gorm:"index"                                                  json:"mirror_channel_id"`
+	PrimaryCode        int       `json:"primary_code"`
+	MirrorCode         int       `json:"mirror_code"`
+	PrimaryLatency     int64     `json:"primary_latency"`
+	MirrorLatency      int64     `json:"mirror_latency"`
+	PrimaryOutputToken int       `json:"primary_output_token"`
+	MirrorInputToken   int       `json:"mirror_input_token"`
+	MirrorOutputToken  int       `json:"mirror_output_token"`
+	MirrorAmount       float64   `json:"mirror_amount"`
+}
+
+func (r *MirrorResult) MarshalJSON() ([]byte, error) {
+	type Alias MirrorResult
+	return sonic.Marshal(&struct {
+		*Alias
+		CreatedAt int64 `json:"created_at"`
+	}{
+		Alias:     (*Alias)(r),
+		CreatedAt: r.CreatedAt.UnixMilli(),
+	})
+}
+
+func RecordMirrorResult(result *MirrorResult) error {
+	return LogDB.Create(result).Error
+}
+
+func filterMirrorResults(tx *gorm.DB, model string, mirrorChannelID int, start, end time.Time) *gorm.DB {
+	if model != "" {
+		tx = tx.Where("model = ?", model)
+	}
+	if mirrorChannelID != 0 {
+		tx = tx.Where("mirror_channel_id = ?", mirrorChannelID)
+	}
+	switch {
+	case !start.IsZero() && !end.IsZero():
+		tx = tx.Where("created_at BETWEEN ? AND ?", start, end)
+	case !start.IsZero():
+		tx = tx.Where("created_at >= ?", start)
+	case !end.IsZero():
+		tx = tx.Where("created_at <= ?", end)
+	}
+	return tx
+}
+
+func SearchMirrorResults(model string, mirrorChannelID int, start, end time.Time, page int, perPage int) ([]*MirrorResult, int64, error) {
+	tx := filterMirrorResults(LogDB.Model(&MirrorResult{}), model, mirrorChannelID, start, end)
+
+	var total int64
+	err := tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	if total <= 0 {
+		return nil, 0, nil
+	}
+
+	var results []*MirrorResult
+	limit, offset := toLimitOffset(page, perPage)
+	err = tx.Order("created_at desc").Limit(limit).Offset(offset).Find(&results).Error
+	return results, total, err
+}
+
+// MirrorReport compares a candidate channel with the channels that served the model
+type MirrorReport struct {
+	Model                 string  `json:"model"`
+	MirrorChannelID       int     `json:"mirror_channel_id"`
+	Total                 int64   `json:"total"`
+	PrimaryErrors         int64   `json:"primary_errors"`
+	MirrorErrors          int64   `json:"mirror_errors"`
+	PrimaryErrorRate      float64 `json:"primary_error_rate"`
+	MirrorErrorRate       float64 `json:"mirror_error_rate"`
+	AvgPrimaryLatency     float64 `json:"avg_primary_latency"`
+	AvgMirrorLatency      float64 `json:"avg_mirror_latency"`
+	LatencyDifference     float64 `json:"latency_difference"`
+	AvgPrimaryOutputToken float64 `json:"avg_primary_output_token"`
+	AvgMirrorOutputToken  float64 `json:"avg_mirror_output_token"`
+	MirrorInputTokens     int64   `json:"mirror_input_tokens"`
+	MirrorOutputTokens    int64   `json:"mirror_output_tokens"`
+	MirrorAmount          float64 `json:"mirror_amount"`
+	ComparedCount         int64   `json:"compared_count"`
+	AvgSimilarity         float64 `json:"avg_similarity"`
+}
+
+// GetMirrorReport aggregates the mirror results per model and candidate channel,
+// latencies and output tokens are averaged over the successful requests,
+// the usage and cost of the mirrored requests are summed over all of them,
+// the similarity over the requests where both outputs could be compared
+func GetMirrorReport(model string, mirrorChannelID int, start, end time.Time) ([]*MirrorReport, error) {
+	var reports []*MirrorReport
+	err := filterMirrorResults(LogDB.Model(&MirrorResult{}), model, mirrorChannelID, start, end).
+		Select(`model, mirror_channel_id, count(*) as total,
+sum(case when primary_code != 200 then 1 else 0 end) as primary_errors,
+sum(case when mirror_code != 200 then 1 else 0 end) as mirror_errors,
+COALESCE(avg(case when primary_code = 200 then primary_latency end), 0) as avg_primary_latency,
+COALESCE(avg(case when mirror_code = 200 then mirror_latency end), 0) as avg_mirror_latency,
+COALESCE(avg(case when primary_code = 200 then primary_output_token end), 0) as avg_primary_output_token,
+COALESCE(avg(case when mirror_code = 200 then mirror_output_token end), 0) as avg_mirror_output_token,
+COALESCE(sum(mirror_input_token), 0) as mirror_input_tokens,
+COALESCE(sum(mirror_output_token), 0) as mirror_output_tokens,
+COALESCE(sum(mirror_amount), 0) as mirror_amount,
+COALESCE(avg(similarity), 0) as avg_similarity,
+count(similarity) as compared_count`).
+		Group("model, mirror_channel_id").
+		Order("model, mirror_channel_id").
+		Scan(&reports).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, report := range reports {
+		if report.Total > 0 {
+			report.PrimaryErrorRate = float64(report.PrimaryErrors) / float64(report.Total)
+			report.MirrorErrorRate = float64(report.MirrorErrors) / float64(report.Total)
+		}
+		report.LatencyDifference = report.AvgMirrorLatency - report.AvgPrimaryLatency
+	}
+	return reports, nil
+}
+
+func cleanMirrorResult(batchSize int) error {
+	logStorageHours := config.GetLogStorageHours()
+	if logStorageHours <= 0 {
+		return nil
+	}
+	if batchSize <= 0 {
+		batchSize = defaultCleanLogBatchSize
+	}
+	return LogDB.
+		Session(&gorm.Session{SkipDefaultTransaction: true}).
+		Where(
+			"created_at < ?",
+			time.Now().Add(-time.Duration(logStorageHours)*time.Hour),
+		).
+		Limit(batchSize).
+		Delete(&MirrorResult{}).Error
+}
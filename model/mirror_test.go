@@ -0,0 +1,104 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestModelMirrorSample(t *testing.T) {
+	convey.Convey("TestModelMirrorSample", t, func() {
+		var mirror *model.ModelMirror
+		convey.So(mirror.Sample(1), convey.ShouldBeFalse)
+
+		mirror = &model.ModelMirror{ChannelID: 2, SampleRate: 1}
+		convey.So(mirror.Validate(), convey.ShouldBeNil)
+		convey.So(mirror.Sample(1), convey.ShouldBeTrue)
+		// the requests served by the mirror channel are not mirrored to itself
+		convey.So(mirror.Sample(2), convey.ShouldBeFalse)
+
+		mirror.SampleRate = 0.5
+		sampled := 0
+		for range 1000 {
+			if mirror.Sample(1) {
+				sampled++
+			}
+		}
+		convey.So(sampled, convey.ShouldBeBetween, 400, 600)
+
+		convey.So((&model.ModelMirror{SampleRate: 1}).Validate(), convey.ShouldNotBeNil)
+		convey.So((&model.ModelMirror{ChannelID: 2}).Validate(), convey.ShouldNotBeNil)
+		convey.So((&model.ModelMirror{ChannelID: 2, SampleRate: 1.5}).Validate(), convey.ShouldNotBeNil)
+	})
+}
+
+func TestOutputSimilarity(t *testing.T) {
+	convey.Convey("TestOutputSimilarity", t, func() {
+		convey.So(model.OutputSimilarity("", ""), convey.ShouldEqual, 1)
+		convey.So(model.OutputSimilarity("hello world", "hello world"), convey.ShouldEqual, 1)
+		convey.So(model.OutputSimilarity("hello", ""), convey.ShouldEqual, 0)
+		convey.So(model.OutputSimilarity("a", "b"), convey.ShouldEqual, 0)
+		convey.So(model.OutputSimilarity("abcd", "wxyz"), convey.ShouldEqual, 0)
+		// ab bc cd against ab bc ce
+		convey.So(model.OutputSimilarity("abcd", "abce"), convey.ShouldAlmostEqual, 2.0/3)
+		convey.So(model.OutputSimilarity("你好世界", "你好世界!"), convey.ShouldAlmostEqual, 6.0/7)
+		convey.So(model.OutputSimilarity("night", "nacht"), convey.ShouldEqual, model.OutputSimilarity("nacht", "night"))
+	})
+}
+
+func TestMirrorReport(t *testing.T) {
+	convey.Convey("TestMirrorReport", t, func() {
+		initTestDB(t)
+		similarity := 0.5
+		results := []*model.MirrorResult{
+			{
+				RequestID: "r1", Model: "gpt-4o", PrimaryChannelID: 1, MirrorChannelID: 2,
+				PrimaryCode: 200, MirrorCode: 200, PrimaryLatency: 100, MirrorLatency: 300,
+				PrimaryOutputToken: 10, MirrorInputToken: 5, MirrorOutputToken: 20, MirrorAmount: 0.1,
+				Similarity: &similarity,
+			},
+			{
+				RequestID: "r2", Model: "gpt-4o", PrimaryChannelID: 1, MirrorChannelID: 2,
+				PrimaryCode: 200, MirrorCode: 500, PrimaryLatency: 300, MirrorLatency: 1000,
+				PrimaryOutputToken: 30, MirrorInputToken: 5, MirrorAmount: 0.05,
+			},
+			{
+				RequestID: "r3", Model: "gpt-4o-mini", PrimaryChannelID: 1, MirrorChannelID: 2,
+				PrimaryCode: 200, MirrorCode: 200,
+			},
+		}
+		for _, result := range results {
+			convey.So(model.RecordMirrorResult(result), convey.ShouldBeNil)
+		}
+
+		found, total, err := model.SearchMirrorResults("gpt-4o", 2, time.Time{}, time.Time{}, 1, 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(total, convey.ShouldEqual, 2)
+		convey.So(found, convey.ShouldHaveLength, 2)
+
+		reports, err := model.GetMirrorReport("gpt-4o", 2, time.Time{}, time.Time{})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(reports, convey.ShouldHaveLength, 1)
+		report := reports[0]
+		convey.So(report.Total, convey.ShouldEqual, 2)
+		convey.So(report.PrimaryErrors, convey.ShouldEqual, 0)
+		convey.So(report.MirrorErrors, convey.ShouldEqual, 1)
+		convey.So(report.MirrorErrorRate, convey.ShouldEqual, 0.5)
+		// latencies and output tokens only average the successful requests
+		convey.So(report.AvgPrimaryLatency, convey.ShouldEqual, 200)
+		convey.So(report.AvgMirrorLatency, convey.ShouldEqual, 300)
+		convey.So(report.LatencyDifference, convey.ShouldEqual, 100)
+		convey.So(report.AvgMirrorOutputToken, convey.ShouldEqual, 20)
+		// usage and cost sum all mirrored requests
+		convey.So(report.MirrorInputTokens, convey.ShouldEqual, 10)
+		convey.So(report.MirrorAmount, convey.ShouldAlmostEqual, 0.15)
+		convey.So(report.ComparedCount, convey.ShouldEqual, 1)
+		convey.So(report.AvgSimilarity, convey.ShouldEqual, 0.5)
+
+		reports, err = model.GetMirrorReport("", 0, time.Time{}, time.Time{})
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(reports, convey.ShouldHaveLength, 2)
+	})
+}
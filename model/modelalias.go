@@ -0,0 +1,50 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/labring/aiproxy/common/config"
+)
+
+// ValidateModelAliases rejects empty names and aliases pointing to other aliases
+func ValidateModelAliases(aliases map[string]string) error {
+	for alias, target := range aliases {
+		if alias == "" || target == "" {
+			return fmt.Errorf("model alias %q and its target %q must not be empty", alias, target)
+		}
+		if alias == target {
+			return fmt.Errorf("model alias %q must not point to itself", alias)
+		}
+		if _, ok := aliases[target]; ok {
+			return fmt.Errorf("model alias %q must not point to another alias %q", alias, target)
+		}
+	}
+	return nil
+}
+
+// ResolveModelAlias returns the real model of the alias,
+// the group aliases take precedence over the global aliases
+func ResolveModelAlias(group *GroupCache, alias string) (string, bool) {
+	if group != nil {
+		if target, ok := group.ModelAliases[alias]; ok {
+			return target, true
+		}
+	}
+	target, ok := config.GetModelAliases()[alias]
+	return target, ok
+}
+
+// GetModelAliases returns the aliases visible to the group, alias to the real model
+func GetModelAliases(group *GroupCache) map[string]string {
+	globalAliases := config.GetModelAliases()
+	aliases := make(map[string]string, len(globalAliases))
+	for alias, target := range globalAliases {
+		aliases[alias] = target
+	}
+	if group != nil {
+		for alias, target := range group.ModelAliases {
+			aliases[alias] = target
+		}
+	}
+	return aliases
+}
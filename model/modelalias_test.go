@@ -0,0 +1,74 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestValidateModelAliases(t *testing.T) {
+	convey.Convey("TestValidateModelAliases", t, func() {
+		convey.So(model.ValidateModelAliases(nil), convey.ShouldBeNil)
+		convey.So(model.ValidateModelAliases(map[string]string{"fast": "gpt-4o-mini", "smart": "gpt-4o"}), convey.ShouldBeNil)
+		convey.So(model.ValidateModelAliases(map[string]string{"": "gpt-4o"}), convey.ShouldNotBeNil)
+		convey.So(model.ValidateModelAliases(map[string]string{"fast": ""}), convey.ShouldNotBeNil)
+		convey.So(model.ValidateModelAliases(map[string]string{"gpt-4o": "gpt-4o"}), convey.ShouldNotBeNil)
+		convey.So(model.ValidateModelAliases(map[string]string{"fast": "smart", "smart": "gpt-4o"}), convey.ShouldNotBeNil)
+	})
+}
+
+func TestResolveModelAlias(t *testing.T) {
+	convey.Convey("TestResolveModelAlias", t, func() {
+		config.SetModelAliases(map[string]string{"fast": "gpt-4o-mini", "smart": "gpt-4o"})
+		defer config.SetModelAliases(nil)
+		group := &model.GroupCache{ID: "g1", ModelAliases: map[string]string{"smart": "claude-3-5-sonnet"}}
+
+		target, ok := model.ResolveModelAlias(nil, "fast")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(target, convey.ShouldEqual, "gpt-4o-mini")
+		target, ok = model.ResolveModelAlias(group, "fast")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(target, convey.ShouldEqual, "gpt-4o-mini")
+
+		// the group aliases take precedence over the global ones
+		target, ok = model.ResolveModelAlias(group, "smart")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(target, convey.ShouldEqual, "claude-3-5-sonnet")
+		target, ok = model.ResolveModelAlias(nil, "smart")
+		convey.So(ok, convey.ShouldBeTrue)
+		convey.So(target, convey.ShouldEqual, "gpt-4o")
+
+		_, ok = model.ResolveModelAlias(group, "gpt-4o")
+		convey.So(ok, convey.ShouldBeFalse)
+
+		convey.So(model.GetModelAliases(group), convey.ShouldResemble, map[string]string{
+			"fast":  "gpt-4o-mini",
+			"smart": "claude-3-5-sonnet",
+		})
+		// the global aliases are not changed by the group
+		convey.So(config.GetModelAliases()["smart"], convey.ShouldEqual, "gpt-4o")
+	})
+}
+
+func TestTokenContainsAliasModel(t *testing.T) {
+	convey.Convey("TestTokenContainsAliasModel", t, func() {
+		token := &model.TokenCache{}
+		token.SetAvailableSets([]string{"default"})
+		token.SetModelsBySet(map[string][]string{"default": {"gpt-4o", "gpt-4o-mini"}})
+
+		convey.So(token.ContainsAliasModel("smart", "gpt-4o"), convey.ShouldBeTrue)
+		// the real model must be available to the group
+		convey.So(token.ContainsAliasModel("smart", "claude-3-5-sonnet"), convey.ShouldBeFalse)
+
+		// a token limited to some models may list either the alias or the real model
+		token.Models = []string{"smart"}
+		convey.So(token.ContainsAliasModel("smart", "gpt-4o"), convey.ShouldBeTrue)
+		convey.So(token.ContainsModel("gpt-4o"), convey.ShouldBeFalse)
+		token.Models = []string{"gpt-4o"}
+		convey.So(token.ContainsAliasModel("smart", "gpt-4o"), convey.ShouldBeTrue)
+		token.Models = []string{"gpt-4o-mini"}
+		convey.So(token.ContainsAliasModel("smart", "gpt-4o"), convey.ShouldBeFalse)
+	})
+}
@@ -29,6 +29,8 @@ type ModelConfig struct {
 	RPM              int64                  `json:"rpm,omitempty"`
 	TPM              int64                  `json:"tpm,omitempty"`
 	Price            Price                  `gorm:"embedded"                      json:"price,omitempty"`
+	Mirror           *ModelMirror           `gorm:"serializer:fastjson;type:text" json:"mirror,omitempty"`
+	Selector         string                 `json:"selector,omitempty"`
 }
 
 func NewDefaultModelConfig(model string) *ModelConfig {
@@ -37,19 +39,39 @@ func NewDefaultModelConfig(model string) *ModelConfig {
 	}
 }
 
+// MarshalJSON also shows the effective price when the price has windows
 func (c *ModelConfig) MarshalJSON() ([]byte, error) {
 	type Alias ModelConfig
+	var effectivePrice *Price
+	if len(c.Price.Windows) > 0 {
+		price, _ := c.Price.EffectiveAt(time.Now())
+		effectivePrice = &price
+	}
 	return sonic.Marshal(&struct {
 		*Alias
-		CreatedAt int64 `json:"created_at,omitempty"`
-		UpdatedAt int64 `json:"updated_at,omitempty"`
+		EffectivePrice *Price `json:"effective_price,omitempty"`
+		BillingUnit    string `json:"billing_unit"`
+		CreatedAt      int64  `json:"created_at,omitempty"`
+		UpdatedAt      int64  `json:"updated_at,omitempty"`
 	}{
-		Alias:     (*Alias)(c),
-		CreatedAt: c.CreatedAt.UnixMilli(),
-		UpdatedAt: c.UpdatedAt.UnixMilli(),
+		Alias:          (*Alias)(c),
+		EffectivePrice: effectivePrice,
+		BillingUnit:    BillingUnitOfMode(c.Type),
+		CreatedAt:      c.CreatedAt.UnixMilli(),
+		UpdatedAt:      c.UpdatedAt.UnixMilli(),
 	})
 }
 
+func (c *ModelConfig) Validate() error {
+	if err := c.Price.Validate(); err != nil {
+		return err
+	}
+	if err := c.Mirror.Validate(); err != nil {
+		return err
+	}
+	return ValidateChannelSelector(c.Selector)
+}
+
 func (c *ModelConfig) MaxContextTokens() (int, bool) {
 	return GetModelConfigInt(c.Config, ModelConfigMaxContextTokensKey)
 }
@@ -78,6 +100,18 @@ func (c *ModelConfig) SupportFormats() ([]string, bool) {
 	return GetModelConfigStringSlice(c.Config, ModelConfigSupportFormatsKey)
 }
 
+func (c *ModelConfig) Capability() ModelCapability {
+	var capability ModelCapability
+	capability.MaxContextTokens, _ = c.MaxContextTokens()
+	if vision, ok := c.SupportVision(); ok {
+		capability.SupportVision = &vision
+	}
+	if toolChoice, ok := c.SupportToolChoice(); ok {
+		capability.SupportToolChoice = &toolChoice
+	}
+	return capability
+}
+
 func GetModelConfigs(page int, perPage int, model string) (configs []*ModelConfig, total int64, err error) {
 	tx := DB.Model(&ModelConfig{})
 	if model != "" {
@@ -64,14 +64,24 @@ func initOptionMap() error {
 	optionMap["LogDetailResponseBodyMaxSize"] = strconv.FormatInt(config.GetLogDetailResponseBodyMaxSize(), 10)
 	optionMap["DisableServe"] = strconv.FormatBool(config.GetDisableServe())
 	optionMap["BillingEnabled"] = strconv.FormatBool(config.GetBillingEnabled())
+	optionMap["BalanceHoldEnabled"] = strconv.FormatBool(config.GetBalanceHoldEnabled())
 	optionMap["RetryTimes"] = strconv.FormatInt(config.GetRetryTimes(), 10)
 	optionMap["ModelErrorAutoBanRate"] = strconv.FormatFloat(config.GetModelErrorAutoBanRate(), 'f', -1, 64)
 	optionMap["EnableModelErrorAutoBan"] = strconv.FormatBool(config.GetEnableModelErrorAutoBan())
+	optionMap["EnableStreamFailover"] = strconv.FormatBool(config.GetEnableStreamFailover())
+	optionMap["ChannelConcurrencyQueueTimeout"] = strconv.FormatInt(config.GetChannelConcurrencyQueueTimeout(), 10)
+	optionMap["RateLimitQueueTimeout"] = strconv.FormatInt(config.GetRateLimitQueueTimeout(), 10)
+	optionMap["RateLimitQueueMaxLength"] = strconv.FormatInt(config.GetRateLimitQueueMaxLength(), 10)
 	timeoutWithModelTypeJSON, err := sonic.Marshal(config.GetTimeoutWithModelType())
 	if err != nil {
 		return err
 	}
 	optionMap["TimeoutWithModelType"] = conv.BytesToString(timeoutWithModelTypeJSON)
+	clientDisconnectPolicyJSON, err := sonic.Marshal(config.GetClientDisconnectPolicy())
+	if err != nil {
+		return err
+	}
+	optionMap["ClientDisconnectPolicy"] = conv.BytesToString(clientDisconnectPolicyJSON)
 	defaultChannelModelsJSON, err := sonic.Marshal(config.GetDefaultChannelModels())
 	if err != nil {
 		return err
@@ -82,6 +92,16 @@ func initOptionMap() error {
 		return err
 	}
 	optionMap["DefaultChannelModelMapping"] = conv.BytesToString(defaultChannelModelMappingJSON)
+	modelAliasesJSON, err := sonic.Marshal(config.GetModelAliases())
+	if err != nil {
+		return err
+	}
+	optionMap["ModelAliases"] = conv.BytesToString(modelAliasesJSON)
+	priorityClassCapacityJSON, err := sonic.Marshal(config.GetPriorityClassCapacity())
+	if err != nil {
+		return err
+	}
+	optionMap["PriorityClassCapacity"] = conv.BytesToString(priorityClassCapacityJSON)
 	optionMap["GeminiSafetySetting"] = config.GetGeminiSafetySetting()
 	optionMap["GroupMaxTokenNum"] = strconv.FormatInt(config.GetGroupMaxTokenNum(), 10)
 	groupConsumeLevelRatioJSON, err := sonic.Marshal(config.GetGroupConsumeLevelRatioStringKeyMap())
@@ -222,6 +242,8 @@ func updateOption(key string, value string, isInit bool) (err error) {
 		config.SetDisableServe(toBool(value))
 	case "BillingEnabled":
 		config.SetBillingEnabled(toBool(value))
+	case "BalanceHoldEnabled":
+		config.SetBalanceHoldEnabled(toBool(value))
 	case "GroupMaxTokenNum":
 		groupMaxTokenNum, err := strconv.ParseInt(value, 10, 32)
 		if err != nil {
@@ -278,6 +300,26 @@ func updateOption(key string, value string, isInit bool) (err error) {
 			return err
 		}
 		config.SetDefaultChannelModelMapping(newMapping)
+	case "ModelAliases":
+		var newAliases map[string]string
+		err := sonic.Unmarshal(conv.StringToBytes(value), &newAliases)
+		if err != nil {
+			return err
+		}
+		if err := ValidateModelAliases(newAliases); err != nil {
+			return err
+		}
+		config.SetModelAliases(newAliases)
+	case "PriorityClassCapacity":
+		var newCapacity map[string]float64
+		err := sonic.Unmarshal(conv.StringToBytes(value), &newCapacity)
+		if err != nil {
+			return err
+		}
+		if err := ValidatePriorityClassCapacity(newCapacity); err != nil {
+			return err
+		}
+		config.SetPriorityClassCapacity(newCapacity)
 	case "RetryTimes":
 		retryTimes, err := strconv.ParseInt(value, 10, 32)
 		if err != nil {
@@ -289,6 +331,8 @@ func updateOption(key string, value string, isInit bool) (err error) {
 		config.SetRetryTimes(retryTimes)
 	case "EnableModelErrorAutoBan":
 		config.SetEnableModelErrorAutoBan(toBool(value))
+	case "EnableStreamFailover":
+		config.SetEnableStreamFailover(toBool(value))
 	case "ModelErrorAutoBanRate":
 		modelErrorAutoBanRate, err := strconv.ParseFloat(value, 64)
 		if err != nil {
@@ -298,6 +342,33 @@ func updateOption(key string, value string, isInit bool) (err error) {
 			return errors.New("model error auto ban rate must be between 0 and 1")
 		}
 		config.SetModelErrorAutoBanRate(modelErrorAutoBanRate)
+	case "ChannelConcurrencyQueueTimeout":
+		channelConcurrencyQueueTimeout, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if channelConcurrencyQueueTimeout < 0 {
+			return errors.New("channel concurrency queue timeout must be greater than 0")
+		}
+		config.SetChannelConcurrencyQueueTimeout(channelConcurrencyQueueTimeout)
+	case "RateLimitQueueTimeout":
+		rateLimitQueueTimeout, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if rateLimitQueueTimeout < 0 {
+			return errors.New("rate limit queue timeout must be greater than 0")
+		}
+		config.SetRateLimitQueueTimeout(rateLimitQueueTimeout)
+	case "RateLimitQueueMaxLength":
+		rateLimitQueueMaxLength, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		if rateLimitQueueMaxLength < 0 {
+			return errors.New("rate limit queue max length must be greater than 0")
+		}
+		config.SetRateLimitQueueMaxLength(rateLimitQueueMaxLength)
 	case "TimeoutWithModelType":
 		var newTimeoutWithModelType map[int]int64
 		err := sonic.Unmarshal(conv.StringToBytes(value), &newTimeoutWithModelType)
@@ -310,6 +381,16 @@ func updateOption(key string, value string, isInit bool) (err error) {
 			}
 		}
 		config.SetTimeoutWithModelType(newTimeoutWithModelType)
+	case "ClientDisconnectPolicy":
+		var newPolicy map[int]string
+		err := sonic.Unmarshal(conv.StringToBytes(value), &newPolicy)
+		if err != nil {
+			return err
+		}
+		if err := ValidateClientDisconnectPolicy(newPolicy); err != nil {
+			return err
+		}
+		config.SetClientDisconnectPolicy(newPolicy)
 	case "GroupConsumeLevelRatio":
 		var newGroupRpmRatio map[string]float64
 		err := sonic.Unmarshal(conv.StringToBytes(value), &newGroupRpmRatio)
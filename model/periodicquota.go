@@ -0,0 +1,96 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/common/conv"
+)
+
+// periods of the periodic quotas, they reset at the start of the day,
+// the week starting on monday and the month in the timezone of the quota
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodWeekly  = "weekly"
+	QuotaPeriodMonthly = "monthly"
+)
+
+// PeriodicQuota caps the amount and the tokens used in each period, zero is unlimited,
+// the periods start at midnight of the IANA timezone, UTC by default
+type PeriodicQuota struct {
+	Period   string  `json:"period"`
+	Timezone string  `json:"timezone,omitempty"`
+	Amount   float64 `json:"amount,omitempty"`
+	Tokens   int64   `json:"tokens,omitempty"`
+}
+
+// location of the periods, UTC by default
+func (q *PeriodicQuota) location() *time.Location {
+	if q.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(q.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// PeriodRange returns the start of the period of the quota containing the time and the start of the next one
+func (q PeriodicQuota) PeriodRange(t time.Time) (start, end time.Time) {
+	return QuotaPeriodRange(q.Period, t, q.location())
+}
+
+type PeriodicQuotas []PeriodicQuota
+
+func (p *PeriodicQuotas) ScanRedis(value string) error {
+	return sonic.Unmarshal(conv.StringToBytes(value), p)
+}
+
+func (p PeriodicQuotas) MarshalBinary() ([]byte, error) {
+	return sonic.Marshal(p)
+}
+
+func (p PeriodicQuotas) Validate() error {
+	periods := make(map[string]struct{}, len(p))
+	for _, quota := range p {
+		switch quota.Period {
+		case QuotaPeriodDaily, QuotaPeriodWeekly, QuotaPeriodMonthly:
+		default:
+			return fmt.Errorf("invalid quota period %q, must be one of %s, %s, %s",
+				quota.Period, QuotaPeriodDaily, QuotaPeriodWeekly, QuotaPeriodMonthly)
+		}
+		if _, ok := periods[quota.Period]; ok {
+			return fmt.Errorf("duplicate %s quota", quota.Period)
+		}
+		periods[quota.Period] = struct{}{}
+		if _, err := time.LoadLocation(quota.Timezone); err != nil {
+			return fmt.Errorf("invalid %s quota timezone %q: %w", quota.Period, quota.Timezone, err)
+		}
+		if quota.Amount < 0 || quota.Tokens < 0 {
+			return errors.New("quota must not be negative")
+		}
+		if quota.Amount == 0 && quota.Tokens == 0 {
+			return fmt.Errorf("%s quota must limit the amount or the tokens", quota.Period)
+		}
+	}
+	return nil
+}
+
+// QuotaPeriodRange returns the start of the period containing the time in the location and the start of the next one
+func QuotaPeriodRange(period string, t time.Time, loc *time.Location) (start, end time.Time) {
+	t = t.In(loc)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+	switch period {
+	case QuotaPeriodWeekly:
+		start = day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+		return start, start.AddDate(0, 0, 7)
+	case QuotaPeriodMonthly:
+		start = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		return start, start.AddDate(0, 1, 0)
+	default:
+		return day, day.AddDate(0, 0, 1)
+	}
+}
@@ -0,0 +1,62 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestQuotaPeriodRange(t *testing.T) {
+	convey.Convey("TestQuotaPeriodRange", t, func() {
+		// a sunday
+		now := time.Date(2025, 3, 16, 15, 4, 5, 0, time.Local)
+
+		start, end := model.QuotaPeriodRange(model.QuotaPeriodDaily, now, time.Local)
+		convey.So(start, convey.ShouldEqual, time.Date(2025, 3, 16, 0, 0, 0, 0, time.Local))
+		convey.So(end, convey.ShouldEqual, time.Date(2025, 3, 17, 0, 0, 0, 0, time.Local))
+
+		start, end = model.QuotaPeriodRange(model.QuotaPeriodWeekly, now, time.Local)
+		convey.So(start, convey.ShouldEqual, time.Date(2025, 3, 10, 0, 0, 0, 0, time.Local))
+		convey.So(end, convey.ShouldEqual, time.Date(2025, 3, 17, 0, 0, 0, 0, time.Local))
+
+		start, end = model.QuotaPeriodRange(model.QuotaPeriodMonthly, now, time.Local)
+		convey.So(start, convey.ShouldEqual, time.Date(2025, 3, 1, 0, 0, 0, 0, time.Local))
+		convey.So(end, convey.ShouldEqual, time.Date(2025, 4, 1, 0, 0, 0, 0, time.Local))
+	})
+}
+
+func TestPeriodicQuotaPeriodRange(t *testing.T) {
+	convey.Convey("TestPeriodicQuotaPeriodRange", t, func() {
+		// 2025-03-16 23:30 in UTC is already monday 07:30 in Shanghai
+		at := time.Date(2025, 3, 16, 23, 30, 0, 0, time.UTC)
+		loc, _ := time.LoadLocation("Asia/Shanghai")
+
+		start, end := model.PeriodicQuota{Period: model.QuotaPeriodDaily}.PeriodRange(at)
+		convey.So(start.Equal(time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC)), convey.ShouldBeTrue)
+		convey.So(end.Equal(time.Date(2025, 3, 17, 0, 0, 0, 0, time.UTC)), convey.ShouldBeTrue)
+
+		start, end = model.PeriodicQuota{Period: model.QuotaPeriodDaily, Timezone: "Asia/Shanghai"}.PeriodRange(at)
+		convey.So(start.Equal(time.Date(2025, 3, 17, 0, 0, 0, 0, loc)), convey.ShouldBeTrue)
+		convey.So(end.Equal(time.Date(2025, 3, 18, 0, 0, 0, 0, loc)), convey.ShouldBeTrue)
+
+		start, _ = model.PeriodicQuota{Period: model.QuotaPeriodWeekly, Timezone: "Asia/Shanghai"}.PeriodRange(at)
+		convey.So(start.Equal(time.Date(2025, 3, 17, 0, 0, 0, 0, loc)), convey.ShouldBeTrue)
+	})
+}
+
+func TestPeriodicQuotasValidate(t *testing.T) {
+	convey.Convey("TestPeriodicQuotasValidate", t, func() {
+		quotas := model.PeriodicQuotas{
+			{Period: model.QuotaPeriodDaily, Amount: 10},
+			{Period: model.QuotaPeriodMonthly, Tokens: 1000000},
+		}
+		convey.So(quotas.Validate(), convey.ShouldBeNil)
+
+		convey.So(append(quotas, model.PeriodicQuota{Period: model.QuotaPeriodDaily, Amount: 1}).Validate(), convey.ShouldNotBeNil)
+		convey.So(model.PeriodicQuotas{{Period: "yearly", Amount: 1}}.Validate(), convey.ShouldNotBeNil)
+		convey.So(model.PeriodicQuotas{{Period: model.QuotaPeriodWeekly}}.Validate(), convey.ShouldNotBeNil)
+		convey.So(model.PeriodicQuotas{{Period: model.QuotaPeriodDaily, Timezone: "Mars/Base", Amount: 1}}.Validate(), convey.ShouldNotBeNil)
+	})
+}
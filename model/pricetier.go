@@ -0,0 +1,73 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PriceTier replaces the prices of a request whose input tokens are over the threshold,
+// e.g. long context prompts, a zero price of the tier keeps the base price
+type PriceTier struct {
+	InputTokensOver    int64   `json:"input_tokens_over"`
+	InputPrice         float64 `json:"input_price,omitempty"`
+	OutputPrice        float64 `json:"output_price,omitempty"`
+	CachedPrice        float64 `json:"cached_price,omitempty"`
+	CacheCreationPrice float64 `json:"cache_creation_price,omitempty"`
+}
+
+func (p *Price) Validate() error {
+	if p.InputPrice < 0 || p.OutputPrice < 0 || p.CachedPrice < 0 || p.CacheCreationPrice < 0 ||
+		p.ReasoningPrice < 0 || p.AudioInputPrice < 0 || p.AudioOutputPrice < 0 || p.ImageInputPrice < 0 || p.UnitPrice < 0 {
+		return errors.New("price must not be negative")
+	}
+	if err := p.validateWindows(); err != nil {
+		return err
+	}
+	thresholds := make(map[int64]struct{}, len(p.Tiers))
+	for _, tier := range p.Tiers {
+		if tier.InputTokensOver <= 0 {
+			return errors.New("price tier input tokens over must be greater than 0")
+		}
+		if _, ok := thresholds[tier.InputTokensOver]; ok {
+			return fmt.Errorf("duplicate price tier input tokens over %d", tier.InputTokensOver)
+		}
+		thresholds[tier.InputTokensOver] = struct{}{}
+		if tier.InputPrice < 0 || tier.OutputPrice < 0 || tier.CachedPrice < 0 || tier.CacheCreationPrice < 0 {
+			return errors.New("price tier price must not be negative")
+		}
+	}
+	return nil
+}
+
+// SelectTier returns the prices of a request with the input tokens, without the tiers,
+// and the threshold of the selected tier, 0 is the base price,
+// the tier with the highest threshold below the input tokens applies
+func (p Price) SelectTier(inputTokens int) (Price, int64) {
+	selected := p
+	selected.Tiers = nil
+	var tier *PriceTier
+	for i := range p.Tiers {
+		if int64(inputTokens) <= p.Tiers[i].InputTokensOver {
+			continue
+		}
+		if tier == nil || p.Tiers[i].InputTokensOver > tier.InputTokensOver {
+			tier = &p.Tiers[i]
+		}
+	}
+	if tier == nil {
+		return selected, 0
+	}
+	if tier.InputPrice > 0 {
+		selected.InputPrice = tier.InputPrice
+	}
+	if tier.OutputPrice > 0 {
+		selected.OutputPrice = tier.OutputPrice
+	}
+	if tier.CachedPrice > 0 {
+		selected.CachedPrice = tier.CachedPrice
+	}
+	if tier.CacheCreationPrice > 0 {
+		selected.CacheCreationPrice = tier.CacheCreationPrice
+	}
+	return selected, tier.InputTokensOver
+}
@@ -0,0 +1,42 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestPriceSelectTier(t *testing.T) {
+	convey.Convey("TestPriceSelectTier", t, func() {
+		price := model.Price{
+			InputPrice:  1.25,
+			OutputPrice: 10,
+			CachedPrice: 0.31,
+			Tiers: []model.PriceTier{
+				{InputTokensOver: 1000000, InputPrice: 5, OutputPrice: 20},
+				{InputTokensOver: 200000, InputPrice: 2.5, OutputPrice: 15, CachedPrice: 0.625},
+			},
+		}
+		convey.So(price.Validate(), convey.ShouldBeNil)
+
+		selected, tier := price.SelectTier(200000)
+		convey.So(tier, convey.ShouldEqual, 0)
+		convey.So(selected.InputPrice, convey.ShouldEqual, 1.25)
+		convey.So(selected.Tiers, convey.ShouldBeNil)
+
+		selected, tier = price.SelectTier(200001)
+		convey.So(tier, convey.ShouldEqual, 200000)
+		convey.So(selected.InputPrice, convey.ShouldEqual, 2.5)
+		convey.So(selected.OutputPrice, convey.ShouldEqual, 15)
+		convey.So(selected.CachedPrice, convey.ShouldEqual, 0.625)
+
+		selected, tier = price.SelectTier(1500000)
+		convey.So(tier, convey.ShouldEqual, 1000000)
+		convey.So(selected.InputPrice, convey.ShouldEqual, 5)
+		convey.So(selected.CachedPrice, convey.ShouldEqual, 0.31)
+
+		price.Tiers = append(price.Tiers, model.PriceTier{InputTokensOver: 200000})
+		convey.So(price.Validate(), convey.ShouldNotBeNil)
+	})
+}
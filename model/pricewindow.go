@@ -0,0 +1,119 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const priceWindowTimeLayout = "15:04"
+
+// PriceWindow multiplies the prices of the requests made between start and end,
+// e.g. off-peak discounts, the times are "15:04" in the timezone of the price,
+// a window whose end is not after its start spans midnight
+type PriceWindow struct {
+	Start      string  `json:"start"`
+	End        string  `json:"end"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+func (w *PriceWindow) minutes() (start, end int, err error) {
+	s, err := time.Parse(priceWindowTimeLayout, w.Start)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid price window start %q: %w", w.Start, err)
+	}
+	e, err := time.Parse(priceWindowTimeLayout, w.End)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid price window end %q: %w", w.End, err)
+	}
+	return s.Hour()*60 + s.Minute(), e.Hour()*60 + e.Minute(), nil
+}
+
+func (w *PriceWindow) contains(minute int) bool {
+	start, end, err := w.minutes()
+	if err != nil {
+		return false
+	}
+	if start < end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+func (p *Price) validateWindows() error {
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("invalid price timezone %q: %w", p.Timezone, err)
+	}
+	for _, window := range p.Windows {
+		if _, _, err := window.minutes(); err != nil {
+			return err
+		}
+		if window.Multiplier <= 0 {
+			return errors.New("price window multiplier must be greater than 0")
+		}
+	}
+	return nil
+}
+
+// location of the price windows, UTC by default
+func (p *Price) location() *time.Location {
+	if p.Timezone == "" {
+		return time.UTC
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.UTC
+	}
+	return loc
+}
+
+// EffectiveAt returns the prices of a request made at the time, without the windows,
+// and the multiplier of the window it falls in, 1 outside the windows,
+// the first window containing the time applies
+func (p Price) EffectiveAt(at time.Time) (Price, float64) {
+	effective := p
+	effective.Windows = nil
+	effective.Timezone = ""
+	if len(p.Windows) == 0 {
+		return effective, 1
+	}
+
+	local := at.In(p.location())
+	minute := local.Hour()*60 + local.Minute()
+	multiplier := 1.0
+	for _, window := range p.Windows {
+		if window.contains(minute) {
+			multiplier = window.Multiplier
+			break
+		}
+	}
+	if multiplier == 1 {
+		return effective, 1
+	}
+	return effective.scale(multiplier), multiplier
+}
+
+// scale multiplies all the prices and the prices of the tiers
+func (p Price) scale(multiplier float64) Price {
+	p.InputPrice *= multiplier
+	p.OutputPrice *= multiplier
+	p.CachedPrice *= multiplier
+	p.CacheCreationPrice *= multiplier
+	p.ReasoningPrice *= multiplier
+	p.AudioInputPrice *= multiplier
+	p.AudioOutputPrice *= multiplier
+	p.ImageInputPrice *= multiplier
+	p.UnitPrice *= multiplier
+	if len(p.Tiers) > 0 {
+		tiers := make([]PriceTier, len(p.Tiers))
+		for i, tier := range p.Tiers {
+			tier.InputPrice *= multiplier
+			tier.OutputPrice *= multiplier
+			tier.CachedPrice *= multiplier
+			tier.CacheCreationPrice *= multiplier
+			tiers[i] = tier
+		}
+		p.Tiers = tiers
+	}
+	return p
+}
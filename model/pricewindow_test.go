@@ -0,0 +1,43 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestPriceEffectiveAt(t *testing.T) {
+	convey.Convey("TestPriceEffectiveAt", t, func() {
+		price := model.Price{
+			InputPrice:  2,
+			OutputPrice: 8,
+			Timezone:    "Asia/Shanghai",
+			Windows: []model.PriceWindow{
+				{Start: "00:30", End: "08:30", Multiplier: 0.5},
+				{Start: "22:00", End: "00:30", Multiplier: 0.8},
+			},
+		}
+		convey.So(price.Validate(), convey.ShouldBeNil)
+
+		// 10:00 in Shanghai
+		effective, multiplier := price.EffectiveAt(time.Date(2025, 1, 1, 2, 0, 0, 0, time.UTC))
+		convey.So(multiplier, convey.ShouldEqual, 1)
+		convey.So(effective.InputPrice, convey.ShouldEqual, 2)
+		convey.So(effective.Windows, convey.ShouldBeNil)
+
+		// 01:00 in Shanghai
+		effective, multiplier = price.EffectiveAt(time.Date(2025, 1, 1, 17, 0, 0, 0, time.UTC))
+		convey.So(multiplier, convey.ShouldEqual, 0.5)
+		convey.So(effective.InputPrice, convey.ShouldEqual, 1)
+		convey.So(effective.OutputPrice, convey.ShouldEqual, 4)
+
+		// 00:10 in Shanghai, the window spans midnight
+		_, multiplier = price.EffectiveAt(time.Date(2025, 1, 1, 16, 10, 0, 0, time.UTC))
+		convey.So(multiplier, convey.ShouldEqual, 0.8)
+
+		price.Windows = append(price.Windows, model.PriceWindow{Start: "25:00", End: "01:00", Multiplier: 1})
+		convey.So(price.Validate(), convey.ShouldNotBeNil)
+	})
+}
@@ -0,0 +1,95 @@
+package model
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/labring/aiproxy/common/config"
+)
+
+// priority classes of the requests, the channel capacity not usable by a class
+// is reserved for the higher classes, e.g. interactive traffic over batch jobs
+const (
+	PriorityClassHigh   = "high"
+	PriorityClassNormal = "normal"
+	PriorityClassLow    = "low"
+)
+
+func priorityClassRank(class string) int {
+	switch class {
+	case PriorityClassHigh:
+		return 2
+	case PriorityClassNormal, "":
+		return 1
+	case PriorityClassLow:
+		return 0
+	default:
+		return -1
+	}
+}
+
+// ValidatePriorityClass accepts the priority classes, empty means normal
+func ValidatePriorityClass(class string) error {
+	if priorityClassRank(class) < 0 {
+		return fmt.Errorf("invalid priority class %q, must be one of %s, %s, %s",
+			class, PriorityClassHigh, PriorityClassNormal, PriorityClassLow)
+	}
+	return nil
+}
+
+// ValidatePriorityClassCapacity checks the share of the channel capacity of each class is in (0, 1]
+func ValidatePriorityClassCapacity(capacity map[string]float64) error {
+	for class, share := range capacity {
+		if class == "" {
+			return fmt.Errorf("priority class must not be empty")
+		}
+		if err := ValidatePriorityClass(class); err != nil {
+			return err
+		}
+		if share <= 0 || share > 1 {
+			return fmt.Errorf("capacity of priority class %q must be in (0, 1]", class)
+		}
+	}
+	return nil
+}
+
+// ResolvePriorityClass returns the class of the request, the requested class
+// may lower the token class, e.g. for batch jobs, but never raise it
+func ResolvePriorityClass(tokenClass, requested string) string {
+	if tokenClass == "" {
+		tokenClass = PriorityClassNormal
+	}
+	if requested == "" || priorityClassRank(requested) < 0 {
+		return tokenClass
+	}
+	if priorityClassRank(requested) > priorityClassRank(tokenClass) {
+		return tokenClass
+	}
+	return requested
+}
+
+// GetPriorityClassCapacity returns the share of the channel concurrency, rpm and tpm the class may use
+func GetPriorityClassCapacity(class string) float64 {
+	share, ok := config.GetPriorityClassCapacity()[class]
+	if !ok || share <= 0 || share > 1 {
+		return 1
+	}
+	return share
+}
+
+// HigherPriorityClass reports whether requests of class a are served before those of class b
+func HigherPriorityClass(a, b string) bool {
+	return priorityClassRank(a) > priorityClassRank(b)
+}
+
+// ScaleChannelLimit returns the part of a channel limit usable by a class with the capacity share,
+// a share below 1 always reserves at least one of the limit for the higher classes,
+// ok is false when nothing is left for the class, e.g. a limit of 1 is kept for the higher classes
+func ScaleChannelLimit(limit int64, share float64) (scaled int64, ok bool) {
+	if limit <= 0 || share >= 1 {
+		return limit, true
+	}
+	// the epsilon keeps e.g. 100 * 0.29 from rounding down to 28
+	scaled = min(int64(math.Floor(float64(limit)*share+1e-9)), limit-1)
+	return scaled, scaled > 0
+}
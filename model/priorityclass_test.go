@@ -0,0 +1,88 @@
+package model_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestResolvePriorityClass(t *testing.T) {
+	convey.Convey("TestResolvePriorityClass", t, func() {
+		convey.So(model.ResolvePriorityClass("", ""), convey.ShouldEqual, model.PriorityClassNormal)
+		convey.So(model.ResolvePriorityClass(model.PriorityClassHigh, ""), convey.ShouldEqual, model.PriorityClassHigh)
+
+		// the requested class may lower the token class
+		convey.So(model.ResolvePriorityClass(model.PriorityClassHigh, model.PriorityClassLow), convey.ShouldEqual, model.PriorityClassLow)
+		convey.So(model.ResolvePriorityClass("", model.PriorityClassLow), convey.ShouldEqual, model.PriorityClassLow)
+
+		// but never raise it
+		convey.So(model.ResolvePriorityClass(model.PriorityClassLow, model.PriorityClassHigh), convey.ShouldEqual, model.PriorityClassLow)
+		convey.So(model.ResolvePriorityClass("", model.PriorityClassHigh), convey.ShouldEqual, model.PriorityClassNormal)
+
+		// an unknown requested class is ignored
+		convey.So(model.ResolvePriorityClass(model.PriorityClassHigh, "urgent"), convey.ShouldEqual, model.PriorityClassHigh)
+	})
+}
+
+func TestHigherPriorityClass(t *testing.T) {
+	convey.Convey("TestHigherPriorityClass", t, func() {
+		convey.So(model.HigherPriorityClass(model.PriorityClassHigh, model.PriorityClassNormal), convey.ShouldBeTrue)
+		convey.So(model.HigherPriorityClass(model.PriorityClassNormal, model.PriorityClassLow), convey.ShouldBeTrue)
+		convey.So(model.HigherPriorityClass(model.PriorityClassLow, model.PriorityClassNormal), convey.ShouldBeFalse)
+		convey.So(model.HigherPriorityClass(model.PriorityClassNormal, model.PriorityClassNormal), convey.ShouldBeFalse)
+	})
+}
+
+func TestScaleChannelLimit(t *testing.T) {
+	convey.Convey("TestScaleChannelLimit", t, func() {
+		convey.Convey("unlimited and full share keep the limit", func() {
+			limit, ok := model.ScaleChannelLimit(0, 0.5)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(limit, convey.ShouldEqual, 0)
+
+			limit, ok = model.ScaleChannelLimit(10, 1)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(limit, convey.ShouldEqual, 10)
+		})
+
+		convey.Convey("the share is rounded down", func() {
+			limit, ok := model.ScaleChannelLimit(10, 0.55)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(limit, convey.ShouldEqual, 5)
+
+			limit, ok = model.ScaleChannelLimit(100, 0.29)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(limit, convey.ShouldEqual, 29)
+		})
+
+		convey.Convey("small limits still reserve one for the higher classes", func() {
+			limit, ok := model.ScaleChannelLimit(2, 0.9)
+			convey.So(ok, convey.ShouldBeTrue)
+			convey.So(limit, convey.ShouldEqual, 1)
+
+			_, ok = model.ScaleChannelLimit(1, 0.9)
+			convey.So(ok, convey.ShouldBeFalse)
+
+			_, ok = model.ScaleChannelLimit(3, 0.2)
+			convey.So(ok, convey.ShouldBeFalse)
+		})
+	})
+}
+
+func TestGetPriorityClassCapacity(t *testing.T) {
+	convey.Convey("TestGetPriorityClassCapacity", t, func() {
+		old := config.GetPriorityClassCapacity()
+		defer config.SetPriorityClassCapacity(old)
+
+		config.SetPriorityClassCapacity(map[string]float64{
+			model.PriorityClassLow:    0.5,
+			model.PriorityClassNormal: 2,
+		})
+		convey.So(model.GetPriorityClassCapacity(model.PriorityClassLow), convey.ShouldEqual, 0.5)
+		// invalid and missing shares use the whole capacity
+		convey.So(model.GetPriorityClassCapacity(model.PriorityClassNormal), convey.ShouldEqual, 1)
+		convey.So(model.GetPriorityClassCapacity(model.PriorityClassHigh), convey.ShouldEqual, 1)
+	})
+}
@@ -0,0 +1,253 @@
+package model
+
+import (
+	"errors"
+	"net/http"
+	"slices"
+	"sort"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ErrRoutingRuleNotFound = "routing rule"
+)
+
+const (
+	RoutingRuleStatusEnabled  = 1
+	RoutingRuleStatusDisabled = 2
+)
+
+// RoutingConditions must all hold for a rule to match, empty conditions are ignored
+type RoutingConditions struct {
+	Models     []string `json:"models,omitempty"`
+	Groups     []string `json:"groups,omitempty"`
+	TokenNames []string `json:"token_names,omitempty"`
+	// Headers maps a header name to its expected value, "*" only requires the header to be present
+	Headers         map[string]string `json:"headers,omitempty"`
+	MinPromptLength int64             `json:"min_prompt_length,omitempty"`
+	MaxPromptLength int64             `json:"max_prompt_length,omitempty"`
+	HasImage        *bool             `json:"has_image,omitempty"`
+	Stream          *bool             `json:"stream,omitempty"`
+}
+
+// NeedsRequestBody reports whether the conditions look into the request body
+func (c *RoutingConditions) NeedsRequestBody() bool {
+	return c.MinPromptLength > 0 ||
+		c.MaxPromptLength > 0 ||
+		c.HasImage != nil ||
+		c.Stream != nil
+}
+
+// RoutingAction is applied when a rule matches, a reject ignores the other fields
+type RoutingAction struct {
+	Reject        bool   `json:"reject,omitempty"`
+	RejectStatus  int    `json:"reject_status,omitempty"`
+	RejectMessage string `json:"reject_message,omitempty"`
+	// Sets pins the request to these channel sets instead of the group available sets
+	Sets []string `json:"sets,omitempty"`
+	// Model replaces the request model
+	Model string `json:"model,omitempty"`
+	// PriorityMultipliers scales the priority of channels by channel id
+	PriorityMultipliers map[int]float64 `json:"priority_multipliers,omitempty"`
+}
+
+func (a *RoutingAction) GetRejectStatus() int {
+	if a.RejectStatus == 0 {
+		return http.StatusForbidden
+	}
+	return a.RejectStatus
+}
+
+type RoutingRule struct {
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	Conditions  RoutingConditions `gorm:"serializer:fastjson;type:text" json:"conditions"`
+	Action      RoutingAction     `gorm:"serializer:fastjson;type:text" json:"action"`
+	Name        string            `gorm:"index"                         json:"name"`
+	Description string            `gorm:"type:text"                     json:"description,omitempty"`
+	ID          int               `gorm:"primaryKey"                    json:"id"`
+	// rules are evaluated from the highest priority, the first match wins
+	Priority int `gorm:"index"                         json:"priority"`
+	Status   int `gorm:"default:1;index"               json:"status"`
+}
+
+func (r *RoutingRule) Validate() error {
+	if r.Name == "" {
+		return errors.New("name is required")
+	}
+	if r.Action.RejectStatus != 0 &&
+		(r.Action.RejectStatus < http.StatusBadRequest || r.Action.RejectStatus > 599) {
+		return errors.New("reject status must be an error status")
+	}
+	for _, multiplier := range r.Action.PriorityMultipliers {
+		if multiplier <= 0 {
+			return errors.New("priority multiplier must be greater than 0")
+		}
+	}
+	if !r.Action.Reject &&
+		len(r.Action.Sets) == 0 &&
+		r.Action.Model == "" &&
+		len(r.Action.PriorityMultipliers) == 0 {
+		return errors.New("action is empty")
+	}
+	if r.Action.Model != "" {
+		if err := CheckModelConfigExist([]string{r.Action.Model}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RoutingRequest is the part of a request that routing rules can match on
+type RoutingRequest struct {
+	Model        string
+	Group        string
+	TokenName    string
+	Header       http.Header
+	PromptLength int64
+	HasImage     bool
+	Stream       bool
+}
+
+func (r *RoutingRule) Match(req *RoutingRequest) bool {
+	c := &r.Conditions
+	if len(c.Models) > 0 && !slices.Contains(c.Models, req.Model) {
+		return false
+	}
+	if len(c.Groups) > 0 && !slices.Contains(c.Groups, req.Group) {
+		return false
+	}
+	if len(c.TokenNames) > 0 && !slices.Contains(c.TokenNames, req.TokenName) {
+		return false
+	}
+	for name, value := range c.Headers {
+		got := req.Header.Get(name)
+		if got == "" || (value != "*" && got != value) {
+			return false
+		}
+	}
+	if c.MinPromptLength > 0 && req.PromptLength < c.MinPromptLength {
+		return false
+	}
+	if c.MaxPromptLength > 0 && req.PromptLength > c.MaxPromptLength {
+		return false
+	}
+	if c.HasImage != nil && *c.HasImage != req.HasImage {
+		return false
+	}
+	if c.Stream != nil && *c.Stream != req.Stream {
+		return false
+	}
+	return true
+}
+
+// RoutingRules are the enabled rules in evaluation order
+type RoutingRules []*RoutingRule
+
+func (rs RoutingRules) NeedsRequestBody() bool {
+	for _, r := range rs {
+		if r.Conditions.NeedsRequestBody() {
+			return true
+		}
+	}
+	return false
+}
+
+func (rs RoutingRules) Match(req *RoutingRequest) *RoutingRule {
+	for _, r := range rs {
+		if r.Match(req) {
+			return r
+		}
+	}
+	return nil
+}
+
+func sortRoutingRules(rules []*RoutingRule) {
+	sort.SliceStable(rules, func(i, j int) bool {
+		if rules[i].Priority != rules[j].Priority {
+			return rules[i].Priority > rules[j].Priority
+		}
+		return rules[i].ID < rules[j].ID
+	})
+}
+
+func LoadEnabledRoutingRules() (RoutingRules, error) {
+	var rules []*RoutingRule
+	err := DB.Where("status = ?", RoutingRuleStatusEnabled).Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	sortRoutingRules(rules)
+	return rules, nil
+}
+
+func GetRoutingRules() ([]*RoutingRule, error) {
+	var rules []*RoutingRule
+	err := DB.Find(&rules).Error
+	if err != nil {
+		return nil, err
+	}
+	sortRoutingRules(rules)
+	return rules, nil
+}
+
+func GetRoutingRuleByID(id int) (*RoutingRule, error) {
+	var rule RoutingRule
+	err := DB.First(&rule, "id = ?", id).Error
+	return &rule, HandleNotFound(err, ErrRoutingRuleNotFound)
+}
+
+func CreateRoutingRule(rule *RoutingRule) (err error) {
+	defer func() {
+		if err == nil {
+			_ = InitModelConfigAndChannelCache()
+		}
+	}()
+	return DB.Create(rule).Error
+}
+
+func UpdateRoutingRule(rule *RoutingRule) (err error) {
+	defer func() {
+		if err == nil {
+			_ = InitModelConfigAndChannelCache()
+		}
+	}()
+	result := DB.
+		Model(rule).
+		Select(
+			"name",
+			"description",
+			"priority",
+			"status",
+			"conditions",
+			"action",
+		).
+		Clauses(clause.Returning{}).
+		Where("id = ?", rule.ID).
+		Updates(rule)
+	return HandleUpdateResult(result, ErrRoutingRuleNotFound)
+}
+
+func UpdateRoutingRuleStatus(id int, status int) (err error) {
+	defer func() {
+		if err == nil {
+			_ = InitModelConfigAndChannelCache()
+		}
+	}()
+	result := DB.Model(&RoutingRule{}).
+		Where("id = ?", id).
+		Update("status", status)
+	return HandleUpdateResult(result, ErrRoutingRuleNotFound)
+}
+
+func DeleteRoutingRuleByID(id int) (err error) {
+	defer func() {
+		if err == nil {
+			_ = InitModelConfigAndChannelCache()
+		}
+	}()
+	result := DB.Delete(&RoutingRule{ID: id})
+	return HandleUpdateResult(result, ErrRoutingRuleNotFound)
+}
@@ -0,0 +1,172 @@
+package model_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestRoutingRuleMatch(t *testing.T) {
+	convey.Convey("TestRoutingRuleMatch", t, func() {
+		yes, no := true, false
+		header := http.Header{}
+		header.Set("X-Tenant", "acme")
+		req := &model.RoutingRequest{
+			Model:        "gpt-4o",
+			Group:        "g1",
+			TokenName:    "t1",
+			Header:       header,
+			PromptLength: 1000,
+			HasImage:     true,
+			Stream:       true,
+		}
+
+		tests := []struct {
+			name       string
+			conditions model.RoutingConditions
+			match      bool
+		}{
+			{"empty conditions", model.RoutingConditions{}, true},
+			{"model", model.RoutingConditions{Models: []string{"gpt-4o-mini", "gpt-4o"}}, true},
+			{"other model", model.RoutingConditions{Models: []string{"gpt-4o-mini"}}, false},
+			{"group", model.RoutingConditions{Groups: []string{"g1"}}, true},
+			{"other group", model.RoutingConditions{Groups: []string{"g2"}}, false},
+			{"token name", model.RoutingConditions{TokenNames: []string{"t1"}}, true},
+			{"other token name", model.RoutingConditions{TokenNames: []string{"t2"}}, false},
+			{"header value", model.RoutingConditions{Headers: map[string]string{"x-tenant": "acme"}}, true},
+			{"other header value", model.RoutingConditions{Headers: map[string]string{"X-Tenant": "other"}}, false},
+			{"header present", model.RoutingConditions{Headers: map[string]string{"X-Tenant": "*"}}, true},
+			{"header missing", model.RoutingConditions{Headers: map[string]string{"X-Region": "*"}}, false},
+			{"min prompt length", model.RoutingConditions{MinPromptLength: 1000}, true},
+			{"prompt too short", model.RoutingConditions{MinPromptLength: 1001}, false},
+			{"max prompt length", model.RoutingConditions{MaxPromptLength: 1000}, true},
+			{"prompt too long", model.RoutingConditions{MaxPromptLength: 999}, false},
+			{"prompt length range", model.RoutingConditions{MinPromptLength: 500, MaxPromptLength: 2000}, true},
+			{"has image", model.RoutingConditions{HasImage: &yes}, true},
+			{"no image", model.RoutingConditions{HasImage: &no}, false},
+			{"stream", model.RoutingConditions{Stream: &yes}, true},
+			{"not stream", model.RoutingConditions{Stream: &no}, false},
+			{
+				"all conditions",
+				model.RoutingConditions{
+					Models:          []string{"gpt-4o"},
+					Groups:          []string{"g1"},
+					TokenNames:      []string{"t1"},
+					Headers:         map[string]string{"X-Tenant": "acme"},
+					MinPromptLength: 100,
+					MaxPromptLength: 5000,
+					HasImage:        &yes,
+					Stream:          &yes,
+				},
+				true,
+			},
+			{
+				"one condition fails",
+				model.RoutingConditions{
+					Models: []string{"gpt-4o"},
+					Groups: []string{"g1"},
+					Stream: &no,
+				},
+				false,
+			},
+		}
+		for _, tt := range tests {
+			convey.Convey(tt.name, func() {
+				rule := &model.RoutingRule{Conditions: tt.conditions}
+				convey.So(rule.Match(req), convey.ShouldEqual, tt.match)
+			})
+		}
+	})
+}
+
+func TestRoutingRulesMatch(t *testing.T) {
+	convey.Convey("TestRoutingRulesMatch", t, func() {
+		initTestDB(t)
+
+		yes := true
+		rules := []*model.RoutingRule{
+			{
+				Name:       "any",
+				Priority:   1,
+				Conditions: model.RoutingConditions{},
+				Action:     model.RoutingAction{Sets: []string{"default"}},
+			},
+			{
+				Name:       "stream",
+				Priority:   10,
+				Conditions: model.RoutingConditions{Stream: &yes},
+				Action:     model.RoutingAction{Sets: []string{"stream"}},
+			},
+			{
+				Name:       "long prompt",
+				Priority:   20,
+				Conditions: model.RoutingConditions{MinPromptLength: 10000},
+				Action:     model.RoutingAction{Model: "gpt-4o-mini"},
+			},
+			{
+				// same priority as the stream rule, the earlier rule wins
+				Name:       "stream later",
+				Priority:   10,
+				Conditions: model.RoutingConditions{Stream: &yes},
+				Action:     model.RoutingAction{Sets: []string{"stream-later"}},
+			},
+			{
+				Name:       "disabled",
+				Priority:   100,
+				Status:     model.RoutingRuleStatusDisabled,
+				Conditions: model.RoutingConditions{},
+				Action:     model.RoutingAction{Reject: true},
+			},
+		}
+		for _, rule := range rules {
+			convey.So(model.DB.Create(rule).Error, convey.ShouldBeNil)
+		}
+
+		enabled, err := model.LoadEnabledRoutingRules()
+		convey.So(err, convey.ShouldBeNil)
+		names := make([]string, 0, len(enabled))
+		for _, rule := range enabled {
+			names = append(names, rule.Name)
+		}
+		convey.So(names, convey.ShouldResemble, []string{"long prompt", "stream", "stream later", "any"})
+		convey.So(enabled.NeedsRequestBody(), convey.ShouldBeTrue)
+
+		all, err := model.GetRoutingRules()
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(all, convey.ShouldHaveLength, 5)
+		convey.So(all[0].Name, convey.ShouldEqual, "disabled")
+
+		tests := []struct {
+			name string
+			req  model.RoutingRequest
+			rule string
+		}{
+			{"highest priority first", model.RoutingRequest{PromptLength: 20000, Stream: true}, "long prompt"},
+			{"earlier rule of the same priority", model.RoutingRequest{Stream: true}, "stream"},
+			{"fallback", model.RoutingRequest{}, "any"},
+		}
+		for _, tt := range tests {
+			convey.Convey(tt.name, func() {
+				rule := enabled.Match(&tt.req)
+				convey.So(rule, convey.ShouldNotBeNil)
+				convey.So(rule.Name, convey.ShouldEqual, tt.rule)
+			})
+		}
+
+		convey.Convey("no rule matches", func() {
+			convey.So(enabled[1:3].Match(&model.RoutingRequest{}), convey.ShouldBeNil)
+			convey.So(model.RoutingRules(nil).Match(&model.RoutingRequest{}), convey.ShouldBeNil)
+		})
+
+		convey.Convey("a rule disabled later is not loaded", func() {
+			convey.So(model.UpdateRoutingRuleStatus(enabled[0].ID, model.RoutingRuleStatusDisabled), convey.ShouldBeNil)
+			enabled, err := model.LoadEnabledRoutingRules()
+			convey.So(err, convey.ShouldBeNil)
+			rule := enabled.Match(&model.RoutingRequest{PromptLength: 20000, Stream: true})
+			convey.So(rule, convey.ShouldNotBeNil)
+			convey.So(rule.Name, convey.ShouldEqual, "stream")
+		})
+	})
+}
@@ -0,0 +1,252 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/common/env"
+	log "github.com/sirupsen/logrus"
+	"gorm.io/gorm"
+)
+
+const statementPeriodLayout = "2006-01"
+
+// statementCloseDelay keeps an ended period open for the logs recorded late, consumes are async,
+// a stream is logged when it ends and a hold expires after an hour, so it covers the hold expiry and the longest request
+var statementCloseDelay = time.Duration(env.Int64("STATEMENT_CLOSE_DELAY_SECONDS", 7200)) * time.Second
+
+// StatementItem sums the logs of a model, a token or the whole statement,
+// requests are the results returned to the client, the amount and the tokens include retries,
+// mirrored requests are not logged, so they are never part of a statement
+type StatementItem struct {
+	Name                string  `json:"name,omitempty"`
+	RequestCount        int64   `json:"request_count"`
+	ExceptionCount      int64   `json:"exception_count"`
+	InputTokens         int64   `json:"input_tokens"`
+	OutputTokens        int64   `json:"output_tokens"`
+	CachedTokens        int64   `json:"cached_tokens"`
+	CacheCreationTokens int64   `json:"cache_creation_tokens"`
+	ReasoningTokens     int64   `json:"reasoning_tokens"`
+	AudioInputTokens    int64   `json:"audio_input_tokens"`
+	AudioOutputTokens   int64   `json:"audio_output_tokens"`
+	ImageInputTokens    int64   `json:"image_input_tokens"`
+	Units               int64   `json:"units"`
+	TotalTokens         int64   `json:"total_tokens"`
+	UsedAmount          float64 `json:"used_amount"`
+}
+
+// Statement is the usage of a group in a monthly billing period in the local time of the server,
+// a statement is persisted once the period is over, so that cleaning the logs does not change it
+type Statement struct {
+	ClosedAt time.Time       `json:"closed_at"`
+	StartAt  time.Time       `json:"start_at"`
+	EndAt    time.Time       `json:"end_at"`
+	GroupID  string          `gorm:"type:varchar(64);uniqueIndex:idx_statement_group_period"      json:"group"`
+	Period   string          `gorm:"type:varchar(7);uniqueIndex:idx_statement_group_period;index" json:"period"`
+	Total    StatementItem   `gorm:"serializer:fastjson;type:text"                                json:"total"`
+	Models   []StatementItem `gorm:"serializer:fastjson;type:text"                                json:"models"`
+	Tokens   []StatementItem `gorm:"serializer:fastjson;type:text"                                json:"tokens"`
+	ID       int             `gorm:"primaryKey"                                                   json:"id"`
+	Closed   bool            `gorm:"-"                                                            json:"closed"`
+}
+
+func (s *Statement) MarshalJSON() ([]byte, error) {
+	type Alias Statement
+	var closedAt int64
+	if !s.ClosedAt.IsZero() {
+		closedAt = s.ClosedAt.UnixMilli()
+	}
+	return sonic.Marshal(&struct {
+		*Alias
+		ClosedAt int64 `json:"closed_at,omitempty"`
+		StartAt  int64 `json:"start_at"`
+		EndAt    int64 `json:"end_at"`
+	}{
+		Alias:    (*Alias)(s),
+		ClosedAt: closedAt,
+		StartAt:  s.StartAt.UnixMilli(),
+		EndAt:    s.EndAt.UnixMilli(),
+	})
+}
+
+// ParseStatementPeriod returns the range of the billing period "2006-01", empty is the current month
+func ParseStatementPeriod(period string) (string, time.Time, time.Time, error) {
+	if period == "" {
+		period = time.Now().Format(statementPeriodLayout)
+	}
+	t, err := time.ParseInLocation(statementPeriodLayout, period, time.Local)
+	if err != nil {
+		return "", time.Time{}, time.Time{}, fmt.Errorf("invalid statement period %q, must be like 2006-01", period)
+	}
+	start, end := QuotaPeriodRange(QuotaPeriodMonthly, t, time.Local)
+	return period, start, end, nil
+}
+
+// GetGroupStatement returns the statement of the group in the period,
+// a persisted statement is returned as is, a period is closed and persisted once the close delay after its end passed,
+// until then it is aggregated from the logs every time, a period whose logs are partly cleaned is never persisted,
+// it is aggregated from the remaining logs and stays open
+func GetGroupStatement(group, period string) (*Statement, error) {
+	if group == "" {
+		return nil, errors.New("group id is empty")
+	}
+	period, start, end, err := ParseStatementPeriod(period)
+	if err != nil {
+		return nil, err
+	}
+
+	var statement Statement
+	err = LogDB.Where("group_id = ? AND period = ?", group, period).First(&statement).Error
+	if err == nil {
+		statement.Closed = true
+		return &statement, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	s, err := aggregateStatement(group, period, start, end)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.Before(end.Add(statementCloseDelay)) || !statementLogsRetained(start, now) {
+		return s, nil
+	}
+	return s, closeStatement(s)
+}
+
+// statementLogsRetained reports whether no log of the period starting at start is cleaned yet,
+// the logs are cleaned by their creation time which is never before their request time
+func statementLogsRetained(start, now time.Time) bool {
+	logStorageHours := config.GetLogStorageHours()
+	return logStorageHours <= 0 || !start.Before(now.Add(-time.Duration(logStorageHours)*time.Hour))
+}
+
+// GetStatements returns the persisted statements of the period of all groups
+func GetStatements(period string, page, perPage int) (statements []*Statement, total int64, err error) {
+	tx := LogDB.Model(&Statement{})
+	if period != "" {
+		tx = tx.Where("period = ?", period)
+	}
+	err = tx.Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	if total <= 0 {
+		return nil, 0, nil
+	}
+	limit, offset := toLimitOffset(page, perPage)
+	err = tx.Order("period desc, group_id asc").Limit(limit).Offset(offset).Find(&statements).Error
+	for _, s := range statements {
+		s.Closed = true
+	}
+	return statements, total, err
+}
+
+var lastClosedStatementPeriod atomic.Value
+
+// CloseLastMonthStatements persists the statements of the last month of the groups having logs in it
+// once the close delay passed, it runs before the logs are cleaned, a month whose logs are partly cleaned is skipped
+func CloseLastMonthStatements() error {
+	now := time.Now()
+	period, start, end, err := ParseStatementPeriod(now.AddDate(0, 0, -now.Day()).Format(statementPeriodLayout))
+	if err != nil {
+		return err
+	}
+	if closed, _ := lastClosedStatementPeriod.Load().(string); closed == period {
+		return nil
+	}
+	if now.Before(end.Add(statementCloseDelay)) {
+		return nil
+	}
+	if !statementLogsRetained(start, now) {
+		log.Warnf("the logs of the statement period %s are partly cleaned, its statements are not closed,"+
+			" keep the logs longer than a month to close them", period)
+		lastClosedStatementPeriod.Store(period)
+		return nil
+	}
+
+	var groups []string
+	err = LogDB.Model(&Log{}).
+		Where("request_at >= ? AND request_at < ?", start, end).
+		Where("group_id <> ''").
+		Where("group_id NOT IN (?)", LogDB.Model(&Statement{}).Select("group_id").Where("period = ?", period)).
+		Distinct("group_id").
+		Pluck("group_id", &groups).Error
+	if err != nil {
+		return err
+	}
+
+	for _, group := range groups {
+		s, err := aggregateStatement(group, period, start, end)
+		if err != nil {
+			return err
+		}
+		if err := closeStatement(s); err != nil {
+			return err
+		}
+	}
+	lastClosedStatementPeriod.Store(period)
+	return nil
+}
+
+func closeStatement(s *Statement) error {
+	s.ClosedAt = time.Now()
+	s.Closed = true
+	err := LogDB.Create(s).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return LogDB.Where("group_id = ? AND period = ?", s.GroupID, s.Period).First(s).Error
+	}
+	return err
+}
+
+const statementItemSelect = `COALESCE(sum(case when downstream_result = true then 1 else 0 end), 0) as request_count,
+COALESCE(sum(case when downstream_result = true and code != 200 then 1 else 0 end), 0) as exception_count,
+COALESCE(sum(input_tokens), 0) as input_tokens,
+COALESCE(sum(output_tokens), 0) as output_tokens,
+COALESCE(sum(cached_tokens), 0) as cached_tokens,
+COALESCE(sum(cache_creation_tokens), 0) as cache_creation_tokens,
+COALESCE(sum(reasoning_tokens), 0) as reasoning_tokens,
+COALESCE(sum(audio_input_tokens), 0) as audio_input_tokens,
+COALESCE(sum(audio_output_tokens), 0) as audio_output_tokens,
+COALESCE(sum(image_input_tokens), 0) as image_input_tokens,
+COALESCE(sum(units), 0) as units,
+COALESCE(sum(total_tokens), 0) as total_tokens,
+COALESCE(sum(used_amount), 0) as used_amount`
+
+func aggregateStatement(group, period string, start, end time.Time) (*Statement, error) {
+	query := func() *gorm.DB {
+		return LogDB.Model(&Log{}).
+			Where("group_id = ?", group).
+			Where("request_at >= ? AND request_at < ?", start, end)
+	}
+
+	s := &Statement{
+		GroupID: group,
+		Period:  period,
+		StartAt: start,
+		EndAt:   end,
+	}
+	if err := query().Select(statementItemSelect).Scan(&s.Total).Error; err != nil {
+		return nil, err
+	}
+	if err := query().
+		Select("model as name, " + statementItemSelect).
+		Group("model").
+		Order("used_amount desc").
+		Scan(&s.Models).Error; err != nil {
+		return nil, err
+	}
+	if err := query().
+		Select("token_name as name, " + statementItemSelect).
+		Group("token_name").
+		Order("used_amount desc").
+		Scan(&s.Tokens).Error; err != nil {
+		return nil, err
+	}
+	return s, nil
+}
@@ -0,0 +1,85 @@
+package model_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestGroupStatement(t *testing.T) {
+	convey.Convey("TestGroupStatement", t, func() {
+		initTestDB(t)
+		_, start, _, err := model.ParseStatementPeriod("2024-01")
+		convey.So(err, convey.ShouldBeNil)
+		now := time.Now()
+		for _, requestAt := range []time.Time{start.Add(time.Hour), now} {
+			convey.So(model.LogDB.Create(&model.Log{
+				RequestAt:        requestAt,
+				GroupID:          "g1",
+				Model:            "gpt-4o",
+				TokenName:        "t",
+				Code:             200,
+				DownstreamResult: true,
+				UsedAmount:       1.5,
+			}).Error, convey.ShouldBeNil)
+		}
+
+		// an ended period is closed once the close delay passed
+		s, err := model.GetGroupStatement("g1", "2024-01")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(s.Closed, convey.ShouldBeTrue)
+		convey.So(s.Total.RequestCount, convey.ShouldEqual, 1)
+		convey.So(s.Total.UsedAmount, convey.ShouldEqual, 1.5)
+
+		statements, total, err := model.GetStatements("2024-01", 1, 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(total, convey.ShouldEqual, 1)
+		convey.So(statements[0].GroupID, convey.ShouldEqual, "g1")
+
+		// the current period stays open for the logs recorded late
+		s, err = model.GetGroupStatement("g1", "")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(s.Closed, convey.ShouldBeFalse)
+		convey.So(s.Total.RequestCount, convey.ShouldEqual, 1)
+		_, total, err = model.GetStatements(now.Format("2006-01"), 1, 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(total, convey.ShouldEqual, 0)
+	})
+}
+
+func TestGroupStatementLogRetention(t *testing.T) {
+	convey.Convey("TestGroupStatementLogRetention", t, func() {
+		initTestDB(t)
+		config.SetLogStorageHours(24 * 20)
+		defer config.SetLogStorageHours(0)
+
+		now := time.Now()
+		lastMonth := now.AddDate(0, 0, -now.Day())
+		_, start, _, err := model.ParseStatementPeriod("2024-01")
+		convey.So(err, convey.ShouldBeNil)
+		for _, requestAt := range []time.Time{start.Add(time.Hour), lastMonth} {
+			convey.So(model.LogDB.Create(&model.Log{
+				RequestAt:        requestAt,
+				GroupID:          "g1",
+				Model:            "gpt-4o",
+				TokenName:        "t",
+				Code:             200,
+				DownstreamResult: true,
+				UsedAmount:       1.5,
+			}).Error, convey.ShouldBeNil)
+		}
+
+		// the logs of the period may be cleaned already, so it is aggregated from the remaining logs but not closed
+		s, err := model.GetGroupStatement("g1", "2024-01")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(s.Closed, convey.ShouldBeFalse)
+		convey.So(s.Total.RequestCount, convey.ShouldEqual, 1)
+		convey.So(model.CloseLastMonthStatements(), convey.ShouldBeNil)
+		_, total, err := model.GetStatements("", 1, 10)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(total, convey.ShouldEqual, 0)
+	})
+}
@@ -25,19 +25,22 @@ const (
 )
 
 type Token struct {
-	CreatedAt    time.Time       `json:"created_at"`
-	ExpiredAt    time.Time       `json:"expired_at"`
-	Group        *Group          `gorm:"foreignKey:GroupID"                        json:"-"`
-	Key          string          `gorm:"type:char(48);uniqueIndex"                 json:"key"`
-	Name         EmptyNullString `gorm:"index;uniqueIndex:idx_group_name;not null" json:"name"`
-	GroupID      string          `gorm:"index;uniqueIndex:idx_group_name"          json:"group"`
-	Subnets      []string        `gorm:"serializer:fastjson;type:text"             json:"subnets"`
-	Models       []string        `gorm:"serializer:fastjson;type:text"             json:"models"`
-	Status       int             `gorm:"default:1;index"                           json:"status"`
-	ID           int             `gorm:"primaryKey"                                json:"id"`
-	Quota        float64         `json:"quota"`
-	UsedAmount   float64         `gorm:"index"                                     json:"used_amount"`
-	RequestCount int             `gorm:"index"                                     json:"request_count"`
+	CreatedAt      time.Time       `json:"created_at"`
+	ExpiredAt      time.Time       `json:"expired_at"`
+	Group          *Group          `gorm:"foreignKey:GroupID"                        json:"-"`
+	Key            string          `gorm:"type:char(48);uniqueIndex"                 json:"key"`
+	Name           EmptyNullString `gorm:"index;uniqueIndex:idx_group_name;not null" json:"name"`
+	GroupID        string          `gorm:"index;uniqueIndex:idx_group_name"          json:"group"`
+	Subnets        []string        `gorm:"serializer:fastjson;type:text"             json:"subnets"`
+	Models         []string        `gorm:"serializer:fastjson;type:text"             json:"models"`
+	Status         int             `gorm:"default:1;index"                           json:"status"`
+	ID             int             `gorm:"primaryKey"                                json:"id"`
+	Quota          float64         `json:"quota"`
+	UsedAmount     float64         `gorm:"index"                                     json:"used_amount"`
+	RequestCount   int             `gorm:"index"                                     json:"request_count"`
+	RateLimitWait  bool            `json:"rate_limit_wait"`
+	PriorityClass  string          `json:"priority_class"`
+	PeriodicQuotas PeriodicQuotas  `gorm:"serializer:fastjson;type:text"             json:"periodic_quotas,omitempty"`
 }
 
 func (t *Token) BeforeCreate(_ *gorm.DB) (err error) {
@@ -492,7 +495,7 @@ func UpdateToken(id int, token *Token) (err error) {
 		}
 	}()
 	result := DB.
-		Select("subnets", "quota", "models", "expired_at").
+		Select("subnets", "quota", "models", "expired_at", "rate_limit_wait", "priority_class", "periodic_quotas").
 		Where("id = ?", id).
 		Clauses(clause.Returning{}).
 		Updates(token)
@@ -517,7 +520,7 @@ func UpdateGroupToken(id int, group string, token *Token) (err error) {
 		}
 	}()
 	result := DB.
-		Select("subnets", "quota", "models", "expired_at").
+		Select("subnets", "quota", "models", "expired_at", "rate_limit_wait", "priority_class", "periodic_quotas").
 		Where("id = ? and group_id = ?", id, group).
 		Clauses(clause.Returning{}).
 		Updates(token)
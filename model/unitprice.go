@@ -0,0 +1,29 @@
+package model
+
+import "github.com/labring/aiproxy/relay/mode"
+
+// billing units of the unit price, each mode reports the count of its own unit
+const (
+	BillingUnitRequest   = "request"
+	BillingUnitPage      = "page"
+	BillingUnitCharacter = "character"
+	BillingUnitSecond    = "second"
+	BillingUnitImage     = "image"
+)
+
+// BillingUnitOfMode returns the unit the unit price of the mode is billed by,
+// modes without a natural unit are billed per request
+func BillingUnitOfMode(m mode.Mode) string {
+	switch m {
+	case mode.ParsePdf:
+		return BillingUnitPage
+	case mode.AudioSpeech:
+		return BillingUnitCharacter
+	case mode.AudioTranscription, mode.AudioTranslation:
+		return BillingUnitSecond
+	case mode.ImagesGenerations, mode.Edits:
+		return BillingUnitImage
+	default:
+		return BillingUnitRequest
+	}
+}
@@ -52,9 +52,10 @@ func IgnoreNotFound(err error) error {
 }
 
 type BatchUpdateData struct {
-	Groups   map[string]*GroupUpdate
-	Tokens   map[int]*TokenUpdate
-	Channels map[int]*ChannelUpdate
+	Groups      map[string]*GroupUpdate
+	Tokens      map[int]*TokenUpdate
+	Channels    map[int]*ChannelUpdate
+	ChannelKeys map[int]*ChannelKeyUpdate
 	sync.Mutex
 }
 
@@ -73,13 +74,19 @@ type ChannelUpdate struct {
 	Count  int
 }
 
+type ChannelKeyUpdate struct {
+	Count      int
+	ErrorCount int
+}
+
 var batchData BatchUpdateData
 
 func init() {
 	batchData = BatchUpdateData{
-		Groups:   make(map[string]*GroupUpdate),
-		Tokens:   make(map[int]*TokenUpdate),
-		Channels: make(map[int]*ChannelUpdate),
+		Groups:      make(map[string]*GroupUpdate),
+		Tokens:      make(map[int]*TokenUpdate),
+		Channels:    make(map[int]*ChannelUpdate),
+		ChannelKeys: make(map[int]*ChannelKeyUpdate),
 	}
 }
 
@@ -151,6 +158,35 @@ func ProcessBatchUpdates() {
 			}
 		}
 	}
+
+	if len(batchData.ChannelKeys) > 0 {
+		for keyID, data := range batchData.ChannelKeys {
+			err := UpdateChannelKeyRequestCount(keyID, data.Count, data.ErrorCount)
+			if IgnoreNotFound(err) != nil {
+				notify.ErrorThrottle(
+					"batchUpdateChannelKeyRequestCount",
+					time.Minute,
+					"failed to batch update channel key",
+					err.Error(),
+				)
+			} else {
+				delete(batchData.ChannelKeys, keyID)
+			}
+		}
+	}
+}
+
+func BatchRecordChannelKeyRequest(keyID int, isError bool) {
+	batchData.Lock()
+	defer batchData.Unlock()
+
+	if _, ok := batchData.ChannelKeys[keyID]; !ok {
+		batchData.ChannelKeys[keyID] = &ChannelKeyUpdate{}
+	}
+	batchData.ChannelKeys[keyID].Count++
+	if isError {
+		batchData.ChannelKeys[keyID].ErrorCount++
+	}
 }
 
 func BatchRecordConsume(
@@ -171,6 +207,9 @@ func BatchRecordConsume(
 	downstreamResult bool,
 	usage Usage,
 	modelPrice Price,
+	priceTier int64,
+	priceMultiplier float64,
+	priceAdjustment GroupPriceAdjustment,
 	amount float64,
 ) error {
 	err := RecordConsumeLog(
@@ -191,6 +230,9 @@ func BatchRecordConsume(
 		downstreamResult,
 		usage,
 		modelPrice,
+		priceTier,
+		priceMultiplier,
+		priceAdjustment,
 		amount,
 	)
 
@@ -0,0 +1,237 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/redis/go-redis/v9"
+)
+
+type BreakerState string
+
+const (
+	BreakerStateClosed   BreakerState = "closed"
+	BreakerStateOpen     BreakerState = "open"
+	BreakerStateHalfOpen BreakerState = "half_open"
+)
+
+const (
+	breakerKeySuffix = ":breaker"
+	// the open duration doubles every time the breaker reopens from half-open
+	breakerBaseOpenDuration = time.Minute
+	breakerMaxOpenDuration  = 30 * time.Minute
+	// live requests let through while half-open, all of them must succeed to close the breaker
+	breakerHalfOpenProbes = 3
+	// a probe that never reports back gives its slot up after this long
+	breakerProbeTimeout = 5 * time.Minute
+)
+
+// Breaker is the circuit breaker of a channel model
+type Breaker struct {
+	Model     string       `json:"model"`
+	ChannelID int64        `json:"channel_id"`
+	State     BreakerState `json:"state"`
+	OpenCount int64        `json:"open_count"`
+	OpenUntil int64        `json:"open_until"`
+	Probes    int64        `json:"probes"`
+	Successes int64        `json:"successes"`
+}
+
+// BreakerTransition describes a state change caused by a request, From equals To when nothing changed
+type BreakerTransition struct {
+	From      BreakerState
+	To        BreakerState
+	OpenUntil time.Time
+}
+
+func (t BreakerTransition) Changed() bool {
+	return t.From != t.To
+}
+
+func breakerOpenDuration(openCount int64) time.Duration {
+	d := breakerBaseOpenDuration
+	for i := int64(1); i < openCount && d < breakerMaxOpenDuration; i++ {
+		d *= 2
+	}
+	return min(d, breakerMaxOpenDuration)
+}
+
+var (
+	allowRequestScript = redis.NewScript(allowRequestLuaScript)
+	getBreakerScript   = redis.NewScript(getBreakerLuaScript)
+)
+
+func buildBreakerKey(model string, channelID string) string {
+	return fmt.Sprintf("%s%s%s%v%s", modelKeyPrefix, model, channelKeyPart, channelID, breakerKeySuffix)
+}
+
+func parseBreakerTransition(result []any) (BreakerTransition, error) {
+	if len(result) < 3 {
+		return BreakerTransition{}, errors.New("invalid breaker result")
+	}
+	from, _ := result[1].(string)
+	to, _ := result[2].(string)
+	transition := BreakerTransition{
+		From: BreakerState(from),
+		To:   BreakerState(to),
+	}
+	if len(result) > 3 {
+		if openUntil, _ := result[3].(int64); openUntil > 0 {
+			transition.OpenUntil = time.UnixMilli(openUntil)
+		}
+	}
+	return transition, nil
+}
+
+// AllowRequest reports whether a request may be sent to the channel model, an open breaker denies all requests,
+// an expired open breaker turns half-open here and only lets a limited number of probes through
+func AllowRequest(ctx context.Context, model string, channelID int64) (bool, BreakerTransition, error) {
+	if !config.GetEnableModelErrorAutoBan() {
+		return true, BreakerTransition{From: BreakerStateClosed, To: BreakerStateClosed}, nil
+	}
+
+	if !common.RedisEnabled {
+		allowed, transition := memModelMonitor.AllowRequest(model, channelID)
+		return allowed, transition, nil
+	}
+
+	result, err := allowRequestScript.Run(
+		ctx,
+		common.RDB,
+		[]string{buildBreakerKey(model, strconv.FormatInt(channelID, 10))},
+		time.Now().UnixMilli(),
+		breakerHalfOpenProbes,
+		breakerProbeTimeout.Milliseconds(),
+		breakerMaxOpenDuration.Milliseconds(),
+	).Slice()
+	if err != nil {
+		return true, BreakerTransition{}, err
+	}
+	transition, err := parseBreakerTransition(result)
+	if err != nil {
+		return true, BreakerTransition{}, err
+	}
+	allowed, _ := result[0].(int64)
+	return allowed == 1, transition, nil
+}
+
+// GetAllBreakers gets all channel model breakers that are not closed
+func GetAllBreakers(ctx context.Context) ([]*Breaker, error) {
+	if !common.RedisEnabled {
+		return memModelMonitor.GetAllBreakers(ctx)
+	}
+
+	result := []*Breaker{}
+	pattern := buildBreakerKey("*", "*")
+	iter := common.RDB.Scan(ctx, 0, pattern, 0).Iterator()
+
+	for iter.Next(ctx) {
+		key := iter.Val()
+		content := strings.TrimSuffix(strings.TrimPrefix(key, modelKeyPrefix), breakerKeySuffix)
+		model, channelIDStr, ok := strings.Cut(content, channelKeyPart)
+		if !ok {
+			continue
+		}
+		channelID, err := strconv.ParseInt(channelIDStr, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		values, err := getBreakerScript.Run(
+			ctx,
+			common.RDB,
+			[]string{key},
+			time.Now().UnixMilli(),
+		).Slice()
+		if err != nil {
+			return nil, err
+		}
+		if len(values) < 5 {
+			continue
+		}
+
+		state, _ := values[0].(string)
+		if state == "" || BreakerState(state) == BreakerStateClosed {
+			continue
+		}
+		breaker := &Breaker{
+			Model:     model,
+			ChannelID: channelID,
+			State:     BreakerState(state),
+		}
+		breaker.OpenCount, _ = values[1].(int64)
+		breaker.OpenUntil, _ = values[2].(int64)
+		breaker.Probes, _ = values[3].(int64)
+		breaker.Successes, _ = values[4].(int64)
+		result = append(result, breaker)
+	}
+
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+const (
+	allowRequestLuaScript = `
+local breaker_key = KEYS[1]
+local now_ts = tonumber(ARGV[1])
+local half_open_probes = tonumber(ARGV[2])
+local probe_timeout = tonumber(ARGV[3])
+local max_open_ms = tonumber(ARGV[4])
+
+local values = redis.call("HMGET", breaker_key, "state", "open_until", "probes", "probe_at")
+local state = values[1]
+if not state or state == "closed" then
+    return {1, "closed", "closed"}
+end
+
+local from = state
+local probes = tonumber(values[3]) or 0
+local probe_at = tonumber(values[4]) or 0
+
+if state == "open" then
+    if now_ts < (tonumber(values[2]) or 0) then
+        return {0, "open", "open"}
+    end
+    state = "half_open"
+    probes = 0
+    probe_at = 0
+    redis.call("HSET", breaker_key, "state", state, "probes", 0, "successes", 0, "probe_at", 0)
+end
+
+if probes >= half_open_probes then
+    if now_ts - probe_at < probe_timeout then
+        return {0, from, state}
+    end
+    probes = 0
+end
+
+redis.call("HSET", breaker_key, "probes", probes + 1, "probe_at", now_ts)
+redis.call("PEXPIRE", breaker_key, max_open_ms + probe_timeout)
+return {1, from, state}
+`
+
+	getBreakerLuaScript = `
+local breaker_key = KEYS[1]
+local now_ts = tonumber(ARGV[1])
+
+local values = redis.call("HMGET", breaker_key, "state", "open_count", "open_until", "probes", "successes")
+local state = values[1]
+if not state then
+    return {"", 0, 0, 0, 0}
+end
+local open_until = tonumber(values[3]) or 0
+if state == "open" and now_ts >= open_until then
+    state = "half_open"
+end
+return {state, tonumber(values[2]) or 0, open_until, tonumber(values[4]) or 0, tonumber(values[5]) or 0}
+`
+)
@@ -0,0 +1,122 @@
+package monitor_test
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/labring/aiproxy/common"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/monitor"
+	"github.com/redis/go-redis/v9"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func enableAutoBan(t *testing.T) {
+	t.Helper()
+	config.SetEnableModelErrorAutoBan(true)
+	t.Cleanup(func() {
+		config.SetEnableModelErrorAutoBan(false)
+	})
+}
+
+func TestMemBreaker(t *testing.T) {
+	convey.Convey("TestMemBreaker", t, func() {
+		enableAutoBan(t)
+		ctx := context.Background()
+
+		allowed, transition, err := monitor.AllowRequest(ctx, "mem-model", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(allowed, convey.ShouldBeTrue)
+		convey.So(transition.To, convey.ShouldEqual, monitor.BreakerStateClosed)
+
+		_, transition, err = monitor.AddRequest(ctx, "mem-model", 1, true, true)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(transition.From, convey.ShouldEqual, monitor.BreakerStateClosed)
+		convey.So(transition.To, convey.ShouldEqual, monitor.BreakerStateOpen)
+
+		// an open breaker denies requests until it expires
+		allowed, transition, err = monitor.AllowRequest(ctx, "mem-model", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(allowed, convey.ShouldBeFalse)
+		convey.So(transition.Changed(), convey.ShouldBeFalse)
+
+		// other channels are not affected
+		allowed, _, err = monitor.AllowRequest(ctx, "mem-model", 2)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(allowed, convey.ShouldBeTrue)
+	})
+}
+
+func TestRedisBreaker(t *testing.T) {
+	convey.Convey("TestRedisBreaker", t, func() {
+		enableAutoBan(t)
+		mr := miniredis.RunT(t)
+		common.RDB = redis.NewClient(&redis.Options{Addr: mr.Addr()})
+		common.RedisEnabled = true
+		t.Cleanup(func() {
+			common.RedisEnabled = false
+			_ = common.RDB.Close()
+		})
+		ctx := context.Background()
+		breakerKey := "model:redis-model:channel:1:breaker"
+		expire := func() {
+			mr.HSet(breakerKey, "open_until", strconv.FormatInt(time.Now().Add(-time.Second).UnixMilli(), 10))
+		}
+
+		_, transition, err := monitor.AddRequest(ctx, "redis-model", 1, true, true)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(transition.To, convey.ShouldEqual, monitor.BreakerStateOpen)
+
+		allowed, _, err := monitor.AllowRequest(ctx, "redis-model", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(allowed, convey.ShouldBeFalse)
+
+		// an expired breaker turns half-open and lets a limited number of probes through
+		expire()
+		allowed, transition, err = monitor.AllowRequest(ctx, "redis-model", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(allowed, convey.ShouldBeTrue)
+		convey.So(transition.From, convey.ShouldEqual, monitor.BreakerStateOpen)
+		convey.So(transition.To, convey.ShouldEqual, monitor.BreakerStateHalfOpen)
+		for range 2 {
+			allowed, _, err = monitor.AllowRequest(ctx, "redis-model", 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(allowed, convey.ShouldBeTrue)
+		}
+		allowed, _, err = monitor.AllowRequest(ctx, "redis-model", 1)
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(allowed, convey.ShouldBeFalse)
+
+		convey.Convey("a failed probe reopens the breaker for longer", func() {
+			_, transition, err := monitor.AddRequest(ctx, "redis-model", 1, true, false)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(transition.From, convey.ShouldEqual, monitor.BreakerStateHalfOpen)
+			convey.So(transition.To, convey.ShouldEqual, monitor.BreakerStateOpen)
+			convey.So(time.Until(transition.OpenUntil), convey.ShouldBeGreaterThan, time.Minute)
+
+			allowed, _, err := monitor.AllowRequest(ctx, "redis-model", 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(allowed, convey.ShouldBeFalse)
+		})
+
+		convey.Convey("successful probes close the breaker", func() {
+			for i := range 3 {
+				_, transition, err := monitor.AddRequest(ctx, "redis-model", 1, false, false)
+				convey.So(err, convey.ShouldBeNil)
+				if i < 2 {
+					convey.So(transition.To, convey.ShouldEqual, monitor.BreakerStateHalfOpen)
+				} else {
+					convey.So(transition.To, convey.ShouldEqual, monitor.BreakerStateClosed)
+				}
+			}
+
+			allowed, transition, err := monitor.AllowRequest(ctx, "redis-model", 1)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(allowed, convey.ShouldBeTrue)
+			convey.So(transition.To, convey.ShouldEqual, monitor.BreakerStateClosed)
+		})
+	})
+}
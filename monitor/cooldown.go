@@ -0,0 +1,124 @@
+package monitor
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labring/aiproxy/common"
+	"github.com/redis/go-redis/v9"
+)
+
+// a channel model in cooldown was rate limited by the upstream,
+// it is skipped until the upstream reset time without counting as an error
+const cooldownKeySuffix = ":cooldown"
+
+// MaxCooldown caps the cooldown an upstream can ask for
+const MaxCooldown = 10 * time.Minute
+
+func buildCooldownKey(model string) string {
+	return modelKeyPrefix + model + cooldownKeySuffix
+}
+
+var cooldownChannelScript = redis.NewScript(`
+local key = KEYS[1]
+local channel_id = ARGV[1]
+local until_ms = tonumber(ARGV[2])
+local now_ms = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now_ms)
+local current = tonumber(redis.call('ZSCORE', key, channel_id) or '0')
+if until_ms > current then
+	redis.call('ZADD', key, until_ms, channel_id)
+end
+local max_until = tonumber(redis.call('ZRANGE', key, -1, -1, 'WITHSCORES')[2] or until_ms)
+redis.call('PEXPIREAT', key, max_until)
+return redis.status_reply("ok")
+`)
+
+// CooldownChannel skips the channel model for the duration
+func CooldownChannel(ctx context.Context, model string, channelID int64, duration time.Duration) error {
+	if duration <= 0 {
+		return nil
+	}
+	duration = min(duration, MaxCooldown)
+	now := time.Now()
+	until := now.Add(duration)
+	if !common.RedisEnabled {
+		memCooldown.set(model, channelID, until)
+		return nil
+	}
+	return cooldownChannelScript.Run(
+		ctx,
+		common.RDB,
+		[]string{buildCooldownKey(model)},
+		channelID,
+		until.UnixMilli(),
+		now.UnixMilli(),
+	).Err()
+}
+
+// GetCooldownChannels returns the channels of the model in cooldown and when their cooldown ends
+func GetCooldownChannels(ctx context.Context, model string) (map[int64]time.Time, error) {
+	if !common.RedisEnabled {
+		return memCooldown.get(model), nil
+	}
+	result, err := common.RDB.ZRangeByScoreWithScores(ctx, buildCooldownKey(model), &redis.ZRangeBy{
+		Min: strconv.FormatInt(time.Now().UnixMilli(), 10),
+		Max: "+inf",
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+	channels := make(map[int64]time.Time, len(result))
+	for _, z := range result {
+		member, _ := z.Member.(string)
+		channelID, err := strconv.ParseInt(member, 10, 64)
+		if err != nil {
+			continue
+		}
+		channels[channelID] = time.UnixMilli(int64(z.Score))
+	}
+	return channels, nil
+}
+
+type memCooldownStore struct {
+	mu       sync.Mutex
+	channels map[string]map[int64]time.Time
+}
+
+var memCooldown = &memCooldownStore{
+	channels: make(map[string]map[int64]time.Time),
+}
+
+func (s *memCooldownStore) set(model string, channelID int64, until time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	channels, ok := s.channels[model]
+	if !ok {
+		channels = make(map[int64]time.Time)
+		s.channels[model] = channels
+	}
+	if until.After(channels[channelID]) {
+		channels[channelID] = until
+	}
+}
+
+func (s *memCooldownStore) get(model string) map[int64]time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	result := make(map[int64]time.Time)
+	for channelID, until := range s.channels[model] {
+		if !until.After(now) {
+			delete(s.channels[model], channelID)
+			continue
+		}
+		result[channelID] = until
+	}
+	if len(s.channels[model]) == 0 {
+		delete(s.channels, model)
+	}
+	return result
+}
@@ -17,7 +17,6 @@ func init() {
 const (
 	timeWindow      = 10 * time.Second
 	maxSliceCount   = 12
-	banDuration     = 5 * time.Minute
 	minRequestCount = 20
 	cleanupInterval = time.Minute
 )
@@ -34,7 +33,19 @@ type ModelData struct {
 
 type ChannelStats struct {
 	timeWindows *TimeWindowStats
+	state       BreakerState
+	openCount   int64
 	bannedUntil time.Time
+	probes      int64
+	probeAt     time.Time
+	successes   int64
+}
+
+func (c *ChannelStats) breakerState() BreakerState {
+	if c.state == "" {
+		return BreakerStateClosed
+	}
+	return c.state
 }
 
 type TimeWindowStats struct {
@@ -82,7 +93,9 @@ func (m *MemModelMonitor) cleanupExpiredData() {
 	for modelName, modelData := range m.models {
 		for channelID, channelStats := range modelData.channels {
 			hasValidSlices := channelStats.timeWindows.HasValidSlices()
-			if !hasValidSlices && !channelStats.bannedUntil.After(now) {
+			breakerExpired := channelStats.breakerState() == BreakerStateClosed ||
+				!channelStats.bannedUntil.Add(breakerMaxOpenDuration).After(now)
+			if !hasValidSlices && breakerExpired {
 				delete(modelData.channels, channelID)
 			}
 		}
@@ -94,7 +107,7 @@ func (m *MemModelMonitor) cleanupExpiredData() {
 	}
 }
 
-func (m *MemModelMonitor) AddRequest(model string, channelID int64, isError, tryBan bool) (beyondThreshold, banExecution bool) {
+func (m *MemModelMonitor) AddRequest(model string, channelID int64, isError, tryBan bool) (beyondThreshold bool, transition BreakerTransition) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
@@ -121,32 +134,130 @@ func (m *MemModelMonitor) AddRequest(model string, channelID int64, isError, try
 	modelData.totalStats.AddRequest(now, isError)
 	channel.timeWindows.AddRequest(now, isError)
 
-	return m.checkAndBan(now, channel, tryBan)
+	if !isError {
+		tryBan = false
+	}
+	return m.checkAndBan(now, channel, isError, tryBan)
+}
+
+func (m *MemModelMonitor) openBreaker(now time.Time, channel *ChannelStats, openCount int64) BreakerTransition {
+	from := channel.breakerState()
+	channel.state = BreakerStateOpen
+	channel.openCount = openCount
+	channel.bannedUntil = now.Add(breakerOpenDuration(openCount))
+	channel.probes = 0
+	channel.probeAt = time.Time{}
+	channel.successes = 0
+	return BreakerTransition{From: from, To: BreakerStateOpen, OpenUntil: channel.bannedUntil}
 }
 
-func (m *MemModelMonitor) checkAndBan(now time.Time, channel *ChannelStats, tryBan bool) (beyondThreshold, banExecution bool) {
+func (m *MemModelMonitor) checkAndBan(now time.Time, channel *ChannelStats, isError, tryBan bool) (beyondThreshold bool, transition BreakerTransition) {
+	state := channel.breakerState()
+	unchanged := BreakerTransition{From: state, To: state}
+
+	switch state {
+	case BreakerStateHalfOpen:
+		if isError {
+			return false, m.openBreaker(now, channel, channel.openCount+1)
+		}
+		channel.successes++
+		if channel.successes >= breakerHalfOpenProbes {
+			*channel = ChannelStats{timeWindows: NewTimeWindowStats()}
+			return false, BreakerTransition{From: state, To: BreakerStateClosed}
+		}
+		return false, unchanged
+	case BreakerStateOpen:
+		// results of requests sent before the breaker opened do not move it
+		return false, unchanged
+	}
+
 	canBan := config.GetEnableModelErrorAutoBan()
 	if tryBan && canBan {
-		if channel.bannedUntil.After(now) {
-			return false, false
-		}
-		channel.bannedUntil = now.Add(banDuration)
-		return false, true
+		return false, m.openBreaker(now, channel, 1)
 	}
 
 	req, err := channel.timeWindows.GetStats()
 	if req < minRequestCount {
-		return false, false
+		return false, unchanged
 	}
 
 	if float64(err)/float64(req) >= config.GetModelErrorAutoBanRate() {
-		if !canBan || channel.bannedUntil.After(now) {
-			return true, false
+		if !canBan {
+			return true, unchanged
 		}
-		channel.bannedUntil = now.Add(banDuration)
-		return false, true
+		return false, m.openBreaker(now, channel, 1)
+	}
+	return false, unchanged
+}
+
+func (m *MemModelMonitor) AllowRequest(model string, channelID int64) (bool, BreakerTransition) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	closed := BreakerTransition{From: BreakerStateClosed, To: BreakerStateClosed}
+	data, exists := m.models[model]
+	if !exists {
+		return true, closed
 	}
-	return false, false
+	channel, exists := data.channels[channelID]
+	if !exists {
+		return true, closed
+	}
+
+	now := time.Now()
+	from := channel.breakerState()
+	switch from {
+	case BreakerStateClosed:
+		return true, closed
+	case BreakerStateOpen:
+		if channel.bannedUntil.After(now) {
+			return false, BreakerTransition{From: from, To: from}
+		}
+		channel.state = BreakerStateHalfOpen
+		channel.probes = 0
+		channel.probeAt = time.Time{}
+		channel.successes = 0
+	}
+
+	transition := BreakerTransition{From: from, To: BreakerStateHalfOpen}
+	if channel.probes >= breakerHalfOpenProbes {
+		if now.Sub(channel.probeAt) < breakerProbeTimeout {
+			return false, transition
+		}
+		channel.probes = 0
+	}
+	channel.probes++
+	channel.probeAt = now
+	return true, transition
+}
+
+func (m *MemModelMonitor) GetAllBreakers(_ context.Context) ([]*Breaker, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	result := []*Breaker{}
+	for model, data := range m.models {
+		for channelID, channel := range data.channels {
+			state := channel.breakerState()
+			if state == BreakerStateClosed {
+				continue
+			}
+			if state == BreakerStateOpen && !channel.bannedUntil.After(now) {
+				state = BreakerStateHalfOpen
+			}
+			result = append(result, &Breaker{
+				Model:     model,
+				ChannelID: channelID,
+				State:     state,
+				OpenCount: channel.openCount,
+				OpenUntil: channel.bannedUntil.UnixMilli(),
+				Probes:    channel.probes,
+				Successes: channel.successes,
+			})
+		}
+	}
+	return result, nil
 }
 
 func getErrorRateFromStats(stats *TimeWindowStats) float64 {
@@ -74,11 +74,11 @@ func canBan() int {
 	return 0
 }
 
-// AddRequest adds a request record and checks if channel should be banned
-func AddRequest(ctx context.Context, model string, channelID int64, isError, tryBan bool) (beyondThreshold bool, banExecution bool, err error) {
+// AddRequest adds a request record and moves the channel model breaker according to the result
+func AddRequest(ctx context.Context, model string, channelID int64, isError, tryBan bool) (beyondThreshold bool, transition BreakerTransition, err error) {
 	if !common.RedisEnabled {
-		beyondThreshold, banExecution = memModelMonitor.AddRequest(model, channelID, isError, tryBan)
-		return beyondThreshold, banExecution, nil
+		beyondThreshold, transition = memModelMonitor.AddRequest(model, channelID, isError, tryBan)
+		return beyondThreshold, transition, nil
 	}
 
 	errorFlag := 0
@@ -89,7 +89,7 @@ func AddRequest(ctx context.Context, model string, channelID int64, isError, try
 	}
 
 	now := time.Now().UnixMilli()
-	val, err := addRequestScript.Run(
+	result, err := addRequestScript.Run(
 		ctx,
 		common.RDB,
 		[]string{model},
@@ -99,11 +99,19 @@ func AddRequest(ctx context.Context, model string, channelID int64, isError, try
 		config.GetModelErrorAutoBanRate(),
 		canBan(),
 		tryBan,
-	).Int64()
+		breakerBaseOpenDuration.Milliseconds(),
+		breakerMaxOpenDuration.Milliseconds(),
+		breakerHalfOpenProbes,
+	).Slice()
 	if err != nil {
-		return false, false, err
+		return false, BreakerTransition{}, err
 	}
-	return val == 3, val == 1, nil
+	transition, err = parseBreakerTransition(result)
+	if err != nil {
+		return false, BreakerTransition{}, err
+	}
+	beyond, _ := result[0].(int64)
+	return beyond == 1, transition, nil
 }
 
 func buildStatsKey(model string, channelID string) string {
@@ -363,13 +371,16 @@ local now_ts = tonumber(ARGV[3])
 local max_error_rate = tonumber(ARGV[4])
 local can_ban = tonumber(ARGV[5])
 local try_ban = tonumber(ARGV[6])
+local base_open_ms = tonumber(ARGV[7])
+local max_open_ms = tonumber(ARGV[8])
+local half_open_probes = tonumber(ARGV[9])
 
 local banned_key = "model:" .. model .. ":channel:" .. channel_id .. ":banned"
 local stats_key = "model:" .. model .. ":channel:" .. channel_id .. ":stats"
+local breaker_key = "model:" .. model .. ":channel:" .. channel_id .. ":breaker"
 local model_stats_key = "model:" .. model .. ":total_stats"
 local maxSliceCount = 12
 local statsExpiry = maxSliceCount * 10 * 1000
-local banExpiry = 5 * 60 * 1000
 local current_slice = math.floor(now_ts / 10 / 1000)
 
 local function parse_req_err(value)
@@ -407,33 +418,60 @@ end
 update_stats(stats_key)
 update_stats(model_stats_key)
 
+local function open_breaker(from, open_count)
+    local open_ms = base_open_ms
+    for i = 2, open_count do
+        if open_ms >= max_open_ms then break end
+        open_ms = open_ms * 2
+    end
+    if open_ms > max_open_ms then open_ms = max_open_ms end
+    local open_until = now_ts + open_ms
+    redis.call("HSET", breaker_key,
+        "state", "open",
+        "open_count", open_count,
+        "open_until", open_until,
+        "probes", 0,
+        "successes", 0,
+        "probe_at", 0)
+    redis.call("PEXPIRE", breaker_key, open_ms + max_open_ms)
+    redis.call("SET", banned_key, 1, "PX", open_ms)
+    return {0, from, "open", open_until}
+end
+
 local function check_channel_error()
-    local already_banned = redis.call("EXISTS", banned_key) == 1
+    local values = redis.call("HMGET", breaker_key, "state", "open_count")
+    local state = values[1] or "closed"
+    local open_count = tonumber(values[2]) or 0
+
+    if state == "half_open" then
+        if is_error == 1 then
+            return open_breaker(state, open_count + 1)
+        end
+        local successes = redis.call("HINCRBY", breaker_key, "successes", 1)
+        if successes >= half_open_probes then
+            redis.call("DEL", breaker_key, banned_key, stats_key)
+            return {0, state, "closed", 0}
+        end
+        return {0, state, state, 0}
+    end
+
+    -- results of requests sent before the breaker opened do not move it
+    if state == "open" then
+        return {0, state, state, 0}
+    end
 
 	if try_ban == 1 and can_ban == 1 then
-		if already_banned then
-			return 2
-		end
-		redis.call("SET", banned_key, 1)
-		redis.call("PEXPIRE", banned_key, banExpiry)
-		return 1
+		return open_breaker(state, 1)
 	end
 
 	local total_req, total_err = get_clean_req_err(stats_key)
-	if total_req < 20 then
-		return 0
+	if total_req < 20 or (total_err / total_req) < max_error_rate then
+		return {0, state, state, 0}
 	end
-
-	if (total_err / total_req) < max_error_rate then
-		return 0
-	else
-		if can_ban == 0 or already_banned then
-			return 3
-		end
-		redis.call("SET", banned_key, 1)
-		redis.call("PEXPIRE", banned_key, banExpiry)
-		return 1
+	if can_ban == 0 then
+		return {1, state, state, 0}
 	end
+	return open_breaker(state, 1)
 end
 
 return check_channel_error()
@@ -479,8 +517,11 @@ local channel_id = ARGV[1]
 local stats_key = "model:" .. model .. ":channel:" .. channel_id .. ":stats"
 local banned_key = "model:" .. model .. ":channel:" .. channel_id .. ":banned"
 
+local breaker_key = "model:" .. model .. ":channel:" .. channel_id .. ":breaker"
+
 redis.call("DEL", stats_key)
 redis.call("DEL", banned_key)
+redis.call("DEL", breaker_key)
 return redis.status_reply("ok")
 `
 
@@ -493,9 +534,11 @@ end
 local channel_id = ARGV[1]
 local stats_pattern = "model:*:channel:" .. channel_id .. ":stats"
 local banned_pattern = "model:*:channel:" .. channel_id .. ":banned"
+local breaker_pattern = "model:*:channel:" .. channel_id .. ":breaker"
 
 del_keys(stats_pattern)
 del_keys(banned_pattern)
+del_keys(breaker_pattern)
 
 return redis.status_reply("ok")
 `
@@ -508,6 +551,7 @@ end
 
 del_keys("model:*:channel:*:stats")
 del_keys("model:*:channel:*:banned")
+del_keys("model:*:channel:*:breaker")
 
 return redis.status_reply("ok")
 `
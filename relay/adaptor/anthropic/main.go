@@ -332,9 +332,20 @@ func Response2OpenAI(meta *meta.Meta, claudeResponse *Response) *model.TextRespo
 		},
 	}
 	fullTextResponse.Usage.TotalTokens = fullTextResponse.Usage.PromptTokens + fullTextResponse.Usage.CompletionTokens
+	fullTextResponse.Usage.CompletionTokensDetails = reasoningTokensDetails(thinking, fullTextResponse.Usage.CompletionTokens, meta.ActualModel)
 	return &fullTextResponse
 }
 
+// reasoningTokensDetails estimates the thinking tokens, they are billed as output tokens without a separate count
+func reasoningTokensDetails(thinking string, completionTokens int, modelName string) *model.CompletionTokensDetails {
+	if thinking == "" {
+		return nil
+	}
+	return &model.CompletionTokensDetails{
+		ReasoningTokens: min(openai.CountTokenText(thinking, modelName), completionTokens),
+	}
+}
+
 func StreamHandler(m *meta.Meta, c *gin.Context, resp *http.Response) (*model.Usage, *model.ErrorWithStatusCode) {
 	if resp.StatusCode != http.StatusOK {
 		return nil, ErrorHandler(resp)
@@ -363,6 +374,8 @@ func StreamHandler(m *meta.Meta, c *gin.Context, resp *http.Response) (*model.Us
 	var usage model.Usage
 	var lastToolCallChoice *model.ChatCompletionsStreamResponseChoice
 	var usageWrited bool
+	var tracker openai.StreamTracker
+	var thinking strings.Builder
 
 	for scanner.Scan() {
 		data := scanner.Bytes()
@@ -372,6 +385,7 @@ func StreamHandler(m *meta.Meta, c *gin.Context, resp *http.Response) (*model.Us
 		data = data[6:]
 
 		if conv.BytesToString(data) == "[DONE]" {
+			tracker.Finish()
 			break
 		}
 
@@ -386,7 +400,11 @@ func StreamHandler(m *meta.Meta, c *gin.Context, resp *http.Response) (*model.Us
 		if response == nil {
 			continue
 		}
+		for _, choice := range response.Choices {
+			thinking.WriteString(choice.Delta.ReasoningContent)
+		}
 		if response.Usage != nil {
+			response.Usage.CompletionTokensDetails = reasoningTokensDetails(thinking.String(), response.Usage.CompletionTokens, m.ActualModel)
 			usage = *response.Usage
 			usageWrited = true
 
@@ -400,6 +418,7 @@ func StreamHandler(m *meta.Meta, c *gin.Context, resp *http.Response) (*model.Us
 			}
 		}
 
+		tracker.AddChoices(response.Choices)
 		for _, choice := range response.Choices {
 			if len(choice.Delta.ToolCalls) > 0 {
 				lastToolCallChoice = choice
@@ -408,8 +427,14 @@ func StreamHandler(m *meta.Meta, c *gin.Context, resp *http.Response) (*model.Us
 		_ = render.ObjectData(c, response)
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Error("error reading stream: " + err.Error())
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		log.Error("error reading stream: " + scanErr.Error())
+	}
+
+	interruptedErr := tracker.Interrupted(m, scanErr)
+	if interruptedErr != nil && usage.CompletionTokens == 0 {
+		usage.CompletionTokens = openai.CountTokenText(m.GetString(openai.MetaStreamPartialText), m.ActualModel)
 	}
 
 	if usage.CompletionTokens == 0 && usage.PromptTokens == 0 {
@@ -418,6 +443,10 @@ func StreamHandler(m *meta.Meta, c *gin.Context, resp *http.Response) (*model.Us
 
 	usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
 
+	if interruptedErr != nil {
+		return &usage, interruptedErr
+	}
+
 	if !usageWrited {
 		_ = render.ObjectData(c, &model.ChatCompletionsStreamResponse{
 			ID:      openai.ChatCompletionID(),
@@ -350,6 +350,7 @@ func handleParsePdfResponse(meta *meta.Meta, c *gin.Context, response *StatusRes
 	return &model.Usage{
 		PromptTokens: pages,
 		TotalTokens:  pages,
+		Units:        pages,
 	}, nil
 }
 
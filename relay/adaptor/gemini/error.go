@@ -0,0 +1,52 @@
+package gemini
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/relay/adaptor/openai"
+	"github.com/labring/aiproxy/relay/model"
+)
+
+const retryInfoType = "type.googleapis.com/google.rpc.RetryInfo"
+
+type errorResponse struct {
+	Error struct {
+		Details []struct {
+			Type       string `json:"@type"`
+			RetryDelay string `json:"retryDelay"`
+		} `json:"details"`
+	} `json:"error"`
+}
+
+// status 429 {"error":{"code":429,"status":"RESOURCE_EXHAUSTED","details":[{"@type":"type.googleapis.com/google.rpc.RetryInfo","retryDelay":"30s"}]}}
+func ErrorHandler(resp *http.Response) *model.ErrorWithStatusCode {
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return openai.ErrorWrapperWithMessage("read response body error: "+err.Error(), nil, http.StatusInternalServerError)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+	relayErr := openai.ErrorHanlder(resp)
+	if relayErr.RetryAfter > 0 || resp.StatusCode != http.StatusTooManyRequests {
+		return relayErr
+	}
+
+	var errResponse errorResponse
+	if err := sonic.Unmarshal(respBody, &errResponse); err != nil {
+		return relayErr
+	}
+	for _, detail := range errResponse.Error.Details {
+		if detail.Type != retryInfoType {
+			continue
+		}
+		if delay, err := time.ParseDuration(detail.RetryDelay); err == nil {
+			relayErr.RetryAfter = delay
+		}
+	}
+	return relayErr
+}
@@ -282,9 +282,52 @@ type ChatResponse struct {
 }
 
 type UsageMetadata struct {
-	PromptTokenCount     int `json:"promptTokenCount"`
-	CandidatesTokenCount int `json:"candidatesTokenCount"`
-	TotalTokenCount      int `json:"totalTokenCount"`
+	PromptTokensDetails     []ModalityTokenCount `json:"promptTokensDetails"`
+	CandidatesTokensDetails []ModalityTokenCount `json:"candidatesTokensDetails"`
+	PromptTokenCount        int                  `json:"promptTokenCount"`
+	CandidatesTokenCount    int                  `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int                  `json:"thoughtsTokenCount"`
+	TotalTokenCount         int                  `json:"totalTokenCount"`
+}
+
+type ModalityTokenCount struct {
+	Modality   string `json:"modality"`
+	TokenCount int    `json:"tokenCount"`
+}
+
+func modalityTokenCount(details []ModalityTokenCount, modality string) int {
+	var count int
+	for _, detail := range details {
+		if detail.Modality == modality {
+			count += detail.TokenCount
+		}
+	}
+	return count
+}
+
+// ToUsage converts the usage metadata, the thoughts tokens are billed as reasoning completion tokens
+func (u *UsageMetadata) ToUsage() model.Usage {
+	usage := model.Usage{
+		PromptTokens:     u.PromptTokenCount,
+		CompletionTokens: u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		TotalTokens:      u.TotalTokenCount,
+	}
+	audioInputTokens := modalityTokenCount(u.PromptTokensDetails, "AUDIO")
+	imageInputTokens := modalityTokenCount(u.PromptTokensDetails, "IMAGE")
+	if audioInputTokens > 0 || imageInputTokens > 0 {
+		usage.PromptTokensDetails = &model.PromptTokensDetails{
+			AudioTokens: audioInputTokens,
+			ImageTokens: imageInputTokens,
+		}
+	}
+	audioOutputTokens := modalityTokenCount(u.CandidatesTokensDetails, "AUDIO")
+	if u.ThoughtsTokenCount > 0 || audioOutputTokens > 0 {
+		usage.CompletionTokensDetails = &model.CompletionTokensDetails{
+			ReasoningTokens: u.ThoughtsTokenCount,
+			AudioTokens:     audioOutputTokens,
+		}
+	}
+	return usage
 }
 
 func (g *ChatResponse) GetResponseText() string {
@@ -347,11 +390,7 @@ func responseChat2OpenAI(meta *meta.Meta, response *ChatResponse) *model.TextRes
 		Choices: make([]*model.TextResponseChoice, 0, len(response.Candidates)),
 	}
 	if response.UsageMetadata != nil {
-		fullTextResponse.Usage = model.Usage{
-			PromptTokens:     response.UsageMetadata.PromptTokenCount,
-			CompletionTokens: response.UsageMetadata.CandidatesTokenCount,
-			TotalTokens:      response.UsageMetadata.TotalTokenCount,
-		}
+		fullTextResponse.Usage = response.UsageMetadata.ToUsage()
 	}
 	for i, candidate := range response.Candidates {
 		choice := model.TextResponseChoice{
@@ -421,11 +460,8 @@ func streamResponseChat2OpenAI(meta *meta.Meta, geminiResponse *ChatResponse) *m
 		Choices: make([]*model.ChatCompletionsStreamResponseChoice, 0, len(geminiResponse.Candidates)),
 	}
 	if geminiResponse.UsageMetadata != nil {
-		response.Usage = &model.Usage{
-			PromptTokens:     geminiResponse.UsageMetadata.PromptTokenCount,
-			CompletionTokens: geminiResponse.UsageMetadata.CandidatesTokenCount,
-			TotalTokens:      geminiResponse.UsageMetadata.TotalTokenCount,
-		}
+		usage := geminiResponse.UsageMetadata.ToUsage()
+		response.Usage = &usage
 	}
 	for i, candidate := range geminiResponse.Candidates {
 		choice := model.ChatCompletionsStreamResponseChoice{
@@ -489,7 +525,7 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response) (*model
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, openai.ErrorHanlder(resp)
+		return nil, ErrorHandler(resp)
 	}
 
 	log := middleware.GetLogger(c)
@@ -506,6 +542,7 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response) (*model
 	usage := model.Usage{
 		PromptTokens: meta.InputTokens,
 	}
+	var tracker openai.StreamTracker
 
 	for scanner.Scan() {
 		data := scanner.Bytes()
@@ -515,6 +552,7 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response) (*model
 		data = data[6:]
 
 		if conv.BytesToString(data) == "[DONE]" {
+			tracker.Finish()
 			break
 		}
 
@@ -530,12 +568,21 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response) (*model
 		}
 
 		responseText.WriteString(response.Choices[0].Delta.StringContent())
+		tracker.AddChoices(response.Choices)
 
 		_ = render.ObjectData(c, response)
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Error("error reading stream: " + err.Error())
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		log.Error("error reading stream: " + scanErr.Error())
+	}
+
+	if interruptedErr := tracker.Interrupted(meta, scanErr); interruptedErr != nil {
+		if usage.CompletionTokens == 0 {
+			usage = *openai.ResponseText2Usage(responseText.String(), meta.ActualModel, meta.InputTokens)
+		}
+		return &usage, interruptedErr
 	}
 
 	render.Done(c)
@@ -545,7 +592,7 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response) (*model
 
 func Handler(meta *meta.Meta, c *gin.Context, resp *http.Response) (*model.Usage, *model.ErrorWithStatusCode) {
 	if resp.StatusCode != http.StatusOK {
-		return nil, openai.ErrorHanlder(resp)
+		return nil, ErrorHandler(resp)
 	}
 
 	defer resp.Body.Close()
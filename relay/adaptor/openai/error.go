@@ -10,6 +10,7 @@ import (
 	"github.com/labring/aiproxy/common/conv"
 	"github.com/labring/aiproxy/middleware"
 	"github.com/labring/aiproxy/relay/model"
+	"github.com/labring/aiproxy/relay/utils"
 )
 
 type GeneralErrorResponse struct {
@@ -81,6 +82,7 @@ func ErrorHanlder(resp *http.Response) *model.ErrorWithStatusCode {
 			Code:  ErrorCodeBadResponse,
 			Param: strconv.Itoa(resp.StatusCode),
 		},
+		RetryAfter: utils.RetryAfter(resp),
 	}
 
 	var errResponse GeneralErrorResponse
@@ -64,6 +64,7 @@ func ImageHandler(meta *meta.Meta, c *gin.Context, resp *http.Response) (*model.
 	usage := &model.Usage{
 		PromptTokens: len(imageResponse.Data),
 		TotalTokens:  len(imageResponse.Data),
+		Units:        len(imageResponse.Data),
 	}
 
 	if responseFormat == "b64_json" {
@@ -106,6 +106,7 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response, preHand
 	scanner.Buffer(*buf, cap(*buf))
 
 	var usage *model.Usage
+	var tracker StreamTracker
 
 	common.SetEventStreamHeaders(c)
 
@@ -125,6 +126,7 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response, preHand
 		}
 		data = bytes.TrimSpace(data[DataPrefixLength:])
 		if slices.Equal(data, DoneBytes) {
+			tracker.Finish()
 			break
 		}
 
@@ -148,7 +150,9 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response, preHand
 		if u != nil {
 			usage = u
 			responseText.Reset()
+			tracker.Finish()
 		}
+		tracker.AddChoices(ch)
 		for _, choice := range ch {
 			if usage == nil {
 				if choice.Text != "" {
@@ -182,11 +186,15 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response, preHand
 		_ = render.ObjectData(c, &node)
 	}
 
-	if err := scanner.Err(); err != nil {
-		log.Error("error reading stream: " + err.Error())
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		log.Error("error reading stream: " + scanErr.Error())
 	}
 
-	render.Done(c)
+	interruptedErr := tracker.Interrupted(meta, scanErr)
+	if interruptedErr == nil {
+		render.Done(c)
+	}
 
 	if usage == nil || (usage.TotalTokens == 0 && responseText.Len() > 0) {
 		usage = ResponseText2Usage(responseText.String(), meta.ActualModel, meta.InputTokens)
@@ -197,7 +205,7 @@ func StreamHandler(meta *meta.Meta, c *gin.Context, resp *http.Response, preHand
 		usage.CompletionTokens = usage.TotalTokens - meta.InputTokens
 	}
 
-	return usage, nil
+	return usage, interruptedErr
 }
 
 // renderCallback maybe reuse data, so don't modify data
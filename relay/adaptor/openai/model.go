@@ -1,12 +1,27 @@
 package openai
 
 type SubscriptionResponse struct {
-	Object             string  `json:"object"`
-	HasPaymentMethod   bool    `json:"has_payment_method"`
-	SoftLimitUSD       float64 `json:"soft_limit_usd"`
-	HardLimitUSD       float64 `json:"hard_limit_usd"`
-	SystemHardLimitUSD float64 `json:"system_hard_limit_usd"`
-	AccessUntil        int64   `json:"access_until"`
+	Object             string                      `json:"object"`
+	HasPaymentMethod   bool                        `json:"has_payment_method"`
+	SoftLimitUSD       float64                     `json:"soft_limit_usd"`
+	HardLimitUSD       float64                     `json:"hard_limit_usd"`
+	SystemHardLimitUSD float64                     `json:"system_hard_limit_usd"`
+	AccessUntil        int64                       `json:"access_until"`
+	PeriodicQuotas     []SubscriptionPeriodicQuota `json:"periodic_quotas,omitempty"`
+}
+
+// SubscriptionPeriodicQuota is the budget of a daily, weekly or monthly quota of the token or the group
+// in the current period, the remaining amount and tokens are -1 when they are not limited
+type SubscriptionPeriodicQuota struct {
+	Scope           string  `json:"scope"`
+	Period          string  `json:"period"`
+	ResetAt         int64   `json:"reset_at"`
+	AmountUSD       float64 `json:"amount_usd,omitempty"`
+	UsedAmountUSD   float64 `json:"used_amount_usd"`
+	RemainingUSD    float64 `json:"remaining_usd"`
+	Tokens          int64   `json:"tokens,omitempty"`
+	UsedTokens      int64   `json:"used_tokens"`
+	RemainingTokens int64   `json:"remaining_tokens"`
 }
 
 type UsageResponse struct {
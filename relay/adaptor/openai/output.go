@@ -0,0 +1,62 @@
+package openai
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/labring/aiproxy/relay/model"
+)
+
+// ExtractOutputText returns the assistant text of a chat or completions response, streamed or not,
+// other responses have no text to compare
+func ExtractOutputText(body string) string {
+	trimmed := strings.TrimSpace(body)
+	if strings.HasPrefix(trimmed, DataPrefix) {
+		return extractStreamOutputText(trimmed)
+	}
+
+	var response model.TextResponse
+	if err := sonic.UnmarshalString(trimmed, &response); err != nil {
+		return ""
+	}
+	var text strings.Builder
+	for _, choice := range response.Choices {
+		if choice.Text != "" {
+			text.WriteString(choice.Text)
+		} else {
+			text.WriteString(choice.Message.StringContent())
+		}
+	}
+	return text.String()
+}
+
+func extractStreamOutputText(body string) string {
+	var text strings.Builder
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	buf := GetScannerBuffer()
+	defer PutScannerBuffer(buf)
+	scanner.Buffer(*buf, cap(*buf))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, DataPrefix) {
+			continue
+		}
+		data := strings.TrimSpace(line[DataPrefixLength:])
+		if data == Done {
+			break
+		}
+		var response model.ChatCompletionsStreamResponse
+		if err := sonic.UnmarshalString(data, &response); err != nil {
+			continue
+		}
+		for _, choice := range response.Choices {
+			if choice.Text != "" {
+				text.WriteString(choice.Text)
+			} else {
+				text.WriteString(choice.Delta.StringContent())
+			}
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,38 @@
+package openai_test
+
+import (
+	"testing"
+
+	"github.com/labring/aiproxy/relay/adaptor/openai"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestExtractOutputText(t *testing.T) {
+	convey.Convey("TestExtractOutputText", t, func() {
+		convey.Convey("chat completions", func() {
+			body := `{"id":"1","object":"chat.completion","choices":[{"index":0,"message":{"role":"assistant","content":"hello world"},"finish_reason":"stop"}]}`
+			convey.So(openai.ExtractOutputText(body), convey.ShouldEqual, "hello world")
+		})
+
+		convey.Convey("completions", func() {
+			body := `{"id":"1","object":"text_completion","choices":[{"index":0,"text":"hello"},{"index":1,"text":" again"}]}`
+			convey.So(openai.ExtractOutputText(body), convey.ShouldEqual, "hello again")
+		})
+
+		convey.Convey("streamed chat completions", func() {
+			body := "data: {\"choices\":[{\"index\":0,\"delta\":{\"role\":\"assistant\",\"content\":\"hel\"}}]}\n\n" +
+				": keep-alive\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"lo\"}}]}\n\n" +
+				"data: not json\n\n" +
+				"data: [DONE]\n\n" +
+				"data: {\"choices\":[{\"index\":0,\"delta\":{\"content\":\"ignored\"}}]}\n\n"
+			convey.So(openai.ExtractOutputText(body), convey.ShouldEqual, "hello")
+		})
+
+		convey.Convey("responses without text", func() {
+			convey.So(openai.ExtractOutputText(""), convey.ShouldEqual, "")
+			convey.So(openai.ExtractOutputText("not json"), convey.ShouldEqual, "")
+			convey.So(openai.ExtractOutputText(`{"object":"list","data":[{"embedding":[0.1]}]}`), convey.ShouldEqual, "")
+		})
+	})
+}
@@ -0,0 +1,104 @@
+package openai
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/bytedance/sonic"
+	"github.com/bytedance/sonic/ast"
+	"github.com/labring/aiproxy/relay/meta"
+	"github.com/labring/aiproxy/relay/model"
+)
+
+const (
+	// MetaStreamFailover enables reporting an abnormally terminated stream as an error
+	// so that the relay can continue it on another channel
+	MetaStreamFailover = "stream_failover"
+	// MetaStreamPartialText is the assistant output rendered before the stream was interrupted
+	MetaStreamPartialText = "stream_partial_text"
+)
+
+const ErrorCodeStreamInterrupted = "stream_interrupted"
+
+// StreamTracker records the assistant output of a chat stream and whether it finished normally
+type StreamTracker struct {
+	text     strings.Builder
+	finished bool
+}
+
+func (t *StreamTracker) AddChoices(choices []*model.ChatCompletionsStreamResponseChoice) {
+	for _, choice := range choices {
+		if choice.Text != "" {
+			t.text.WriteString(choice.Text)
+		} else {
+			t.text.WriteString(choice.Delta.StringContent())
+		}
+		if choice.FinishReason != nil && *choice.FinishReason != "" {
+			t.finished = true
+		}
+	}
+}
+
+// Finish marks the stream as finished, e.g. when [DONE] or the usage chunk is received
+func (t *StreamTracker) Finish() {
+	t.finished = true
+}
+
+// Interrupted returns a stream interrupted error when failover is enabled
+// and the stream ended without a finish reason or with a read error,
+// the partial text is saved to the meta for the continuation
+func (t *StreamTracker) Interrupted(m *meta.Meta, scanErr error) *model.ErrorWithStatusCode {
+	if !m.GetBool(MetaStreamFailover) {
+		return nil
+	}
+	if t.finished && scanErr == nil {
+		return nil
+	}
+	// the upstream request was canceled because the client is gone, there is nothing to continue
+	if errors.Is(scanErr, context.Canceled) {
+		return nil
+	}
+	m.Set(MetaStreamPartialText, t.text.String())
+	if scanErr == nil {
+		scanErr = errors.New("stream ended without a finish reason")
+	}
+	return ErrorWrapperWithMessage(
+		"upstream stream interrupted: "+scanErr.Error(),
+		ErrorCodeStreamInterrupted,
+		http.StatusBadGateway,
+	)
+}
+
+func IsStreamInterrupted(err *model.ErrorWithStatusCode) bool {
+	if err == nil {
+		return false
+	}
+	code, ok := err.Error.Code.(string)
+	return ok && code == ErrorCodeStreamInterrupted
+}
+
+// ContinuationRequestBody appends the partial output of an interrupted stream to the chat request
+// as an assistant prefill, so the next channel continues where the stream stopped
+func ContinuationRequestBody(body []byte, partialText string) ([]byte, error) {
+	if partialText == "" {
+		return body, nil
+	}
+	node, err := sonic.Get(body)
+	if err != nil {
+		return nil, err
+	}
+	messages := node.Get("messages")
+	if !messages.Exists() {
+		return nil, errors.New("messages not found")
+	}
+	err = messages.Add(ast.NewAny(model.Message{
+		Role:    "assistant",
+		Content: partialText,
+	}))
+	if err != nil {
+		return nil, err
+	}
+	return node.MarshalJSON()
+}
@@ -0,0 +1,141 @@
+package openai_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bytedance/sonic"
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/adaptor/openai"
+	"github.com/labring/aiproxy/relay/meta"
+	"github.com/labring/aiproxy/relay/mode"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+// errReader returns the body and then fails like a broken upstream connection
+type errReader struct {
+	body io.Reader
+	err  error
+}
+
+func (r *errReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if errors.Is(err, io.EOF) {
+		return n, r.err
+	}
+	return n, err
+}
+
+func streamChunk(content string, finishReason string) string {
+	finish := "null"
+	if finishReason != "" {
+		finish = `"` + finishReason + `"`
+	}
+	return `data: {"id":"1","object":"chat.completion.chunk","choices":[{"index":0,"delta":{"content":"` + content + `"},"finish_reason":` + finish + "}]}\n\n"
+}
+
+func handleStream(failover bool, body io.Reader) (*meta.Meta, *httptest.ResponseRecorder, *relaymodel.ErrorWithStatusCode) {
+	m := meta.NewMeta(
+		&model.Channel{ID: 1, Name: "c1"},
+		mode.ChatCompletions,
+		"gpt-4o",
+		&model.ModelConfig{Model: "gpt-4o"},
+		meta.WithInputTokens(10),
+	)
+	if failover {
+		m.Set(openai.MetaStreamFailover, true)
+	}
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	resp := &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(body)}
+	_, err := openai.StreamHandler(m, c, resp, nil)
+	return m, w, err
+}
+
+func TestStreamTrackerInterrupted(t *testing.T) {
+	convey.Convey("TestStreamTrackerInterrupted", t, func() {
+		convey.Convey("a finished stream is ended normally", func() {
+			body := streamChunk("hello", "") + streamChunk(" world", "stop") + "data: [DONE]\n\n"
+			m, w, err := handleStream(true, strings.NewReader(body))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(w.Body.String(), convey.ShouldContainSubstring, "[DONE]")
+			convey.So(m.GetString(openai.MetaStreamPartialText), convey.ShouldBeEmpty)
+		})
+
+		convey.Convey("a stream ended without a finish reason is interrupted", func() {
+			body := streamChunk("hello", "") + streamChunk(" wor", "")
+			m, w, err := handleStream(true, strings.NewReader(body))
+			convey.So(openai.IsStreamInterrupted(err), convey.ShouldBeTrue)
+			convey.So(err.StatusCode, convey.ShouldEqual, http.StatusBadGateway)
+			// the output is kept for the continuation and the client stream is left open for it
+			convey.So(m.GetString(openai.MetaStreamPartialText), convey.ShouldEqual, "hello wor")
+			convey.So(w.Body.String(), convey.ShouldContainSubstring, "hello")
+			convey.So(w.Body.String(), convey.ShouldNotContainSubstring, "[DONE]")
+		})
+
+		convey.Convey("a broken upstream connection is interrupted", func() {
+			body := &errReader{body: strings.NewReader(streamChunk("hello", "")), err: io.ErrUnexpectedEOF}
+			m, _, err := handleStream(true, body)
+			convey.So(openai.IsStreamInterrupted(err), convey.ShouldBeTrue)
+			convey.So(err.Error.Message, convey.ShouldContainSubstring, io.ErrUnexpectedEOF.Error())
+			convey.So(m.GetString(openai.MetaStreamPartialText), convey.ShouldEqual, "hello")
+		})
+
+		convey.Convey("a stream canceled because the client is gone is not continued", func() {
+			body := &errReader{body: strings.NewReader(streamChunk("hello", "")), err: context.Canceled}
+			_, _, err := handleStream(true, body)
+			convey.So(err, convey.ShouldBeNil)
+		})
+
+		convey.Convey("without failover a broken stream just ends", func() {
+			_, w, err := handleStream(false, strings.NewReader(streamChunk("hello", "")))
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(w.Body.String(), convey.ShouldContainSubstring, "[DONE]")
+		})
+
+		convey.Convey("the usage chunk finishes the stream", func() {
+			body := streamChunk("hello", "") + `data: {"id":"1","choices":[],"usage":{"prompt_tokens":10,"completion_tokens":1,"total_tokens":11}}` + "\n\n"
+			_, _, err := handleStream(true, strings.NewReader(body))
+			convey.So(err, convey.ShouldBeNil)
+		})
+
+		convey.So(openai.IsStreamInterrupted(nil), convey.ShouldBeFalse)
+		convey.So(openai.IsStreamInterrupted(openai.ErrorWrapperWithMessage("bad", "bad_request", http.StatusBadRequest)), convey.ShouldBeFalse)
+	})
+}
+
+func TestContinuationRequestBody(t *testing.T) {
+	convey.Convey("TestContinuationRequestBody", t, func() {
+		body := []byte(`{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"say hello world"}]}`)
+
+		// the output received by the client is appended as an assistant prefill
+		continuation, err := openai.ContinuationRequestBody(body, "hello wor")
+		convey.So(err, convey.ShouldBeNil)
+		var request relaymodel.GeneralOpenAIRequest
+		convey.So(sonic.Unmarshal(continuation, &request), convey.ShouldBeNil)
+		convey.So(request.Model, convey.ShouldEqual, "gpt-4o")
+		convey.So(request.Stream, convey.ShouldBeTrue)
+		convey.So(request.Messages, convey.ShouldHaveLength, 2)
+		convey.So(request.Messages[0].StringContent(), convey.ShouldEqual, "say hello world")
+		convey.So(request.Messages[1].Role, convey.ShouldEqual, "assistant")
+		convey.So(request.Messages[1].StringContent(), convey.ShouldEqual, "hello wor")
+
+		// nothing was sent yet, the request is replayed as is
+		continuation, err = openai.ContinuationRequestBody(body, "")
+		convey.So(err, convey.ShouldBeNil)
+		convey.So(string(continuation), convey.ShouldEqual, string(body))
+
+		_, err = openai.ContinuationRequestBody([]byte(`{"model":"gpt-4o","prompt":"hi"}`), "hello")
+		convey.So(err, convey.ShouldNotBeNil)
+		_, err = openai.ContinuationRequestBody([]byte(`not json`), "hello")
+		convey.So(err, convey.ShouldNotBeNil)
+	})
+}
@@ -19,5 +19,6 @@ func GetChatRequestUsage(c *gin.Context, _ *model.ModelConfig) (model.Usage, err
 
 	return model.Usage{
 		InputTokens: openai.CountTokenMessages(textRequest.Messages, textRequest.Model),
+		Units:       1,
 	}, nil
 }
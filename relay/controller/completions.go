@@ -19,5 +19,6 @@ func GetCompletionsRequestUsage(c *gin.Context, _ *model.ModelConfig) (model.Usa
 
 	return model.Usage{
 		InputTokens: openai.CountTokenInput(textRequest.Prompt, textRequest.Model),
+		Units:       1,
 	}, nil
 }
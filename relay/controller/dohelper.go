@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -20,6 +21,7 @@ import (
 	"github.com/labring/aiproxy/relay/meta"
 	"github.com/labring/aiproxy/relay/mode"
 	relaymodel "github.com/labring/aiproxy/relay/model"
+	"github.com/labring/aiproxy/relay/utils"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -28,6 +30,9 @@ const (
 	maxBufferSize = 512 * 1024
 )
 
+// MetaUpstreamCanceled is set when the upstream request was canceled because the client disconnected
+const MetaUpstreamCanceled = "upstream_canceled"
+
 type responseWriter struct {
 	gin.ResponseWriter
 	body *bytes.Buffer
@@ -85,9 +90,15 @@ func DoHelper(
 		return relaymodel.Usage{}, nil, err
 	}
 
+	upstream := newUpstreamContext(c, meta)
+	defer upstream.release()
+
 	// 2. Convert and prepare request
-	resp, err := prepareAndDoRequest(a, c, meta)
+	resp, err := prepareAndDoRequest(upstream, a, c, meta)
 	if err != nil {
+		if upstream.canceledByClient() {
+			return canceledUsage(meta), &detail, err
+		}
 		return relaymodel.Usage{}, &detail, err
 	}
 
@@ -103,10 +114,21 @@ func DoHelper(
 	// 4. Handle success response
 	usage, relayErr := handleResponse(a, c, meta, resp, &detail)
 	if relayErr != nil {
+		// the interrupted part of a stream has been sent to the client, so it is billed
+		if openai.IsStreamInterrupted(relayErr) {
+			updateUsageMetrics(usage, middleware.GetLogger(c))
+			return usage, &detail, relayErr
+		}
+		if upstream.canceledByClient() {
+			return canceledUsage(meta), &detail, relayErr
+		}
 		return relaymodel.Usage{}, &detail, relayErr
 	}
 
 	// 5. Update usage metrics
+	if usage.Units == 0 {
+		usage.Units = meta.RequestUnits
+	}
 	updateUsageMetrics(usage, middleware.GetLogger(c))
 
 	return usage, &detail, nil
@@ -126,7 +148,78 @@ func getRequestBody(meta *meta.Meta, c *gin.Context, detail *model.RequestDetail
 	}
 }
 
-func prepareAndDoRequest(a adaptor.Adaptor, c *gin.Context, meta *meta.Meta) (*http.Response, *relaymodel.ErrorWithStatusCode) {
+// upstreamContext bounds the upstream request by the timeout of the mode,
+// it is not canceled by the client by default, so that the usage of non-streaming requests
+// can still be recorded, the client disconnect policy of the mode may cancel it once the client is gone
+type upstreamContext struct {
+	context.Context
+	meta     *meta.Meta
+	cancel   context.CancelFunc
+	stop     func() bool
+	canceled atomic.Bool
+}
+
+func newUpstreamContext(c *gin.Context, meta *meta.Meta) *upstreamContext {
+	ctx, cancel := context.WithCancel(context.Background())
+	u := &upstreamContext{
+		meta:   meta,
+		cancel: cancel,
+		stop:   func() bool { return false },
+	}
+	if timeout := config.GetTimeoutWithModelType()[int(meta.Mode)]; timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+		u.cancel = func() {
+			cancelTimeout()
+			cancel()
+		}
+	}
+	u.Context = ctx
+	if cancelOnClientDisconnect(c, meta) {
+		u.stop = context.AfterFunc(c.Request.Context(), func() {
+			u.canceled.Store(true)
+			cancel()
+		})
+	}
+	return u
+}
+
+func cancelOnClientDisconnect(c *gin.Context, meta *meta.Meta) bool {
+	switch model.GetClientDisconnectPolicy(int(meta.Mode)) {
+	case model.ClientDisconnectPolicyCancel:
+		return true
+	case model.ClientDisconnectPolicyCancelStream:
+		attrs, err := middleware.GetRequestAttrs(c, meta.Mode)
+		return err == nil && attrs.Stream
+	default:
+		return false
+	}
+}
+
+func (u *upstreamContext) canceledByClient() bool {
+	return u.canceled.Load()
+}
+
+// release marks the meta when the client disconnect canceled the upstream request,
+// a canceled stream is billed by the part streamed before the client disconnected
+func (u *upstreamContext) release() {
+	u.stop()
+	u.cancel()
+	if u.canceled.Load() {
+		u.meta.Set(MetaUpstreamCanceled, true)
+	}
+}
+
+// canceledUsage bills the input tokens of a request canceled before its response was read,
+// the upstream has already processed the prompt
+func canceledUsage(meta *meta.Meta) relaymodel.Usage {
+	return relaymodel.Usage{
+		PromptTokens: meta.InputTokens,
+		TotalTokens:  meta.InputTokens,
+	}
+}
+
+func prepareAndDoRequest(ctx context.Context, a adaptor.Adaptor, c *gin.Context, meta *meta.Meta) (*http.Response, *relaymodel.ErrorWithStatusCode) {
 	method, header, body, err := a.ConvertRequest(meta, c.Request)
 	if err != nil {
 		return nil, openai.ErrorWrapperWithMessage("convert request failed: "+err.Error(), "convert_request_failed", http.StatusBadRequest)
@@ -146,15 +239,6 @@ func prepareAndDoRequest(a adaptor.Adaptor, c *gin.Context, meta *meta.Meta) (*h
 
 	log.Debugf("request url: %s %s", method, fullRequestURL)
 
-	ctx := context.Background()
-	if timeout := config.GetTimeoutWithModelType()[int(meta.Mode)]; timeout > 0 {
-		// donot use c.Request.Context() because it will be canceled by the client
-		// which will cause the usage of non-streaming requests to be unable to be recorded
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
-		defer cancel()
-	}
-
 	req, err := http.NewRequestWithContext(ctx, method, fullRequestURL, body)
 	if err != nil {
 		return nil, openai.ErrorWrapperWithMessage("new request failed: "+err.Error(), "new_request_failed", http.StatusBadRequest)
@@ -217,6 +301,9 @@ func handleResponse(a adaptor.Adaptor, c *gin.Context, meta *meta.Meta, resp *ht
 	c.Header("Content-Type", resp.Header.Get("Content-Type"))
 
 	usage, relayErr := a.DoResponse(meta, c, resp)
+	if relayErr != nil && relayErr.RetryAfter == 0 {
+		relayErr.RetryAfter = utils.RetryAfter(resp)
+	}
 	if relayErr != nil {
 		detail.ResponseBody = relayErr.JSONOrEmpty()
 	} else {
@@ -256,6 +343,23 @@ func updateUsageMetrics(usage relaymodel.Usage, log *log.Entry) {
 		if usage.PromptTokensDetails.CacheCreationTokens > 0 {
 			log.Data["t_cache_creation"] = usage.PromptTokensDetails.CacheCreationTokens
 		}
+		if usage.PromptTokensDetails.AudioTokens > 0 {
+			log.Data["t_audio_input"] = usage.PromptTokensDetails.AudioTokens
+		}
+		if usage.PromptTokensDetails.ImageTokens > 0 {
+			log.Data["t_image_input"] = usage.PromptTokensDetails.ImageTokens
+		}
+	}
+	if usage.CompletionTokensDetails != nil {
+		if usage.CompletionTokensDetails.ReasoningTokens > 0 {
+			log.Data["t_reasoning"] = usage.CompletionTokensDetails.ReasoningTokens
+		}
+		if usage.CompletionTokensDetails.AudioTokens > 0 {
+			log.Data["t_audio_output"] = usage.CompletionTokensDetails.AudioTokens
+		}
 	}
 	log.Data["t_total"] = usage.TotalTokens
+	if usage.Units > 0 {
+		log.Data["units"] = usage.Units
+	}
 }
@@ -0,0 +1,144 @@
+package controller_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labring/aiproxy/common/config"
+	"github.com/labring/aiproxy/model"
+	"github.com/labring/aiproxy/relay/adaptor/openai"
+	"github.com/labring/aiproxy/relay/controller"
+	"github.com/labring/aiproxy/relay/meta"
+	"github.com/labring/aiproxy/relay/mode"
+	relaymodel "github.com/labring/aiproxy/relay/model"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+const completion = `{"id":"1","object":"chat.completion","model":"gpt-4o",` +
+	`"choices":[{"index":0,"message":{"role":"assistant","content":"hello"},"finish_reason":"stop"}],` +
+	`"usage":{"prompt_tokens":10,"completion_tokens":5,"total_tokens":15}}`
+
+// upstream answers once the test releases it, it reports whether the request was canceled before that
+type upstream struct {
+	*httptest.Server
+	received chan struct{}
+	release  chan struct{}
+	canceled chan bool
+}
+
+func newUpstream() *upstream {
+	u := &upstream{
+		received: make(chan struct{}, 1),
+		release:  make(chan struct{}),
+		canceled: make(chan bool, 1),
+	}
+	u.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the server notices a closed connection only once the body is read
+		_, _ = io.Copy(io.Discard, r.Body)
+		u.received <- struct{}{}
+		select {
+		case <-r.Context().Done():
+			u.canceled <- true
+			return
+		case <-u.release:
+			u.canceled <- false
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(completion))
+	}))
+	return u
+}
+
+// doWithClientDisconnect relays the request and disconnects the client while the upstream is working on it
+func doWithClientDisconnect(u *upstream, m mode.Mode, body string) (*meta.Meta, relaymodel.Usage, *relaymodel.ErrorWithStatusCode, bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequestWithContext(ctx, http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+
+	relayMeta := meta.NewMeta(
+		&model.Channel{ID: 1, Name: "c1", BaseURL: u.URL, Key: "sk-test"},
+		m,
+		"gpt-4o",
+		&model.ModelConfig{Model: "gpt-4o"},
+		meta.WithInputTokens(10),
+	)
+
+	go func() {
+		<-u.received
+		cancel()
+		// a canceled upstream has returned by now, the other one is answered after the client is gone
+		time.Sleep(50 * time.Millisecond)
+		close(u.release)
+	}()
+	usage, _, err := controller.DoHelper(&openai.Adaptor{}, c, relayMeta)
+	return relayMeta, usage, err, <-u.canceled
+}
+
+func TestDoHelperClientDisconnect(t *testing.T) {
+	convey.Convey("TestDoHelperClientDisconnect", t, func() {
+		defer config.SetClientDisconnectPolicy(nil)
+		u := newUpstream()
+		defer u.Close()
+
+		const request = `{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`
+		const streamRequest = `{"model":"gpt-4o","stream":true,"messages":[{"role":"user","content":"hi"}]}`
+
+		// a continued request is billed by its response
+		continued := func(m *meta.Meta, usage relaymodel.Usage, err *relaymodel.ErrorWithStatusCode, upstreamCanceled bool) {
+			convey.So(upstreamCanceled, convey.ShouldBeFalse)
+			convey.So(err, convey.ShouldBeNil)
+			convey.So(usage.PromptTokens, convey.ShouldEqual, 10)
+			convey.So(usage.CompletionTokens, convey.ShouldEqual, 5)
+			convey.So(m.GetBool(controller.MetaUpstreamCanceled), convey.ShouldBeFalse)
+		}
+		// a canceled request is billed by the input tokens
+		canceled := func(m *meta.Meta, usage relaymodel.Usage, err *relaymodel.ErrorWithStatusCode, upstreamCanceled bool) {
+			convey.So(upstreamCanceled, convey.ShouldBeTrue)
+			convey.So(err, convey.ShouldNotBeNil)
+			convey.So(err.Error.Code, convey.ShouldEqual, "request_canceled")
+			convey.So(usage, convey.ShouldResemble, relaymodel.Usage{PromptTokens: 10, TotalTokens: 10})
+			convey.So(m.GetBool(controller.MetaUpstreamCanceled), convey.ShouldBeTrue)
+		}
+
+		convey.Convey("the upstream request continues by default", func() {
+			config.SetClientDisconnectPolicy(nil)
+			continued(doWithClientDisconnect(u, mode.ChatCompletions, request))
+		})
+
+		convey.Convey("the continue policy", func() {
+			config.SetClientDisconnectPolicy(map[int]string{int(mode.ChatCompletions): model.ClientDisconnectPolicyContinue})
+			continued(doWithClientDisconnect(u, mode.ChatCompletions, streamRequest))
+		})
+
+		convey.Convey("the cancel policy cancels every request", func() {
+			config.SetClientDisconnectPolicy(map[int]string{int(mode.ChatCompletions): model.ClientDisconnectPolicyCancel})
+			canceled(doWithClientDisconnect(u, mode.ChatCompletions, request))
+		})
+
+		convey.Convey("the cancel stream policy cancels streams only", func() {
+			config.SetClientDisconnectPolicy(map[int]string{int(mode.ChatCompletions): model.ClientDisconnectPolicyCancelStream})
+
+			convey.Convey("stream", func() {
+				canceled(doWithClientDisconnect(u, mode.ChatCompletions, streamRequest))
+			})
+
+			convey.Convey("non-stream", func() {
+				continued(doWithClientDisconnect(u, mode.ChatCompletions, request))
+			})
+		})
+
+		convey.Convey("the policy of another mode does not apply", func() {
+			config.SetClientDisconnectPolicy(map[int]string{int(mode.Completions): model.ClientDisconnectPolicyCancel})
+			continued(doWithClientDisconnect(u, mode.ChatCompletions, request))
+		})
+	})
+}
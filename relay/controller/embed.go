@@ -19,5 +19,6 @@ func GetEmbedRequestUsage(c *gin.Context, _ *model.ModelConfig) (model.Usage, er
 
 	return model.Usage{
 		InputTokens: openai.CountTokenInput(textRequest.Input, textRequest.Model),
+		Units:       1,
 	}, nil
 }
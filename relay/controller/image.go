@@ -46,9 +46,12 @@ func GetImageRequestPrice(c *gin.Context, mc *model.ModelConfig) (model.Price, e
 		return model.Price{}, fmt.Errorf("invalid image size: %s", imageRequest.Size)
 	}
 
-	return model.Price{
-		InputPrice: imageCostPrice,
-	}, nil
+	// the price of the size replaces the input price, the input tokens of an image request are its images,
+	// so the tiers by input tokens do not apply, the windows still do
+	price := mc.Price
+	price.InputPrice = imageCostPrice
+	price.Tiers = nil
+	return price, nil
 }
 
 func GetImageRequestUsage(c *gin.Context, _ *model.ModelConfig) (model.Usage, error) {
@@ -59,5 +62,6 @@ func GetImageRequestUsage(c *gin.Context, _ *model.ModelConfig) (model.Usage, er
 
 	return model.Usage{
 		InputTokens: imageRequest.N,
+		Units:       imageRequest.N,
 	}, nil
 }
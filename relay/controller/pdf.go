@@ -9,6 +9,7 @@ func GetPdfRequestPrice(_ *gin.Context, mc *model.ModelConfig) (model.Price, err
 	return mc.Price, nil
 }
 
+// GetPdfRequestUsage reports no pages, the pages are only known from the parsed response
 func GetPdfRequestUsage(_ *gin.Context, _ *model.ModelConfig) (model.Usage, error) {
 	return model.Usage{}, nil
 }
@@ -43,5 +43,6 @@ func GetRerankRequestUsage(c *gin.Context, _ *model.ModelConfig) (model.Usage, e
 	}
 	return model.Usage{
 		InputTokens: rerankPromptTokens(rerankRequest),
+		Units:       1,
 	}, nil
 }
@@ -34,6 +34,7 @@ func GetSTTRequestUsage(c *gin.Context, _ *model.ModelConfig) (model.Usage, erro
 
 	return model.Usage{
 		InputTokens: durationInt,
+		Units:       durationInt,
 	}, nil
 }
 
@@ -18,7 +18,9 @@ func GetTTSRequestUsage(c *gin.Context, _ *model.ModelConfig) (model.Usage, erro
 		return model.Usage{}, err
 	}
 
+	characters := utf8.RuneCountInString(ttsRequest.Input)
 	return model.Usage{
-		InputTokens: utf8.RuneCountInString(ttsRequest.Input),
+		InputTokens: characters,
+		Units:       characters,
 	}, nil
 }
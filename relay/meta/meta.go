@@ -14,6 +14,10 @@ type ChannelMeta struct {
 	Key     string
 	ID      int
 	Type    int
+	// KeyID is the id of the channel key in use, 0 means the channel's own key
+	KeyID int
+	// TPM is the upstream tpm quota of the channel for the model, 0 means unlimited
+	TPM int64
 }
 
 type Meta struct {
@@ -32,6 +36,10 @@ type Meta struct {
 	Mode        mode.Mode
 	// TODO: remove this field
 	InputTokens int
+	// RequestUnits is the count of the billing unit of the mode known from the request
+	RequestUnits int
+	// PriceAdjustment is how the pricing of the group changed the price of the request
+	PriceAdjustment model.GroupPriceAdjustment
 }
 
 type Option func(meta *Meta)
@@ -72,6 +80,18 @@ func WithInputTokens(inputTokens int) Option {
 	}
 }
 
+func WithRequestUnits(requestUnits int) Option {
+	return func(meta *Meta) {
+		meta.RequestUnits = requestUnits
+	}
+}
+
+func WithPriceAdjustment(priceAdjustment model.GroupPriceAdjustment) Option {
+	return func(meta *Meta) {
+		meta.PriceAdjustment = priceAdjustment
+	}
+}
+
 func NewMeta(
 	channel *model.Channel,
 	mode mode.Mode,
@@ -99,6 +119,7 @@ func NewMeta(
 			Key:     channel.Key,
 			ID:      channel.ID,
 			Type:    channel.Type,
+			TPM:     channel.GetModelTPM(modelName),
 		}
 		if channel.Config != nil {
 			meta.ChannelConfig = *channel.Config
@@ -1,6 +1,8 @@
 package model
 
 import (
+	"time"
+
 	"github.com/bytedance/sonic"
 	"github.com/labring/aiproxy/common/conv"
 )
@@ -10,12 +12,25 @@ type Usage struct {
 	CompletionTokens int `json:"completion_tokens"`
 	TotalTokens      int `json:"total_tokens"`
 
-	PromptTokensDetails *PromptTokensDetails `json:"prompt_tokens_details,omitempty"`
+	PromptTokensDetails     *PromptTokensDetails     `json:"prompt_tokens_details,omitempty"`
+	CompletionTokensDetails *CompletionTokensDetails `json:"completion_tokens_details,omitempty"`
+
+	// Units is the count of the billing unit of the mode, it is not part of the response
+	Units int `json:"-"`
 }
 
+// PromptTokensDetails are parts of the prompt tokens
 type PromptTokensDetails struct {
 	CachedTokens        int `json:"cached_tokens"`
 	CacheCreationTokens int `json:"cache_creation_tokens"`
+	AudioTokens         int `json:"audio_tokens,omitempty"`
+	ImageTokens         int `json:"image_tokens,omitempty"`
+}
+
+// CompletionTokensDetails are parts of the completion tokens
+type CompletionTokensDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens,omitempty"`
+	AudioTokens     int `json:"audio_tokens,omitempty"`
 }
 
 type Error struct {
@@ -43,6 +58,8 @@ func (e *Error) JSONOrEmpty() string {
 type ErrorWithStatusCode struct {
 	Error      Error `json:"error,omitempty"`
 	StatusCode int   `json:"-"`
+	// RetryAfter is how long the upstream asks to wait before the next request
+	RetryAfter time.Duration `json:"-"`
 }
 
 func (e *ErrorWithStatusCode) JSONOrEmpty() string {
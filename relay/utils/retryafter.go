@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rate limit reset headers paired with the remaining header that tells whether the limit is exhausted
+var rateLimitResetHeaders = [][2]string{
+	// openai, azure, groq, deepseek... reset is a duration such as 1s, 6m0s or 20ms
+	{"X-Ratelimit-Reset-Requests", "X-Ratelimit-Remaining-Requests"},
+	{"X-Ratelimit-Reset-Tokens", "X-Ratelimit-Remaining-Tokens"},
+	// anthropic, reset is a RFC 3339 time
+	{"Anthropic-Ratelimit-Requests-Reset", "Anthropic-Ratelimit-Requests-Remaining"},
+	{"Anthropic-Ratelimit-Tokens-Reset", "Anthropic-Ratelimit-Tokens-Remaining"},
+	{"Anthropic-Ratelimit-Input-Tokens-Reset", "Anthropic-Ratelimit-Input-Tokens-Remaining"},
+	{"Anthropic-Ratelimit-Output-Tokens-Reset", "Anthropic-Ratelimit-Output-Tokens-Remaining"},
+	// github style, reset is a unix timestamp
+	{"X-Ratelimit-Reset", "X-Ratelimit-Remaining"},
+}
+
+// RetryAfter returns how long the upstream asks to wait before the next request,
+// 0 when the response is not rate limited or carries no hint
+func RetryAfter(resp *http.Response) time.Duration {
+	if resp == nil ||
+		(resp.StatusCode != http.StatusTooManyRequests &&
+			resp.StatusCode != http.StatusServiceUnavailable) {
+		return 0
+	}
+	return ParseRetryAfter(resp.Header, time.Now())
+}
+
+// ParseRetryAfter reads Retry-After, retry-after-ms and the reset headers of the exhausted provider rate limits
+func ParseRetryAfter(header http.Header, now time.Time) time.Duration {
+	if v := header.Get("Retry-After-Ms"); v != "" {
+		if ms, err := strconv.ParseFloat(v, 64); err == nil && ms > 0 {
+			return time.Duration(ms * float64(time.Millisecond))
+		}
+	}
+	if v := header.Get("Retry-After"); v != "" {
+		if d := parseResetValue(v, now); d > 0 {
+			return d
+		}
+	}
+
+	// only the exhausted limits tell when to come back, a limit with requests or tokens left
+	// may reset much later than the one that rejected the request
+	var exhausted time.Duration
+	for _, pair := range rateLimitResetHeaders {
+		if strings.TrimSpace(header.Get(pair[1])) != "0" {
+			continue
+		}
+		exhausted = max(exhausted, parseResetValue(header.Get(pair[0]), now))
+	}
+	return exhausted
+}
+
+// parseResetValue accepts seconds, a go duration, a unix timestamp, a RFC 3339 or a http date
+func parseResetValue(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(v, 64); err == nil {
+		// large values are unix timestamps rather than delays
+		if seconds > float64(now.Unix()/2) {
+			return time.Unix(int64(seconds), 0).Sub(now)
+		}
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return d
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.Sub(now)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,48 @@
+package utils_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/labring/aiproxy/relay/utils"
+	"github.com/smartystreets/goconvey/convey"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	header := func(kv ...string) http.Header {
+		h := http.Header{}
+		for i := 0; i < len(kv); i += 2 {
+			h.Set(kv[i], kv[i+1])
+		}
+		return h
+	}
+	convey.Convey("TestParseRetryAfter", t, func() {
+		convey.So(utils.ParseRetryAfter(header(), now), convey.ShouldEqual, 0)
+		convey.So(utils.ParseRetryAfter(header("Retry-After", "20"), now), convey.ShouldEqual, 20*time.Second)
+		convey.So(utils.ParseRetryAfter(header("Retry-After-Ms", "1500"), now), convey.ShouldEqual, 1500*time.Millisecond)
+		convey.So(utils.ParseRetryAfter(header("Retry-After", now.Add(time.Minute).Format(http.TimeFormat)), now), convey.ShouldEqual, time.Minute)
+		convey.So(utils.ParseRetryAfter(header(
+			"X-Ratelimit-Reset-Requests", "6m0s",
+			"X-Ratelimit-Remaining-Requests", "10",
+			"X-Ratelimit-Reset-Tokens", "1.5s",
+			"X-Ratelimit-Remaining-Tokens", "0",
+		), now), convey.ShouldEqual, 1500*time.Millisecond)
+		convey.So(utils.ParseRetryAfter(header(
+			"Anthropic-Ratelimit-Requests-Reset", now.Add(30*time.Second).Format(time.RFC3339),
+			"Anthropic-Ratelimit-Requests-Remaining", "0",
+		), now), convey.ShouldEqual, 30*time.Second)
+		convey.So(utils.ParseRetryAfter(header(
+			"X-Ratelimit-Reset", "1735689610",
+			"X-Ratelimit-Remaining", "0",
+		), now), convey.ShouldEqual, 10*time.Second)
+
+		// the reset of a limit that is not exhausted is no hint
+		convey.So(utils.ParseRetryAfter(header(
+			"X-Ratelimit-Reset-Requests", "6m0s",
+			"X-Ratelimit-Remaining-Requests", "10",
+		), now), convey.ShouldEqual, 0)
+		convey.So(utils.ParseRetryAfter(header("X-Ratelimit-Reset", "1735689610"), now), convey.ShouldEqual, 0)
+	})
+}
@@ -60,6 +60,9 @@ func SetAPIRouter(router *gin.Engine) {
 			groupRoute.POST("/:group/rpm", controller.UpdateGroupRPM)
 			groupRoute.POST("/:group/tpm_ratio", controller.UpdateGroupTPMRatio)
 			groupRoute.POST("/:group/tpm", controller.UpdateGroupTPM)
+			groupRoute.POST("/:group/pricing", controller.UpdateGroupPricing)
+			groupRoute.GET("/:group/ledger", controller.GetGroupLedger)
+			groupRoute.POST("/:group/ledger", controller.CreditGroupLedger)
 		}
 
 		optionRoute := apiRouter.Group("/option")
@@ -99,6 +102,10 @@ func SetAPIRouter(router *gin.Engine) {
 			channelRoute.GET("/:id/test", controller.TestChannelModels)
 			channelRoute.GET("/:id/test/:model", controller.TestChannel)
 			channelRoute.GET("/:id/update_balance", controller.UpdateChannelBalance)
+			channelRoute.GET("/:id/keys", controller.GetChannelKeys)
+			channelRoute.POST("/:id/keys", controller.AddChannelKeys)
+			channelRoute.DELETE("/:id/keys/:key_id", controller.DeleteChannelKey)
+			channelRoute.POST("/:id/keys/:key_id/status", controller.UpdateChannelKeyStatus)
 		}
 
 		tokensRoute := apiRouter.Group("/tokens")
@@ -131,6 +138,8 @@ func SetAPIRouter(router *gin.Engine) {
 			logsRoute.DELETE("/", controller.DeleteHistoryLogs)
 			logsRoute.GET("/search", controller.SearchLogs)
 			logsRoute.GET("/consume_error", controller.SearchConsumeError)
+			logsRoute.POST("/consume_error/:id/retry", controller.RetryConsumeError)
+			logsRoute.POST("/consume_error/:id/write_off", controller.WriteOffConsumeError)
 			logsRoute.GET("/detail/:log_id", controller.GetLogDetail)
 			logsRoute.GET("/used/models", controller.GetUsedModels)
 			logsRoute.GET("/used/token_names", controller.GetUsedTokenNames)
@@ -144,6 +153,15 @@ func SetAPIRouter(router *gin.Engine) {
 			logRoute.GET("/:group/used/token_names", controller.GetGroupUsedTokenNames)
 		}
 
+		statementsRoute := apiRouter.Group("/statements")
+		{
+			statementsRoute.GET("/", controller.GetStatements)
+		}
+		statementRoute := apiRouter.Group("/statement")
+		{
+			statementRoute.GET("/:group", controller.GetGroupStatement)
+		}
+
 		modelConfigsRoute := apiRouter.Group("/model_configs")
 		{
 			modelConfigsRoute.GET("/", controller.GetModelConfigs)
@@ -160,6 +178,17 @@ func SetAPIRouter(router *gin.Engine) {
 			modelConfigRoute.DELETE("/:model", controller.DeleteModelConfig)
 		}
 
+		routingRulesRoute := apiRouter.Group("/routing_rules")
+		{
+			routingRulesRoute.GET("/", controller.GetRoutingRules)
+			routingRulesRoute.POST("/", controller.AddRoutingRule)
+			routingRulesRoute.POST("/dry_run", controller.DryRunRoutingRule)
+			routingRulesRoute.GET("/:id", controller.GetRoutingRule)
+			routingRulesRoute.PUT("/:id", controller.UpdateRoutingRule)
+			routingRulesRoute.DELETE("/:id", controller.DeleteRoutingRule)
+			routingRulesRoute.POST("/:id/status", controller.UpdateRoutingRuleStatus)
+		}
+
 		monitorRoute := apiRouter.Group("/monitor")
 		{
 			monitorRoute.GET("/", controller.GetAllChannelModelErrorRates)
@@ -169,6 +198,17 @@ func SetAPIRouter(router *gin.Engine) {
 			monitorRoute.DELETE("/:id/:model", controller.ClearChannelModelErrors)
 			monitorRoute.GET("/models", controller.GetModelsErrorRate)
 			monitorRoute.GET("/banned_channels", controller.GetAllBannedModelChannels)
+			monitorRoute.GET("/breakers", controller.GetAllBreakers)
+			monitorRoute.GET("/breaker_transitions", controller.SearchBreakerTransitions)
+			monitorRoute.GET("/breaker_dashboard", controller.GetBreakerDashboard)
+			monitorRoute.GET("/rate_limit_queues", controller.GetRateLimitQueues)
+			monitorRoute.GET("/client_disconnects", controller.GetClientDisconnects)
+		}
+
+		mirrorRoute := apiRouter.Group("/mirror")
+		{
+			mirrorRoute.GET("/results", controller.SearchMirrorResults)
+			mirrorRoute.GET("/report", controller.GetMirrorReport)
 		}
 	}
 }